@@ -0,0 +1,280 @@
+// Package audit keeps an append-only, hash-chained log of key operations.
+//
+// Each entry records the SHA-256 of the previous one, and the hash of the
+// last entry is mirrored in a head file next to the log. Editing an entry
+// breaks its hash, removing or reordering entries breaks the chain, and
+// cutting entries off the end no longer matches the head. Anyone able to
+// rewrite both files can forge a consistent history, so keep a copy of the
+// head hash reported by Verify somewhere the operator cannot change.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/filelock"
+)
+
+// Results recorded in Entry.Result.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// GenesisHash is the Prev of the first entry.
+var GenesisHash = strings.Repeat("0", 64)
+
+// Entry is one audited operation. Entries identify keys by address or
+// address hash and never hold keys, passphrases or intermediate codes.
+type Entry struct {
+	Seq         uint64    `json:"seq"`
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Host        string    `json:"host"`
+	Command     string    `json:"command,omitempty"`
+	Operation   string    `json:"operation"`
+	Network     string    `json:"network,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+	Prev        string    `json:"prev"`
+	Hash        string    `json:"hash,omitempty"`
+}
+
+// Head records the last entry of a log.
+type Head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Problem describes the first inconsistency Verify found.
+type Problem struct {
+	Line   int
+	Reason string
+}
+
+func (p *Problem) Error() string {
+	if p.Line == 0 {
+		return p.Reason
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Reason)
+}
+
+// Log appends entries to one audit file.
+type Log struct {
+	path string
+	user string
+	host string
+}
+
+// Open returns the log at path, creating its directory with owner-only
+// permissions. The log and its head are created on first append.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	return &Log{path: path, user: currentUser(), host: currentHost()}, nil
+}
+
+// Path returns the file backing the log.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// HeadPath returns the head file of the log at path.
+func HeadPath(path string) string {
+	return path + ".head"
+}
+
+// Append chains e to the log and returns it as written. Seq, Prev and Hash
+// are always set here; Time, User and Host are filled in when empty.
+func (l *Log) Append(e Entry) (Entry, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600) //nolint:gosec
+	if err != nil {
+		return e, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := filelock.Lock(f, true); err != nil {
+		return e, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer func() { _ = filelock.Unlock(f) }()
+
+	head, err := readHead(l.path)
+	if os.IsNotExist(err) {
+		info, statErr := f.Stat()
+		if statErr != nil {
+			return e, fmt.Errorf("failed to read audit log: %w", statErr)
+		}
+		if info.Size() > 0 {
+			return e, fmt.Errorf("audit log %s has entries but no head file", l.path)
+		}
+		head, err = Head{Hash: GenesisHash}, nil
+	}
+	if err != nil {
+		return e, err
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.User == "" {
+		e.User = l.user
+	}
+	if e.Host == "" {
+		e.Host = l.host
+	}
+	e.Seq = head.Seq + 1
+	e.Prev = head.Hash
+	e.Hash = hashEntry(e)
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return e, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := writeHead(l.path, Head{Seq: e.Seq, Hash: e.Hash}); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// Verify checks every entry of the log at path against its hash, its
+// predecessor and the head file, and returns the head on success. The first
+// inconsistency is returned as a *Problem.
+func Verify(path string) (Head, error) {
+	head := Head{Hash: GenesisHash}
+
+	f, err := os.Open(path) //nolint:gosec
+	if os.IsNotExist(err) {
+		recorded, headErr := readHead(path)
+		if headErr == nil && recorded.Seq > 0 {
+			return head, &Problem{Reason: fmt.Sprintf("log is missing but its head records %d entries", recorded.Seq)}
+		}
+		return head, nil
+	}
+	if err != nil {
+		return head, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := filelock.Lock(f, false); err != nil {
+		return head, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer func() { _ = filelock.Unlock(f) }()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e Entry
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&e); err != nil {
+			return head, &Problem{Line: line, Reason: fmt.Sprintf("malformed entry: %v", err)}
+		}
+		switch {
+		case e.Seq != head.Seq+1:
+			return head, &Problem{Line: line, Reason: fmt.Sprintf("sequence %d follows %d: entries were removed or reordered", e.Seq, head.Seq)}
+		case e.Prev != head.Hash:
+			return head, &Problem{Line: line, Reason: "entry does not chain to the previous one"}
+		case e.Hash != hashEntry(e):
+			return head, &Problem{Line: line, Reason: "hash mismatch: entry was modified"}
+		}
+		head = Head{Seq: e.Seq, Hash: e.Hash}
+	}
+	if err := scanner.Err(); err != nil {
+		return head, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	recorded, err := readHead(path)
+	switch {
+	case os.IsNotExist(err):
+		if head.Seq > 0 {
+			return head, &Problem{Reason: "head file is missing"}
+		}
+		return head, nil
+	case err != nil:
+		return head, err
+	case recorded.Seq > head.Seq:
+		return head, &Problem{Reason: fmt.Sprintf("log was truncated: head records %d entries, found %d", recorded.Seq, head.Seq)}
+	case recorded.Seq < head.Seq:
+		return head, &Problem{Reason: fmt.Sprintf("log has %d entries past its head", head.Seq-recorded.Seq)}
+	case recorded.Hash != head.Hash:
+		return head, &Problem{Reason: "last entry does not match the head"}
+	}
+	return head, nil
+}
+
+// hashEntry is the SHA-256 of the entry's JSON encoding without its hash.
+func hashEntry(e Entry) string {
+	e.Hash = ""
+	encoded, _ := json.Marshal(e) // Entry has no values that fail to encode
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+func readHead(path string) (Head, error) {
+	data, err := os.ReadFile(HeadPath(path)) //nolint:gosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Head{}, err
+		}
+		return Head{}, fmt.Errorf("failed to read audit head: %w", err)
+	}
+	var head Head
+	if err := json.Unmarshal(data, &head); err != nil {
+		return Head{}, fmt.Errorf("failed to parse audit head: %w", err)
+	}
+	return head, nil
+}
+
+// writeHead atomically replaces the head file. Callers hold the log lock.
+func writeHead(path string, head Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit head: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(HeadPath(path))+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), HeadPath(path)); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+func currentHost() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "unknown"
+}
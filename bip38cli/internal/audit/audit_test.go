@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeLog appends n entries to a fresh log and returns its path.
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := log.Append(Entry{Operation: "decrypt", Network: "mainnet", Fingerprint: "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB", Result: ResultSuccess}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	return path
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	content := strings.Join(lines, "")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestAppendAndVerify(t *testing.T) {
+	path := writeLog(t, 3)
+
+	head, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if head.Seq != 3 || len(head.Hash) != 64 {
+		t.Fatalf("head = %+v", head)
+	}
+
+	for _, file := range []string{path, HeadPath(path)} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("%s has mode %v, want 0600", file, info.Mode().Perm())
+		}
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	e, err := log.Append(Entry{Operation: "confirm", Result: ResultFailure, Error: "incorrect passphrase"})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if e.Seq != 4 || e.Prev != head.Hash || e.User == "" || e.Host == "" || e.Time.IsZero() {
+		t.Fatalf("appended entry = %+v", e)
+	}
+	if head, err := Verify(path); err != nil || head.Hash != e.Hash {
+		t.Fatalf("Verify after append = %+v, %v", head, err)
+	}
+}
+
+func TestVerifyEmptyLog(t *testing.T) {
+	head, err := Verify(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil || head.Seq != 0 || head.Hash != GenesisHash {
+		t.Fatalf("Verify of a missing log = %+v, %v", head, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, path string)
+		want   string
+	}{
+		{
+			name: "edited entry",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				lines[1] = strings.Replace(lines[1], `"result":"success"`, `"result":"failure"`, 1)
+				writeLines(t, path, lines)
+			},
+			want: "line 2: hash mismatch",
+		},
+		{
+			name: "added field",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				lines[0] = strings.Replace(lines[0], `{"seq"`, `{"note":"x","seq"`, 1)
+				writeLines(t, path, lines)
+			},
+			want: "line 1: malformed entry",
+		},
+		{
+			name: "removed entry",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				writeLines(t, path, append(lines[:1:1], lines[2:]...))
+			},
+			want: "line 2: sequence 3 follows 1",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(t *testing.T, path string) {
+				lines := readLines(t, path)
+				lines[1], lines[2] = lines[2], lines[1]
+				writeLines(t, path, lines)
+			},
+			want: "line 2: sequence 3 follows 1",
+		},
+		{
+			name: "truncated log",
+			tamper: func(t *testing.T, path string) {
+				writeLines(t, path, readLines(t, path)[:2])
+			},
+			want: "head records 3 entries, found 2",
+		},
+		{
+			name: "deleted log",
+			tamper: func(t *testing.T, path string) {
+				if err := os.Remove(path); err != nil {
+					t.Fatalf("Remove: %v", err)
+				}
+			},
+			want: "head records 3 entries",
+		},
+		{
+			name: "deleted head",
+			tamper: func(t *testing.T, path string) {
+				if err := os.Remove(HeadPath(path)); err != nil {
+					t.Fatalf("Remove: %v", err)
+				}
+			},
+			want: "head file is missing",
+		},
+		{
+			name: "rewritten chain",
+			tamper: func(t *testing.T, path string) {
+				// A forged last entry with a valid hash still disagrees with the head.
+				lines := readLines(t, path)
+				forged := writeLog(t, 3)
+				writeLines(t, path, append(lines[:2:2], readLines(t, forged)[2]))
+			},
+			want: "line 3: entry does not chain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLog(t, 3)
+			tt.tamper(t, path)
+
+			_, err := Verify(path)
+			var problem *Problem
+			if !errors.As(err, &problem) {
+				t.Fatalf("Verify = %v, want a *Problem", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Verify = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendRefusesLogWithoutHead(t *testing.T) {
+	path := writeLog(t, 1)
+	if err := os.Remove(HeadPath(path)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := log.Append(Entry{Operation: "encrypt", Result: ResultSuccess}); err == nil {
+		t.Fatal("Append restarted the chain of a log whose head is missing")
+	}
+}
+
+func TestConcurrentAppends(t *testing.T) {
+	path := writeLog(t, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Separate Logs, as separate processes would have.
+			log, err := Open(path)
+			if err != nil {
+				t.Errorf("Open: %v", err)
+				return
+			}
+			if _, err := log.Append(Entry{Operation: "encrypt", Result: ResultSuccess}); err != nil {
+				t.Errorf("Append: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	head, err := Verify(path)
+	if err != nil || head.Seq != 10 {
+		t.Fatalf("Verify after concurrent appends = %+v, %v", head, err)
+	}
+}
@@ -0,0 +1,348 @@
+// Package batch reads key lists from CSV or JSONL and processes them with a
+// bounded worker pool, producing one manifest entry per row.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ScryptMemory is the memory one BIP38 scrypt derivation needs
+// (128 * r * N bytes with N=16384, r=8).
+const ScryptMemory = 128 * 8 * 16384
+
+// Input formats accepted by ReadRows.
+const (
+	FormatAuto  = "auto"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Manifest statuses.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Row is one input record. Err is set when the record itself could not be
+// parsed; such rows are reported as failures instead of stopping the run.
+type Row struct {
+	Number        int    `json:"-"`
+	Key           string `json:"key"`
+	Label         string `json:"label,omitempty"`
+	PassphraseRef string `json:"passphrase_ref,omitempty"`
+	Err           error  `json:"-"`
+}
+
+// ReadRows parses every row from r. CSV input may start with a header naming
+// the key, label and passphrase_ref columns; without one the columns are
+// taken in that order. Blank lines and CSV lines starting with # are skipped.
+func ReadRows(r io.Reader, format string) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatAuto:
+		if trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace); len(trimmed) > 0 && trimmed[0] == '{' {
+			return readJSONL(data)
+		}
+		return readCSV(data)
+	case FormatCSV:
+		return readCSV(data)
+	case FormatJSONL, "ndjson":
+		return readJSONL(data)
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+}
+
+func readJSONL(data []byte) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row Row
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			row = Row{Err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		row.Number = line
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return rows, nil
+}
+
+func readCSV(data []byte) ([]Row, error) { //nolint:gocyclo
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	columns := map[string]int{"key": 0, "label": 1, "passphrase_ref": 2}
+	width := len(columns)
+	var rows []Row
+	first := true
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, Row{Number: parseErr.Line, Err: fmt.Errorf("invalid CSV: %w", parseErr.Err)})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		if first {
+			first = false
+			if header, ok := parseHeader(record); ok {
+				columns, width = header, len(record)
+				continue
+			}
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{Number: line}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.Key = field("key")
+		row.Label = field("label")
+		row.PassphraseRef = field("passphrase_ref")
+		if len(record) > width {
+			row.Err = fmt.Errorf("expected at most %d columns, got %d", width, len(record))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseHeader recognises a header row by its key column. Columns it does
+// not know are ignored.
+func parseHeader(record []string) (map[string]int, bool) {
+	columns := make(map[string]int)
+	for i, cell := range record {
+		name := strings.ToLower(strings.TrimSpace(cell))
+		switch name {
+		case "key", "label", "passphrase_ref":
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil, false
+	}
+	return columns, true
+}
+
+// WorkersForBudget returns how many scrypt operations fit in budget bytes,
+// capped by the CPU count and the number of rows, and at least one.
+func WorkersForBudget(budget uint64, rows int) int {
+	workers := int(budget / ScryptMemory)
+	if cpus := runtime.NumCPU(); workers > cpus {
+		workers = cpus
+	}
+	if workers > rows {
+		workers = rows
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// ParseSize parses a byte size such as "512MiB", "1GiB", "64MB" or "1048576".
+func ParseSize(value string) (uint64, error) {
+	text := strings.TrimSpace(value)
+	units := []struct {
+		suffix     string
+		multiplier uint64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	}
+
+	multiplier := uint64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(text), strings.ToUpper(unit.suffix)) {
+			text = strings.TrimSpace(text[:len(text)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseUint(text, 10, 64)
+	if err != nil || number == 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	if number > ^uint64(0)/multiplier {
+		return 0, fmt.Errorf("size too large: %s", value)
+	}
+	return number * multiplier, nil
+}
+
+// ProcessFunc handles one row and returns the fields to record for it.
+type ProcessFunc func(ctx context.Context, row Row) (map[string]any, error)
+
+// Summary counts the outcome of a run.
+type Summary struct {
+	Total  int `json:"total"`
+	OK     int `json:"ok"`
+	Failed int `json:"failed"`
+}
+
+// Run processes rows with the given number of workers and passes one
+// manifest entry per row to emit, in input order. A failing or panicking row
+// is recorded as an error entry; only an emit error or ctx stops the run.
+func Run(ctx context.Context, rows []Row, workers int, process ProcessFunc, emit func(map[string]any) error) (Summary, error) { //nolint:gocyclo
+	summary := Summary{Total: len(rows)}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		index int
+		entry map[string]any
+	}
+	indexes := make(chan int)
+	outcomes := make(chan outcome)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				entry := processRow(ctx, rows[i], process)
+				select {
+				case outcomes <- outcome{i, entry}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := range rows {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	// Emit in input order, buffering rows that finish early.
+	pending := make(map[int]map[string]any)
+	next := 0
+	var emitErr error
+	for o := range outcomes {
+		if emitErr != nil {
+			continue
+		}
+		pending[o.index] = o.entry
+		for entry, ok := pending[next]; ok; entry, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if entry["status"] == StatusOK {
+				summary.OK++
+			} else {
+				summary.Failed++
+			}
+			if err := emit(entry); err != nil {
+				emitErr = fmt.Errorf("failed to write manifest: %w", err)
+				cancel()
+				break
+			}
+		}
+	}
+
+	if emitErr != nil {
+		return summary, emitErr
+	}
+	if next < len(rows) {
+		return summary, ctx.Err()
+	}
+	return summary, nil
+}
+
+func processRow(ctx context.Context, row Row, process ProcessFunc) (entry map[string]any) {
+	defer func() {
+		if r := recover(); r != nil {
+			entry = failedEntry(row, fmt.Errorf("internal error: %v", r))
+		}
+	}()
+
+	if row.Err != nil {
+		return failedEntry(row, row.Err)
+	}
+	if strings.TrimSpace(row.Key) == "" {
+		return failedEntry(row, errors.New("key is required"))
+	}
+
+	fields, err := process(ctx, row)
+	if err != nil {
+		return failedEntry(row, err)
+	}
+	entry = baseEntry(row, StatusOK)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	return entry
+}
+
+func baseEntry(row Row, status string) map[string]any {
+	entry := map[string]any{
+		"row":    row.Number,
+		"status": status,
+	}
+	if row.Label != "" {
+		entry["label"] = row.Label
+	}
+	return entry
+}
+
+func failedEntry(row Row, err error) map[string]any {
+	entry := baseEntry(row, StatusError)
+	entry["error"] = err.Error()
+	return entry
+}
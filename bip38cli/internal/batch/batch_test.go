@@ -0,0 +1,423 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/keyring"
+)
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		want   []Row
+		errs   []bool
+	}{
+		{
+			name:  "csv positional",
+			input: "# keys\nk1\nk2,second,env:PASS\n\n",
+			want: []Row{
+				{Number: 2, Key: "k1"},
+				{Number: 3, Key: "k2", Label: "second", PassphraseRef: "env:PASS"},
+			},
+			errs: []bool{false, false},
+		},
+		{
+			name:  "csv header reorders columns",
+			input: "label,passphrase_ref,key\nfirst,,k1\nsecond,file:p.txt,k2\n",
+			want: []Row{
+				{Number: 2, Key: "k1", Label: "first"},
+				{Number: 3, Key: "k2", Label: "second", PassphraseRef: "file:p.txt"},
+			},
+			errs: []bool{false, false},
+		},
+		{
+			name:  "csv header with unknown columns",
+			input: "id,key,notes\n1,k1,first\n2,k2\n3,k3,x,y\n",
+			want: []Row{
+				{Number: 2, Key: "k1"},
+				{Number: 3, Key: "k2"},
+				{Number: 4, Key: "k3"},
+			},
+			errs: []bool{false, false, true},
+		},
+		{
+			name:  "csv extra column",
+			input: "k1,a,b,c\n",
+			want:  []Row{{Number: 1, Key: "k1", Label: "a", PassphraseRef: "b"}},
+			errs:  []bool{true},
+		},
+		{
+			name:  "jsonl detected",
+			input: "\n{\"key\":\"k1\",\"label\":\"one\"}\nnot json\n{\"key\":\"k3\",\"passphrase_ref\":\"env:X\"}\n",
+			want: []Row{
+				{Number: 2, Key: "k1", Label: "one"},
+				{Number: 3},
+				{Number: 4, Key: "k3", PassphraseRef: "env:X"},
+			},
+			errs: []bool{false, true, false},
+		},
+		{
+			name:   "jsonl rejects unknown fields",
+			input:  "{\"key\":\"k1\",\"passphrase\":\"secret\"}\n",
+			format: FormatJSONL,
+			want:   []Row{{Number: 1}},
+			errs:   []bool{true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ReadRows(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("ReadRows: %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(rows), len(tt.want), rows)
+			}
+			for i, row := range rows {
+				if (row.Err != nil) != tt.errs[i] {
+					t.Fatalf("row %d: Err = %v, want error %v", i, row.Err, tt.errs[i])
+				}
+				row.Err = nil
+				if row != tt.want[i] {
+					t.Fatalf("row %d = %+v, want %+v", i, row, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadRowsRejectsUnknownFormat(t *testing.T) {
+	if _, err := ReadRows(strings.NewReader("k1\n"), "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+		err   bool
+	}{
+		{input: "1048576", want: 1 << 20},
+		{input: "512MiB", want: 512 << 20},
+		{input: "1 GiB", want: 1 << 30},
+		{input: "64mb", want: 64 * 1000 * 1000},
+		{input: "16M", want: 16 << 20},
+		{input: "0", err: true},
+		{input: "lots", err: true},
+		{input: "-5MiB", err: true},
+		{input: "99999999999999GiB", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if tt.err {
+			if err == nil {
+				t.Fatalf("ParseSize(%q) = %d, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("ParseSize(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestWorkersForBudget(t *testing.T) {
+	if got := WorkersForBudget(ScryptMemory-1, 10); got != 1 {
+		t.Fatalf("budget below one derivation: got %d workers, want 1", got)
+	}
+	if got, want := WorkersForBudget(64*ScryptMemory, 2), min(2, runtime.NumCPU()); got != want {
+		t.Fatalf("capped by rows: got %d workers, want %d", got, want)
+	}
+	if got := WorkersForBudget(2*ScryptMemory, 100); got > 2 || got < 1 {
+		t.Fatalf("capped by budget: got %d workers, want at most 2", got)
+	}
+}
+
+func TestRunKeepsOrderAndIsolatesFailures(t *testing.T) {
+	rows := []Row{
+		{Number: 1, Key: "slow", Label: "a"},
+		{Number: 2, Key: "fail"},
+		{Number: 3, Key: "panic"},
+		{Number: 4, Key: ""},
+		{Number: 5, Err: errors.New("bad line")},
+		{Number: 6, Key: "fast"},
+	}
+
+	process := func(_ context.Context, row Row) (map[string]any, error) {
+		switch row.Key {
+		case "slow":
+			time.Sleep(20 * time.Millisecond)
+		case "fail":
+			return nil, errors.New("boom")
+		case "panic":
+			panic("unexpected")
+		}
+		return map[string]any{"value": strings.ToUpper(row.Key)}, nil
+	}
+
+	var entries []map[string]any
+	summary, err := Run(context.Background(), rows, 4, process, func(entry map[string]any) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if summary != (Summary{Total: 6, OK: 2, Failed: 4}) {
+		t.Fatalf("summary = %+v", summary)
+	}
+	if len(entries) != len(rows) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(rows))
+	}
+
+	wantStatus := []string{StatusOK, StatusError, StatusError, StatusError, StatusError, StatusOK}
+	for i, entry := range entries {
+		if entry["row"] != rows[i].Number {
+			t.Fatalf("entry %d is row %v, want %d", i, entry["row"], rows[i].Number)
+		}
+		if entry["status"] != wantStatus[i] {
+			t.Fatalf("entry %d status = %v, want %s", i, entry["status"], wantStatus[i])
+		}
+		if entry["status"] == StatusError && entry["error"] == "" {
+			t.Fatalf("entry %d has no error message", i)
+		}
+	}
+	if entries[0]["label"] != "a" || entries[0]["value"] != "SLOW" {
+		t.Fatalf("unexpected first entry: %v", entries[0])
+	}
+}
+
+func TestRunStopsOnEmitError(t *testing.T) {
+	rows := make([]Row, 20)
+	for i := range rows {
+		rows[i] = Row{Number: i + 1, Key: "k"}
+	}
+	process := func(context.Context, Row) (map[string]any, error) {
+		return nil, nil
+	}
+
+	emitted := 0
+	_, err := Run(context.Background(), rows, 2, process, func(map[string]any) error {
+		emitted++
+		if emitted == 3 {
+			return errors.New("disk full")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Run error = %v, want disk full", err)
+	}
+	if emitted != 3 {
+		t.Fatalf("emitted %d entries after failure, want 3", emitted)
+	}
+}
+
+func TestRunHonoursCancellation(t *testing.T) {
+	rows := make([]Row, 50)
+	for i := range rows {
+		rows[i] = Row{Number: i + 1, Key: "k"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	process := func(context.Context, Row) (map[string]any, error) {
+		cancel()
+		return nil, nil
+	}
+
+	summary, err := Run(ctx, rows, 1, process, func(map[string]any) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run error = %v, want context.Canceled", err)
+	}
+	if summary.OK+summary.Failed == len(rows) {
+		t.Fatal("expected the run to stop early")
+	}
+}
+
+func TestPassphrasesResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pass.txt")
+	if err := os.WriteFile(path, []byte("from file\r\nsecond line\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("BATCH_TEST_PASS", "from env")
+
+	p := &Passphrases{Default: []byte("shared")}
+	tests := []struct {
+		ref  string
+		want string
+		err  bool
+	}{
+		{ref: "", want: "shared"},
+		{ref: "env:BATCH_TEST_PASS", want: "from env"},
+		{ref: "file:" + path, want: "from file"},
+		{ref: "env:BATCH_TEST_UNSET", err: true},
+		{ref: "file:" + filepath.Join(dir, "missing"), err: true},
+		{ref: "file:" + empty, err: true},
+		{ref: "literal", err: true},
+		{ref: "keyring:bip38cli-test-missing", err: true},
+	}
+	// The kernel keyring is only there on Linux, and not in every sandbox.
+	keyringKey := fmt.Sprintf("bip38cli-test:%d", os.Getpid())
+	if err := keyring.Store(keyring.Session, keyringKey, []byte("from keyring"), time.Minute); err == nil {
+		defer func() { _ = keyring.Remove(keyring.Session, keyringKey) }()
+		tests = append(tests, struct {
+			ref  string
+			want string
+			err  bool
+		}{ref: "keyring:session:" + keyringKey, want: "from keyring"})
+	}
+	for _, tt := range tests {
+		got, err := p.Resolve(tt.ref)
+		if tt.err {
+			if err == nil {
+				t.Fatalf("Resolve(%q) = %q, want error", tt.ref, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Fatalf("Resolve(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+		}
+	}
+
+	cached, _ := p.Resolve("env:BATCH_TEST_PASS")
+	p.Zero()
+	for _, b := range cached {
+		if b != 0 {
+			t.Fatal("Zero left a cached passphrase intact")
+		}
+	}
+	if _, err := (&Passphrases{}).Resolve(""); err == nil {
+		t.Fatal("expected error without a default passphrase")
+	}
+}
+
+func TestNeedsDefault(t *testing.T) {
+	if NeedsDefault([]Row{{Key: "k", PassphraseRef: "env:X"}, {Err: errors.New("bad")}}) {
+		t.Fatal("rows with references should not need a default")
+	}
+	if !NeedsDefault([]Row{{Key: "k", PassphraseRef: "env:X"}, {Key: "k2"}}) {
+		t.Fatal("a row without a reference needs the default")
+	}
+}
+
+func TestManifestFormatFor(t *testing.T) {
+	tests := []struct {
+		format, path, want string
+	}{
+		{"", "keys.csv", FormatCSV},
+		{"auto", "KEYS.CSV", FormatCSV},
+		{"auto", "keys.jsonl", FormatJSONL},
+		{"", "", FormatJSONL},
+		{"csv", "keys.jsonl", FormatCSV},
+		{"ndjson", "keys.csv", FormatJSONL},
+	}
+	for _, tt := range tests {
+		if got, err := ManifestFormatFor(tt.format, tt.path); err != nil || got != tt.want {
+			t.Fatalf("ManifestFormatFor(%q, %q) = %q, %v; want %q", tt.format, tt.path, got, err, tt.want)
+		}
+	}
+	if _, err := ManifestFormatFor("xml", "keys.csv"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestManifestWriter(t *testing.T) {
+	entries := []map[string]any{
+		{"row": 1, "status": StatusOK, "key": "a,b", "extra": "dropped from CSV"},
+		{"row": 2, "status": StatusError, "error": "boom"},
+	}
+
+	var csvOut strings.Builder
+	m, err := NewManifestWriter(&csvOut, FormatCSV, []string{"row", "status", "key", "error"})
+	if err != nil {
+		t.Fatalf("NewManifestWriter: %v", err)
+	}
+	for _, entry := range entries {
+		if err := m.Write(entry); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if want := "row,status,key,error\n1,ok,\"a,b\",\n2,error,,boom\n"; csvOut.String() != want {
+		t.Fatalf("CSV manifest = %q, want %q", csvOut.String(), want)
+	}
+
+	var jsonOut strings.Builder
+	m, _ = NewManifestWriter(&jsonOut, FormatJSONL, nil)
+	for _, entry := range entries {
+		if err := m.Write(entry); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(jsonOut.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"extra":"dropped from CSV"`) {
+		t.Fatalf("JSONL manifest = %q", jsonOut.String())
+	}
+
+	if _, err := NewManifestWriter(&jsonOut, "xml", nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestReadManifestRoundTrip(t *testing.T) {
+	entries := []map[string]any{
+		{"row": 1, "status": StatusOK, "key": "a,b", "compressed": true},
+		{"row": 2, "status": StatusError, "error": "boom"},
+	}
+	columns := []string{"row", "status", "key", "compressed", "error"}
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		var out strings.Builder
+		m, _ := NewManifestWriter(&out, format, columns)
+		for _, entry := range entries {
+			if err := m.Write(entry); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+
+		read, err := ReadManifest(strings.NewReader(out.String()), FormatAuto)
+		if err != nil {
+			t.Fatalf("%s: ReadManifest: %v", format, err)
+		}
+		if len(read) != 2 || read[0].Err != nil || read[1].Err != nil {
+			t.Fatalf("%s: ReadManifest = %+v", format, read)
+		}
+		first, second := read[0].Fields, read[1].Fields
+		if first["row"] != "1" || first["key"] != "a,b" || first["compressed"] != "true" || first["error"] != "" {
+			t.Fatalf("%s: first entry = %v", format, first)
+		}
+		if second["status"] != StatusError || second["error"] != "boom" || second["key"] != "" {
+			t.Fatalf("%s: second entry = %v", format, second)
+		}
+	}
+}
+
+func TestReadManifestBadRecords(t *testing.T) {
+	read, err := ReadManifest(strings.NewReader("row,key\n1,a\n2,b,extra\n"), FormatCSV)
+	if err != nil || len(read) != 2 || read[0].Err != nil || read[1].Err == nil || read[1].Line != 3 {
+		t.Fatalf("CSV: %+v, %v", read, err)
+	}
+
+	read, err = ReadManifest(strings.NewReader("{\"row\":1}\n\n{not json\n{\"row\":[3]}\n"), FormatJSONL)
+	if err != nil || len(read) != 3 || read[0].Err != nil || read[1].Err == nil || read[2].Err == nil || read[1].Line != 3 {
+		t.Fatalf("JSONL: %+v, %v", read, err)
+	}
+
+	if _, err := ReadManifest(strings.NewReader(""), "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
@@ -0,0 +1,196 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ManifestFormatFor picks the manifest format for a destination: the given
+// format, or CSV for a .csv file and JSONL otherwise.
+func ManifestFormatFor(format, path string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatAuto:
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return FormatCSV, nil
+		}
+		return FormatJSONL, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unsupported manifest format: %s", format)
+	}
+}
+
+// ManifestWriter writes manifest entries as JSON lines or as CSV rows with
+// a fixed header. CSV leaves out fields not named in columns.
+type ManifestWriter struct {
+	format  string
+	columns []string
+	json    *json.Encoder
+	csv     *csv.Writer
+	started bool
+}
+
+// NewManifestWriter returns a writer for format, FormatCSV or FormatJSONL.
+func NewManifestWriter(w io.Writer, format string, columns []string) (*ManifestWriter, error) {
+	m := &ManifestWriter{format: format, columns: columns}
+	switch format {
+	case FormatCSV:
+		m.csv = csv.NewWriter(w)
+	case FormatJSONL:
+		m.json = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", format)
+	}
+	return m, nil
+}
+
+// Write appends one entry.
+func (m *ManifestWriter) Write(entry map[string]any) error {
+	if m.json != nil {
+		return m.json.Encode(entry)
+	}
+
+	if !m.started {
+		m.started = true
+		if err := m.csv.Write(m.columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(m.columns))
+	for i, column := range m.columns {
+		if value, ok := entry[column]; ok && value != nil {
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	if err := m.csv.Write(record); err != nil {
+		return err
+	}
+	// Flush per row so an interrupted run keeps what it finished.
+	m.csv.Flush()
+	return m.csv.Error()
+}
+
+// ManifestEntry is one manifest record read back by ReadManifest. Err is set
+// when the record could not be parsed.
+type ManifestEntry struct {
+	Line   int
+	Fields map[string]string
+	Err    error
+}
+
+// ReadManifest parses a manifest written by ManifestWriter, or any CSV file
+// with a header row or JSONL file of flat objects. JSON values are turned
+// back into strings the way the CSV writer prints them.
+func ReadManifest(r io.Reader, format string) ([]ManifestEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatAuto:
+		if trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace); len(trimmed) > 0 && trimmed[0] == '{' {
+			return readManifestJSONL(data)
+		}
+		return readManifestCSV(data)
+	case FormatCSV:
+		return readManifestCSV(data)
+	case FormatJSONL, "ndjson":
+		return readManifestJSONL(data)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", format)
+	}
+}
+
+func readManifestJSONL(data []byte) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		entry := ManifestEntry{Line: line, Fields: make(map[string]string)}
+		var values map[string]any
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			entry.Err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		for name, value := range values {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				entry.Fields[name] = v
+			case json.Number, bool:
+				entry.Fields[name] = fmt.Sprint(v)
+			default:
+				entry.Err = fmt.Errorf("field %s is not a plain value", name)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return entries, nil
+}
+
+func readManifestCSV(data []byte) ([]ManifestEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var header []string
+	var entries []ManifestEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && header != nil {
+				entries = append(entries, ManifestEntry{Line: parseErr.Line, Err: fmt.Errorf("invalid CSV: %w", parseErr.Err)})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+
+		if header == nil {
+			for _, cell := range record {
+				header = append(header, strings.ToLower(strings.TrimSpace(cell)))
+			}
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		entry := ManifestEntry{Line: line, Fields: make(map[string]string)}
+		if len(record) != len(header) {
+			entry.Err = fmt.Errorf("expected %d columns, got %d", len(header), len(record))
+		}
+		for i, cell := range record {
+			if i < len(header) && strings.TrimSpace(cell) != "" {
+				entry.Fields[header[i]] = strings.TrimSpace(cell)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
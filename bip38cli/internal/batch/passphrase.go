@@ -0,0 +1,107 @@
+package batch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/keyring"
+)
+
+// Passphrases resolves per-row passphrase references. A reference is
+// "env:NAME" (an environment variable), "file:PATH" (the first line of a
+// file) or "keyring:KEY" (a Linux kernel keyring key, as in keyring.ParseRef).
+// Rows without a reference use Default. Resolved values are cached
+// and wiped by Zero.
+type Passphrases struct {
+	Default []byte
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// NeedsDefault reports whether any row relies on the default passphrase.
+func NeedsDefault(rows []Row) bool {
+	for _, row := range rows {
+		if row.Err == nil && strings.TrimSpace(row.PassphraseRef) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the passphrase for ref. The slice is shared; callers must
+// not modify it.
+func (p *Passphrases) Resolve(ref string) ([]byte, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		if len(p.Default) == 0 {
+			return nil, errors.New("no passphrase for row")
+		}
+		return p.Default, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.cache[ref]; ok {
+		return cached, nil
+	}
+
+	var value []byte
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		value = []byte(env)
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:")) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		line, _, _ := bytes.Cut(data, []byte("\n"))
+		value = append([]byte{}, bytes.TrimSuffix(line, []byte("\r"))...)
+		zero(data)
+	case strings.HasPrefix(ref, "keyring:"):
+		ring, description, err := keyring.ParseRef(strings.TrimPrefix(ref, "keyring:"))
+		if err != nil {
+			return nil, err
+		}
+		if value, err = keyring.Read(ring, description); err != nil {
+			return nil, fmt.Errorf("failed to read passphrase from keyring: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported passphrase reference %q (use env:NAME, file:PATH or keyring:KEY)", ref)
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("passphrase reference %s is empty", ref)
+	}
+
+	if p.cache == nil {
+		p.cache = make(map[string][]byte)
+	}
+	p.cache[ref] = value
+	return value, nil
+}
+
+// Zero wipes every cached passphrase and the default.
+func (p *Passphrases) Zero() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ref, value := range p.cache {
+		zero(value)
+		delete(p.cache, ref)
+	}
+	zero(p.Default)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
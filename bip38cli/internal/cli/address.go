@@ -5,8 +5,9 @@ import (
 	"strings"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 )
 
 const (
@@ -27,16 +28,35 @@ func parseAddressType(value string) (addressType, error) {
 	return "", fmt.Errorf("unsupported address type: %s", value)
 }
 
+// effectiveAddressType falls back to legacy P2PKH when a bech32 address is not
+// possible: uncompressed keys and networks without segwit.
+func effectiveAddressType(mode addressType, compressed bool, netParams *chaincfg.Params) addressType {
+	if mode != addressTypeBIP84 {
+		return mode
+	}
+	if !compressed || (netParams != nil && netParams.Bech32HRPSegwit == "") {
+		return addressTypeBIP44
+	}
+	return mode
+}
+
 func addressForWIF(wif *btcutil.WIF, mode addressType) (string, error) {
-	netParams, err := bip38.NetworkFromWIF(wif)
-	if err != nil {
-		return "", err
+	return addressForKey(wif, nil, mode)
+}
+
+// addressForKey derives the address on netParams, or on the network inferred
+// from the WIF when netParams is nil.
+func addressForKey(wif *btcutil.WIF, netParams *chaincfg.Params, mode addressType) (string, error) {
+	if netParams == nil {
+		inferred, err := bip38.NetworkFromWIF(wif)
+		if err != nil {
+			return "", err
+		}
+		netParams = inferred
 	}
 
 	pubKey := wif.PrivKey.PubKey()
-	if mode == addressTypeBIP84 && !wif.CompressPubKey {
-		mode = addressTypeBIP44
-	}
+	mode = effectiveAddressType(mode, wif.CompressPubKey, netParams)
 
 	switch mode {
 	case addressTypeBIP84:
@@ -0,0 +1,403 @@
+package cli
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/strength"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+// apiOperation runs one command for a programmatic front end (serve, rpc).
+// decode fills the operation's request struct from the transport and must
+// reject unknown fields. Results use the same field names as the commands'
+// --output-format json output.
+type apiOperation func(decode func(v any) error) (any, error)
+
+// apiPassphrase copies a request passphrase into a buffer the caller zeroes.
+func apiPassphrase(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.NewValidationError("passphrase is required", nil)
+	}
+	return []byte(passphrase), nil
+}
+
+// apiCheckStrength applies the passphrase policy to a new passphrase. There
+// is no report or prompt to fall back on, so a weak passphrase is only
+// accepted when the request sets allow_weak.
+func apiCheckStrength(passphrase []byte, allowWeak bool) error {
+	if allowWeak {
+		return nil
+	}
+	minBits, err := defaultPassphraseBits()
+	if err != nil {
+		return err
+	}
+	if result := strength.Estimate(passphrase); result.Bits < minBits {
+		return weakPassphraseError(result, minBits, "set allow_weak")
+	}
+	return nil
+}
+
+func apiEncrypt(decode func(v any) error) (any, error) {
+	var req struct {
+		WIF        string `json:"wif"`
+		Passphrase string `json:"passphrase"`
+		AllowWeak  bool   `json:"allow_weak"`
+		Network    string `json:"network"`
+		Compressed *bool  `json:"compressed"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	wif, err := btcutil.DecodeWIF(strings.TrimSpace(req.WIF))
+	if err != nil {
+		return nil, errors.NewValidationError("invalid WIF private key", err)
+	}
+	params, err := resolveNetworkFlag(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := apiPassphrase(req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer secureZero(passphrase)
+	if err := apiCheckStrength(passphrase, req.AllowWeak); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := bip38.Encrypt(bip38.EncryptOptions{
+		WIF:        wif,
+		Passphrase: passphrase,
+		Compressed: req.Compressed,
+		Network:    params,
+	})
+	if err != nil {
+		return nil, errors.NewCryptoError("encryption failed", err)
+	}
+
+	return map[string]any{
+		"encrypted_key": encrypted.EncryptedKey,
+		"address":       encrypted.Address,
+		"network":       encrypted.Network.Name,
+		"compressed":    encrypted.Compressed,
+	}, nil
+}
+
+func apiDecrypt(decode func(v any) error) (any, error) {
+	var req struct {
+		EncryptedKey string `json:"encrypted_key"`
+		Passphrase   string `json:"passphrase"`
+		Network      string `json:"network"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	if !bip38.IsBIP38Format(req.EncryptedKey) {
+		return nil, errors.NewValidationError("invalid BIP38 encrypted key format", nil)
+	}
+	params, err := resolveNetworkFlag(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := apiPassphrase(req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer secureZero(passphrase)
+
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: req.EncryptedKey,
+		Passphrase:   passphrase,
+		Network:      params,
+	})
+	if err != nil {
+		return nil, errors.NewCryptoError("decryption failed", err)
+	}
+
+	result := map[string]any{
+		"private_key": decrypted.WIF.String(),
+		"address":     decrypted.Address,
+		"compressed":  decrypted.Compressed,
+		"ec_multiply": decrypted.ECMultiply,
+	}
+	addNetworkFields(result, decrypted.Network, decrypted.Candidates)
+	return result, nil
+}
+
+func apiGenerateIntermediate(decode func(v any) error) (any, error) {
+	var req struct {
+		Passphrase string  `json:"passphrase"`
+		AllowWeak  bool    `json:"allow_weak"`
+		Lot        *uint32 `json:"lot"`
+		Sequence   *uint32 `json:"sequence"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	if (req.Lot == nil) != (req.Sequence == nil) {
+		return nil, errors.NewValidationError("lot and sequence must be provided together", nil)
+	}
+	if req.Lot != nil && (*req.Lot > 1048575 || *req.Sequence > 4095) {
+		return nil, errors.NewValidationError("lot must be 0-1048575 and sequence 0-4095", nil)
+	}
+	passphrase, err := apiPassphrase(req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer secureZero(passphrase)
+	if err := apiCheckStrength(passphrase, req.AllowWeak); err != nil {
+		return nil, err
+	}
+
+	generated, err := bip38.GenerateIntermediate(bip38.IntermediateOptions{
+		Passphrase:     passphrase,
+		LotNumber:      req.Lot,
+		SequenceNumber: req.Sequence,
+	})
+	if err != nil {
+		return nil, errors.NewCryptoError("failed to generate intermediate code", err)
+	}
+
+	result := map[string]any{
+		"intermediate_code": generated.Code,
+		"has_lot_sequence":  req.Lot != nil,
+	}
+	if req.Lot != nil {
+		result["lot_number"] = *req.Lot
+		result["sequence_number"] = *req.Sequence
+	}
+	return result, nil
+}
+
+func apiEncryptIntermediate(decode func(v any) error) (any, error) {
+	var req struct {
+		IntermediateCode string `json:"intermediate_code"`
+		Compressed       *bool  `json:"compressed"`
+		Network          string `json:"network"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	if !bip38.IsValidIntermediateCode(req.IntermediateCode) {
+		return nil, errors.NewValidationError("invalid intermediate code format", nil)
+	}
+	params, err := resolveNetworkFlag(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	compressed := req.Compressed == nil || *req.Compressed
+
+	minted, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: req.IntermediateCode,
+		Compressed:       compressed,
+		Network:          params,
+	})
+	if err != nil {
+		return nil, errors.NewCryptoError("EC-multiply encryption failed", err)
+	}
+
+	return map[string]any{
+		"encrypted_key":     minted.EncryptedKey,
+		"confirmation_code": minted.ConfirmationCode,
+		"compressed":        minted.Compressed,
+		"address":           minted.Address,
+		"network":           minted.Network.Name,
+	}, nil
+}
+
+func apiConfirmIntermediate(decode func(v any) error) (any, error) {
+	var req struct {
+		ConfirmationCode string `json:"confirmation_code"`
+		Passphrase       string `json:"passphrase"`
+		Network          string `json:"network"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	params, err := resolveNetworkFlag(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := apiPassphrase(req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer secureZero(passphrase)
+
+	confirmation, err := bip38.Confirm(bip38.ConfirmOptions{
+		ConfirmationCode: req.ConfirmationCode,
+		Passphrase:       passphrase,
+		Network:          params,
+	})
+	if err != nil {
+		return nil, errors.NewCryptoError("confirmation failed", err)
+	}
+	return confirmationResultMap(req.ConfirmationCode, confirmation), nil
+}
+
+func apiInspect(decode func(v any) error) (any, error) {
+	var req struct {
+		WIF         string `json:"wif"`
+		Network     string `json:"network"`
+		AddressType string `json:"address_type"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	wif, err := btcutil.DecodeWIF(strings.TrimSpace(req.WIF))
+	if err != nil {
+		return nil, errors.NewValidationError("invalid WIF private key", err)
+	}
+	params, err := resolveNetworkFlag(req.Network)
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		if params, err = bip38.NetworkFromWIF(wif); err != nil {
+			return nil, errors.NewValidationError("unsupported WIF network", err)
+		}
+	} else if !wif.IsForNet(params) {
+		return nil, errors.NewValidationError("WIF does not belong to the selected network", nil).
+			WithContext("network", params.Name)
+	}
+
+	addrType, err := parseAddressType(req.AddressType)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid address type", err).
+			WithContext("address_type", req.AddressType)
+	}
+	effectiveType := effectiveAddressType(addrType, wif.CompressPubKey, params)
+	address, err := addressForKey(wif, params, effectiveType)
+	if err != nil {
+		return nil, errors.NewSystemError("failed to derive address", err)
+	}
+
+	return map[string]any{
+		"compressed":   wif.CompressPubKey,
+		"network":      params.Name,
+		"address":      address,
+		"address_type": string(effectiveType),
+	}, nil
+}
+
+func apiGenerateWallet(decode func(v any) error) (any, error) {
+	var req struct {
+		Network     string `json:"network"`
+		Compressed  *bool  `json:"compressed"`
+		AddressType string `json:"address_type"`
+		ShowAddress bool   `json:"show_address"`
+		Passphrase  string `json:"passphrase"`
+		AllowWeak   bool   `json:"allow_weak"`
+		ShowWIF     bool   `json:"show_wif"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	if req.Network == "" {
+		req.Network = "mainnet"
+	}
+	params, err := bip38.NetworkFromName(req.Network)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid network", err).
+			WithContext("network", req.Network)
+	}
+	addrType, err := parseAddressType(req.AddressType)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid address type", err).
+			WithContext("address_type", req.AddressType)
+	}
+
+	encrypt := req.Passphrase != ""
+	passphrase := []byte(req.Passphrase)
+	defer secureZero(passphrase)
+	if encrypt {
+		if err := apiCheckStrength(passphrase, req.AllowWeak); err != nil {
+			return nil, err
+		}
+	}
+
+	wif, err := generateWIF(params, req.Compressed == nil || *req.Compressed)
+	if err != nil {
+		return nil, errors.NewCryptoError("failed to generate private key", err)
+	}
+	effectiveType := effectiveAddressType(addrType, wif.CompressPubKey, params)
+
+	result := map[string]any{
+		"compressed":   wif.CompressPubKey,
+		"network":      params.Name,
+		"address_type": string(effectiveType),
+	}
+	if !encrypt || req.ShowWIF {
+		result["wif"] = wif.String()
+	}
+	if req.ShowAddress {
+		address, err := addressForKey(wif, params, effectiveType)
+		if err != nil {
+			return nil, errors.NewSystemError("failed to derive address", err)
+		}
+		result["address"] = address
+	}
+
+	if encrypt {
+		encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
+		if err != nil {
+			return nil, errors.NewCryptoError("failed to encrypt generated key", err)
+		}
+		result["bip38_encrypted_key"] = encrypted.EncryptedKey
+	}
+	return result, nil
+}
+
+func apiValidateIntermediate(decode func(v any) error) (any, error) {
+	var req struct {
+		IntermediateCode string `json:"intermediate_code"`
+	}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+
+	code := strings.TrimSpace(req.IntermediateCode)
+	if code == "" {
+		return nil, errors.NewValidationError("intermediate code is required", nil)
+	}
+	if !bip38.IsValidIntermediateCode(code) {
+		return nil, errors.NewValidationError("invalid intermediate code format", nil)
+	}
+	parsed, err := bip38.ParseIntermediateCode(code)
+	if err != nil {
+		return nil, errors.NewValidationError("failed to parse intermediate code", err)
+	}
+
+	result := map[string]any{
+		"valid":            true,
+		"has_lot_sequence": parsed.HasLotSeq,
+		"owner_salt":       hex.EncodeToString(parsed.OwnerSalt),
+		"pass_point":       hex.EncodeToString(parsed.PassPoint),
+	}
+	if parsed.HasLotSeq {
+		result["lot_number"] = *parsed.LotNumber
+		result["sequence_number"] = *parsed.SeqNumber
+	}
+	return result, nil
+}
+
+func apiMetrics(decode func(v any) error) (any, error) {
+	var req struct{}
+	if err := decode(&req); err != nil {
+		return nil, err
+	}
+	snap := metrics.GetSnapshot()
+	return &snap, nil
+}
@@ -0,0 +1,412 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/batch"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/strength"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Encrypt or decrypt many keys from a CSV or JSONL file",
+	Long: `Process a list of keys in parallel and write a manifest with one JSON line
+per input row.
+
+Input is CSV (key, label, passphrase_ref; an optional header names the
+columns) or JSONL ({"key": ..., "label": ..., "passphrase_ref": ...}). The
+format is detected unless --input-format is given; use - to read stdin.
+
+A passphrase_ref of env:NAME reads the passphrase from an environment
+variable, file:PATH from the first line of a file and keyring:KEY from the
+Linux kernel keyring (see 'passphrase cache'). Rows without one use a
+passphrase prompted once for the whole run, or read from the passphrase
+source flags.
+
+Each scrypt derivation needs about 16 MiB, so the number of parallel workers
+follows --memory-budget unless --workers is set. A failed row is recorded in
+the manifest with its error and does not stop the others.`,
+}
+
+var batchEncryptCmd = &cobra.Command{
+	Use:   "encrypt INPUT",
+	Short: "Encrypt WIF private keys listed in a file",
+	Long: `Encrypt every WIF private key in INPUT with BIP38.
+
+The manifest records the encrypted key, address, network and compression for
+each row; the input WIF is not repeated. Passphrases must meet the same
+minimum strength as for 'encrypt': a weak prompted passphrase stops the run,
+and a row whose passphrase_ref is weak fails, unless --allow-weak is given.
+
+Examples:
+  bip38cli batch encrypt --manifest encrypted.jsonl keys.csv
+  bip38cli batch encrypt --memory-budget 1GiB --input-format jsonl keys.jsonl`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBatchEncrypt,
+}
+
+var batchDecryptCmd = &cobra.Command{
+	Use:   "decrypt INPUT",
+	Short: "Decrypt BIP38 encrypted keys listed in a file",
+	Long: `Decrypt every BIP38 encrypted key in INPUT.
+
+The manifest records the private key (WIF), address and network for each row
+and is written with owner-only permissions.
+
+Examples:
+  bip38cli batch decrypt --manifest decrypted.jsonl encrypted.csv
+  bip38cli batch decrypt --workers 2 --network testnet3 - < encrypted.jsonl`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBatchDecrypt,
+}
+
+var (
+	batchInputFormat  = batch.FormatAuto
+	batchManifest     string
+	batchMemoryBudget = "256MiB"
+	batchWorkers      int
+	batchNetwork      string
+)
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.AddCommand(batchEncryptCmd)
+	batchCmd.AddCommand(batchDecryptCmd)
+
+	batchCmd.PersistentFlags().StringVar(&batchInputFormat, "input-format", batch.FormatAuto, "input format (auto|csv|jsonl)")
+	batchCmd.PersistentFlags().StringVar(&batchManifest, "manifest", "", "write the manifest to this file (default: stdout)")
+	batchCmd.PersistentFlags().StringVar(&batchMemoryBudget, "memory-budget", "256MiB", "memory available to scrypt across workers")
+	batchCmd.PersistentFlags().IntVar(&batchWorkers, "workers", 0, "parallel workers (default: from --memory-budget)")
+	batchCmd.PersistentFlags().StringVar(&batchNetwork, "network", "", "network of the keys ("+networkChoices()+"; default: detect)")
+	addPassphraseFlags(batchEncryptCmd)
+	addStrengthFlags(batchEncryptCmd)
+	addPassphraseFlags(batchDecryptCmd)
+}
+
+func runBatchEncrypt(cmd *cobra.Command, args []string) error {
+	minBits, err := minimumPassphraseBits(cmd)
+	if err != nil {
+		return err
+	}
+	return runBatch(cmd, args[0], "encrypt", func(params *chaincfg.Params, passphrases *batch.Passphrases) batch.ProcessFunc {
+		return func(_ context.Context, row batch.Row) (map[string]any, error) {
+			passphrase, err := passphrases.Resolve(row.PassphraseRef)
+			if err != nil {
+				return nil, rowError{errors.InputError, err}
+			}
+			// The shared passphrase was checked when it was read.
+			if row.PassphraseRef != "" && !allowWeakPassphrase {
+				if result := strength.Estimate(passphrase); result.Bits < minBits {
+					return nil, rowError{errors.ValidationError, weakPassphraseError(result, minBits, "pass --allow-weak")}
+				}
+			}
+			wif, err := btcutil.DecodeWIF(row.Key)
+			if err != nil {
+				return nil, rowError{errors.ValidationError, fmt.Errorf("invalid WIF private key: %w", err)}
+			}
+
+			encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
+			if err != nil {
+				return nil, rowError{libraryErrorType(err), err}
+			}
+			return map[string]any{
+				"encrypted_key": encrypted.EncryptedKey,
+				"address":       encrypted.Address,
+				"network":       encrypted.Network.Name,
+				"compressed":    encrypted.Compressed,
+			}, nil
+		}
+	})
+}
+
+func runBatchDecrypt(cmd *cobra.Command, args []string) error {
+	// EC-multiply keys from one intermediate code share their passfactor.
+	cache := bip38.NewPassfactorCache()
+	defer cache.Clear()
+
+	return runBatch(cmd, args[0], "decrypt", func(params *chaincfg.Params, passphrases *batch.Passphrases) batch.ProcessFunc {
+		return func(_ context.Context, row batch.Row) (map[string]any, error) {
+			passphrase, err := passphrases.Resolve(row.PassphraseRef)
+			if err != nil {
+				return nil, rowError{errors.InputError, err}
+			}
+			if !bip38.IsBIP38Format(row.Key) {
+				return nil, rowError{errors.ValidationError, fmt.Errorf("invalid BIP38 encrypted key format")}
+			}
+
+			decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+				EncryptedKey: row.Key,
+				Passphrase:   passphrase,
+				Network:      params,
+				Cache:        cache,
+			})
+			if err != nil {
+				return nil, rowError{libraryErrorType(err), err}
+			}
+			fields := map[string]any{
+				"encrypted_key": row.Key,
+				"private_key":   decrypted.WIF.String(),
+				"address":       decrypted.Address,
+				"compressed":    decrypted.Compressed,
+			}
+			addNetworkFields(fields, decrypted.Network, decrypted.Candidates)
+			return fields, nil
+		}
+	})
+}
+
+// runBatch reads the input, gathers passphrases and drives the worker pool.
+// newProcess builds the per-row operation once the shared state is known.
+func runBatch(cmd *cobra.Command, input, operation string, newProcess func(*chaincfg.Params, *batch.Passphrases) batch.ProcessFunc) error { //nolint:gocyclo
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	params, err := resolveNetworkFlag(batchNetwork)
+	if err != nil {
+		return err
+	}
+	budget, err := batch.ParseSize(batchMemoryBudget)
+	if err != nil {
+		return errors.NewValidationError("invalid memory budget", err).
+			WithContext("memory_budget", batchMemoryBudget)
+	}
+
+	if input == "-" {
+		if err := checkStdinFree("input"); err != nil {
+			return err
+		}
+	}
+	rows, err := readBatchRows(input)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return errors.NewValidationError("input has no rows", nil).
+			WithContext("input", input)
+	}
+
+	passphrases := &batch.Passphrases{}
+	defer passphrases.Zero()
+	if batch.NeedsDefault(rows) {
+		passphrase, err := promptBatchPassphrase(operation == "encrypt")
+		if err != nil {
+			return err
+		}
+		passphrases.Default = passphrase
+		if operation == "encrypt" {
+			if err := checkPassphraseStrength(cmd, passphrase); err != nil {
+				return err
+			}
+		}
+	}
+
+	workers := batchWorkers
+	if workers <= 0 {
+		workers = batch.WorkersForBudget(budget, len(rows))
+	}
+	logger.WithField("rows", len(rows)).WithField("workers", workers).
+		Debugf("Starting batch %s", operation)
+
+	manifest, closeManifest, err := openBatchManifest(batchManifest)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifest)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failures := &rowFailures{}
+	summary, runErr := batch.Run(ctx, rows, workers, failures.track(newProcess(params, passphrases)), func(entry map[string]any) error {
+		return encoder.Encode(entry)
+	})
+	if err := closeManifest(); err != nil && runErr == nil {
+		runErr = fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if runErr != nil {
+		return errors.NewSystemError("batch "+operation+" stopped", runErr).
+			WithContext("processed", summary.OK+summary.Failed)
+	}
+
+	if err := printBatchSummary(cmd, summary); err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return failures.summaryError(summary)
+	}
+	return nil
+}
+
+// rowError types a row failure without changing the message recorded in the
+// manifest.
+type rowError struct {
+	kind errors.ErrorType
+	err  error
+}
+
+func (e rowError) Error() string { return e.err.Error() }
+
+func (e rowError) Unwrap() error { return e.err }
+
+// rowFailures collects the type of each failed row, so the run's error says
+// why rows failed.
+type rowFailures struct {
+	mu    sync.Mutex
+	types map[int]errors.ErrorType
+}
+
+// track wraps process to record the type of each row it fails. A row that
+// panics counts as a system error; rows rejected before process runs, for a
+// parse error or a missing key, are not recorded and count as validation.
+func (f *rowFailures) track(process batch.ProcessFunc) batch.ProcessFunc {
+	return func(ctx context.Context, row batch.Row) (map[string]any, error) {
+		f.set(row.Number, errors.SystemError)
+		fields, err := process(ctx, row)
+		kind := errors.ErrorType("")
+		if err != nil {
+			kind = errors.CryptoError
+			var typed rowError
+			if stderrors.As(err, &typed) {
+				kind = typed.kind
+			}
+		}
+		f.set(row.Number, kind)
+		return fields, err
+	}
+}
+
+func (f *rowFailures) set(row int, kind errors.ErrorType) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.types == nil {
+		f.types = make(map[int]errors.ErrorType)
+	}
+	if kind == "" {
+		delete(f.types, row)
+		return
+	}
+	f.types[row] = kind
+}
+
+// summaryError reports the failed rows with their type when they all failed
+// the same way, and as a system error with a count per type otherwise.
+func (f *rowFailures) summaryError(summary batch.Summary) *errors.AppError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[string]int)
+	for _, kind := range f.types {
+		counts[string(kind)]++
+	}
+	if unrecorded := summary.Failed - len(f.types); unrecorded > 0 {
+		counts[string(errors.ValidationError)] += unrecorded
+	}
+
+	newError := errors.NewSystemError
+	if len(counts) == 1 {
+		for only := range counts {
+			switch errors.ErrorType(only) {
+			case errors.ValidationError:
+				newError = errors.NewValidationError
+			case errors.InputError:
+				newError = errors.NewInputError
+			case errors.CryptoError:
+				newError = errors.NewCryptoError
+			}
+		}
+	}
+	return newError(fmt.Sprintf("%d of %d rows failed", summary.Failed, summary.Total), nil).
+		WithContext("failed", summary.Failed).
+		WithContext("error_types", counts)
+}
+
+func readBatchRows(input string) ([]batch.Row, error) {
+	var reader io.Reader = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input) //nolint:gosec
+		if err != nil {
+			return nil, errors.NewInputError("failed to open input file", err).
+				WithContext("input", input)
+		}
+		defer func() { _ = file.Close() }()
+		reader = file
+	}
+
+	rows, err := batch.ReadRows(reader, batchInputFormat)
+	if err != nil {
+		return nil, errors.NewInputError("failed to read input", err).
+			WithContext("input", input)
+	}
+	return rows, nil
+}
+
+// promptBatchPassphrase asks once for the passphrase shared by rows without
+// a reference, confirming it when encrypting.
+func promptBatchPassphrase(confirm bool) ([]byte, error) {
+	if confirm {
+		return getNewPassphrase("Enter passphrase: ")
+	}
+	passphrase, err := getPassphrase("Enter passphrase: ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	return passphrase, nil
+}
+
+// openBatchManifest opens the manifest destination. Files are created with
+// owner-only permissions because decrypt manifests hold private keys.
+func openBatchManifest(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return nil, nil, errors.NewSystemError("failed to create manifest", err).
+			WithContext("path", path)
+	}
+	return file, file.Close, nil
+}
+
+// printBatchSummary reports the totals. It goes to stderr when the manifest
+// itself is written to stdout.
+func printBatchSummary(cmd *cobra.Command, summary batch.Summary) error {
+	if batchManifest == "" {
+		fmt.Fprintf(os.Stderr, "Processed %d rows: %d ok, %d failed\n", summary.Total, summary.OK, summary.Failed)
+		return nil
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		jsonOutput, err := json.MarshalIndent(map[string]any{
+			"manifest": batchManifest,
+			"total":    summary.Total,
+			"ok":       summary.OK,
+			"failed":   summary.Failed,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Processed %d rows: %d ok, %d failed\n", summary.Total, summary.OK, summary.Failed)
+		fmt.Printf("Manifest: %s\n", batchManifest)
+	}
+	return nil
+}
@@ -3,18 +3,39 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/batch"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/keyring"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/recovery"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/server"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
 )
 
@@ -59,7 +80,16 @@ func captureOutput() (func() []byte, func()) {
 	return collect, restore
 }
 
+// allowWeakPassphrases lets a test encrypt with the short passphrases of the
+// BIP38 test vectors, as --allow-weak would.
+func allowWeakPassphrases(t *testing.T) {
+	t.Helper()
+	allowWeakPassphrase = true
+	t.Cleanup(func() { allowWeakPassphrase = false })
+}
+
 func TestRunEncryptWithStubbedPassphrase(t *testing.T) {
+	allowWeakPassphrases(t)
 	origReadPassword := readPassword
 	defer func() { readPassword = origReadPassword }()
 
@@ -238,6 +268,7 @@ func TestRunDecryptWithStubbedPassphrase(t *testing.T) {
 }
 
 func testRunEncryptWithFlag(t *testing.T, compressed, uncompressed bool) {
+	allowWeakPassphrases(t)
 	origReadPassword := readPassword
 	defer func() { readPassword = origReadPassword }()
 
@@ -471,6 +502,7 @@ func TestRunWalletGenerateProducesWIF(t *testing.T) {
 }
 
 func TestRunWalletGenerateEncryptsAndShowsAddress(t *testing.T) {
+	allowWeakPassphrases(t)
 	origGenerate := generateWIF
 	defer func() { generateWIF = origGenerate }()
 
@@ -586,7 +618,7 @@ func TestRunWalletGenerateJSON(t *testing.T) {
 		}
 		generatedWIF = wif.String()
 
-		address, err := addressForWIF(wif, addressTypeBIP84)
+		address, err := addressForKey(wif, params, addressTypeBIP84)
 		if err != nil {
 			return nil, err
 		}
@@ -821,6 +853,7 @@ func TestRunWalletInspectInvalidWIF(t *testing.T) {
 }
 
 func TestRunGenerateIntermediateWithLotSequence(t *testing.T) {
+	allowWeakPassphrases(t)
 	origReadPassword := readPassword
 	defer func() { readPassword = origReadPassword }()
 
@@ -975,3 +1008,1818 @@ func TestRunDecryptWithShowAddress(t *testing.T) {
 		t.Fatalf("runDecrypt returned unexpected error: %v", runErr)
 	}
 }
+
+func TestRunConfirmIntermediateJSON(t *testing.T) {
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+
+	readPassword = func(int) ([]byte, error) {
+		return []byte("MOLON LABE"), nil
+	}
+
+	cmd := &cobra.Command{Use: "intermediate-confirm"}
+	cmd.Flags().String("output-format", "text", "")
+	if err := cmd.Flags().Set("output-format", "json"); err != nil {
+		t.Fatalf("failed to set output-format flag: %v", err)
+	}
+
+	collect, restore := captureOutput()
+	defer restore()
+
+	runErr := runConfirmIntermediate(cmd, []string{
+		"cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD",
+	})
+
+	outputBytes := collect()
+
+	if runErr != nil {
+		t.Fatalf("runConfirmIntermediate returned error: %v", runErr)
+	}
+
+	// The passphrase prompt precedes the JSON document on stdout.
+	jsonStart := bytes.IndexByte(outputBytes, '{')
+	if jsonStart < 0 {
+		t.Fatalf("expected JSON output, got %q", outputBytes)
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(outputBytes[jsonStart:], &result); err != nil {
+		t.Fatalf("failed to parse JSON output: %v (%q)", err, outputBytes)
+	}
+	if result["address"] != "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh" {
+		t.Fatalf("unexpected address: %v", result["address"])
+	}
+	if result["compressed"] != false {
+		t.Fatalf("expected uncompressed key, got %v", result["compressed"])
+	}
+	if result["network"] != "mainnet" {
+		t.Fatalf("expected mainnet, got %v", result["network"])
+	}
+	if result["lot_number"] != float64(263183) || result["sequence_number"] != float64(1) {
+		t.Fatalf("unexpected lot/sequence: %v/%v", result["lot_number"], result["sequence_number"])
+	}
+}
+
+func TestRunConfirmIntermediateReportsEachCode(t *testing.T) {
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+
+	readCount := 0
+	readPassword = func(int) ([]byte, error) {
+		readCount++
+		return []byte("MOLON LABE"), nil
+	}
+
+	cmd := &cobra.Command{Use: "intermediate-confirm"}
+
+	collect, restore := captureOutput()
+	defer restore()
+
+	runErr := runConfirmIntermediate(cmd, []string{
+		"cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD",
+		"cfrm38invalid",
+	})
+
+	output := string(collect())
+
+	if runErr == nil || !strings.Contains(runErr.Error(), "1 of 2 confirmation codes failed") {
+		t.Fatalf("expected partial failure error, got %v", runErr)
+	}
+	if readCount != 1 {
+		t.Fatalf("expected passphrase to be read once, got %d", readCount)
+	}
+	if !strings.Contains(output, "PASS cfrm38V8aXBn7") || !strings.Contains(output, "FAIL cfrm38invalid") {
+		t.Fatalf("expected per-code PASS/FAIL lines, got %q", output)
+	}
+	if !strings.Contains(output, "Passed: 1  Failed: 1") {
+		t.Fatalf("expected summary line, got %q", output)
+	}
+}
+
+func TestRunDecryptReportsCandidateNetworks(t *testing.T) {
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+
+	passphrase := []byte("TestingOneTwoThree")
+	readPassword = func(int) ([]byte, error) {
+		buf := make([]byte, len(passphrase))
+		copy(buf, passphrase)
+		return buf, nil
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x22}, 32))
+	wif, err := btcutil.NewWIF(privKey, &chaincfg.SigNetParams, true)
+	if err != nil {
+		t.Fatalf("NewWIF: %v", err)
+	}
+	encrypted, err := bip38.EncryptKey(wif, passphrase)
+	if err != nil {
+		t.Fatalf("EncryptKey: %v", err)
+	}
+
+	decodeJSON := func(t *testing.T, network string) map[string]any {
+		t.Helper()
+		decryptNetwork = network
+		defer func() { decryptNetwork = "" }()
+
+		cmd := &cobra.Command{Use: "decrypt"}
+		cmd.Flags().String("output-format", "text", "")
+		if err := cmd.Flags().Set("output-format", "json"); err != nil {
+			t.Fatalf("failed to set output-format flag: %v", err)
+		}
+
+		collect, restore := captureOutput()
+		defer restore()
+
+		runErr := runDecrypt(cmd, []string{encrypted})
+		outputBytes := collect()
+		if runErr != nil {
+			t.Fatalf("runDecrypt returned error: %v", runErr)
+		}
+
+		var result map[string]any
+		if err := json.Unmarshal(outputBytes[bytes.IndexByte(outputBytes, '{'):], &result); err != nil {
+			t.Fatalf("failed to parse JSON output: %v (%q)", err, outputBytes)
+		}
+		return result
+	}
+
+	detected := decodeJSON(t, "")
+	if _, ok := detected["network"]; ok {
+		t.Fatalf("expected no single network for ambiguous key, got %v", detected["network"])
+	}
+	candidates, _ := detected["candidate_networks"].([]any)
+	if len(candidates) < 2 {
+		t.Fatalf("expected several candidate networks, got %v", detected["candidate_networks"])
+	}
+
+	explicit := decodeJSON(t, "signet")
+	if explicit["network"] != "signet" {
+		t.Fatalf("expected signet, got %v", explicit["network"])
+	}
+}
+
+func TestRunWalletGenerateAltcoinFallsBackToP2PKH(t *testing.T) {
+	walletNetwork = "doge"
+	walletEncrypt = false
+	walletShowAddr = true
+	walletAddressType = "bip84"
+	defer func() {
+		walletShowAddr = false
+		walletNetwork = "mainnet"
+		walletAddressType = "bip84"
+	}()
+
+	cmd := &cobra.Command{Use: "wallet-generate"}
+	cmd.Flags().String("output-format", "text", "")
+	if err := cmd.Flags().Set("output-format", "json"); err != nil {
+		t.Fatalf("failed to set output-format flag: %v", err)
+	}
+
+	collect, restore := captureOutput()
+	defer restore()
+
+	if err := runWalletGenerate(cmd, nil); err != nil {
+		t.Fatalf("runWalletGenerate returned error: %v", err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(collect(), &payload); err != nil {
+		t.Fatalf("failed to parse JSON output: %v", err)
+	}
+
+	if payload["network"] != "dogecoin" {
+		t.Fatalf("expected dogecoin network, got %v", payload["network"])
+	}
+	if payload["address_type"] != "bip44" {
+		t.Fatalf("expected bip44 fallback without segwit, got %v", payload["address_type"])
+	}
+	if address, _ := payload["address"].(string); !strings.HasPrefix(address, "D") {
+		t.Fatalf("expected Dogecoin P2PKH address, got %v", payload["address"])
+	}
+}
+
+func TestLoadNetworkFileEnablesCustomNetwork(t *testing.T) {
+	path := t.TempDir() + "/networks.json"
+	definitions := `{"networks": [{"name": "clitestnet", "aliases": ["ctn"], "pubkey_hash_addr_id": "0x3c", "private_key_id": "0xbc", "bech32_hrp": "ctn"}]}`
+	if err := os.WriteFile(path, []byte(definitions), 0o600); err != nil {
+		t.Fatalf("failed to write network file: %v", err)
+	}
+
+	if err := loadNetworkFile(path); err != nil {
+		t.Fatalf("loadNetworkFile returned error: %v", err)
+	}
+
+	params, err := resolveNetworkFlag("CTN")
+	if err != nil {
+		t.Fatalf("resolveNetworkFlag returned error: %v", err)
+	}
+	if params.Name != "clitestnet" {
+		t.Fatalf("expected clitestnet, got %s", params.Name)
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x66}, 32))
+	wif, err := btcutil.NewWIF(privKey, params, true)
+	if err != nil {
+		t.Fatalf("failed to create WIF: %v", err)
+	}
+
+	segwit, err := addressForWIF(wif, addressTypeBIP84)
+	if err != nil {
+		t.Fatalf("addressForWIF bip84 returned error: %v", err)
+	}
+	if !strings.HasPrefix(segwit, "ctn1") {
+		t.Fatalf("expected ctn1 address, got %s", segwit)
+	}
+
+	legacy, err := addressForWIF(wif, addressTypeBIP44)
+	if err != nil {
+		t.Fatalf("addressForWIF bip44 returned error: %v", err)
+	}
+	decoded, err := btcutil.DecodeAddress(legacy, params)
+	if err != nil || !decoded.IsForNet(params) {
+		t.Fatalf("expected clitestnet P2PKH address, got %s (%v)", legacy, err)
+	}
+
+	if err := loadNetworkFile(path); err == nil {
+		t.Fatal("expected loading the same definitions twice to fail")
+	}
+}
+
+func TestLoadNetworkFileErrors(t *testing.T) {
+	if err := loadNetworkFile(""); err != nil {
+		t.Fatalf("empty path should be a no-op, got %v", err)
+	}
+
+	if err := loadNetworkFile(t.TempDir() + "/missing.json"); err == nil || !strings.Contains(err.Error(), "failed to open network file") {
+		t.Fatalf("expected open error, got %v", err)
+	}
+
+	path := t.TempDir() + "/broken.json"
+	if err := os.WriteFile(path, []byte(`{"networks": [{"name": "x"`), 0o600); err != nil {
+		t.Fatalf("failed to write network file: %v", err)
+	}
+	if err := loadNetworkFile(path); err == nil || !strings.Contains(err.Error(), "invalid network file") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestRunRecoverFindsPassphraseAndResumes(t *testing.T) {
+	const encrypted = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+
+	dir := t.TempDir()
+	wordlist := dir + "/words.txt"
+	if err := os.WriteFile(wordlist, []byte("hunter2\nTestingOneTwoThree\n"), 0o600); err != nil {
+		t.Fatalf("failed to write wordlist: %v", err)
+	}
+	checkpointPath := dir + "/checkpoint.json"
+
+	recoverWordlists = []string{wordlist}
+	recoverFragments = []string{"One", "Two"}
+	recoverCheckpoint = checkpointPath
+	defer func() {
+		recoverWordlists = nil
+		recoverFragments = nil
+		recoverCheckpoint = ""
+		recoverRestart = false
+	}()
+
+	// A checkpoint past the wordlist resumes into the fragments and misses the passphrase.
+	plan, err := recoverySpec().Build()
+	if err != nil {
+		t.Fatalf("failed to build plan: %v", err)
+	}
+	checkpoint := recovery.NewCheckpoint(encrypted, recoverySpec(), plan)
+	checkpoint.Next = 2
+	if err := checkpoint.Save(checkpointPath); err != nil {
+		t.Fatalf("failed to save checkpoint: %v", err)
+	}
+
+	cmd := &cobra.Command{Use: "recover"}
+	cmd.Flags().String("output-format", "text", "")
+	if err := cmd.Flags().Set("output-format", "json"); err != nil {
+		t.Fatalf("failed to set output-format flag: %v", err)
+	}
+
+	err = runRecover(cmd, []string{encrypted})
+	if err == nil || !strings.Contains(err.Error(), "passphrase not found") {
+		t.Fatalf("expected resumed run to miss the passphrase, got %v", err)
+	}
+	saved, err := recovery.LoadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatalf("failed to reload checkpoint: %v", err)
+	}
+	if saved.Next != saved.Total || saved.Tried != 4 {
+		t.Fatalf("expected exhausted checkpoint after 4 attempts, got %+v", saved)
+	}
+
+	recoverRestart = true
+	collect, restore := captureOutput()
+	defer restore()
+
+	if err := runRecover(cmd, []string{encrypted}); err != nil {
+		t.Fatalf("runRecover returned error: %v", err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(collect(), &payload); err != nil {
+		t.Fatalf("failed to parse JSON output: %v", err)
+	}
+	if payload["passphrase"] != "TestingOneTwoThree" {
+		t.Fatalf("unexpected passphrase: %v", payload["passphrase"])
+	}
+	if payload["private_key"] != "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR" {
+		t.Fatalf("unexpected private key: %v", payload["private_key"])
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Fatalf("expected checkpoint to be removed after success, got %v", err)
+	}
+}
+
+func TestRunRecoverRejectsMismatchedCheckpoint(t *testing.T) {
+	path := t.TempDir() + "/checkpoint.json"
+	other := recovery.NewCheckpoint("6Pother", recovery.Spec{}, &recovery.Plan{Space: recovery.Words{"x"}})
+	if err := other.Save(path); err != nil {
+		t.Fatalf("failed to save checkpoint: %v", err)
+	}
+
+	recoverMasks = []string{"?d"}
+	recoverCheckpoint = path
+	defer func() {
+		recoverMasks = nil
+		recoverCheckpoint = ""
+	}()
+
+	err := runRecover(&cobra.Command{Use: "recover"}, []string{"6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"})
+	if err == nil || !strings.Contains(err.Error(), "--restart") {
+		t.Fatalf("expected checkpoint mismatch error, got %v", err)
+	}
+}
+
+func TestRunRecoverCoordinatorWithWorker(t *testing.T) {
+	const encrypted = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+
+	dir := t.TempDir()
+	wordlist := dir + "/words.txt"
+	if err := os.WriteFile(wordlist, []byte("hunter2\nTestingOneTwoThree\n"), 0o600); err != nil {
+		t.Fatalf("failed to write wordlist: %v", err)
+	}
+	socket := dir + "/recover.sock"
+
+	recoverWordlists = []string{wordlist}
+	recoverListen = "unix:" + socket
+	recoverConnect = "unix:" + socket
+	recoverShardSize = 1
+	recoverLeaseTimeout = 3 * time.Second
+	recoverToken = "shared"
+	defer func() {
+		recoverWordlists = nil
+		recoverListen = "127.0.0.1:7838"
+		recoverConnect = ""
+		recoverShardSize = 256
+		recoverLeaseTimeout = 2 * time.Minute
+		recoverToken = ""
+	}()
+
+	collect, restore := captureOutput()
+	defer restore()
+
+	coordinatorErr := make(chan error, 1)
+	go func() {
+		coordinatorErr <- runRecoverCoordinator(&cobra.Command{Use: "coordinator"}, []string{encrypted})
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("coordinator socket did not appear")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected owner-only socket, got %v", info.Mode().Perm())
+	}
+
+	if err := runRecoverWorker(&cobra.Command{Use: "worker"}, nil); err != nil {
+		t.Fatalf("runRecoverWorker returned error: %v", err)
+	}
+	if err := <-coordinatorErr; err != nil {
+		t.Fatalf("runRecoverCoordinator returned error: %v", err)
+	}
+
+	output := string(collect())
+	if !strings.Contains(output, "Passphrase: TestingOneTwoThree") {
+		t.Fatalf("expected coordinator to report the passphrase, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Search finished:") {
+		t.Fatalf("expected worker summary, got:\n%s", output)
+	}
+}
+
+func TestCheckRecoverListenRequiresTokenOffLoopback(t *testing.T) {
+	for _, listen := range []string{"0.0.0.0:7838", ":7838", "tcp:192.0.2.10:7838", "[::]:7838"} {
+		var appErr *errors.AppError
+		if err := checkRecoverListen(listen, ""); !stderrors.As(err, &appErr) || appErr.Type != errors.ValidationError {
+			t.Fatalf("%s without a token: expected validation error, got %v", listen, err)
+		}
+		if err := checkRecoverListen(listen, "shared"); err != nil {
+			t.Fatalf("%s with a token: unexpected error %v", listen, err)
+		}
+	}
+	for _, listen := range []string{"127.0.0.1:7838", "tcp:[::1]:7838", "localhost:7838", "unix:/tmp/recover.sock"} {
+		if err := checkRecoverListen(listen, ""); err != nil {
+			t.Fatalf("%s without a token: unexpected error %v", listen, err)
+		}
+	}
+}
+
+func readManifest(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid manifest line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRunBatchDecryptRecordsFailuresPerRow(t *testing.T) {
+	const encrypted = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+	const wif = "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR"
+
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	prompts := 0
+	readPassword = func(int) ([]byte, error) {
+		prompts++
+		return []byte("TestingOneTwoThree"), nil
+	}
+	t.Setenv("BATCH_CLI_PASS", "TestingOneTwoThree")
+	t.Setenv("BATCH_CLI_WRONG", "wrong")
+
+	dir := t.TempDir()
+	input := dir + "/keys.csv"
+	csv := "key,label,passphrase_ref\n" +
+		encrypted + ",from-env,env:BATCH_CLI_PASS\n" +
+		encrypted + ",wrong,env:BATCH_CLI_WRONG\n" +
+		"6Pnot-a-key,broken,env:BATCH_CLI_PASS\n" +
+		encrypted + ",prompted,\n"
+	if err := os.WriteFile(input, []byte(csv), 0o600); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	batchManifest = dir + "/manifest.jsonl"
+	batchWorkers = 2
+	defer func() {
+		batchManifest = ""
+		batchWorkers = 0
+	}()
+
+	cmd := &cobra.Command{Use: "decrypt"}
+	cmd.Flags().String("output-format", "text", "")
+	collect, restore := captureOutput()
+	defer restore()
+
+	err := runBatchDecrypt(cmd, []string{input})
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 rows failed") {
+		t.Fatalf("expected two failed rows, got %v", err)
+	}
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) || appErr.Type != errors.SystemError ||
+		fmt.Sprint(appErr.Context["error_types"]) != "map[crypto:1 validation:1]" {
+		t.Fatalf("expected mixed failures to be typed as system with counts, got %v %v", err, appErr.Context)
+	}
+	if !strings.Contains(string(collect()), "Processed 4 rows: 2 ok, 2 failed") {
+		t.Fatal("expected summary in output")
+	}
+	if prompts != 1 {
+		t.Fatalf("expected one passphrase prompt, got %d", prompts)
+	}
+
+	info, err := os.Stat(batchManifest)
+	if err != nil {
+		t.Fatalf("failed to stat manifest: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("manifest permissions = %o, want 600", info.Mode().Perm())
+	}
+
+	entries := readManifest(t, batchManifest)
+	wantStatus := []string{"ok", "error", "error", "ok"}
+	wantLabel := []string{"from-env", "wrong", "broken", "prompted"}
+	if len(entries) != len(wantStatus) {
+		t.Fatalf("got %d manifest entries, want %d", len(entries), len(wantStatus))
+	}
+	for i, entry := range entries {
+		if entry["status"] != wantStatus[i] || entry["label"] != wantLabel[i] {
+			t.Fatalf("entry %d = %v", i, entry)
+		}
+		if entry["row"] != float64(i+2) {
+			t.Fatalf("entry %d row = %v, want %d", i, entry["row"], i+2)
+		}
+		if entry["status"] == "ok" && entry["private_key"] != wif {
+			t.Fatalf("entry %d private key = %v", i, entry["private_key"])
+		}
+	}
+	if !strings.Contains(entries[1]["error"].(string), "incorrect passphrase") {
+		t.Fatalf("expected incorrect passphrase error, got %v", entries[1]["error"])
+	}
+}
+
+func TestRunBatchTypesFailuresFromRows(t *testing.T) {
+	t.Setenv("BATCH_CLI_PASS", "TestingOneTwoThree")
+	dir := t.TempDir()
+	input := dir + "/keys.csv"
+	csv := "id,key,passphrase_ref\n" +
+		"1,6Pnot-a-key,env:BATCH_CLI_PASS\n" +
+		"2,,env:BATCH_CLI_PASS\n"
+	if err := os.WriteFile(input, []byte(csv), 0o600); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	cmd := &cobra.Command{Use: "decrypt"}
+	cmd.Flags().String("output-format", "text", "")
+	collect, restore := captureOutput()
+	err := runBatchDecrypt(cmd, []string{input})
+	collect()
+	restore()
+
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) || appErr.Type != errors.ValidationError || !strings.Contains(err.Error(), "2 of 2 rows failed") {
+		t.Fatalf("expected a validation error for malformed rows, got %v", err)
+	}
+}
+
+func TestRunBatchEncryptRoundTrip(t *testing.T) {
+	const wif = "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR"
+
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	readPassword = func(int) ([]byte, error) {
+		return []byte("plinth-cobalt-marmoset-quibble"), nil
+	}
+
+	dir := t.TempDir()
+	input := dir + "/keys.jsonl"
+	if err := os.WriteFile(input, []byte(`{"key":"`+wif+`","label":"cold"}`+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	batchManifest = dir + "/manifest.jsonl"
+	defer func() { batchManifest = "" }()
+
+	cmd := &cobra.Command{Use: "encrypt"}
+	cmd.Flags().String("output-format", "text", "")
+	if err := cmd.Flags().Set("output-format", "json"); err != nil {
+		t.Fatalf("failed to set output-format flag: %v", err)
+	}
+	collect, restore := captureOutput()
+	defer restore()
+
+	if err := runBatchEncrypt(cmd, []string{input}); err != nil {
+		t.Fatalf("runBatchEncrypt returned error: %v", err)
+	}
+	output := string(collect())
+	if !strings.Contains(output, `"ok": 1`) {
+		t.Fatalf("expected JSON summary, got %q", output)
+	}
+
+	entries := readManifest(t, batchManifest)
+	if len(entries) != 1 || entries[0]["status"] != "ok" || entries[0]["label"] != "cold" {
+		t.Fatalf("unexpected manifest: %v", entries)
+	}
+	if strings.Contains(fmt.Sprint(entries[0]), wif) {
+		t.Fatal("manifest must not repeat the input WIF")
+	}
+
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: entries[0]["encrypted_key"].(string),
+		Passphrase:   []byte("plinth-cobalt-marmoset-quibble"),
+	})
+	if err != nil {
+		t.Fatalf("failed to decrypt batch output: %v", err)
+	}
+	if decrypted.WIF.String() != wif || decrypted.Address != entries[0]["address"] {
+		t.Fatalf("round trip mismatch: %s %s", decrypted.WIF.String(), decrypted.Address)
+	}
+}
+
+func TestRunBatchEncryptChecksPassphraseStrength(t *testing.T) {
+	const wif = "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR"
+
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	readPassword = func(int) ([]byte, error) {
+		return []byte("password1"), nil
+	}
+	t.Setenv("BATCH_CLI_WEAK", "password1")
+	t.Setenv("BATCH_CLI_STRONG", "plinth-cobalt-marmoset-quibble")
+
+	dir := t.TempDir()
+	batchManifest = dir + "/manifest.jsonl"
+	defer func() { batchManifest = "" }()
+	run := func(rows string) error {
+		input := dir + "/keys.csv"
+		if err := os.WriteFile(input, []byte(rows), 0o600); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+		cmd := &cobra.Command{Use: "encrypt"}
+		cmd.Flags().String("output-format", "text", "")
+		collect, restore := captureOutput()
+		defer restore()
+		err := runBatchEncrypt(cmd, []string{input})
+		collect()
+		return err
+	}
+
+	var appErr *errors.AppError
+	err := run(wif + ",weak,env:BATCH_CLI_WEAK\n" + wif + ",strong,env:BATCH_CLI_STRONG\n")
+	if !stderrors.As(err, &appErr) || appErr.Type != errors.ValidationError || !strings.Contains(err.Error(), "1 of 2 rows failed") {
+		t.Fatalf("expected the weak row to fail validation, got %v", err)
+	}
+	entries := readManifest(t, batchManifest)
+	if len(entries) != 2 || entries[0]["status"] != "error" || !strings.Contains(entries[0]["error"].(string), "too weak") || entries[1]["status"] != "ok" {
+		t.Fatalf("unexpected manifest: %v", entries)
+	}
+
+	if err := run(wif + ",prompted,\n"); !stderrors.As(err, &appErr) || !strings.Contains(appErr.Message, "too weak") {
+		t.Fatalf("expected a weak prompted passphrase to stop the run, got %v", err)
+	}
+
+	allowWeakPassphrases(t)
+	if err := run(wif + ",weak,env:BATCH_CLI_WEAK\n" + wif + ",prompted,\n"); err != nil {
+		t.Fatalf("--allow-weak: %v", err)
+	}
+}
+
+func TestServeEndpoints(t *testing.T) {
+	const encrypted = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+	const wif = "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR"
+
+	handler := newServeServer(server.Config{MaxConcurrent: 2})
+	post := func(path, body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var payload map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("%s: invalid JSON response %q: %v", path, rec.Body.String(), err)
+		}
+		return rec.Code, payload
+	}
+
+	status, payload := post("/v1/decrypt", `{"encrypted_key":"`+encrypted+`","passphrase":"TestingOneTwoThree"}`)
+	if status != http.StatusOK || payload["private_key"] != wif || payload["network"] != "mainnet" {
+		t.Fatalf("decrypt: %d %v", status, payload)
+	}
+
+	status, payload = post("/v1/decrypt", `{"encrypted_key":"`+encrypted+`","passphrase":"wrong"}`)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong passphrase: status = %d, want 422 (%v)", status, payload)
+	}
+	if errBody := payload["error"].(map[string]any); errBody["type"] != "crypto" || !strings.Contains(errBody["cause"].(string), "incorrect passphrase") {
+		t.Fatalf("wrong passphrase error body: %v", errBody)
+	}
+
+	status, payload = post("/v1/encrypt", `{"wif":"`+wif+`","passphrase":"TestingOneTwoThree","allow_weak":true}`)
+	if status != http.StatusOK || payload["encrypted_key"] != encrypted {
+		t.Fatalf("encrypt: %d %v", status, payload)
+	}
+	for path, body := range map[string]string{
+		"/v1/encrypt":               `{"wif":"` + wif + `","passphrase":"TestingOneTwoThree"}`,
+		"/v1/intermediate/generate": `{"passphrase":"a"}`,
+	} {
+		status, payload := post(path, body)
+		if errBody, _ := payload["error"].(map[string]any); status != http.StatusBadRequest || errBody["type"] != "validation" {
+			t.Fatalf("%s with a weak passphrase: %d %v, want 400", path, status, payload)
+		}
+	}
+
+	for _, body := range []string{
+		`{"wif":"` + wif + `"}`,
+		`{"wif":"not-a-wif","passphrase":"x"}`,
+		`{"wif":"` + wif + `","passphrase":"x","network":"nowhere"}`,
+		`not json`,
+	} {
+		if status, payload := post("/v1/encrypt", body); status != http.StatusBadRequest {
+			t.Fatalf("encrypt %s: status = %d, want 400 (%v)", body, status, payload)
+		}
+	}
+
+	status, payload = post("/v1/inspect", `{"wif":"`+wif+`","address_type":"bip44"}`)
+	if status != http.StatusOK || payload["address"] != "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB" {
+		t.Fatalf("inspect: %d %v", status, payload)
+	}
+	if _, leaked := payload["wif"]; leaked {
+		t.Fatal("inspect must not echo the WIF")
+	}
+
+	status, payload = post("/v1/intermediate/generate", `{"passphrase":"TestingOneTwoThree","lot":1}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("generate with lot only: status = %d, want 400 (%v)", status, payload)
+	}
+}
+
+func TestRPCMethods(t *testing.T) {
+	const encrypted = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+	const wif = "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR"
+
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"decrypt","params":{"encrypted_key":"` + encrypted + `","passphrase":"TestingOneTwoThree"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"decrypt","params":{"encrypted_key":"` + encrypted + `","passphrase":"wrong"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"wallet.inspect","params":{"wif":"` + wif + `","address_type":"bip44"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"wallet.generate","params":{"network":"testnet","show_address":true}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"intermediate.validate","params":{"intermediate_code":"passphrase"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"wallet.inspect","params":{"wif":"` + wif + `","network":"nowhere"}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"metrics"}`,
+		`{"jsonrpc":"2.0","id":8,"method":"wallet.generate","params":{"network":"testnet","passphrase":"a"}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"wallet.generate","params":{"network":"testnet","passphrase":"a","allow_weak":true}}`,
+	}
+	var out bytes.Buffer
+	if err := newRPCServer().Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	type reply struct {
+		ID     int            `json:"id"`
+		Result map[string]any `json:"result"`
+		Error  *struct {
+			Code int            `json:"code"`
+			Data map[string]any `json:"data"`
+		} `json:"error"`
+	}
+	var replies []reply
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r reply
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid reply %q: %v", line, err)
+		}
+		replies = append(replies, r)
+	}
+	if len(replies) != len(requests) {
+		t.Fatalf("got %d replies, want %d", len(replies), len(requests))
+	}
+
+	if r := replies[0]; r.Error != nil || r.Result["private_key"] != wif || r.Result["network"] != "mainnet" {
+		t.Fatalf("decrypt reply %+v", r)
+	}
+	if r := replies[1]; r.Error == nil || r.Error.Code != -32000 || r.Error.Data["type"] != "crypto" {
+		t.Fatalf("wrong passphrase reply %+v", r)
+	}
+	if r := replies[2]; r.Error != nil || r.Result["address"] != "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB" {
+		t.Fatalf("inspect reply %+v", r)
+	}
+	if r := replies[3]; r.Error != nil || r.Result["network"] != "testnet3" || r.Result["wif"] == nil || r.Result["address"] == nil {
+		t.Fatalf("wallet.generate reply %+v", r)
+	}
+	if r := replies[4]; r.Error == nil || r.Error.Data["type"] != "validation" {
+		t.Fatalf("intermediate.validate reply %+v", r)
+	}
+	if r := replies[5]; r.Error == nil || r.Error.Data["context"].(map[string]any)["network"] != "nowhere" {
+		t.Fatalf("bad network reply %+v", r)
+	}
+	if r := replies[6]; r.Error != nil || r.Result["decrypt_count"] == nil {
+		t.Fatalf("metrics reply %+v", r)
+	}
+	if r := replies[7]; r.Error == nil || r.Error.Data["type"] != "validation" {
+		t.Fatalf("wallet.generate with a weak passphrase reply %+v", r)
+	}
+	if r := replies[8]; r.Error != nil || r.Result["bip38_encrypted_key"] == nil {
+		t.Fatalf("wallet.generate with allow_weak reply %+v", r)
+	}
+}
+
+func TestMetricsExport(t *testing.T) {
+	metrics.Reset()
+	defer metrics.Reset()
+
+	textfile := filepath.Join(t.TempDir(), "bip38cli.prom")
+	metricsTextfile, metricsListen, metricsInterval = textfile, "tcp:127.0.0.1:0", time.Hour
+	defer func() { metricsTextfile, metricsListen, metricsInterval = "", "", 15*time.Second }()
+
+	if err := startMetricsExport(); err != nil {
+		t.Fatalf("startMetricsExport: %v", err)
+	}
+	if _, err := os.Stat(textfile); err != nil {
+		t.Fatalf("textfile not written at start: %v", err)
+	}
+
+	metrics.NewTimer("decrypt").StopWithError(errors.NewCryptoError("decryption failed", nil))
+	resp, err := http.Get("http://" + activeMetricsExport.listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `bip38cli_operation_errors_total{operation="decrypt",type="crypto"} 1`) {
+		t.Fatalf("endpoint output lacks the decrypt failure:\n%s", body)
+	}
+
+	stopMetricsExport()
+	data, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(data), `bip38cli_operations_total{operation="decrypt"} 1`) {
+		t.Fatalf("final textfile lacks the decrypt count:\n%s", data)
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "2026-10-01T08:30:00Z", want: time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2026-10-01", want: time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "7d", want: now.AddDate(0, 0, -7)},
+		{value: "-1h", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeBound(tt.value, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("parseTimeBound(%q) succeeded, want error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Fatalf("parseTimeBound(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestMetricsStoreCommands(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv(metricsStoreEnv, "1")
+	defer func() { metricsSince, metricsUntil = "", "" }()
+	defer metrics.SetStore(nil)
+
+	if err := startMetricsStore(); err != nil {
+		t.Fatalf("startMetricsStore: %v", err)
+	}
+	metrics.NewTimer("encrypt").Stop(true)
+	metrics.NewTimer("decrypt").StopWithError(errors.NewCryptoError("decryption failed", nil))
+	metrics.Reset()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-format", "json", "")
+	_ = cmd.Flags().Set("output-format", "json")
+
+	collect, restore := captureOutput()
+	err := runMetrics(cmd, nil)
+	out := collect()
+	restore()
+	if err != nil {
+		t.Fatalf("runMetrics: %v", err)
+	}
+	var snap map[string]any
+	if err := json.Unmarshal(out, &snap); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if snap["encrypt_count"] != float64(1) || snap["decrypt_errors"] != float64(1) {
+		t.Fatalf("stored metrics were not aggregated across runs: %v", snap)
+	}
+
+	metricsSince = "2000-01-01"
+	metricsUntil = "2000-01-02"
+	collect, restore = captureOutput()
+	err = runMetricsExport(cmd, nil)
+	out = collect()
+	restore()
+	if err != nil || len(bytes.TrimSpace(out)) != 0 {
+		t.Fatalf("export outside the window: %q, %v", out, err)
+	}
+
+	metricsSince, metricsUntil = "", ""
+	collect, restore = captureOutput()
+	err = runMetricsExport(cmd, nil)
+	out = collect()
+	restore()
+	if err != nil || len(strings.Split(strings.TrimSpace(string(out)), "\n")) != 2 {
+		t.Fatalf("export: %q, %v", out, err)
+	}
+
+	collect, restore = captureOutput()
+	err = runMetricsReset(cmd, nil)
+	out = collect()
+	restore()
+	if err != nil || !strings.Contains(string(out), `"removed": 2`) {
+		t.Fatalf("reset: %q, %v", out, err)
+	}
+}
+
+func TestLibraryEventsReachMetrics(t *testing.T) {
+	metrics.Reset()
+	defer metrics.Reset()
+
+	if _, err := bip38.GenerateWIF(&chaincfg.TestNet3Params, true); err != nil {
+		t.Fatalf("GenerateWIF: %v", err)
+	}
+	if _, err := bip38.Confirm(bip38.ConfirmOptions{ConfirmationCode: "cfrm38-invalid", Passphrase: []byte("x")}); err == nil {
+		t.Fatal("Confirm accepted an invalid code")
+	}
+
+	stats := metrics.GetMetrics().Operations()
+	if len(stats) != 2 || stats[0].Operation != "confirm" || stats[0].ErrorTypes["validation"] != 1 {
+		t.Fatalf("confirm event not recorded as a validation failure: %+v", stats)
+	}
+	if stats[1].Operation != "generate_wif" || stats[1].Labels["network"] != "testnet3" || stats[1].Labels["compressed"] != "true" {
+		t.Fatalf("generate_wif event lacks its labels: %+v", stats)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-format", "text", "")
+	collect, restore := captureOutput()
+	err := runMetrics(cmd, nil)
+	out := string(collect())
+	restore()
+	if err != nil {
+		t.Fatalf("runMetrics: %v", err)
+	}
+	for _, line := range []string{
+		"Confirm - count: 1  errors: 1",
+		"Encrypt - count: 0  errors: 0",
+		"Generate_wif - count: 1  errors: 0",
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("metrics output lacks %q:\n%s", line, out)
+		}
+	}
+
+	if got := libraryErrorType(fmt.Errorf("confirm: %w", bip38.ErrIncorrectPassphrase)); got != errors.CryptoError {
+		t.Fatalf("wrong passphrase typed as %s, want crypto", got)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLogPath = path
+	defer func() { auditLogPath = "" }()
+
+	if err := startAuditLog("bip38cli encrypt"); err != nil {
+		t.Fatalf("startAuditLog: %v", err)
+	}
+	wif, err := btcutil.DecodeWIF("5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR")
+	if err != nil {
+		t.Fatalf("DecodeWIF: %v", err)
+	}
+	encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: []byte("TestingOneTwoThree")})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if _, err := bip38.Decrypt(bip38.DecryptOptions{EncryptedKey: encrypted.EncryptedKey, Passphrase: []byte("wrong")}); err == nil {
+		t.Fatal("Decrypt accepted a wrong passphrase")
+	}
+	stopAuditLog()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for _, secret := range []string{"TestingOneTwoThree", "wrong\"", wif.String(), encrypted.EncryptedKey} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("audit log contains %q:\n%s", secret, data)
+		}
+	}
+	for _, field := range []string{`"command":"bip38cli encrypt"`, `"fingerprint":"1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB"`, `"result":"failure"`} {
+		if !strings.Contains(string(data), field) {
+			t.Fatalf("audit log lacks %s:\n%s", field, data)
+		}
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-format", "json", "")
+	_ = cmd.Flags().Set("output-format", "json")
+
+	collect, restore := captureOutput()
+	err = runAuditVerify(cmd, nil)
+	out := collect()
+	restore()
+	if err != nil || !strings.Contains(string(out), `"valid": true`) || !strings.Contains(string(out), `"entries": 2`) {
+		t.Fatalf("audit verify: %s, %v", out, err)
+	}
+
+	tampered := strings.Replace(string(data), `"result":"failure"`, `"result":"success"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	collect, restore = captureOutput()
+	err = runAuditVerify(cmd, []string{path})
+	out = collect()
+	restore()
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) || appErr.Context["line"] != 2 || !strings.Contains(string(out), `"valid": false`) {
+		t.Fatalf("audit verify of an edited log: %s, %v", out, err)
+	}
+}
+
+func TestRunPaper(t *testing.T) {
+	dir := t.TempDir()
+	defer func() {
+		paperAddress, paperConfirmationCode, paperLabel = "", "", ""
+		paperSVG, paperPDF, paperQRLevel = "", "", "M"
+	}()
+
+	render := func(args ...string) ([]byte, error) {
+		collect, restore := captureOutput()
+		err := runPaper(&cobra.Command{}, args)
+		out := collect()
+		restore()
+		return out, err
+	}
+
+	paperAddress = "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh"
+	paperConfirmationCode = "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD"
+	paperLabel = "Lot test"
+	paperQRLevel = "M"
+	paperSVG = filepath.Join(dir, "first.svg")
+	paperPDF = filepath.Join(dir, "first.pdf")
+	key := "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j"
+	out, err := render(key)
+	if err != nil {
+		t.Fatalf("runPaper: %v", err)
+	}
+	if !strings.Contains(string(out), "Lot/sequence:      263183/1") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	paperSVG = filepath.Join(dir, "second.svg")
+	paperPDF = filepath.Join(dir, "second.pdf")
+	if _, err := render(key); err != nil {
+		t.Fatalf("runPaper: %v", err)
+	}
+	for _, ext := range []string{"svg", "pdf"} {
+		first, err := os.ReadFile(filepath.Join(dir, "first."+ext))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		second, _ := os.ReadFile(filepath.Join(dir, "second."+ext))
+		if !bytes.Equal(first, second) {
+			t.Fatalf("%s output is not reproducible", ext)
+		}
+		if !bytes.Contains(first, []byte("Lot 263183  Sequence 1")) || !bytes.Contains(first, []byte("CONFIRMATION CODE")) {
+			t.Fatalf("%s lacks the EC-multiply details", ext)
+		}
+	}
+
+	paperAddress = "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB"
+	var appErr *errors.AppError
+	if _, err := render(key); !stderrors.As(err, &appErr) || appErr.Type != errors.ValidationError {
+		t.Fatalf("mismatched address: %v", err)
+	}
+
+	paperConfirmationCode = ""
+	if _, err := render("6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"); err != nil {
+		t.Fatalf("runPaper without confirmation code: %v", err)
+	}
+	paperConfirmationCode = "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD"
+	if _, err := render("6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"); err == nil {
+		t.Fatal("accepted a confirmation code of another key")
+	}
+
+	paperSVG, paperPDF = "", ""
+	if _, err := render(key); err == nil {
+		t.Fatal("rendered without an output file")
+	}
+}
+
+func TestRunPaperGenerateChecksPassphrase(t *testing.T) {
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	readPassword = func(int) ([]byte, error) {
+		t.Fatal("prompted for a passphrase despite a source")
+		return nil, nil
+	}
+	defer func() { paperGenerate, paperSVG, passphraseEnv = false, "", "" }()
+
+	render := func() error {
+		collect, restore := captureOutput()
+		err := runPaper(&cobra.Command{}, nil)
+		collect()
+		restore()
+		return err
+	}
+
+	t.Setenv("BIP38CLI_TEST_PASS", "password1")
+	passphraseEnv = "BIP38CLI_TEST_PASS"
+	paperGenerate = true
+	paperSVG = filepath.Join(t.TempDir(), "wallet.svg")
+	var appErr *errors.AppError
+	if err := render(); !stderrors.As(err, &appErr) || appErr.Type != errors.ValidationError {
+		t.Fatalf("weak passphrase: expected validation error, got %v", err)
+	}
+	if _, err := os.Stat(paperSVG); !os.IsNotExist(err) {
+		t.Fatalf("wallet written with a weak passphrase: %v", err)
+	}
+
+	t.Setenv("BIP38CLI_TEST_PASS", "plinth-cobalt-marmoset-quibble")
+	if err := render(); err != nil {
+		t.Fatalf("runPaper --generate: %v", err)
+	}
+	if _, err := os.Stat(paperSVG); err != nil {
+		t.Fatalf("wallet not written: %v", err)
+	}
+}
+
+// writeQRImage renders payloads as QR codes side by side into a PNG or,
+// for a .jpg path, a JPEG file.
+func writeQRImage(t *testing.T, path string, payloads ...string) {
+	t.Helper()
+	const scale, border = 4, 4
+	var codes []*qr.Code
+	width, height := 0, 0
+	for _, payload := range payloads {
+		code, err := qr.Encode([]byte(payload), qr.M)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		codes = append(codes, code)
+		width += (code.Size + 2*border) * scale
+		height = max(height, (code.Size+2*border)*scale)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	left := 0
+	for _, code := range codes {
+		for y := 0; y < code.Size*scale; y++ {
+			for x := 0; x < code.Size*scale; x++ {
+				if code.Black(x/scale, y/scale) {
+					img.SetGray(left+border*scale+x, border*scale+y, color.Gray{})
+				}
+			}
+		}
+		left += (code.Size + 2*border) * scale
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if strings.HasSuffix(path, ".jpg") {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestRunWithQRImage(t *testing.T) {
+	dir := t.TempDir()
+	origReadPassword := readPassword
+	defer func() {
+		readPassword = origReadPassword
+		decryptQRImage, encryptIntermediateQRImage, confirmQRImages = "", "", nil
+	}()
+	passphrase := "TestingOneTwoThree"
+	readPassword = func(int) ([]byte, error) { return []byte(passphrase), nil }
+
+	run := func(runE func(*cobra.Command, []string) error, args ...string) (string, error) {
+		collect, restore := captureOutput()
+		err := runE(&cobra.Command{}, args)
+		out := collect()
+		restore()
+		return string(out), err
+	}
+	errorType := func(err error) errors.ErrorType {
+		var appErr *errors.AppError
+		if !stderrors.As(err, &appErr) {
+			t.Fatalf("expected an AppError, got %v", err)
+		}
+		return appErr.Type
+	}
+
+	// A paper wallet scan: the address code is skipped, the key is used.
+	wallet := filepath.Join(dir, "wallet.png")
+	writeQRImage(t, wallet, "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB", "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg")
+	decryptQRImage = wallet
+	out, err := run(runDecrypt)
+	if err != nil {
+		t.Fatalf("decrypt --qr-image: %v", err)
+	}
+	if !strings.Contains(out, "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR") {
+		t.Fatalf("unexpected decrypt output: %s", out)
+	}
+	if _, err := run(runDecrypt, "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"); err == nil {
+		t.Fatal("decrypt accepted both an argument and --qr-image")
+	}
+
+	addressOnly := filepath.Join(dir, "address.png")
+	writeQRImage(t, addressOnly, "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB")
+	decryptQRImage = addressOnly
+	if _, err := run(runDecrypt); errorType(err) != errors.ValidationError {
+		t.Fatalf("image without a key: %v", err)
+	}
+
+	twoKeys := filepath.Join(dir, "two.png")
+	writeQRImage(t, twoKeys, "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg", "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j")
+	decryptQRImage = twoKeys
+	if _, err := run(runDecrypt); err == nil || !strings.Contains(err.Error(), "2 different values") {
+		t.Fatalf("image with two keys: %v", err)
+	}
+
+	blank := filepath.Join(dir, "blank.png")
+	if err := png.Encode(mustCreate(t, blank), image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	decryptQRImage = blank
+	if _, err := run(runDecrypt); errorType(err) != errors.InputError {
+		t.Fatalf("image without QR codes: %v", err)
+	}
+	decryptQRImage = filepath.Join(dir, "missing.png")
+	if _, err := run(runDecrypt); errorType(err) != errors.InputError {
+		t.Fatalf("missing image: %v", err)
+	}
+	decryptQRImage = ""
+
+	intermediate := filepath.Join(dir, "intermediate.jpg")
+	writeQRImage(t, intermediate, "passphraseoRDGAXTWzbp72eVbtUDdn1rwpgPUGjNZEc6CGBo8i5EC1FPW8wcnLdq4ThKzAS")
+	encryptIntermediateQRImage = intermediate
+	if out, err := run(runEncryptIntermediate); err != nil || !strings.Contains(out, "Confirmation code: cfrm38") {
+		t.Fatalf("intermediate encrypt --qr-image: %v\n%s", err, out)
+	}
+
+	passphrase = "MOLON LABE"
+	confirmation := filepath.Join(dir, "confirmation.png")
+	writeQRImage(t, confirmation, "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD", "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh")
+	confirmQRImages = []string{confirmation}
+	out, err = run(runConfirmIntermediate)
+	if err != nil || !strings.Contains(out, "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh") {
+		t.Fatalf("intermediate confirm --qr-image: %v\n%s", err, out)
+	}
+	confirmQRImages = []string{confirmation, wallet}
+	if _, err := run(runConfirmIntermediate); errorType(err) != errors.ValidationError {
+		t.Fatalf("image without confirmation codes: %v", err)
+	}
+}
+
+func mustCreate(t *testing.T, path string) *os.File {
+	t.Helper()
+	file, err := os.Create(path) //nolint:gosec
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { _ = file.Close() })
+	return file
+}
+
+func TestRunEncryptIntermediateBulk(t *testing.T) {
+	dir := t.TempDir()
+	origReadPassword := readPassword
+	defer func() {
+		readPassword = origReadPassword
+		encryptIntermediateCount, encryptIntermediateWorkers = 1, 0
+		encryptIntermediateManifest, encryptIntermediateManifestFormat = "", batch.FormatAuto
+		encryptIntermediatePaperDir, encryptIntermediatePaperFormat = "", "pdf"
+	}()
+	readPassword = func(int) ([]byte, error) {
+		t.Fatal("bulk generation asked for the passphrase")
+		return nil, nil
+	}
+
+	// Intermediate code for "MOLON LABE" with lot 263183, sequence 1.
+	code := "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvuR1hy25aTu5sX"
+	encryptIntermediateCount = 7
+	encryptIntermediateWorkers = 3
+	encryptIntermediateManifest = filepath.Join(dir, "keys.csv")
+	encryptIntermediatePaperDir = filepath.Join(dir, "wallets")
+	encryptIntermediatePaperFormat = "svg"
+
+	collect, restore := captureOutput()
+	err := runEncryptIntermediate(&cobra.Command{}, []string{code})
+	out := collect()
+	restore()
+	if err != nil {
+		t.Fatalf("runEncryptIntermediate: %v", err)
+	}
+	if !strings.Contains(string(out), "Generated 7 keys: 7 ok, 0 failed") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	file, err := os.Open(encryptIntermediateManifest)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("manifest is not CSV: %v", err)
+	}
+	if strings.Join(records[0], ",") != strings.Join(intermediateManifestColumns, ",") || len(records) != 8 {
+		t.Fatalf("unexpected manifest layout: %q", records)
+	}
+	seen := map[string]bool{}
+	for i, record := range records[1:] {
+		entry := map[string]string{}
+		for j, column := range records[0] {
+			entry[column] = record[j]
+		}
+		if entry["row"] != fmt.Sprint(i+1) || entry["status"] != "ok" {
+			t.Fatalf("row %d out of order or failed: %v", i+1, entry)
+		}
+		if entry["lot_number"] != "263183" || entry["sequence_number"] != "1" || entry["compressed"] != "true" {
+			t.Fatalf("row %d has wrong details: %v", i+1, entry)
+		}
+		if seen[entry["encrypted_key"]] {
+			t.Fatalf("row %d repeats a key", i+1)
+		}
+		seen[entry["encrypted_key"]] = true
+
+		info, err := bip38.InspectConfirmationCode(entry["confirmation_code"])
+		if err != nil || !info.MatchesAddress(entry["address"]) {
+			t.Fatalf("row %d: confirmation code does not match the address: %v", i+1, err)
+		}
+		svg, err := os.ReadFile(entry["paper"])
+		if err != nil || !bytes.Contains(svg, []byte(entry["address"])) || !bytes.Contains(svg, []byte(fmt.Sprintf("No. %d", i+1))) {
+			t.Fatalf("row %d: paper wallet %s is missing or wrong: %v", i+1, entry["paper"], err)
+		}
+	}
+	if filepath.Base(records[7][len(records[7])-2]) != "wallet-7.svg" {
+		t.Fatalf("unexpected paper file name %q", records[7][len(records[7])-2])
+	}
+
+	encryptIntermediateCount = 0
+	if err := runEncryptIntermediate(&cobra.Command{}, []string{code}); err == nil {
+		t.Fatal("accepted a count of zero")
+	}
+}
+
+func TestRunVerifyManifest(t *testing.T) {
+	dir := t.TempDir()
+	origReadPassword := readPassword
+	defer func() {
+		readPassword = origReadPassword
+		encryptIntermediateCount, encryptIntermediateManifest = 1, ""
+		verifyManifestIntermediate = ""
+	}()
+	readPassword = func(int) ([]byte, error) { return []byte("MOLON LABE"), nil }
+
+	// Intermediate code for "MOLON LABE" with lot 263183, sequence 1.
+	code := "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvuR1hy25aTu5sX"
+	manifest := filepath.Join(dir, "keys.jsonl")
+	encryptIntermediateCount, encryptIntermediateManifest = 3, manifest
+	_, restore := captureOutput()
+	err := runEncryptIntermediate(&cobra.Command{}, []string{code})
+	restore()
+	if err != nil {
+		t.Fatalf("runEncryptIntermediate: %v", err)
+	}
+
+	verify := func(intermediate string) (manifestReport, error) {
+		t.Helper()
+		verifyManifestIntermediate = intermediate
+		cmd := &cobra.Command{}
+		cmd.Flags().String("output-format", "text", "")
+		_ = cmd.Flags().Set("output-format", "json")
+		collect, restore := captureOutput()
+		err := runVerifyManifest(cmd, []string{manifest})
+		out := collect()
+		restore()
+		var report manifestReport
+		start := bytes.IndexByte(out, '{')
+		if start < 0 {
+			t.Fatalf("no JSON report in %q (%v)", out, err)
+		}
+		if jsonErr := json.Unmarshal(out[start:], &report); jsonErr != nil {
+			t.Fatalf("report is not JSON: %v\n%s", jsonErr, out)
+		}
+		return report, err
+	}
+
+	report, err := verify(code)
+	if err != nil || !report.SignedOff || report.Verified != 3 || len(report.Rows) != 3 {
+		t.Fatalf("clean manifest: %+v, %v", report, err)
+	}
+	data, _ := os.ReadFile(manifest)
+	if sum := sha256.Sum256(data); report.ManifestSHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("report names the wrong manifest digest %s", report.ManifestSHA256)
+	}
+
+	// Tamper: swap row 2's address for row 1's, drop row 3's lot number and
+	// repeat row 1 at the end.
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var rows []map[string]any
+	for _, line := range lines {
+		var row map[string]any
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("manifest line is not JSON: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	rows[1]["address"] = rows[0]["address"]
+	rows[2]["lot_number"] = 7
+	rows = append(rows, rows[0])
+	var tampered bytes.Buffer
+	for _, row := range rows {
+		line, _ := json.Marshal(row)
+		tampered.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(manifest, tampered.Bytes(), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	report, err = verify(code)
+	if err == nil || report.SignedOff || report.Verified != 1 || report.Mismatched != 3 {
+		t.Fatalf("tampered manifest: %+v, %v", report, err)
+	}
+	expect := map[int]string{2: "claimed address", 3: "claimed lot/sequence 7/1", 4: "encrypted_key repeats line 1"}
+	for line, want := range expect {
+		issues := strings.Join(report.Rows[line-1].Issues, "; ")
+		if report.Rows[line-1].Status != manifestMismatch || !strings.Contains(issues, want) {
+			t.Fatalf("line %d: issues %q, want %q", line, issues, want)
+		}
+	}
+
+	// A manifest checked against another intermediate code is not signed off.
+	report, err = verify("passphraseoRDGAXTWzbp72eVbtUDdn1rwpgPUGjNZEc6CGBo8i5EC1FPW8wcnLdq4ThKzAS")
+	if err == nil || report.Verified != 0 || !strings.Contains(strings.Join(report.Rows[0].Issues, "; "), "not minted from the issued intermediate code") {
+		t.Fatalf("foreign intermediate code: %+v, %v", report, err)
+	}
+}
+
+func TestRunVanityIntermediate(t *testing.T) {
+	defer func() { vanityIntermediatePrefix, vanityIntermediateNetwork = "", "mainnet" }()
+
+	// Intermediate code for "MOLON LABE" with lot 263183, sequence 1.
+	code := "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvuR1hy25aTu5sX"
+	for _, prefix := range []string{"", "1O", "2abc"} {
+		vanityIntermediatePrefix = prefix
+		if err := runVanityIntermediate(&cobra.Command{}, []string{code}); err == nil {
+			t.Fatalf("accepted prefix %q", prefix)
+		}
+	}
+
+	vanityIntermediatePrefix = "1A"
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-format", "text", "")
+	_ = cmd.Flags().Set("output-format", "json")
+	collect, restore := captureOutput()
+	err := runVanityIntermediate(cmd, []string{code})
+	out := collect()
+	restore()
+	if err != nil {
+		t.Fatalf("runVanityIntermediate: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	address, _ := result["address"].(string)
+	if !strings.HasPrefix(address, "1A") {
+		t.Fatalf("address %q does not start with 1A", address)
+	}
+
+	confirmation, err := bip38.Confirm(bip38.ConfirmOptions{
+		ConfirmationCode: result["confirmation_code"].(string),
+		Passphrase:       []byte("MOLON LABE"),
+	})
+	if err != nil || confirmation.Address != address {
+		t.Fatalf("owner cannot confirm the vanity key: %v", err)
+	}
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{EncryptedKey: result["encrypted_key"].(string), Passphrase: []byte("MOLON LABE")})
+	if err != nil || decrypted.Address != address {
+		t.Fatalf("vanity key does not decrypt to its address: %v", err)
+	}
+}
+
+func TestRunWalletGenerateVanity(t *testing.T) {
+	allowWeakPassphrases(t)
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	defer func() {
+		walletVanityPrefix, walletVanitySuffix, walletVanityIgnoreCase = "", "", false
+		walletEncrypt, walletShowWIF = false, false
+		walletNetwork, walletAddressType = "mainnet", "bip84"
+	}()
+
+	run := func() map[string]any {
+		t.Helper()
+		cmd := &cobra.Command{}
+		cmd.Flags().String("output-format", "text", "")
+		_ = cmd.Flags().Set("output-format", "json")
+		collect, restore := captureOutput()
+		err := runWalletGenerate(cmd, nil)
+		out := collect()
+		restore()
+		if err != nil {
+			t.Fatalf("runWalletGenerate: %v", err)
+		}
+		var result map[string]any
+		// Passphrase prompts come before the JSON.
+		out = out[bytes.IndexByte(out, '{'):]
+		if err := json.Unmarshal(out, &result); err != nil {
+			t.Fatalf("output is not JSON: %v\n%s", err, out)
+		}
+		return result
+	}
+
+	// bip84 addresses are lowercase, so an uppercase pattern still matches.
+	walletVanityPrefix, walletVanitySuffix = "BC1QQ", "p"
+	result := run()
+	address, _ := result["address"].(string)
+	if !strings.HasPrefix(address, "bc1qq") || !strings.HasSuffix(address, "p") || result["address_type"] != "bip84" {
+		t.Fatalf("address %q (%v) does not match bc1qq...p", address, result["address_type"])
+	}
+	wif, err := btcutil.DecodeWIF(result["wif"].(string))
+	if err != nil {
+		t.Fatalf("DecodeWIF: %v", err)
+	}
+	if derived, _ := addressForKey(wif, &chaincfg.MainNetParams, addressTypeBIP84); derived != address {
+		t.Fatalf("WIF gives %s, not %s", derived, address)
+	}
+
+	// bip44, in either case, encrypted through --encrypt.
+	walletVanityPrefix, walletVanitySuffix, walletVanityIgnoreCase = "1ab", "", true
+	walletAddressType, walletEncrypt = "bip44", true
+	readPassword = func(int) ([]byte, error) { return []byte("TestingOneTwoThree"), nil }
+	result = run()
+	address, _ = result["address"].(string)
+	if !strings.HasPrefix(strings.ToLower(address), "1ab") {
+		t.Fatalf("address %q does not start with 1ab in any case", address)
+	}
+	if _, ok := result["wif"]; ok {
+		t.Fatal("plaintext WIF shown without --show-wif")
+	}
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{EncryptedKey: result["bip38_encrypted_key"].(string), Passphrase: []byte("TestingOneTwoThree")})
+	if err != nil || decrypted.Address != address {
+		t.Fatalf("encrypted vanity key does not decrypt to its address: %v", err)
+	}
+
+	// Patterns that cannot match are rejected before searching.
+	walletEncrypt, walletVanityIgnoreCase = false, false
+	for typ, prefix := range map[string]string{"bip44": "1O", "bip84": "bc1qb"} {
+		walletAddressType, walletVanityPrefix = typ, prefix
+		if err := runWalletGenerate(&cobra.Command{}, nil); err == nil {
+			t.Fatalf("%s: accepted prefix %q", typ, prefix)
+		}
+	}
+}
+
+func TestRunWalletGenerateVanityAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLogPath = path
+	defer func() { auditLogPath = "" }()
+	defer func() {
+		walletVanityPrefix, walletVanityIgnoreCase = "", false
+		walletNetwork, walletAddressType = "mainnet", "bip84"
+	}()
+
+	if err := startAuditLog("bip38cli wallet generate"); err != nil {
+		t.Fatalf("startAuditLog: %v", err)
+	}
+	walletVanityPrefix, walletVanityIgnoreCase, walletAddressType = "1a", true, "bip44"
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-format", "json", "")
+	_ = cmd.Flags().Set("output-format", "json")
+	collect, restore := captureOutput()
+	err := runWalletGenerate(cmd, nil)
+	out := collect()
+	restore()
+	stopAuditLog()
+	if err != nil {
+		t.Fatalf("runWalletGenerate: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	// A bip44 address is the P2PKH address the event is fingerprinted by.
+	for _, field := range []string{`"operation":"generate_wif"`, `"fingerprint":"` + result["address"].(string) + `"`} {
+		if !strings.Contains(string(data), field) {
+			t.Fatalf("audit log lacks %s:\n%s", field, data)
+		}
+	}
+}
+
+func TestPassphraseSources(t *testing.T) {
+	allowWeakPassphrases(t)
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	readPassword = func(int) ([]byte, error) {
+		t.Fatal("prompted for a passphrase despite a source")
+		return nil, nil
+	}
+	reset := func() { passphraseFile, passphraseFD, passphraseEnv, passphraseStdin = "", -1, "", false }
+	defer reset()
+
+	path := t.TempDir() + "/pass.txt"
+	if err := os.WriteFile(path, []byte("TestingOneTwoThree\r\nsecond line\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	reset()
+	passphraseFile = path
+	got, err := getNewPassphrase("")
+	if err != nil || string(got) != "TestingOneTwoThree" {
+		t.Fatalf("file: got %q, %v", got, err)
+	}
+
+	reset()
+	t.Setenv("BIP38CLI_TEST_PASS", "from env")
+	passphraseEnv = "BIP38CLI_TEST_PASS"
+	if got, err := getPassphrase(""); err != nil || string(got) != "from env" {
+		t.Fatalf("env: got %q, %v", got, err)
+	}
+	passphraseEnv = "BIP38CLI_TEST_UNSET"
+	if _, err := getPassphrase(""); err == nil {
+		t.Fatal("env: accepted an unset variable")
+	}
+
+	// Only the first line is consumed, so the rest stays readable.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	if _, err := w.WriteString("piped\nleft over\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = w.Close()
+	origStdin := os.Stdin
+	defer func() { os.Stdin = origStdin }()
+	os.Stdin = r
+	reset()
+	passphraseStdin = true
+	if got, err := getPassphrase(""); err != nil || string(got) != "piped" {
+		t.Fatalf("stdin: got %q, %v", got, err)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "left over\n" {
+		t.Fatalf("stdin: %q left, want the second line", rest)
+	}
+	_ = r.Close()
+	var appErr *errors.AppError
+	if err := runBatchDecrypt(&cobra.Command{}, []string{"-"}); !stderrors.As(err, &appErr) || !strings.Contains(appErr.Message, "from stdin") {
+		t.Fatalf("stdin: batch input from stdin too: %v", err)
+	}
+
+	reset()
+	long := t.TempDir() + "/long.txt"
+	if err := os.WriteFile(long, bytes.Repeat([]byte("x"), maxPassphraseLen+1), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	passphraseFile = long
+	if _, err := getPassphrase(""); err == nil {
+		t.Fatal("accepted an overlong passphrase")
+	}
+
+	passphraseFile, passphraseStdin = path, true
+	if _, err := getPassphrase(""); err == nil || !strings.Contains(err.Error(), "only one passphrase source") {
+		t.Fatalf("accepted two sources: %v", err)
+	}
+	if err := runDecrypt(&cobra.Command{}, nil); err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Fatalf("decrypt read both the key and the passphrase from stdin: %v", err)
+	}
+
+	// Encrypt and decrypt end to end from the file, without confirmation.
+	reset()
+	passphraseFile = path
+	forceCompressed, forceUncompressed = false, false
+	collect, restore := captureOutput()
+	err = runEncrypt(&cobra.Command{}, []string{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"})
+	out := string(collect())
+	restore()
+	if err != nil || !strings.Contains(out, "Encrypted key: 6PRQLXPwy4YFcXPRgkGR9andHXt27ZtFN5M7Xmrm3QS6P1KMwZu8VKDDtV") {
+		t.Fatalf("encrypt with --passphrase-file: %v\n%s", err, out)
+	}
+}
+
+func TestPassphraseCacheInKeyring(t *testing.T) {
+	key := fmt.Sprintf("session:bip38cli-test:%d", os.Getpid())
+	if err := keyring.Store(keyring.Session, "bip38cli-probe", []byte("x"), time.Second); err != nil {
+		t.Skipf("kernel keyring unavailable: %v", err)
+	}
+	defer func() {
+		passphraseEnv, passphraseKeyring, passphraseCacheTTL = "", "", 15*time.Minute
+		_ = runPassphraseForget(&cobra.Command{}, []string{key})
+	}()
+
+	t.Setenv("BIP38CLI_TEST_PASS", "TestingOneTwoThree")
+	passphraseEnv = "BIP38CLI_TEST_PASS"
+	passphraseCacheTTL = time.Minute
+	collect, restore := captureOutput()
+	err := runPassphraseCache(&cobra.Command{}, []string{key})
+	out := string(collect())
+	restore()
+	if err != nil || !strings.Contains(out, "--passphrase-keyring "+key) {
+		t.Fatalf("passphrase cache: %v\n%s", err, out)
+	}
+
+	// Decrypt with the cached passphrase instead of a prompt.
+	passphraseEnv, passphraseKeyring = "", key
+	decryptNetwork, decryptQRImage = "", ""
+	collect, restore = captureOutput()
+	err = runDecrypt(&cobra.Command{}, []string{"6PRQLXPwy4YFcXPRgkGR9andHXt27ZtFN5M7Xmrm3QS6P1KMwZu8VKDDtV"})
+	out = string(collect())
+	restore()
+	if err != nil || !strings.Contains(out, "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ") {
+		t.Fatalf("decrypt with --passphrase-keyring: %v\n%s", err, out)
+	}
+
+	if err := runPassphraseForget(&cobra.Command{}, []string{key}); err != nil {
+		t.Fatalf("passphrase forget: %v", err)
+	}
+	if _, err := getPassphrase(""); err == nil || !strings.Contains(err.Error(), "passphrase cache") {
+		t.Fatalf("read a forgotten passphrase: %v", err)
+	}
+	if err := runPassphraseForget(&cobra.Command{}, []string{key}); err == nil {
+		t.Fatal("forgot a passphrase twice")
+	}
+}
+
+func TestPassphraseStrengthPolicy(t *testing.T) {
+	cmd := &cobra.Command{Use: "encrypt"}
+	addStrengthFlags(cmd)
+	defer func() { allowWeakPassphrase, minPassphraseBits = false, defaultMinPassphraseBits }()
+	t.Setenv(minPassphraseBitsEnv, "")
+
+	const (
+		weak   = "Password1"
+		strong = "plinth-cobalt-marmoset-quibble"
+	)
+	isValidationError := func(err error) bool {
+		var appErr *errors.AppError
+		return stderrors.As(err, &appErr) && appErr.Type == errors.ValidationError
+	}
+
+	if err := checkPassphraseStrength(cmd, []byte(weak)); !isValidationError(err) || !strings.Contains(err.Error(), "--allow-weak") {
+		t.Fatalf("weak passphrase: got %v, want a validation error naming --allow-weak", err)
+	}
+	if err := checkPassphraseStrength(cmd, []byte(strong)); err != nil {
+		t.Fatalf("strong passphrase: %v", err)
+	}
+
+	t.Setenv(minPassphraseBitsEnv, "200")
+	if err := checkPassphraseStrength(cmd, []byte(strong)); !isValidationError(err) {
+		t.Fatalf("minimum from %s: got %v, want a validation error", minPassphraseBitsEnv, err)
+	}
+	t.Setenv(minPassphraseBitsEnv, "many")
+	if err := checkPassphraseStrength(cmd, []byte(strong)); !isValidationError(err) {
+		t.Fatalf("invalid %s: got %v, want a validation error", minPassphraseBitsEnv, err)
+	}
+
+	// The flag wins over the environment.
+	if err := cmd.Flags().Set("min-passphrase-bits", "0"); err != nil {
+		t.Fatalf("failed to set min-passphrase-bits flag: %v", err)
+	}
+	if err := checkPassphraseStrength(cmd, []byte(weak)); err != nil {
+		t.Fatalf("weak passphrase with --min-passphrase-bits 0: %v", err)
+	}
+
+	if err := cmd.Flags().Set("min-passphrase-bits", "60"); err != nil {
+		t.Fatalf("failed to set min-passphrase-bits flag: %v", err)
+	}
+	if err := cmd.Flags().Set("allow-weak", "true"); err != nil {
+		t.Fatalf("failed to set allow-weak flag: %v", err)
+	}
+	if err := checkPassphraseStrength(cmd, []byte(weak)); err != nil {
+		t.Fatalf("weak passphrase with --allow-weak: %v", err)
+	}
+}
+
+func TestRunEncryptRejectsWeakPassphrase(t *testing.T) {
+	origReadPassword := readPassword
+	defer func() { readPassword = origReadPassword }()
+	readPassword = func(int) ([]byte, error) { return []byte("letmein"), nil }
+	t.Setenv(minPassphraseBitsEnv, "")
+
+	cmd := &cobra.Command{Use: "encrypt"}
+	collect, restore := captureOutput()
+	defer restore()
+	err := runEncrypt(cmd, []string{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"})
+	output := collect()
+
+	if err == nil || !strings.Contains(err.Error(), "too weak") {
+		t.Fatalf("expected weak passphrase to be rejected, got %v", err)
+	}
+	if strings.Contains(string(output), "6P") {
+		t.Fatalf("key was encrypted despite the weak passphrase: %q", output)
+	}
+}
@@ -7,10 +7,9 @@ import (
 	"os"
 	"strings"
 
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
 )
 
@@ -21,11 +20,22 @@ var decryptCmd = &cobra.Command{
 
 The encrypted key should be in the standard BIP38 format (starting with 6P).
 If no encrypted key is provided as an argument, you will be prompted to enter it.
-The passphrase will always be prompted securely.
+With --qr-image it is read from the QR code in a PNG, JPEG or GIF image, such
+as a photo or scan of a paper wallet; other codes in the image are ignored.
+The passphrase is prompted securely, unless one of the --passphrase-* flags
+supplies it from a file, descriptor, stdin, environment variable, kernel
+keyring or helper command for use in scripts.
+
+The network is detected from the key's address hash. Testnet3, regtest and
+signet share address versions, so such keys are reported with every candidate
+network; pass --network to choose one.
 
 Examples:
   bip38cli decrypt 6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg
-  bip38cli decrypt --show-address 6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg`,
+  bip38cli decrypt --show-address 6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg
+  bip38cli decrypt --network signet --show-address 6P...
+  bip38cli decrypt --qr-image wallet.png
+  printf '%s\n' "$PASS" | bip38cli decrypt --passphrase-stdin 6P...`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runDecrypt,
 }
@@ -33,12 +43,17 @@ Examples:
 var (
 	showAddress        bool
 	decryptAddressType = "bip84"
+	decryptNetwork     string
+	decryptQRImage     string
 )
 
 func init() {
 	rootCmd.AddCommand(decryptCmd)
 	decryptCmd.Flags().BoolVar(&showAddress, "show-address", false, "show the Bitcoin address for the decrypted key")
 	decryptCmd.Flags().StringVar(&decryptAddressType, "address-type", "bip44", "address type (bip84|bip44); BIP38 addresshash uses P2PKH (bip44)")
+	decryptCmd.Flags().StringVar(&decryptNetwork, "network", "", "network of the decrypted key ("+networkChoices()+"; default: detect)")
+	decryptCmd.Flags().StringVar(&decryptQRImage, "qr-image", "", "read the encrypted key from a QR code in this image file")
+	addPassphraseFlags(decryptCmd)
 }
 
 func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
@@ -51,9 +66,21 @@ func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 
 	// Grab encrypted key text
 	var encryptedKey string
-	if len(args) > 0 {
+	switch {
+	case decryptQRImage != "" && len(args) > 0:
+		return errors.NewValidationError("pass the encrypted key either as an argument or with --qr-image, not both", nil)
+	case decryptQRImage != "":
+		key, err := readSingleQRImage(decryptQRImage, "BIP38 encrypted key", bip38.IsBIP38Format)
+		if err != nil {
+			return err
+		}
+		encryptedKey = key
+	case len(args) > 0:
 		encryptedKey = args[0]
-	} else {
+	default:
+		if err := checkStdinFree("encrypted key"); err != nil {
+			return err
+		}
 		fmt.Print("Enter BIP38 encrypted key: ")
 		scanner := bufio.NewScanner(os.Stdin)
 		if scanner.Scan() {
@@ -78,6 +105,11 @@ func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 
 	logger.Debug("Validated BIP38 encrypted key format")
 
+	params, err := resolveNetworkFlag(decryptNetwork)
+	if err != nil {
+		return err
+	}
+
 	// Ask for passphrase the same way as encrypt
 	passphrase, err := getPassphrase("Enter passphrase: ")
 	if err != nil {
@@ -90,22 +122,30 @@ func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 	}
 
 	// Decrypt the key with domain helper
-	timer := metrics.NewTimer("decrypt")
-	wif, err := bip38.DecryptKey(encryptedKey, passphrase)
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: encryptedKey,
+		Passphrase:   passphrase,
+		Network:      params,
+	})
 	if err != nil {
-		timer.Stop(false)
 		logger.WithError(err).Error("Failed to decrypt private key")
 		return errors.NewCryptoError("decryption failed", err)
 	}
-	timer.Stop(true)
 
 	logger.Info("Successfully decrypted private key")
 
+	wif := decrypted.WIF
+
 	// Prepare output data
 	result := map[string]interface{}{
 		"private_key": wif.String(),
 		"compressed":  wif.CompressPubKey,
 	}
+	addNetworkFields(result, decrypted.Network, decrypted.Candidates)
+	if decrypted.Ambiguous() {
+		logger.WithField("candidates", networkNames(decrypted.Candidates)).
+			Warn("Network is ambiguous; pass --network to choose one")
+	}
 
 	// Show address when user requests
 	if showAddress {
@@ -115,12 +155,13 @@ func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 				WithContext("address_type", decryptAddressType)
 		}
 
-		effectiveType := addrType
-		if effectiveType == addressTypeBIP84 && !wif.CompressPubKey {
-			effectiveType = addressTypeBIP44
+		addressNet := decrypted.Network
+		if addressNet == nil {
+			addressNet = decrypted.Candidates[0]
 		}
+		effectiveType := effectiveAddressType(addrType, wif.CompressPubKey, addressNet)
 
-		address, err := addressForWIF(wif, effectiveType)
+		address, err := addressForKey(wif, addressNet, effectiveType)
 		if err != nil {
 			return fmt.Errorf("failed to derive address: %v", err)
 		}
@@ -140,6 +181,7 @@ func runDecrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 	default:
 		// Text output
 		fmt.Printf("Private key (WIF): %s\n", wif.String())
+		fmt.Printf("Network: %s\n", networkLabel(result))
 
 		if showAddress {
 			fmt.Printf("Bitcoin address (%s): %s\n", result["address_type"], result["address"])
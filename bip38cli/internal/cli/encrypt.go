@@ -2,22 +2,18 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
-	"syscall"
 	"unsafe"
 
 	"github.com/btcsuite/btcd/btcutil"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 var encryptCmd = &cobra.Command{
@@ -27,11 +23,21 @@ var encryptCmd = &cobra.Command{
 
 The private key should be provided in WIF (Wallet Import Format).
 If no private key is provided as an argument, you will be prompted to enter it.
-The passphrase will always be prompted securely.
+The passphrase is prompted securely and asked twice, unless one of the
+--passphrase-* flags supplies it from a file, descriptor, stdin, environment
+variable, kernel keyring or helper command for use in scripts.
+
+The passphrase's strength is estimated from the patterns it uses (common
+passwords and words, keyboard walks, dates, repeats, sequences) and reported
+on stderr with the time an offline attacker would need to guess it. One
+weaker than --min-passphrase-bits (default 50, or $BIP38CLI_MIN_PASSPHRASE_BITS)
+is rejected unless --allow-weak is given.
 
 Examples:
   bip38cli encrypt
+  bip38cli encrypt --passphrase-file pass.txt 5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ
   bip38cli encrypt --uncompressed 5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ
+  bip38cli encrypt --min-passphrase-bits 64 5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ
 
 Passing a WIF as a command-line argument may expose it via shell history
 and process listings. Prefer interactive prompt or stdin when possible.`,
@@ -42,14 +48,16 @@ and process listings. Prefer interactive prompt or stdin when possible.`,
 var (
 	forceCompressed   bool
 	forceUncompressed bool
+	encryptNetwork    string
 )
 
-var readPassword = term.ReadPassword
-
 func init() {
 	rootCmd.AddCommand(encryptCmd)
 	encryptCmd.Flags().BoolVar(&forceCompressed, "compressed", false, "force compressed public key format")
 	encryptCmd.Flags().BoolVar(&forceUncompressed, "uncompressed", false, "force uncompressed public key format")
+	encryptCmd.Flags().StringVar(&encryptNetwork, "network", "", "network the address hash commits to ("+networkChoices()+"; default: from WIF)")
+	addPassphraseFlags(encryptCmd)
+	addStrengthFlags(encryptCmd)
 }
 
 func runEncrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
@@ -71,6 +79,9 @@ func runEncrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 	if len(args) > 0 {
 		wifStr = args[0]
 	} else {
+		if err := checkStdinFree("private key"); err != nil {
+			return err
+		}
 		fmt.Print("Enter WIF private key: ")
 		scanner := bufio.NewScanner(os.Stdin)
 		if scanner.Scan() {
@@ -93,6 +104,11 @@ func runEncrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 	}
 	logger.WithField("compressed", wif.CompressPubKey).Debug("Successfully decoded WIF private key")
 
+	params, err := resolveNetworkFlag(encryptNetwork)
+	if err != nil {
+		return err
+	}
+
 	// Only override compression when an explicit encrypt flag is set.
 	switch {
 	case forceCompressed:
@@ -101,44 +117,30 @@ func runEncrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 		wif.CompressPubKey = false
 	}
 
-	// Ask hidden passphrase from user
-	passphrase, err := getPassphrase("Enter passphrase for encryption: ")
+	// Ask hidden passphrase from user; typed ones are confirmed to avoid typos
+	passphrase, err := getNewPassphrase("Enter passphrase for encryption: ")
 	if err != nil {
-		return fmt.Errorf("failed to read passphrase: %v", err)
+		return err
 	}
 	defer secureZero(passphrase)
-
-	if len(passphrase) == 0 {
-		return fmt.Errorf("passphrase cannot be empty")
-	}
-
-	// Confirm passphrase a second time to avoid typos
-	confirmPassphrase, err := getPassphrase("Confirm passphrase: ")
-	if err != nil {
-		return fmt.Errorf("failed to read passphrase confirmation: %v", err)
-	}
-	defer secureZero(confirmPassphrase)
-
-	if !bytes.Equal(passphrase, confirmPassphrase) {
-		return fmt.Errorf("passphrases do not match")
+	if err := checkPassphraseStrength(cmd, passphrase); err != nil {
+		return err
 	}
 
 	// Encrypt the key using domain logic
-	timer := metrics.NewTimer("encrypt")
-	encryptedKey, err := bip38.EncryptKey(wif, passphrase)
+	encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
 	if err != nil {
-		timer.Stop(false)
 		logger.WithError(err).Error("Failed to encrypt private key")
 		return errors.NewCryptoError("encryption failed", err)
 	}
-	timer.Stop(true)
 
 	logger.Info("Successfully encrypted private key")
 
 	// Prepare output data
+	encryptedKey := encrypted.EncryptedKey
 	result := map[string]interface{}{
 		"encrypted_key": encryptedKey,
-		"compressed":    wif.CompressPubKey,
+		"compressed":    encrypted.Compressed,
 	}
 
 	// Output based on format
@@ -166,16 +168,6 @@ func runEncrypt(cmd *cobra.Command, args []string) error { //nolint:gocyclo
 	return nil
 }
 
-func getPassphrase(prompt string) ([]byte, error) {
-	fmt.Print(prompt)
-	bytePassword, err := readPassword(syscall.Stdin)
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println() // Print newline after hidden input so shell isn't messy
-	return bytePassword, nil
-}
-
 // secureZero wipes a byte slice in a way that resists dead store elimination
 // by the Go compiler. Using unsafe.Pointer forces the write to be observable,
 // and runtime.KeepAlive prevents the buffer from being collected before zeroing.
@@ -2,16 +2,14 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
 )
 
@@ -30,9 +28,20 @@ var generateIntermediateCmd = &cobra.Command{
 	Short: "Generate an intermediate passphrase code",
 	Long: `Generate a BIP38 intermediate passphrase code from a passphrase.
 
+The passphrase is prompted twice, unless one of the --passphrase-* flags
+supplies it from a file, descriptor, stdin, environment variable, kernel
+keyring or helper command for use in scripts.
+
+The passphrase's strength is estimated from the patterns it uses (common
+passwords and words, keyboard walks, dates, repeats, sequences) and reported
+on stderr with the time an offline attacker would need to guess it. One
+weaker than --min-passphrase-bits (default 50, or $BIP38CLI_MIN_PASSPHRASE_BITS)
+is rejected unless --allow-weak is given.
+
 Examples:
   bip38cli intermediate generate
-  bip38cli intermediate generate --lot 123 --sequence 456`,
+  bip38cli intermediate generate --lot 123 --sequence 456
+  bip38cli intermediate generate --passphrase-fd 3 3<pass.txt`,
 	RunE: runGenerateIntermediate,
 }
 
@@ -59,19 +68,61 @@ requiring knowledge of the passphrase.
 The output includes the encrypted key (6P...) and a confirmation code (cfrm38...)
 that the passphrase owner can use to verify the derived address.
 
+With --qr-image the intermediate code is read from the QR code in a PNG, JPEG
+or GIF image.
+
+--count mints many keys in parallel for a printer servicing one intermediate
+code. Instead of printing a key, a manifest is written in row order with the
+encrypted key, confirmation code, address, compression and the lot/sequence
+numbers of the intermediate code of every key, as CSV or JSON lines.
+--paper-dir also renders a paper wallet per key, numbered like the manifest.
+The passphrase is never needed or asked for.
+
 Examples:
   bip38cli intermediate encrypt passphraseXXX...
   bip38cli intermediate encrypt --uncompressed passphraseXXX...
-  bip38cli intermediate encrypt --output-format json passphraseXXX...`,
+  bip38cli intermediate encrypt --output-format json passphraseXXX...
+  bip38cli intermediate encrypt --qr-image intermediate.png
+  bip38cli intermediate encrypt --count 500 --manifest keys.csv passphraseXXX...
+  bip38cli intermediate encrypt --count 500 --manifest keys.jsonl --paper-dir wallets passphraseXXX...`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runEncryptIntermediate,
 }
 
+var confirmIntermediateCmd = &cobra.Command{
+	Use:   "confirm [CONFIRMATION_CODE...]",
+	Short: "Verify EC-multiply confirmation codes with the owner's passphrase",
+	Long: `Verify one or more BIP38 confirmation codes (cfrm38...) produced by
+'intermediate encrypt'.
+
+The passphrase owner runs this command to check that a key printed by a third
+party really depends on their passphrase. The passphrase is prompted once and
+every code is checked against it. For each code the derived address,
+compression and lot/sequence numbers are reported.
+
+Codes can be passed as arguments, read from a file with one code per line
+(use "-" for stdin), read from the QR codes in PNG, JPEG or GIF images with
+--qr-image (repeatable; every confirmation code in an image is checked), or
+typed interactively when none of these is given.
+
+Examples:
+  bip38cli intermediate confirm cfrm38XXX...
+  bip38cli intermediate confirm cfrm38AAA... cfrm38BBB...
+  bip38cli intermediate confirm --codes-file codes.txt --output-format json
+  bip38cli intermediate confirm --qr-image scan1.png --qr-image scan2.jpg`,
+	RunE: runConfirmIntermediate,
+}
+
 var (
-	lotNumber                    uint32
-	sequenceNumber               uint32
-	useLotSeq                    bool
+	lotNumber                       uint32
+	sequenceNumber                  uint32
+	useLotSeq                       bool
 	encryptIntermediateUncompressed bool
+	encryptIntermediateNetwork      = "mainnet"
+	encryptIntermediateQRImage      string
+	confirmCodesFile                string
+	confirmNetwork                  string
+	confirmQRImages                 []string
 )
 
 func init() {
@@ -79,12 +130,21 @@ func init() {
 	intermediateCmd.AddCommand(generateIntermediateCmd)
 	intermediateCmd.AddCommand(validateIntermediateCmd)
 	intermediateCmd.AddCommand(encryptIntermediateCmd)
+	intermediateCmd.AddCommand(confirmIntermediateCmd)
 
 	generateIntermediateCmd.Flags().Uint32Var(&lotNumber, "lot", 0, "lot number (0-1048575)")
 	generateIntermediateCmd.Flags().Uint32Var(&sequenceNumber, "sequence", 0, "sequence number (0-4095)")
 	generateIntermediateCmd.Flags().BoolVar(&useLotSeq, "use-lot-sequence", false, "use lot and sequence numbers")
+	addPassphraseFlags(generateIntermediateCmd)
+	addStrengthFlags(generateIntermediateCmd)
 
 	encryptIntermediateCmd.Flags().BoolVar(&encryptIntermediateUncompressed, "uncompressed", false, "generate uncompressed key")
+	encryptIntermediateCmd.Flags().StringVar(&encryptIntermediateNetwork, "network", "mainnet", "network of the generated address ("+networkChoices()+")")
+	encryptIntermediateCmd.Flags().StringVar(&encryptIntermediateQRImage, "qr-image", "", "read the intermediate code from a QR code in this image file")
+
+	confirmIntermediateCmd.Flags().StringVar(&confirmCodesFile, "codes-file", "", "read confirmation codes from file, one per line (- for stdin)")
+	confirmIntermediateCmd.Flags().StringVar(&confirmNetwork, "network", "", "only accept codes for this network ("+networkChoices()+"; default: detect)")
+	confirmIntermediateCmd.Flags().StringArrayVar(&confirmQRImages, "qr-image", nil, "read confirmation codes from the QR codes in this image file (repeatable)")
 }
 
 func runGenerateIntermediate(cmd *cobra.Command, _ []string) error { //nolint:gocyclo
@@ -121,37 +181,29 @@ func runGenerateIntermediate(cmd *cobra.Command, _ []string) error { //nolint:go
 		seq = &sequenceNumber
 	}
 
-	passphrase, err := getPassphrase("Enter passphrase: ")
+	passphrase, err := getNewPassphrase("Enter passphrase: ")
 	if err != nil {
-		return fmt.Errorf("failed to read passphrase: %v", err)
+		return err
 	}
 	defer secureZero(passphrase)
-
-	if len(passphrase) == 0 {
-		return fmt.Errorf("passphrase cannot be empty")
+	if err := checkPassphraseStrength(cmd, passphrase); err != nil {
+		return err
 	}
 
-	confirmPassphrase, err := getPassphrase("Confirm passphrase: ")
+	generated, err := bip38.GenerateIntermediate(bip38.IntermediateOptions{
+		Passphrase:     passphrase,
+		LotNumber:      lot,
+		SequenceNumber: seq,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read passphrase confirmation: %v", err)
-	}
-	defer secureZero(confirmPassphrase)
-
-	if !bytes.Equal(passphrase, confirmPassphrase) {
-		return fmt.Errorf("passphrases do not match")
-	}
-
-	timer := metrics.NewTimer("intermediate")
-	intermediate, err := bip38.GenerateIntermediateCode(passphrase, lot, seq)
-	if err != nil {
-		timer.Stop(false)
 		logger.WithError(err).Error("Failed to generate intermediate code")
 		return errors.NewCryptoError("failed to generate intermediate code", err)
 	}
-	timer.Stop(true)
 
 	logger.Info("Successfully generated intermediate code")
 
+	intermediate := generated.Code
+
 	result := map[string]interface{}{
 		"intermediate_code": intermediate,
 		"has_lot_sequence":  lot != nil && seq != nil,
@@ -236,9 +288,21 @@ func runEncryptIntermediate(cmd *cobra.Command, args []string) error {
 	}
 
 	var intermediateCode string
-	if len(args) > 0 {
+	switch {
+	case encryptIntermediateQRImage != "" && len(args) > 0:
+		return errors.NewValidationError("pass the intermediate code either as an argument or with --qr-image, not both", nil)
+	case encryptIntermediateQRImage != "":
+		code, err := readSingleQRImage(encryptIntermediateQRImage, "intermediate code", func(code string) bool {
+			_, err := bip38.ParseIntermediateCode(code)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		intermediateCode = code
+	case len(args) > 0:
 		intermediateCode = args[0]
-	} else {
+	default:
 		fmt.Print("Enter intermediate code: ")
 		scanner := bufio.NewScanner(os.Stdin)
 		if scanner.Scan() {
@@ -259,14 +323,26 @@ func runEncryptIntermediate(cmd *cobra.Command, args []string) error {
 
 	compressed := !encryptIntermediateUncompressed
 
-	timer := metrics.NewTimer("intermediate")
-	ecResult, err := bip38.ECMultiplyEncrypt(intermediateCode, compressed)
+	params, err := bip38.NetworkFromName(encryptIntermediateNetwork)
+	if err != nil {
+		logger.WithError(err).Error("Unsupported network provided")
+		return errors.NewValidationError("invalid network", err).
+			WithContext("network", encryptIntermediateNetwork)
+	}
+
+	if bulkIntermediateRequested() {
+		return runEncryptIntermediateBulk(cmd, intermediateCode, params, compressed)
+	}
+
+	ecResult, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: intermediateCode,
+		Compressed:       compressed,
+		Network:          params,
+	})
 	if err != nil {
-		timer.Stop(false)
 		logger.WithError(err).Error("EC-multiply encryption failed")
 		return errors.NewCryptoError("EC-multiply encryption failed", err)
 	}
-	timer.Stop(true)
 
 	logger.Info("Successfully generated EC-multiply encrypted key")
 
@@ -274,6 +350,8 @@ func runEncryptIntermediate(cmd *cobra.Command, args []string) error {
 		"encrypted_key":     ecResult.EncryptedKey,
 		"confirmation_code": ecResult.ConfirmationCode,
 		"compressed":        ecResult.Compressed,
+		"address":           ecResult.Address,
+		"network":           ecResult.Network.Name,
 	}
 
 	switch outputFormat(cmd) {
@@ -286,6 +364,7 @@ func runEncryptIntermediate(cmd *cobra.Command, args []string) error {
 	default:
 		fmt.Printf("Encrypted key:     %s\n", ecResult.EncryptedKey)
 		fmt.Printf("Confirmation code: %s\n", ecResult.ConfirmationCode)
+		fmt.Printf("Address (%s):  %s\n", ecResult.Network.Name, ecResult.Address)
 		if isVerbose(cmd) {
 			compression := "uncompressed"
 			if ecResult.Compressed {
@@ -297,3 +376,229 @@ func runEncryptIntermediate(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func runConfirmIntermediate(cmd *cobra.Command, args []string) error { //nolint:gocyclo
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	codes, err := collectConfirmationCodes(args, confirmCodesFile, confirmQRImages)
+	if err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return errors.NewValidationError("confirmation code is required", nil)
+	}
+
+	params, err := resolveNetworkFlag(confirmNetwork)
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("codes", len(codes)).Debug("Starting confirmation code verification")
+
+	passphrase, err := getPassphrase("Enter passphrase: ")
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	defer secureZero(passphrase)
+
+	if len(passphrase) == 0 {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+
+	// Codes from one intermediate code share the expensive passfactor.
+	cache := bip38.NewPassfactorCache()
+	defer cache.Clear()
+
+	results := make([]map[string]any, 0, len(codes))
+	var lastErr error
+	failed := 0
+	for _, code := range codes {
+		confirmation, confirmErr := bip38.Confirm(bip38.ConfirmOptions{
+			ConfirmationCode: code,
+			Passphrase:       passphrase,
+			Network:          params,
+			Cache:            cache,
+		})
+		if confirmErr != nil {
+			logger.WithError(confirmErr).Warn("Confirmation code verification failed")
+			failed++
+			lastErr = confirmErr
+			results = append(results, map[string]any{
+				"confirmation_code": code,
+				"valid":             false,
+				"error":             confirmErr.Error(),
+			})
+			continue
+		}
+		results = append(results, confirmationResultMap(code, confirmation))
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		var payload any = results[0]
+		if len(results) > 1 {
+			payload = map[string]any{
+				"results": results,
+				"passed":  len(results) - failed,
+				"failed":  failed,
+			}
+		}
+		jsonOutput, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		for _, result := range results {
+			printConfirmationResult(result, len(results) > 1)
+		}
+		if len(results) > 1 {
+			fmt.Printf("Passed: %d  Failed: %d\n", len(results)-failed, failed)
+		}
+	}
+
+	if failed == 1 && len(codes) == 1 {
+		return errors.NewCryptoError("confirmation failed", lastErr)
+	}
+	if failed > 0 {
+		return errors.NewCryptoError(fmt.Sprintf("%d of %d confirmation codes failed", failed, len(codes)), nil).
+			WithContext("failed", failed)
+	}
+
+	return nil
+}
+
+// collectConfirmationCodes gathers codes from arguments, a file, QR images, or an interactive prompt.
+func collectConfirmationCodes(args []string, path string, images []string) ([]string, error) {
+	codes := make([]string, 0, len(args))
+	for _, arg := range args {
+		if code := strings.TrimSpace(arg); code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	if path != "" {
+		fromFile, err := readCodesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, fromFile...)
+	}
+
+	for _, imagePath := range images {
+		fromImage, err := readQRImage(imagePath, "confirmation code", isConfirmationCode)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, fromImage...)
+	}
+
+	if len(codes) == 0 && path == "" && len(images) == 0 {
+		fmt.Print("Enter confirmation code: ")
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan() {
+			if code := strings.TrimSpace(scanner.Text()); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.NewInputError("failed to read confirmation code", err)
+		}
+	}
+
+	return codes, nil
+}
+
+func isConfirmationCode(code string) bool {
+	_, err := bip38.InspectConfirmationCode(code)
+	return err == nil
+}
+
+// readCodesFile reads one code per line, skipping blank lines and # comments.
+func readCodesFile(path string) ([]string, error) {
+	var file *os.File
+	if path == "-" {
+		file = os.Stdin
+	} else {
+		opened, err := os.Open(path) //nolint:gosec
+		if err != nil {
+			return nil, errors.NewInputError("failed to open codes file", err).
+				WithContext("path", path)
+		}
+		defer func() { _ = opened.Close() }()
+		file = opened
+	}
+
+	var codes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		codes = append(codes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.NewInputError("failed to read codes file", err).
+			WithContext("path", path)
+	}
+	return codes, nil
+}
+
+func confirmationResultMap(code string, confirmation *bip38.ConfirmationResult) map[string]any {
+	result := map[string]any{
+		"confirmation_code": code,
+		"valid":             true,
+		"address":           confirmation.Address,
+		"compressed":        confirmation.Compressed,
+		"has_lot_sequence":  confirmation.HasLotSeq,
+	}
+	addNetworkFields(result, confirmation.Network, confirmation.Candidates)
+	if confirmation.HasLotSeq {
+		result["lot_number"] = *confirmation.LotNumber
+		result["sequence_number"] = *confirmation.SeqNumber
+	}
+	return result
+}
+
+func printConfirmationResult(result map[string]any, multiple bool) {
+	valid, _ := result["valid"].(bool)
+	if multiple {
+		status := "FAIL"
+		if valid {
+			status = "PASS"
+		}
+		fmt.Printf("%s %s\n", status, result["confirmation_code"])
+	}
+
+	if !valid {
+		if multiple {
+			fmt.Printf("  Error: %s\n", result["error"])
+		} else {
+			fmt.Println("✗ Confirmation code invalid")
+		}
+		return
+	}
+
+	indent := ""
+	if multiple {
+		indent = "  "
+	} else {
+		fmt.Println("✓ Confirmation code valid")
+	}
+
+	compression := "uncompressed"
+	if compressed, _ := result["compressed"].(bool); compressed {
+		compression = "compressed"
+	}
+	fmt.Printf("%sAddress (%s): %s\n", indent, networkLabel(result), result["address"])
+	fmt.Printf("%sKey format: %s\n", indent, compression)
+	if hasLotSeq, _ := result["has_lot_sequence"].(bool); hasLotSeq {
+		fmt.Printf("%sLot number: %d\n", indent, result["lot_number"])
+		fmt.Printf("%sSequence number: %d\n", indent, result["sequence_number"])
+	} else {
+		fmt.Printf("%sType: No lot/sequence\n", indent)
+	}
+}
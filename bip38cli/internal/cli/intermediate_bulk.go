@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/batch"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/paper"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+// maxIntermediateCount bounds --count; a larger order belongs in several
+// manifests.
+const maxIntermediateCount = 1_000_000
+
+// intermediateManifestColumns is the CSV layout of a bulk manifest. JSONL
+// entries carry the same fields, leaving out empty ones.
+var intermediateManifestColumns = []string{
+	"row", "status", "encrypted_key", "confirmation_code", "address", "network",
+	"compressed", "lot_number", "sequence_number", "paper", "error",
+}
+
+var (
+	encryptIntermediateCount          = 1
+	encryptIntermediateWorkers        int
+	encryptIntermediateManifest       string
+	encryptIntermediateManifestFormat = batch.FormatAuto
+	encryptIntermediatePaperDir       string
+	encryptIntermediatePaperFormat    = "pdf"
+	encryptIntermediatePaperTemplate  string
+	encryptIntermediateQRLevel        = "M"
+)
+
+func init() {
+	flags := encryptIntermediateCmd.Flags()
+	flags.IntVar(&encryptIntermediateCount, "count", 1, "number of keys to generate; more than one writes a manifest")
+	flags.IntVar(&encryptIntermediateWorkers, "workers", 0, "parallel workers for --count (default: number of CPUs)")
+	flags.StringVar(&encryptIntermediateManifest, "manifest", "", "write the manifest to this file (default: stdout)")
+	flags.StringVar(&encryptIntermediateManifestFormat, "manifest-format", batch.FormatAuto, "manifest format (auto|csv|jsonl; auto picks csv for a .csv file)")
+	flags.StringVar(&encryptIntermediatePaperDir, "paper-dir", "", "also render a paper wallet for every key into this directory")
+	flags.StringVar(&encryptIntermediatePaperFormat, "paper-format", "pdf", "paper wallet format for --paper-dir (svg|pdf)")
+	flags.StringVar(&encryptIntermediatePaperTemplate, "paper-template", "", "JSON layout template for --paper-dir (default: built-in)")
+	flags.StringVar(&encryptIntermediateQRLevel, "qr-level", "M", "QR error correction level for --paper-dir (L|M|Q|H)")
+}
+
+// bulkIntermediateRequested reports whether intermediate encrypt should
+// write a manifest instead of printing a single key.
+func bulkIntermediateRequested() bool {
+	return encryptIntermediateCount != 1 || encryptIntermediateManifest != "" || encryptIntermediatePaperDir != ""
+}
+
+// paperRenderer writes one paper wallet file per manifest row.
+type paperRenderer struct {
+	dir    string
+	format string
+	layout *paper.Layout
+	level  qr.Level
+	width  int
+}
+
+func newPaperRenderer(dir, format, template, level string, count int) (*paperRenderer, error) {
+	r := &paperRenderer{dir: dir, format: strings.ToLower(format), width: len(fmt.Sprint(count))}
+	if r.format != "svg" && r.format != "pdf" {
+		return nil, errors.NewValidationError("invalid paper format", nil).WithContext("paper_format", format)
+	}
+	parsed, err := qr.ParseLevel(level)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid QR error correction level", err).
+			WithContext("qr_level", level)
+	}
+	r.level = parsed
+	if r.layout, err = loadPaperLayout(template); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.NewSystemError("failed to create paper wallet directory", err).
+			WithContext("path", dir)
+	}
+	return r, nil
+}
+
+// render writes wallet-NNN.svg or .pdf, numbered by row so the files sort
+// like the manifest.
+func (r *paperRenderer) render(row int, wallet paper.Wallet) (string, error) {
+	wallet.Label = fmt.Sprintf("No. %d", row)
+	path := filepath.Join(r.dir, fmt.Sprintf("wallet-%0*d.%s", r.width, row, r.format))
+	err := writePaperFile(path, func(w io.Writer) error {
+		if r.format == "svg" {
+			return paper.RenderSVG(w, r.layout, wallet, r.level)
+		}
+		return paper.RenderPDF(w, r.layout, wallet, r.level)
+	})
+	return path, err
+}
+
+// runEncryptIntermediateBulk mints count EC-multiply keys from one
+// intermediate code in parallel. Only the public intermediate code is
+// involved: the passphrase is never asked for.
+func runEncryptIntermediateBulk(cmd *cobra.Command, code string, params *chaincfg.Params, compressed bool) error { //nolint:gocyclo
+	if encryptIntermediateCount < 1 || encryptIntermediateCount > maxIntermediateCount {
+		return errors.NewValidationError(fmt.Sprintf("count must be between 1 and %d", maxIntermediateCount), nil).
+			WithContext("count", encryptIntermediateCount)
+	}
+	intermediate, err := bip38.ParseIntermediateCode(code)
+	if err != nil {
+		return errors.NewValidationError("invalid intermediate code format", err)
+	}
+	format, err := batch.ManifestFormatFor(encryptIntermediateManifestFormat, encryptIntermediateManifest)
+	if err != nil {
+		return errors.NewValidationError("invalid manifest format", err).
+			WithContext("manifest_format", encryptIntermediateManifestFormat)
+	}
+
+	var renderer *paperRenderer
+	if encryptIntermediatePaperDir != "" {
+		renderer, err = newPaperRenderer(encryptIntermediatePaperDir, encryptIntermediatePaperFormat,
+			encryptIntermediatePaperTemplate, encryptIntermediateQRLevel, encryptIntermediateCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	workers := encryptIntermediateWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, encryptIntermediateCount)
+
+	rows := make([]batch.Row, encryptIntermediateCount)
+	for i := range rows {
+		rows[i] = batch.Row{Number: i + 1, Key: code}
+	}
+
+	process := func(_ context.Context, row batch.Row) (map[string]any, error) {
+		ecResult, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+			IntermediateCode: row.Key,
+			Compressed:       compressed,
+			Network:          params,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]any{
+			"encrypted_key":     ecResult.EncryptedKey,
+			"confirmation_code": ecResult.ConfirmationCode,
+			"address":           ecResult.Address,
+			"network":           ecResult.Network.Name,
+			"compressed":        ecResult.Compressed,
+		}
+		wallet := paper.Wallet{
+			Address:          ecResult.Address,
+			EncryptedKey:     ecResult.EncryptedKey,
+			ConfirmationCode: ecResult.ConfirmationCode,
+			Network:          ecResult.Network.Name,
+		}
+		if intermediate.HasLotSeq {
+			fields["lot_number"] = *intermediate.LotNumber
+			fields["sequence_number"] = *intermediate.SeqNumber
+			wallet.Lot, wallet.Sequence = intermediate.LotNumber, intermediate.SeqNumber
+		}
+		if renderer != nil {
+			path, err := renderer.render(row.Number, wallet)
+			if err != nil {
+				return nil, err
+			}
+			fields["paper"] = path
+		}
+		return fields, nil
+	}
+
+	output, closeManifest, err := openBatchManifest(encryptIntermediateManifest)
+	if err != nil {
+		return err
+	}
+	manifest, err := batch.NewManifestWriter(output, format, intermediateManifestColumns)
+	if err != nil {
+		_ = closeManifest()
+		return errors.NewValidationError("invalid manifest format", err)
+	}
+
+	logger.WithField("count", encryptIntermediateCount).WithField("workers", workers).
+		Debug("Starting bulk EC-multiply generation")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, runErr := batch.Run(ctx, rows, workers, process, manifest.Write)
+	if err := closeManifest(); err != nil && runErr == nil {
+		runErr = fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if runErr != nil {
+		return errors.NewSystemError("bulk generation stopped", runErr).
+			WithContext("processed", summary.OK+summary.Failed)
+	}
+
+	if err := printIntermediateBulkSummary(cmd, summary, format); err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return errors.NewCryptoError(fmt.Sprintf("%d of %d keys failed", summary.Failed, summary.Total), nil).
+			WithContext("failed", summary.Failed)
+	}
+	return nil
+}
+
+// printIntermediateBulkSummary reports the totals. It goes to stderr when
+// the manifest itself is written to stdout.
+func printIntermediateBulkSummary(cmd *cobra.Command, summary batch.Summary, format string) error {
+	if encryptIntermediateManifest == "" {
+		fmt.Fprintf(os.Stderr, "Generated %d keys: %d ok, %d failed\n", summary.Total, summary.OK, summary.Failed)
+		return nil
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		result := map[string]any{
+			"manifest":        encryptIntermediateManifest,
+			"manifest_format": format,
+			"total":           summary.Total,
+			"ok":              summary.OK,
+			"failed":          summary.Failed,
+		}
+		if encryptIntermediatePaperDir != "" {
+			result["paper_dir"] = encryptIntermediatePaperDir
+		}
+		jsonOutput, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Generated %d keys: %d ok, %d failed\n", summary.Total, summary.OK, summary.Failed)
+		fmt.Printf("Manifest written to %s\n", encryptIntermediateManifest)
+		if encryptIntermediatePaperDir != "" {
+			fmt.Printf("Paper wallets written to %s\n", encryptIntermediatePaperDir)
+		}
+	}
+	return nil
+}
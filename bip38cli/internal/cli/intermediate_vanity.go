@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/humanize"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/vanity"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+var vanityIntermediateCmd = &cobra.Command{
+	Use:   "vanity INTERMEDIATE_CODE",
+	Short: "Search for an EC-multiply key whose address starts with a prefix",
+	Long: `Search for a BIP38 EC-multiply key whose address starts with --prefix, using
+only the owner's intermediate code.
+
+This is outsourced vanity generation: whoever runs the search never learns
+the private key or the passphrase, and the owner checks the result with
+'intermediate confirm' like any other EC-multiply key. The search tries
+random seeds on every core until the address of passpoint*factorb matches,
+then prints the encrypted key and confirmation code.
+
+The difficulty and the expected time at the measured speed are printed to
+stderr before the search starts, followed by progress every few seconds.
+Every extra prefix character makes the search about 58 times longer. Each
+seed is hashed into its factor, so candidates cannot be stepped through by
+adding one point at a time; multiples of the passpoint are tabulated up
+front instead, and each candidate takes at most 32 point additions.
+
+Examples:
+  bip38cli intermediate vanity --prefix 1Team passphraseXXX...
+  bip38cli intermediate vanity --prefix 1Abc --timeout 1h --output-format json passphraseXXX...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVanityIntermediate,
+}
+
+var (
+	vanityIntermediatePrefix       string
+	vanityIntermediateNetwork      = "mainnet"
+	vanityIntermediateUncompressed bool
+	vanityIntermediateWorkers      int
+	vanityIntermediateTimeout      time.Duration
+)
+
+func init() {
+	intermediateCmd.AddCommand(vanityIntermediateCmd)
+
+	flags := vanityIntermediateCmd.Flags()
+	flags.StringVar(&vanityIntermediatePrefix, "prefix", "", "address prefix to search for, such as 1Team (required)")
+	flags.StringVar(&vanityIntermediateNetwork, "network", "mainnet", "network of the generated address ("+networkChoices()+")")
+	flags.BoolVar(&vanityIntermediateUncompressed, "uncompressed", false, "search for an uncompressed key")
+	flags.IntVar(&vanityIntermediateWorkers, "workers", 0, "parallel workers (default: number of CPUs)")
+	flags.DurationVar(&vanityIntermediateTimeout, "timeout", 0, "give up after this long (default: no limit)")
+}
+
+// vanityMeasureTime is how long one worker runs to measure the search speed
+// for the up-front estimate.
+const vanityMeasureTime = 300 * time.Millisecond
+
+func runVanityIntermediate(cmd *cobra.Command, args []string) error { //nolint:gocyclo
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	code, err := bip38.ParseIntermediateCode(args[0])
+	if err != nil {
+		return errors.NewValidationError("invalid intermediate code format", err)
+	}
+	params, err := bip38.NetworkFromName(vanityIntermediateNetwork)
+	if err != nil {
+		return errors.NewValidationError("invalid network", err).
+			WithContext("network", vanityIntermediateNetwork)
+	}
+	if vanityIntermediatePrefix == "" {
+		return errors.NewValidationError("--prefix is required", nil)
+	}
+	pattern, err := vanity.Base58(params.PubKeyHashAddrID, vanity.Spec{Prefix: vanityIntermediatePrefix})
+	if err != nil {
+		return errors.NewValidationError("invalid vanity prefix", err).
+			WithContext("prefix", vanityIntermediatePrefix).
+			WithContext("network", params.Name)
+	}
+	compressed := !vanityIntermediateUncompressed
+
+	search, err := vanity.NewECMultiplySearch(code.PassPoint, compressed, vanity.P2PKH(params.PubKeyHashAddrID), pattern)
+	if err != nil {
+		return errors.NewValidationError("invalid intermediate code", err)
+	}
+	workers := vanityIntermediateWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	rate, err := vanity.Measure(search.Worker, vanityMeasureTime)
+	if err != nil {
+		return errors.NewSystemError("failed to start vanity search", err)
+	}
+	rate *= float64(workers)
+	estimate := vanity.Estimate{Probability: pattern.Probability()}
+	printVanityEstimate(fmt.Sprintf("a %s address %s", params.Name, pattern), estimate, rate, workers)
+
+	ctx, stop := vanityContext(vanityIntermediateTimeout)
+	defer stop()
+
+	match, stats, err := vanity.Search(ctx, vanity.Options{
+		Workers:  workers,
+		Progress: func(s vanity.Stats) { printVanityProgress(s, estimate) },
+	}, search.Worker)
+	if err != nil {
+		return errors.NewSystemError("vanity search stopped before a match was found", err).
+			WithContext("tried", stats.Tried).
+			WithContext("elapsed", stats.Elapsed.Round(time.Second).String())
+	}
+	defer secureZero(match.Seed)
+
+	ecResult, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: code.Code,
+		Compressed:       compressed,
+		Network:          params,
+		Seed:             match.Seed,
+	})
+	if err != nil {
+		return errors.NewCryptoError("EC-multiply encryption failed", err)
+	}
+	if ecResult.Address != match.Address {
+		return errors.NewCryptoError("minted key does not have the address the search found", nil).
+			WithContext("found", match.Address).
+			WithContext("minted", ecResult.Address)
+	}
+
+	logger.WithField("tried", stats.Tried).Info("Found vanity EC-multiply key")
+
+	switch outputFormat(cmd) {
+	case "json":
+		out := map[string]any{
+			"encrypted_key":     ecResult.EncryptedKey,
+			"confirmation_code": ecResult.ConfirmationCode,
+			"compressed":        ecResult.Compressed,
+			"address":           ecResult.Address,
+			"network":           ecResult.Network.Name,
+			"prefix":            vanityIntermediatePrefix,
+			"tried":             stats.Tried,
+			"elapsed_seconds":   stats.Elapsed.Seconds(),
+		}
+		jsonOutput, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Encrypted key:     %s\n", ecResult.EncryptedKey)
+		fmt.Printf("Confirmation code: %s\n", ecResult.ConfirmationCode)
+		fmt.Printf("Address (%s):  %s\n", ecResult.Network.Name, ecResult.Address)
+		fmt.Printf("Found after %s keys in %s\n", humanize.Count(float64(stats.Tried)), humanize.Seconds(stats.Elapsed.Seconds()))
+	}
+	return nil
+}
+
+// printVanityEstimate tells the user on stderr what the search is for and
+// how long it should take at rate keys per second.
+func printVanityEstimate(target string, estimate vanity.Estimate, rate float64, workers int) {
+	fmt.Fprintf(os.Stderr, "Searching for %s\n", target)
+	fmt.Fprintf(os.Stderr, "Difficulty: 1 in %s keys\n", humanize.Count(estimate.Difficulty()))
+	fmt.Fprintf(os.Stderr, "Speed: about %.0f keys/s on %d worker(s)\n", rate, workers)
+	fmt.Fprintf(os.Stderr, "Expected time: 50%% chance within %s, 90%% within %s\n",
+		humanize.Seconds(estimate.Seconds(0.5, rate)), humanize.Seconds(estimate.Seconds(0.9, rate)))
+}
+
+// vanityContext stops a search on interrupt, or after timeout when it is
+// positive.
+func vanityContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// printVanityProgress reports a running search on stderr, with the chance
+// that a match would have turned up by now.
+func printVanityProgress(s vanity.Stats, estimate vanity.Estimate) {
+	chance := -math.Expm1(float64(s.Tried) * math.Log1p(-estimate.Probability))
+	fmt.Fprintf(os.Stderr, "Tried %s keys in %s (%.0f keys/s, %.0f%% of searches would be done by now)\n",
+		humanize.Count(float64(s.Tried)), humanize.Seconds(s.Elapsed.Seconds()), s.Rate(), 100*chance)
+}
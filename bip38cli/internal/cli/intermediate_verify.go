@@ -0,0 +1,380 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/batch"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+var verifyManifestCmd = &cobra.Command{
+	Use:   "verify-manifest MANIFEST",
+	Short: "Check every key in a printer's manifest with the owner's passphrase",
+	Long: `Verify a manifest of EC-multiply keys returned by a printer, as written by
+'intermediate encrypt --count'.
+
+The passphrase is prompted once. For every row the confirmation code is
+checked against it, the address it derives must be the address the printer
+claimed, the encrypted key must decrypt to that address, compression and
+network must match, and the key must come from the intermediate code given
+with --intermediate, with its lot and sequence numbers. Keys, addresses and
+confirmation codes that repeat an earlier row are flagged too.
+
+The report lists every mismatch and ends with a sign-off line naming the
+SHA-256 of the manifest that was checked. It is only signed off when every
+row passes; otherwise the command exits with an error. Private keys are
+never printed.
+
+Examples:
+  bip38cli intermediate verify-manifest keys.csv --intermediate passphraseXXX...
+  bip38cli intermediate verify-manifest keys.jsonl --intermediate passphraseXXX... --output-format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVerifyManifest,
+}
+
+var (
+	verifyManifestIntermediate string
+	verifyManifestFormat       = batch.FormatAuto
+	verifyManifestNetwork      string
+	verifyManifestWorkers      int
+)
+
+func init() {
+	intermediateCmd.AddCommand(verifyManifestCmd)
+
+	flags := verifyManifestCmd.Flags()
+	flags.StringVar(&verifyManifestIntermediate, "intermediate", "", "intermediate code issued to the printer (required)")
+	flags.StringVar(&verifyManifestFormat, "manifest-format", batch.FormatAuto, "manifest format (auto|csv|jsonl)")
+	flags.StringVar(&verifyManifestNetwork, "network", "", "only accept keys for this network ("+networkChoices()+"; default: the manifest's)")
+	flags.IntVar(&verifyManifestWorkers, "workers", 0, "parallel workers (default: number of CPUs)")
+}
+
+// manifestReport is the outcome of verify-manifest.
+type manifestReport struct {
+	Manifest       string           `json:"manifest"`
+	ManifestSHA256 string           `json:"manifest_sha256"`
+	LotNumber      *uint32          `json:"lot_number,omitempty"`
+	SequenceNumber *uint32          `json:"sequence_number,omitempty"`
+	CheckedAt      string           `json:"checked_at"`
+	Rows           []manifestResult `json:"rows"`
+	Total          int              `json:"total"`
+	Verified       int              `json:"verified"`
+	Mismatched     int              `json:"mismatched"`
+	SignedOff      bool             `json:"signed_off"`
+}
+
+// manifestResult is the verdict on one manifest row. Line is where the row
+// sits in the manifest file; Row is the printer's own row number.
+type manifestResult struct {
+	Line    int      `json:"line"`
+	Row     string   `json:"row,omitempty"`
+	Address string   `json:"address,omitempty"`
+	Status  string   `json:"status"`
+	Issues  []string `json:"issues,omitempty"`
+}
+
+// Row verdicts.
+const (
+	manifestVerified = "verified"
+	manifestMismatch = "mismatch"
+)
+
+func runVerifyManifest(cmd *cobra.Command, args []string) error { //nolint:gocyclo
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	if verifyManifestIntermediate == "" {
+		return errors.NewValidationError("--intermediate is required: give the intermediate code issued to the printer", nil)
+	}
+	issued, err := bip38.ParseIntermediateCode(verifyManifestIntermediate)
+	if err != nil {
+		return errors.NewValidationError("invalid intermediate code format", err)
+	}
+	params, err := resolveNetworkFlag(verifyManifestNetwork)
+	if err != nil {
+		return err
+	}
+
+	path := args[0]
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return errors.NewInputError("failed to read manifest", err).WithContext("path", path)
+	}
+	entries, err := batch.ReadManifest(bytes.NewReader(data), verifyManifestFormat)
+	if err != nil {
+		return errors.NewInputError("failed to parse manifest", err).WithContext("path", path)
+	}
+	if len(entries) == 0 {
+		return errors.NewValidationError("manifest has no rows", nil).WithContext("path", path)
+	}
+	digest := sha256.Sum256(data)
+
+	passphrase, err := getPassphrase("Enter passphrase: ")
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	defer secureZero(passphrase)
+	if len(passphrase) == 0 {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+
+	// Every key from one intermediate code shares the expensive passfactor.
+	cache := bip38.NewPassfactorCache()
+	defer cache.Clear()
+
+	fields := make(map[int]map[string]string, len(entries))
+	rows := make([]batch.Row, len(entries))
+	for i, entry := range entries {
+		fields[entry.Line] = entry.Fields
+		rows[i] = batch.Row{Number: entry.Line, Key: entry.Fields["confirmation_code"], Label: entry.Fields["row"], Err: entry.Err}
+		switch {
+		case rows[i].Err != nil:
+		case entry.Fields["status"] != "" && entry.Fields["status"] != batch.StatusOK:
+			rows[i].Err = fmt.Errorf("printer reported a failure: %s", entry.Fields["error"])
+		case rows[i].Key == "":
+			rows[i].Err = stderrors.New("no confirmation code")
+		}
+	}
+
+	process := func(_ context.Context, row batch.Row) (map[string]any, error) {
+		address, issues := verifyManifestRow(fields[row.Number], passphrase, issued, params, cache)
+		return map[string]any{"address": address, "issues": issues}, nil
+	}
+
+	report := &manifestReport{
+		Manifest:       path,
+		ManifestSHA256: hex.EncodeToString(digest[:]),
+		LotNumber:      issued.LotNumber,
+		SequenceNumber: issued.SeqNumber,
+		Total:          len(entries),
+	}
+	seen := map[string]int{}
+	emit := func(entry map[string]any) error {
+		line, _ := entry["row"].(int)
+		result := manifestResult{Line: line}
+		result.Row, _ = entry["label"].(string)
+		result.Address, _ = entry["address"].(string)
+		result.Issues, _ = entry["issues"].([]string)
+		if message, ok := entry["error"].(string); ok {
+			result.Issues = append(result.Issues, message)
+		}
+		// Rows arrive in manifest order, so a repeat always names the earlier row.
+		for _, column := range []string{"encrypted_key", "confirmation_code", "address"} {
+			value := fields[line][column]
+			if value == "" {
+				continue
+			}
+			if first, ok := seen[column+"\x00"+value]; ok {
+				result.Issues = append(result.Issues, fmt.Sprintf("%s repeats line %d", column, first))
+				continue
+			}
+			seen[column+"\x00"+value] = line
+		}
+
+		result.Status = manifestVerified
+		if len(result.Issues) > 0 {
+			result.Status = manifestMismatch
+			report.Mismatched++
+		} else {
+			report.Verified++
+		}
+		report.Rows = append(report.Rows, result)
+		return nil
+	}
+
+	workers := verifyManifestWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	logger.WithField("rows", len(rows)).WithField("workers", workers).Debug("Starting manifest verification")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if _, err := batch.Run(ctx, rows, min(workers, len(rows)), process, emit); err != nil {
+		return errors.NewSystemError("manifest verification stopped", err).
+			WithContext("checked", len(report.Rows))
+	}
+
+	report.CheckedAt = time.Now().UTC().Format(time.RFC3339)
+	report.SignedOff = report.Mismatched == 0
+	if err := printManifestReport(cmd, report); err != nil {
+		return err
+	}
+	if !report.SignedOff {
+		return errors.NewCryptoError(fmt.Sprintf("%d of %d manifest rows failed verification", report.Mismatched, report.Total), nil).
+			WithContext("mismatched", report.Mismatched)
+	}
+	return nil
+}
+
+// verifyManifestRow checks one printer row against the passphrase and the
+// issued intermediate code. It returns the derived address, when the
+// confirmation code yields one, and every mismatch found.
+func verifyManifestRow(row map[string]string, passphrase []byte, issued *bip38.IntermediateCode, network *chaincfg.Params, cache *bip38.PassfactorCache) (string, []string) { //nolint:gocyclo
+	var issues []string
+	flag := func(format string, args ...any) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	code := row["confirmation_code"]
+	info, err := bip38.InspectConfirmationCode(code)
+	if err != nil {
+		flag("invalid confirmation code: %v", err)
+		return "", issues
+	}
+	if !bytes.Equal(info.OwnerEntropy, issued.OwnerEntropy) {
+		flag("confirmation code was not minted from the issued intermediate code")
+	}
+	if want, got := lotSequenceLabel(issued.LotNumber, issued.SeqNumber), lotSequenceLabel(info.LotNumber, info.SeqNumber); want != got {
+		flag("lot/sequence %s does not match the issued %s", got, want)
+	}
+	if claimed := lotSequenceClaim(row); claimed != "" && claimed != lotSequenceLabel(info.LotNumber, info.SeqNumber) {
+		flag("claimed lot/sequence %s, confirmation code has %s", claimed, lotSequenceLabel(info.LotNumber, info.SeqNumber))
+	}
+
+	confirmation, err := bip38.Confirm(bip38.ConfirmOptions{
+		ConfirmationCode: code,
+		Passphrase:       passphrase,
+		Network:          network,
+		Cache:            cache,
+	})
+	if stderrors.Is(err, bip38.ErrIncorrectPassphrase) {
+		flag("confirmation code does not match the passphrase")
+		return "", issues
+	}
+	if err != nil {
+		flag("confirmation failed: %v", err)
+		return "", issues
+	}
+	derived := confirmation.Address
+
+	switch claimed := row["address"]; {
+	case claimed == "":
+		flag("no address claimed")
+	case claimed != derived:
+		flag("claimed address %s, confirmation code derives %s", claimed, derived)
+	}
+	if value, ok := row["compressed"]; ok {
+		if claimed, err := strconv.ParseBool(value); err != nil || claimed != confirmation.Compressed {
+			flag("claimed compressed=%s, confirmation code has %t", value, confirmation.Compressed)
+		}
+	}
+	if name := row["network"]; name != "" {
+		params, err := bip38.NetworkFromName(name)
+		if err != nil || !containsNetwork(confirmation.Candidates, params) {
+			flag("claimed network %s does not match the key (%s)", name, networkLabel(confirmationResultMap(code, confirmation)))
+		}
+	}
+
+	key := row["encrypted_key"]
+	if key == "" {
+		flag("no encrypted key")
+		return derived, issues
+	}
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: key,
+		Passphrase:   passphrase,
+		Network:      confirmation.Network,
+		Cache:        cache,
+	})
+	switch {
+	case err != nil:
+		flag("encrypted key does not decrypt with the passphrase: %v", err)
+	case decrypted.Address != derived:
+		flag("encrypted key decrypts to %s, confirmation code derives %s", decrypted.Address, derived)
+	case !decrypted.ECMultiply:
+		flag("encrypted key is not an EC-multiply key")
+	}
+	return derived, issues
+}
+
+func containsNetwork(networks []*chaincfg.Params, params *chaincfg.Params) bool {
+	for _, candidate := range networks {
+		if candidate == params {
+			return true
+		}
+	}
+	return false
+}
+
+// lotSequenceLabel renders lot/sequence numbers, or "none" for codes
+// without them.
+func lotSequenceLabel(lot, sequence *uint32) string {
+	if lot == nil || sequence == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d/%d", *lot, *sequence)
+}
+
+// lotSequenceClaim renders the lot/sequence columns of a manifest row, or ""
+// when the printer left both out.
+func lotSequenceClaim(row map[string]string) string {
+	lot, sequence := row["lot_number"], row["sequence_number"]
+	if lot == "" && sequence == "" {
+		return ""
+	}
+	if lot == "" || sequence == "" {
+		return "incomplete"
+	}
+	return lot + "/" + sequence
+}
+
+func printManifestReport(cmd *cobra.Command, report *manifestReport) error {
+	if outputFormat(cmd) == "json" {
+		jsonOutput, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+
+	fmt.Printf("Manifest:       %s\n", report.Manifest)
+	fmt.Printf("SHA-256:        %s\n", report.ManifestSHA256)
+	fmt.Printf("Lot/sequence:   %s\n", lotSequenceLabel(report.LotNumber, report.SequenceNumber))
+	fmt.Printf("Checked at:     %s\n", report.CheckedAt)
+	fmt.Printf("Rows:           %d\n", report.Total)
+	fmt.Printf("Verified:       %d\n", report.Verified)
+	fmt.Printf("Mismatched:     %d\n", report.Mismatched)
+
+	for _, result := range report.Rows {
+		if result.Status != manifestMismatch {
+			continue
+		}
+		fmt.Println()
+		if result.Row != "" {
+			fmt.Printf("✗ Row %s (line %d)\n", result.Row, result.Line)
+		} else {
+			fmt.Printf("✗ Line %d\n", result.Line)
+		}
+		for _, issue := range result.Issues {
+			fmt.Printf("  - %s\n", issue)
+		}
+	}
+
+	fmt.Println()
+	if report.SignedOff {
+		fmt.Printf("✓ SIGNED OFF: all %d keys verified against the passphrase and intermediate code (manifest sha256 %s)\n",
+			report.Total, report.ManifestSHA256)
+	} else {
+		fmt.Printf("✗ NOT SIGNED OFF: %d of %d rows failed verification\n", report.Mismatched, report.Total)
+	}
+	return nil
+}
@@ -2,31 +2,235 @@ package cli
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
 )
 
+// metricsStoreEnv turns the metrics store on for every invocation.
+const metricsStoreEnv = "BIP38CLI_METRICS_STORE"
+
 var metricsCmd = &cobra.Command{
 	Use:   "metrics",
 	Short: "Show operation metrics",
-	Long: `Display collected metrics for encrypt, decrypt, and intermediate operations.
+	Long: `Display collected metrics for every operation: encrypt, decrypt,
+intermediate, confirm and generate_wif (wallet generate). EC-multiply
+encryption counts as encrypt.
+
+Includes operation counts, average durations, and success rates, overall
+and per label set (network, ec_multiply, compressed).
+--output-format prometheus prints the Prometheus text exposition instead.
 
-Includes operation counts, average durations, and success rates.
+Metrics live in the running process unless the metrics store is enabled
+with --metrics-store or ` + metricsStoreEnv + `=1. Every command then appends its
+operations to metrics.jsonl under $XDG_STATE_HOME/bip38cli (default
+~/.local/state/bip38cli), and this command reports across all runs.
+--since and --until limit the report to a window; each takes an RFC 3339
+time, a date (2006-01-02) or an age such as 24h or 7d.
+
+To watch a long batch, serve or rpc run live, export its metrics with the
+global --metrics-textfile (node_exporter's textfile collector) or
+--metrics-listen flags.
 
 Examples:
   bip38cli metrics
-  bip38cli metrics --output-format json`,
+  bip38cli metrics --output-format json
+  bip38cli metrics --since 7d
+  bip38cli batch decrypt keys.csv --metrics-textfile /var/lib/node_exporter/bip38cli.prom
+  bip38cli serve --metrics-listen tcp:127.0.0.1:9638`,
 	RunE: runMetrics,
 }
 
+var metricsResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove events from the metrics store",
+	Long: `Remove events from the metrics store. Without --since or --until the store
+is emptied; with them only events inside the window are removed.
+
+Examples:
+  bip38cli metrics reset
+  bip38cli metrics reset --until 2026-01-01`,
+	Args: cobra.NoArgs,
+	RunE: runMetricsReset,
+}
+
+var metricsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write stored metrics events to stdout",
+	Long: `Write the events of the metrics store to stdout, one JSON object per line
+with time, operation, duration_ns, success and error_type. With
+--output-format prometheus the window is aggregated into the Prometheus
+text exposition instead.
+
+Examples:
+  bip38cli metrics export --since 2026-10-01 > october.jsonl
+  bip38cli metrics export --since 24h --output-format prometheus`,
+	Args: cobra.NoArgs,
+	RunE: runMetricsExport,
+}
+
+var (
+	metricsStoreEnabled bool
+	metricsSince        string
+	metricsUntil        string
+)
+
 func init() {
 	rootCmd.AddCommand(metricsCmd)
+	metricsCmd.AddCommand(metricsResetCmd)
+	metricsCmd.AddCommand(metricsExportCmd)
+
+	rootCmd.PersistentFlags().BoolVar(&metricsStoreEnabled, "metrics-store", false, "record operations in the local metrics store (default: $"+metricsStoreEnv+")")
+	metricsCmd.PersistentFlags().StringVar(&metricsSince, "since", "", "only events at or after this time (RFC 3339, date, or age like 24h/7d)")
+	metricsCmd.PersistentFlags().StringVar(&metricsUntil, "until", "", "only events before this time (RFC 3339, date, or age like 24h/7d)")
+
+	bip38.AddSink(bip38.SinkFunc(recordLibraryEvent))
+}
+
+// recordLibraryEvent forwards an operation timed by pkg/bip38 to the process
+// metrics and the store.
+func recordLibraryEvent(e bip38.Event) {
+	event := metrics.Event{
+		Operation: e.Operation,
+		Labels:    metrics.Labels(e.Labels),
+		Duration:  e.Duration,
+		Success:   e.Err == nil,
+	}
+	if e.Err != nil {
+		event.ErrorType = string(libraryErrorType(e.Err))
+	}
+	metrics.Publish(event)
+}
+
+// libraryErrorType types a library failure: input that does not decode is a
+// validation error, anything else (a wrong passphrase included) a crypto one.
+func libraryErrorType(err error) errors.ErrorType {
+	if stderrors.Is(err, bip38.ErrInvalidFormat) {
+		return errors.ValidationError
+	}
+	return errors.CryptoError
+}
+
+// metricsStoreRequested reports whether the flag or environment enables the store.
+func metricsStoreRequested() bool {
+	if metricsStoreEnabled {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(metricsStoreEnv))
+	return enabled
+}
+
+// openMetricsStore opens the store at its default location.
+func openMetricsStore() (*metrics.Store, error) {
+	path, err := metrics.DefaultStorePath()
+	if err != nil {
+		return nil, errors.NewConfigError("failed to locate metrics store", err)
+	}
+	store, err := metrics.OpenStore(path)
+	if err != nil {
+		return nil, errors.NewSystemError("failed to open metrics store", err).
+			WithContext("path", path)
+	}
+	return store, nil
+}
+
+// startMetricsStore makes every timed operation of this run persist.
+func startMetricsStore() error {
+	if !metricsStoreRequested() {
+		return nil
+	}
+	store, err := openMetricsStore()
+	if err != nil {
+		return err
+	}
+	metrics.SetStore(store)
+	return nil
+}
+
+// parseTimeBound accepts an RFC 3339 time, a local date or an age before now.
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 time, a date or an age, got %q", value)
+}
+
+// metricsWindow parses --since and --until.
+func metricsWindow() (since, until time.Time, err error) {
+	now := time.Now()
+	if since, err = parseTimeBound(metricsSince, now); err != nil {
+		return since, until, errors.NewValidationError("invalid --since", err)
+	}
+	if until, err = parseTimeBound(metricsUntil, now); err != nil {
+		return since, until, errors.NewValidationError("invalid --until", err)
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		return since, until, errors.NewValidationError("--since must be before --until", nil).
+			WithContext("since", since.Format(time.RFC3339)).
+			WithContext("until", until.Format(time.RFC3339))
+	}
+	return since, until, nil
+}
+
+// storedMetrics aggregates the store over the requested window.
+func storedMetrics() (*metrics.Metrics, *metrics.Store, error) {
+	since, until, err := metricsWindow()
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := openMetricsStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := store.Read(since, until)
+	if err != nil {
+		return nil, nil, errors.NewSystemError("failed to read metrics store", err).
+			WithContext("path", store.Path())
+	}
+	return metrics.Aggregate(events, since), store, nil
 }
 
 func runMetrics(cmd *cobra.Command, _ []string) error {
-	snap := metrics.GetSnapshot()
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	m := metrics.GetMetrics()
+	var store *metrics.Store
+	if metricsStoreRequested() {
+		var err error
+		if m, store, err = storedMetrics(); err != nil {
+			return err
+		}
+	} else if metricsSince != "" || metricsUntil != "" {
+		return errors.NewValidationError("--since and --until need the metrics store (--metrics-store or "+metricsStoreEnv+"=1)", nil)
+	}
+	snap := m.GetSnapshot()
 
 	switch outputFormat(cmd) {
 	case "json":
@@ -35,19 +239,139 @@ func runMetrics(cmd *cobra.Command, _ []string) error {
 			return fmt.Errorf("failed to marshal metrics: %v", err)
 		}
 		fmt.Println(string(out))
+	case "prometheus":
+		if err := m.WritePrometheus(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write metrics: %v", err)
+		}
 	default:
-		fmt.Printf("Uptime:               %s\n", snap.Uptime.Round(1000000))
+		if store != nil {
+			fmt.Printf("Store:                %s\n", store.Path())
+			fmt.Printf("Since:                %s\n", snap.StartTime.Local().Format(time.RFC3339))
+		} else {
+			fmt.Printf("Uptime:               %s\n", snap.Uptime.Round(1000000))
+		}
 		fmt.Println()
-		fmt.Printf("Encrypt  - count: %d  errors: %d  avg: %s  success: %.2f%%\n",
-			snap.EncryptCount, snap.EncryptErrors, snap.AverageEncryptTime.Round(1000000),
-			metrics.GetMetrics().EncryptSuccessRate())
-		fmt.Printf("Decrypt  - count: %d  errors: %d  avg: %s  success: %.2f%%\n",
-			snap.DecryptCount, snap.DecryptErrors, snap.AverageDecryptTime.Round(1000000),
-			metrics.GetMetrics().DecryptSuccessRate())
-		fmt.Printf("Intermediate - count: %d  errors: %d  avg: %s  success: %.2f%%\n",
-			snap.IntermediateCount, snap.IntermediateErrors, snap.AverageIntermediateTime.Round(1000000),
-			metrics.GetMetrics().IntermediateSuccessRate())
+		printOperationMetrics(&snap)
+	}
+
+	return nil
+}
+
+// printOperationMetrics prints one line per operation, followed by its
+// label sets when it ran under more than one. Encrypt, decrypt and
+// intermediate are always listed.
+func printOperationMetrics(m *metrics.Metrics) {
+	names := m.OperationNames()
+	for _, name := range []string{"encrypt", "decrypt", "intermediate"} {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	stats := m.Operations()
+	for _, name := range names {
+		count, failures, total := m.Totals(name)
+		var avg time.Duration
+		if count > 0 {
+			avg = total / time.Duration(count)
+		}
+		fmt.Printf("%s - count: %d  errors: %d  avg: %s  success: %.2f%%\n",
+			strings.ToUpper(name[:1])+name[1:], count, failures, avg.Round(time.Millisecond), m.SuccessRate(name))
+
+		var labelled []metrics.OperationStats
+		for _, s := range stats {
+			if s.Operation == name {
+				labelled = append(labelled, s)
+			}
+		}
+		if len(labelled) < 2 {
+			continue
+		}
+		for _, s := range labelled {
+			fmt.Printf("  %s - count: %d  errors: %d  avg: %s  success: %.2f%%\n",
+				formatLabels(s.Labels), s.Count, s.Errors, s.AverageDuration.Round(time.Millisecond), s.SuccessRate)
+		}
+	}
+}
+
+// formatLabels renders labels as name=value pairs in name order.
+func formatLabels(labels metrics.Labels) string {
+	if len(labels) == 0 {
+		return "(no labels)"
+	}
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func runMetricsReset(cmd *cobra.Command, _ []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
 	}
 
+	since, until, err := metricsWindow()
+	if err != nil {
+		return err
+	}
+	store, err := openMetricsStore()
+	if err != nil {
+		return err
+	}
+	removed, err := store.Reset(since, until)
+	if err != nil {
+		return errors.NewSystemError("failed to reset metrics store", err).
+			WithContext("path", store.Path())
+	}
+	metrics.Reset()
+
+	switch outputFormat(cmd) {
+	case "json":
+		out, err := json.MarshalIndent(map[string]any{"store": store.Path(), "removed": removed}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(out))
+	default:
+		fmt.Printf("Removed %d events from %s\n", removed, store.Path())
+	}
+	return nil
+}
+
+func runMetricsExport(cmd *cobra.Command, _ []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	since, until, err := metricsWindow()
+	if err != nil {
+		return err
+	}
+	store, err := openMetricsStore()
+	if err != nil {
+		return err
+	}
+	events, err := store.Read(since, until)
+	if err != nil {
+		return errors.NewSystemError("failed to read metrics store", err).
+			WithContext("path", store.Path())
+	}
+
+	if outputFormat(cmd) == "prometheus" {
+		if err := metrics.Aggregate(events, since).WritePrometheus(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write metrics: %v", err)
+		}
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write metrics event: %v", err)
+		}
+	}
 	return nil
 }
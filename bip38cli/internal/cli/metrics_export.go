@@ -0,0 +1,123 @@
+package cli
+
+import (
+	stderrors "errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/metrics"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/server"
+)
+
+var (
+	metricsTextfile string
+	metricsListen   string
+	metricsInterval = 15 * time.Second
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&metricsTextfile, "metrics-textfile", "", "write Prometheus metrics to this .prom file while the command runs")
+	rootCmd.PersistentFlags().StringVar(&metricsListen, "metrics-listen", "", "serve Prometheus metrics at /metrics on tcp:127.0.0.1:PORT or unix:/path")
+	rootCmd.PersistentFlags().DurationVar(&metricsInterval, "metrics-interval", 15*time.Second, "how often --metrics-textfile is rewritten")
+}
+
+// metricsExport publishes the process metrics for the lifetime of a command.
+type metricsExport struct {
+	textfile string
+	listener net.Listener
+	srv      *http.Server
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var activeMetricsExport *metricsExport
+
+// startMetricsExport starts the exports requested by the global flags. The
+// textfile is written right away, then every --metrics-interval and once
+// more by stopMetricsExport.
+func startMetricsExport() error {
+	if metricsTextfile == "" && metricsListen == "" {
+		return nil
+	}
+	if metricsTextfile != "" && metricsInterval <= 0 {
+		return errors.NewValidationError("metrics interval must be positive", nil).
+			WithContext("metrics_interval", metricsInterval.String())
+	}
+
+	export := &metricsExport{textfile: metricsTextfile, stop: make(chan struct{}), done: make(chan struct{})}
+	if metricsListen != "" {
+		ln, err := server.Listen(metricsListen, nil)
+		if err != nil {
+			return errors.NewConfigError("failed to listen for metrics", err).
+				WithContext("metrics_listen", metricsListen)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		export.listener = ln
+		export.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := export.srv.Serve(ln); err != nil && !stderrors.Is(err, http.ErrServerClosed) {
+				logger.WithError(err).Warn("Metrics endpoint stopped")
+			}
+		}()
+		logger.WithField("listen", metricsListen).Info("Serving Prometheus metrics")
+	}
+
+	if export.textfile != "" {
+		if err := metrics.WriteTextfile(export.textfile); err != nil {
+			export.shutdown()
+			return errors.NewSystemError("failed to write metrics textfile", err).
+				WithContext("metrics_textfile", export.textfile)
+		}
+		go export.refresh(metricsInterval)
+	} else {
+		close(export.done)
+	}
+
+	activeMetricsExport = export
+	return nil
+}
+
+// refresh rewrites the textfile until stop is closed.
+func (e *metricsExport) refresh(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := metrics.WriteTextfile(e.textfile); err != nil {
+				logger.WithError(err).Warn("Failed to write metrics textfile")
+			}
+		}
+	}
+}
+
+func (e *metricsExport) shutdown() {
+	if e.srv != nil {
+		_ = e.srv.Close()
+	}
+}
+
+// stopMetricsExport writes the final textfile and closes the endpoint.
+func stopMetricsExport() {
+	export := activeMetricsExport
+	if export == nil {
+		return
+	}
+	activeMetricsExport = nil
+
+	close(export.stop)
+	<-export.done
+	if export.textfile != "" {
+		if err := metrics.WriteTextfile(export.textfile); err != nil {
+			logger.WithError(err).Warn("Failed to write metrics textfile")
+		}
+	}
+	export.shutdown()
+}
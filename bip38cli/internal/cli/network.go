@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+// resolveNetworkFlag maps an optional --network value to chain parameters.
+// An empty value returns nil so the library detects the network itself.
+func resolveNetworkFlag(name string) (*chaincfg.Params, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+	params, err := bip38.NetworkFromName(name)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid network", err).
+			WithContext("network", name)
+	}
+	return params, nil
+}
+
+// networkChoices lists the registered network names for flag help text.
+func networkChoices() string {
+	return strings.Join(networkNames(bip38.Networks()), "|")
+}
+
+func networkNames(networks []*chaincfg.Params) []string {
+	names := make([]string, 0, len(networks))
+	for _, params := range networks {
+		names = append(names, params.Name)
+	}
+	return names
+}
+
+// addNetworkFields reports the selected network, or every candidate when the
+// key alone cannot tell them apart.
+func addNetworkFields(result map[string]any, selected *chaincfg.Params, candidates []*chaincfg.Params) {
+	if selected != nil {
+		result["network"] = selected.Name
+		return
+	}
+	result["candidate_networks"] = networkNames(candidates)
+}
+
+// networkLabel renders the network fields set by addNetworkFields for text output.
+func networkLabel(result map[string]any) string {
+	if name, ok := result["network"].(string); ok {
+		return name
+	}
+	if names, ok := result["candidate_networks"].([]string); ok {
+		return "ambiguous: " + strings.Join(names, ", ")
+	}
+	return "unknown"
+}
+
+// loadNetworkFile registers the networks defined in path with the default
+// registry so every command can resolve them. An empty path is a no-op.
+func loadNetworkFile(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return nil
+	}
+
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return errors.NewConfigError("failed to open network file", err).
+			WithContext("path", path)
+	}
+	defer func() { _ = file.Close() }()
+
+	defs, err := bip38.ParseNetworkDefinitions(file)
+	if err != nil {
+		return errors.NewConfigError("invalid network file", err).
+			WithContext("path", path)
+	}
+	if _, err := bip38.DefaultNetworks.RegisterDefinitions(defs); err != nil {
+		return errors.NewConfigError("invalid network definition", err).
+			WithContext("path", path)
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/paper"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+var paperCmd = &cobra.Command{
+	Use:   "paper [ENCRYPTED_KEY]",
+	Short: "Render a printable paper wallet as SVG and PDF",
+	Long: `Render a paper wallet holding an address and its BIP38 encrypted key, as text
+and QR codes, to SVG and/or PDF files.
+
+The key comes from the argument, or is created on the spot: --generate makes
+a new key and encrypts it with a passphrase asked for twice, as 'wallet
+generate --encrypt' does, and --intermediate derives one from an intermediate
+code, as 'intermediate encrypt' does. For an existing key, --address names its
+address and is checked against the key; without it the passphrase is prompted
+and the key decrypted to find the address. The --passphrase-* flags supply
+the passphrase from a file, descriptor, stdin, environment variable, kernel
+keyring or helper command instead of a prompt. A new passphrase must meet the
+same minimum strength as for 'encrypt' (--min-passphrase-bits, --allow-weak).
+
+EC-multiply keys also print their confirmation code (taken from
+--intermediate or --confirmation-code) and their lot and sequence numbers.
+
+The page follows a JSON layout template (--template); --print-template shows
+the built-in one to start from. The same inputs always produce byte-for-byte
+identical files.
+
+Examples:
+  bip38cli paper --address 1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB --svg wallet.svg 6PRVWUbkzzsb...
+  bip38cli paper --generate --label "Savings" --pdf wallet.pdf --svg wallet.svg
+  bip38cli paper --intermediate passphraseXXX... --pdf wallet.pdf
+  bip38cli paper --print-template > layout.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPaper,
+}
+
+var (
+	paperAddress          string
+	paperConfirmationCode string
+	paperGenerate         bool
+	paperIntermediate     string
+	paperNetwork          string
+	paperUncompressed     bool
+	paperLabel            string
+	paperTemplate         string
+	paperPrintTemplate    bool
+	paperSVG              string
+	paperPDF              string
+	paperQRLevel          string
+)
+
+func init() {
+	rootCmd.AddCommand(paperCmd)
+
+	paperCmd.Flags().StringVar(&paperAddress, "address", "", "address of the encrypted key; checked against the key instead of decrypting it")
+	paperCmd.Flags().StringVar(&paperConfirmationCode, "confirmation-code", "", "confirmation code of an EC-multiply key to print")
+	paperCmd.Flags().BoolVar(&paperGenerate, "generate", false, "generate a new key and encrypt it with a prompted passphrase")
+	paperCmd.Flags().StringVar(&paperIntermediate, "intermediate", "", "generate an EC-multiply key from this intermediate code")
+	paperCmd.Flags().StringVar(&paperNetwork, "network", "", "network of the key ("+networkChoices()+"; default: mainnet when generating, else detect)")
+	paperCmd.Flags().BoolVar(&paperUncompressed, "uncompressed", false, "generate an uncompressed key")
+	paperCmd.Flags().StringVar(&paperLabel, "label", "", "label printed on the wallet")
+	paperCmd.Flags().StringVar(&paperTemplate, "template", "", "JSON layout template (default: built-in)")
+	paperCmd.Flags().BoolVar(&paperPrintTemplate, "print-template", false, "print the built-in layout template and exit")
+	paperCmd.Flags().StringVar(&paperSVG, "svg", "", "write the wallet as SVG to this file")
+	paperCmd.Flags().StringVar(&paperPDF, "pdf", "", "write the wallet as PDF to this file")
+	paperCmd.Flags().StringVar(&paperQRLevel, "qr-level", "M", "QR error correction level (L|M|Q|H)")
+	addPassphraseFlags(paperCmd)
+	addStrengthFlags(paperCmd)
+}
+
+func runPaper(cmd *cobra.Command, args []string) error { //nolint:gocyclo
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	if paperPrintTemplate {
+		fmt.Print(paper.DefaultLayoutJSON())
+		return nil
+	}
+
+	sources := 0
+	for _, set := range []bool{len(args) == 1, paperGenerate, paperIntermediate != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.NewValidationError("give exactly one of an encrypted key, --generate or --intermediate", nil)
+	}
+	if paperSVG == "" && paperPDF == "" {
+		return errors.NewValidationError("at least one of --svg or --pdf is required", nil)
+	}
+	if paperAddress != "" && len(args) == 0 {
+		return errors.NewValidationError("--address only applies to an existing encrypted key", nil)
+	}
+	if paperConfirmationCode != "" && paperIntermediate != "" {
+		return errors.NewValidationError("--intermediate already produces a confirmation code", nil)
+	}
+	if paperUncompressed && len(args) == 1 {
+		return errors.NewValidationError("--uncompressed only applies when generating a key", nil)
+	}
+
+	level, err := qr.ParseLevel(paperQRLevel)
+	if err != nil {
+		return errors.NewValidationError("invalid QR error correction level", err).
+			WithContext("qr_level", paperQRLevel)
+	}
+
+	layout, err := loadPaperLayout(paperTemplate)
+	if err != nil {
+		return err
+	}
+
+	params, err := resolveNetworkFlag(paperNetwork)
+	if err != nil {
+		return err
+	}
+
+	var wallet paper.Wallet
+	switch {
+	case paperGenerate:
+		wallet, err = generatePaperWallet(cmd, params, !paperUncompressed)
+	case paperIntermediate != "":
+		wallet, err = intermediatePaperWallet(paperIntermediate, params, !paperUncompressed)
+	default:
+		wallet, err = existingPaperWallet(args[0], paperAddress, params)
+	}
+	if err != nil {
+		return err
+	}
+	wallet.Label = paperLabel
+
+	if paperConfirmationCode != "" {
+		if err := addConfirmationCode(&wallet, paperConfirmationCode); err != nil {
+			return err
+		}
+	}
+
+	if paperSVG != "" {
+		if err := writePaperFile(paperSVG, func(w io.Writer) error {
+			return paper.RenderSVG(w, layout, wallet, level)
+		}); err != nil {
+			return err
+		}
+	}
+	if paperPDF != "" {
+		if err := writePaperFile(paperPDF, func(w io.Writer) error {
+			return paper.RenderPDF(w, layout, wallet, level)
+		}); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Paper wallet rendered")
+
+	result := map[string]any{
+		"address":       wallet.Address,
+		"encrypted_key": wallet.EncryptedKey,
+	}
+	if wallet.Network != "" {
+		result["network"] = wallet.Network
+	}
+	if wallet.ConfirmationCode != "" {
+		result["confirmation_code"] = wallet.ConfirmationCode
+	}
+	if wallet.Lot != nil && wallet.Sequence != nil {
+		result["lot_number"] = *wallet.Lot
+		result["sequence_number"] = *wallet.Sequence
+	}
+	if paperSVG != "" {
+		result["svg"] = paperSVG
+	}
+	if paperPDF != "" {
+		result["pdf"] = paperPDF
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		jsonOutput, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Address:           %s\n", wallet.Address)
+		fmt.Printf("Encrypted key:     %s\n", wallet.EncryptedKey)
+		if wallet.ConfirmationCode != "" {
+			fmt.Printf("Confirmation code: %s\n", wallet.ConfirmationCode)
+		}
+		if wallet.Lot != nil && wallet.Sequence != nil {
+			fmt.Printf("Lot/sequence:      %d/%d\n", *wallet.Lot, *wallet.Sequence)
+		}
+		if paperSVG != "" {
+			fmt.Printf("SVG written to %s\n", paperSVG)
+		}
+		if paperPDF != "" {
+			fmt.Printf("PDF written to %s\n", paperPDF)
+		}
+	}
+
+	return nil
+}
+
+// loadPaperLayout reads a layout template, or returns the built-in layout
+// when path is empty.
+func loadPaperLayout(path string) (*paper.Layout, error) {
+	if path == "" {
+		return paper.DefaultLayout(), nil
+	}
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, errors.NewInputError("failed to open layout template", err).
+			WithContext("path", path)
+	}
+	defer func() { _ = file.Close() }()
+
+	layout, err := paper.ParseLayout(file)
+	if err != nil {
+		return nil, errors.NewValidationError("invalid layout template", err).
+			WithContext("path", path)
+	}
+	return layout, nil
+}
+
+// existingPaperWallet describes an encrypted key, checking address against
+// it or, without an address, decrypting the key to find it.
+func existingPaperWallet(encryptedKey, address string, params *chaincfg.Params) (paper.Wallet, error) {
+	info, err := bip38.InspectKey(encryptedKey)
+	if err != nil {
+		return paper.Wallet{}, errors.NewValidationError("invalid encrypted key", err)
+	}
+
+	wallet := paper.Wallet{EncryptedKey: encryptedKey}
+	if info.HasLotSeq {
+		wallet.Lot, wallet.Sequence = info.LotNumber, info.SeqNumber
+	}
+	if params != nil {
+		wallet.Network = params.Name
+	}
+
+	if address != "" {
+		if !info.MatchesAddress(address) {
+			return paper.Wallet{}, errors.NewValidationError("address does not match the encrypted key", nil).
+				WithContext("address", address)
+		}
+		wallet.Address = address
+		return wallet, nil
+	}
+
+	passphrase, err := getPassphrase("Enter passphrase: ")
+	if err != nil {
+		return paper.Wallet{}, fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	defer secureZero(passphrase)
+
+	decrypted, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: encryptedKey,
+		Passphrase:   passphrase,
+		Network:      params,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to decrypt key")
+		return paper.Wallet{}, errors.NewCryptoError("failed to decrypt key", err)
+	}
+	wallet.Address = decrypted.Address
+	if decrypted.Network != nil {
+		wallet.Network = decrypted.Network.Name
+	}
+	return wallet, nil
+}
+
+// generatePaperWallet creates a key and encrypts it with a new passphrase
+// that meets the strength policy.
+func generatePaperWallet(cmd *cobra.Command, params *chaincfg.Params, compressed bool) (paper.Wallet, error) {
+	if params == nil {
+		params = &chaincfg.MainNetParams
+	}
+
+	passphrase, err := getNewPassphrase("Enter passphrase for encryption: ")
+	if err != nil {
+		return paper.Wallet{}, err
+	}
+	defer secureZero(passphrase)
+	if err := checkPassphraseStrength(cmd, passphrase); err != nil {
+		return paper.Wallet{}, err
+	}
+
+	wif, err := generateWIF(params, compressed)
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate WIF")
+		return paper.Wallet{}, errors.NewCryptoError("failed to generate private key", err)
+	}
+
+	encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
+	if err != nil {
+		logger.WithError(err).Error("Failed to encrypt generated WIF")
+		return paper.Wallet{}, errors.NewCryptoError("failed to encrypt generated key", err)
+	}
+
+	return paper.Wallet{
+		Address:      encrypted.Address,
+		EncryptedKey: encrypted.EncryptedKey,
+		Network:      params.Name,
+	}, nil
+}
+
+// intermediatePaperWallet creates an EC-multiply key from an intermediate
+// code.
+func intermediatePaperWallet(code string, params *chaincfg.Params, compressed bool) (paper.Wallet, error) {
+	if !bip38.IsValidIntermediateCode(code) {
+		return paper.Wallet{}, errors.NewValidationError("invalid intermediate code format", nil)
+	}
+
+	ecResult, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: code,
+		Compressed:       compressed,
+		Network:          params,
+	})
+	if err != nil {
+		logger.WithError(err).Error("EC-multiply encryption failed")
+		return paper.Wallet{}, errors.NewCryptoError("EC-multiply encryption failed", err)
+	}
+
+	wallet := paper.Wallet{
+		Address:          ecResult.Address,
+		EncryptedKey:     ecResult.EncryptedKey,
+		ConfirmationCode: ecResult.ConfirmationCode,
+		Network:          ecResult.Network.Name,
+	}
+	if info, err := bip38.InspectKey(ecResult.EncryptedKey); err == nil && info.HasLotSeq {
+		wallet.Lot, wallet.Sequence = info.LotNumber, info.SeqNumber
+	}
+	return wallet, nil
+}
+
+// addConfirmationCode attaches a confirmation code after checking that it
+// belongs to the wallet's key.
+func addConfirmationCode(wallet *paper.Wallet, code string) error {
+	info, err := bip38.InspectConfirmationCode(code)
+	if err != nil {
+		return errors.NewValidationError("invalid confirmation code", err)
+	}
+	key, err := bip38.InspectKey(wallet.EncryptedKey)
+	if err != nil {
+		return errors.NewValidationError("invalid encrypted key", err)
+	}
+	if !key.ECMultiply || !bytes.Equal(info.AddressHash, key.AddressHash) {
+		return errors.NewValidationError("confirmation code does not belong to the encrypted key", nil)
+	}
+	wallet.ConfirmationCode = code
+	return nil
+}
+
+// writePaperFile renders into memory first so a failed render leaves no
+// partial file behind. Paper wallets hold keys, so files are private.
+func writePaperFile(path string, render func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		return errors.NewValidationError("failed to render paper wallet", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return errors.NewSystemError("failed to write paper wallet", err).
+			WithContext("path", path)
+	}
+	return nil
+}
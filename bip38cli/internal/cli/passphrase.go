@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/keyring"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Non-interactive passphrase sources for scripts, pipelines and secret
+// stores. At most one may be set; without any, getPassphrase prompts on the
+// terminal.
+var (
+	passphraseFile    string
+	passphraseFD      = -1
+	passphraseEnv     string
+	passphraseStdin   bool
+	passphraseKeyring string
+	passphraseCommand string
+)
+
+var readPassword = term.ReadPassword
+
+// maxPassphraseLen bounds a passphrase read from a file, descriptor or stdin,
+// so a wrong path cannot make us read a large file into memory.
+const maxPassphraseLen = 4096
+
+// passphraseProvider supplies a passphrase without a terminal prompt.
+type passphraseProvider interface {
+	// Passphrase returns the passphrase in a new slice, which the caller
+	// wipes with secureZero.
+	Passphrase() ([]byte, error)
+}
+
+// addPassphraseFlags registers the passphrase source flags on cmd.
+func addPassphraseFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&passphraseFile, "passphrase-file", "", "read the passphrase from the first line of this file")
+	flags.IntVar(&passphraseFD, "passphrase-fd", -1, "read the passphrase from the first line of this open file descriptor")
+	flags.StringVar(&passphraseEnv, "passphrase-env", "", "read the passphrase from this environment variable (insecure)")
+	flags.BoolVar(&passphraseStdin, "passphrase-stdin", false, "read the passphrase from the first line of stdin")
+	flags.StringVar(&passphraseKeyring, "passphrase-keyring", "", "read the passphrase from this Linux kernel keyring key ([session:|user:]DESCRIPTION)")
+	flags.StringVar(&passphraseCommand, "passphrase-command", "", "run this shell command and read the passphrase from the first line of its output")
+}
+
+// passphraseFromFlags returns the provider chosen with the passphrase flags,
+// or nil when the passphrase is typed at a prompt.
+func passphraseFromFlags() (passphraseProvider, error) {
+	var (
+		names     []string
+		providers []passphraseProvider
+	)
+	add := func(set bool, name string, provider passphraseProvider) {
+		if set {
+			names = append(names, name)
+			providers = append(providers, provider)
+		}
+	}
+	add(passphraseFile != "", "--passphrase-file", filePassphrase(passphraseFile))
+	add(passphraseFD >= 0, "--passphrase-fd", fdPassphrase(passphraseFD))
+	add(passphraseEnv != "", "--passphrase-env", envPassphrase(passphraseEnv))
+	add(passphraseStdin, "--passphrase-stdin", stdinPassphrase{})
+	add(passphraseKeyring != "", "--passphrase-keyring", keyringPassphrase(passphraseKeyring))
+	add(passphraseCommand != "", "--passphrase-command", commandPassphrase(passphraseCommand))
+
+	switch len(providers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return providers[0], nil
+	default:
+		return nil, errors.NewValidationError("only one passphrase source may be given", nil).
+			WithContext("sources", strings.Join(names, ", "))
+	}
+}
+
+// checkStdinFree rejects --passphrase-stdin when what stands for the key is
+// also to be read from stdin.
+func checkStdinFree(what string) error {
+	if passphraseStdin {
+		return errors.NewValidationError("cannot read both the passphrase and the "+what+" from stdin; pass the "+what+" as an argument", nil)
+	}
+	return nil
+}
+
+func getPassphrase(prompt string) ([]byte, error) {
+	provider, err := passphraseFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		return provider.Passphrase()
+	}
+
+	fmt.Print(prompt)
+	bytePassword, err := readPassword(syscall.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println() // Print newline after hidden input so shell isn't messy
+	return bytePassword, nil
+}
+
+// getNewPassphrase reads a passphrase to encrypt with. A typed passphrase is
+// asked for twice to catch typos; one read from a source is taken as given.
+func getNewPassphrase(prompt string) ([]byte, error) {
+	passphrase, err := getPassphrase(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	if provider, _ := passphraseFromFlags(); provider != nil {
+		return passphrase, nil
+	}
+
+	confirmPassphrase, err := getPassphrase("Confirm passphrase: ")
+	if err != nil {
+		secureZero(passphrase)
+		return nil, fmt.Errorf("failed to read passphrase confirmation: %v", err)
+	}
+	defer secureZero(confirmPassphrase)
+
+	if !bytes.Equal(passphrase, confirmPassphrase) {
+		secureZero(passphrase)
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// filePassphrase reads the first line of a file, warning when other users
+// can read the file too.
+type filePassphrase string
+
+func (path filePassphrase) Passphrase() ([]byte, error) {
+	file, err := os.Open(string(path)) //nolint:gosec
+	if err != nil {
+		return nil, errors.NewInputError("failed to open passphrase file", err).
+			WithContext("path", string(path))
+	}
+	defer func() { _ = file.Close() }()
+
+	// Permission bits mean nothing on Windows, where ACLs decide.
+	if info, err := file.Stat(); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		logger.WithField("path", string(path)).
+			WithField("mode", info.Mode().Perm().String()).
+			Warn("Passphrase file is accessible to other users; restrict it with chmod 600")
+	}
+	return readPassphraseLine(file)
+}
+
+// fdPassphrase reads the first line of an inherited file descriptor and
+// closes it.
+type fdPassphrase int
+
+func (fd fdPassphrase) Passphrase() ([]byte, error) {
+	file := os.NewFile(uintptr(fd), "passphrase-fd")
+	if file == nil {
+		return nil, errors.NewInputError("invalid passphrase file descriptor", nil).
+			WithContext("fd", int(fd))
+	}
+	defer func() { _ = file.Close() }()
+	return readPassphraseLine(file)
+}
+
+// envPassphrase copies the passphrase out of an environment variable.
+type envPassphrase string
+
+func (name envPassphrase) Passphrase() ([]byte, error) {
+	value, ok := os.LookupEnv(string(name))
+	if !ok {
+		return nil, errors.NewInputError("passphrase environment variable is not set", nil).
+			WithContext("variable", string(name))
+	}
+	logger.WithField("variable", string(name)).
+		Warn("Reading the passphrase from the environment: other processes of the same user can see it, and it is passed on to child processes; prefer --passphrase-file or --passphrase-fd")
+	return []byte(value), nil
+}
+
+// stdinPassphrase reads the first line of stdin.
+type stdinPassphrase struct{}
+
+func (stdinPassphrase) Passphrase() ([]byte, error) {
+	return readPassphraseLine(os.Stdin)
+}
+
+// keyringPassphrase reads a key from the Linux kernel keyring, such as one
+// stored with 'passphrase cache'.
+type keyringPassphrase string
+
+func (ref keyringPassphrase) Passphrase() ([]byte, error) {
+	ring, description, err := keyring.ParseRef(string(ref))
+	if err != nil {
+		return nil, errors.NewValidationError("invalid keyring reference", err)
+	}
+	value, err := keyring.Read(ring, description)
+	switch {
+	case stderrors.Is(err, keyring.ErrNotFound):
+		return nil, errors.NewInputError("passphrase not found in the kernel keyring; store it with 'bip38cli passphrase cache'", err).
+			WithContext("key", string(ref))
+	case err != nil:
+		return nil, errors.NewSystemError("failed to read the kernel keyring", err).
+			WithContext("key", string(ref))
+	}
+	return value, nil
+}
+
+// commandPassphrase runs a helper such as "pass show bip38/cold" through the
+// shell and reads the first line of its output. The helper shares our
+// terminal, so it can prompt to unlock its own store.
+type commandPassphrase string
+
+func (command commandPassphrase) Passphrase() ([]byte, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, string(command)) //nolint:gosec
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.NewSystemError("failed to run passphrase command", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.NewInputError("failed to run passphrase command", err).
+			WithContext("command", string(command))
+	}
+
+	passphrase, readErr := readPassphraseLine(stdout)
+	// Let the helper write the rest, such as the other lines of a pass entry.
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		secureZero(passphrase)
+		return nil, errors.NewInputError("passphrase command failed", err).
+			WithContext("command", string(command))
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return passphrase, nil
+}
+
+// readPassphraseLine reads up to the first newline, which is dropped along
+// with a preceding carriage return. It reads one byte at a time so nothing
+// after the line is consumed, and wipes what it read if it fails.
+func readPassphraseLine(r io.Reader) ([]byte, error) {
+	buf := make([]byte, 0, maxPassphraseLen)
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			if len(buf) == maxPassphraseLen {
+				secureZero(buf)
+				return nil, errors.NewInputError(fmt.Sprintf("passphrase is longer than %d bytes", maxPassphraseLen), nil)
+			}
+			buf = append(buf, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			secureZero(buf)
+			return nil, errors.NewInputError("failed to read passphrase", err)
+		}
+	}
+	if n := len(buf); n > 0 && buf[n-1] == '\r' {
+		buf[n-1] = 0
+		buf = buf[:n-1]
+	}
+	return buf, nil
+}
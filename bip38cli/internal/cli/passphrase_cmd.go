@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/keyring"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// defaultPassphraseKey is the keyring key 'passphrase cache' and 'passphrase
+// forget' use when none is named.
+const defaultPassphraseKey = "bip38cli"
+
+var passphraseCmd = &cobra.Command{
+	Use:   "passphrase",
+	Short: "Cache passphrases in the Linux kernel keyring",
+	Long: `Keep an unlocked passphrase in the Linux kernel keyring for a while, so
+scripts and batch jobs can use it without asking again.
+
+The passphrase lives in kernel memory, is never written to disk and expires
+on its own. Commands read it back with --passphrase-keyring, and batch rows
+with a passphrase_ref of keyring:KEY.`,
+}
+
+var passphraseCacheCmd = &cobra.Command{
+	Use:   "cache [KEY]",
+	Short: "Store a passphrase in the kernel keyring until it expires",
+	Long: `Store a passphrase in the kernel keyring under KEY (default: ` + defaultPassphraseKey + `) for
+--ttl. KEY may start with session: or user: to pick the keyring; the session
+keyring, shared by the processes of this login session, is the default.
+Outside a login session, such as under cron, the user's default session
+keyring takes its place.
+
+The passphrase is prompted twice, or read once from any of the passphrase
+source flags, so an entry of a password manager can be unlocked once for a
+whole run.
+
+Examples:
+  bip38cli passphrase cache
+  bip38cli passphrase cache --ttl 1h --passphrase-command "pass show bip38/cold" cold
+  bip38cli batch decrypt --passphrase-keyring cold keys.csv`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPassphraseCache,
+}
+
+var passphraseForgetCmd = &cobra.Command{
+	Use:   "forget [KEY]",
+	Short: "Remove a cached passphrase from the kernel keyring",
+	Long: `Revoke the passphrase cached under KEY (default: ` + defaultPassphraseKey + `) before it expires.
+
+Examples:
+  bip38cli passphrase forget
+  bip38cli passphrase forget cold`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPassphraseForget,
+}
+
+var passphraseCacheTTL = 15 * time.Minute
+
+func init() {
+	rootCmd.AddCommand(passphraseCmd)
+	passphraseCmd.AddCommand(passphraseCacheCmd)
+	passphraseCmd.AddCommand(passphraseForgetCmd)
+
+	passphraseCacheCmd.Flags().DurationVar(&passphraseCacheTTL, "ttl", 15*time.Minute, "forget the passphrase after this long (0: when the keyring goes away)")
+	addPassphraseFlags(passphraseCacheCmd)
+}
+
+// passphraseKeyArg returns the keyring reference named on the command line.
+func passphraseKeyArg(args []string) (string, keyring.Ring, string, error) {
+	ref := defaultPassphraseKey
+	if len(args) > 0 {
+		ref = args[0]
+	}
+	ring, description, err := keyring.ParseRef(ref)
+	if err != nil {
+		return "", "", "", errors.NewValidationError("invalid keyring key", err)
+	}
+	return ref, ring, description, nil
+}
+
+func runPassphraseCache(cmd *cobra.Command, args []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	ref, ring, description, err := passphraseKeyArg(args)
+	if err != nil {
+		return err
+	}
+	if passphraseCacheTTL < 0 {
+		return errors.NewValidationError("--ttl cannot be negative", nil)
+	}
+	if ring == "" {
+		ring = keyring.Session
+	}
+
+	passphrase, err := getNewPassphrase("Enter passphrase to cache: ")
+	if err != nil {
+		return err
+	}
+	defer secureZero(passphrase)
+
+	if err := keyring.Store(ring, description, passphrase, passphraseCacheTTL); err != nil {
+		return errors.NewSystemError("failed to store the passphrase in the kernel keyring", err).
+			WithContext("key", ref)
+	}
+	logger.WithField("key", ref).Info("Cached passphrase in kernel keyring")
+
+	switch outputFormat(cmd) {
+	case "json":
+		out := map[string]any{
+			"key":         ref,
+			"keyring":     string(ring),
+			"ttl_seconds": passphraseCacheTTL.Seconds(),
+		}
+		jsonOutput, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		expiry := "until the keyring goes away"
+		if passphraseCacheTTL > 0 {
+			expiry = "for " + passphraseCacheTTL.String()
+		}
+		fmt.Printf("Passphrase cached in the %s keyring as %s %s\n", ring, description, expiry)
+		fmt.Printf("Use it with: --passphrase-keyring %s\n", ref)
+	}
+	return nil
+}
+
+func runPassphraseForget(cmd *cobra.Command, args []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	ref, ring, description, err := passphraseKeyArg(args)
+	if err != nil {
+		return err
+	}
+	err = keyring.Remove(ring, description)
+	switch {
+	case stderrors.Is(err, keyring.ErrNotFound):
+		return errors.NewInputError("no cached passphrase under this key", err).
+			WithContext("key", ref)
+	case err != nil:
+		return errors.NewSystemError("failed to remove the passphrase from the kernel keyring", err).
+			WithContext("key", ref)
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		jsonOutput, err := json.MarshalIndent(map[string]any{"key": ref, "forgotten": true}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Forgot cached passphrase %s\n", ref)
+	}
+	return nil
+}
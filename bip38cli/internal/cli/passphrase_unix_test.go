@@ -0,0 +1,49 @@
+//go:build unix
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestPassphraseFromFD(t *testing.T) {
+	defer func() { passphraseFD = -1 }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	if _, err := w.WriteString("from fd"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = w.Close()
+
+	// getPassphrase closes the descriptor it reads, so hand it a copy that
+	// no *os.File owns.
+	fd, err := syscall.Dup(int(r.Fd()))
+	_ = r.Close()
+	if err != nil {
+		t.Fatalf("Dup: %v", err)
+	}
+	passphraseFD = fd
+	if got, err := getPassphrase(""); err != nil || string(got) != "from fd" {
+		t.Fatalf("fd: got %q, %v", got, err)
+	}
+}
+
+func TestPassphraseFromCommand(t *testing.T) {
+	defer func() { passphraseCommand = "" }()
+
+	// Only the first line is the passphrase, as with pass entries.
+	passphraseCommand = `printf 'from helper\nlogin: someone\n'`
+	if got, err := getNewPassphrase(""); err != nil || string(got) != "from helper" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	passphraseCommand = "echo partial; exit 3"
+	if _, err := getPassphrase(""); err == nil {
+		t.Fatal("accepted the output of a failing command")
+	}
+}
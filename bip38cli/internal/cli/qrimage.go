@@ -0,0 +1,86 @@
+package cli
+
+import (
+	stderrors "errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoding for --qr-image
+	_ "image/jpeg" // register JPEG decoding for --qr-image
+	_ "image/png"  // register PNG decoding for --qr-image
+	"io"
+	"os"
+	"strings"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+// maxQRImagePixels bounds the decoded size of --qr-image files, so a small
+// compressed file cannot claim gigabytes of memory.
+const maxQRImagePixels = 50_000_000
+
+// readQRImage decodes every QR code in the image at path and returns the
+// distinct payloads accepted by valid. A paper wallet scan holds an address
+// code too, which valid filters out. what names the expected payload in
+// errors.
+func readQRImage(path, what string, valid func(string) bool) ([]string, error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, errors.NewInputError("failed to open QR image", err).WithContext("path", path)
+	}
+	defer func() { _ = file.Close() }()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, errors.NewInputError("failed to decode QR image", err).WithContext("path", path)
+	}
+	if config.Width*config.Height > maxQRImagePixels {
+		return nil, errors.NewInputError(fmt.Sprintf("QR image is too large (%dx%d)", config.Width, config.Height), nil).
+			WithContext("path", path)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.NewSystemError("failed to read QR image", err).WithContext("path", path)
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, errors.NewInputError("failed to decode QR image", err).WithContext("path", path)
+	}
+
+	payloads, err := qr.DecodeImage(img)
+	if stderrors.Is(err, qr.ErrNotFound) {
+		return nil, errors.NewInputError("no readable QR code found in image", err).WithContext("path", path)
+	}
+	if err != nil {
+		return nil, errors.NewInputError("failed to decode QR image", err).WithContext("path", path)
+	}
+
+	var values []string
+	for _, payload := range payloads {
+		value := strings.TrimSpace(string(payload))
+		if valid(value) {
+			values = append(values, value)
+		}
+	}
+	logger.WithField("codes", len(payloads)).WithField("accepted", len(values)).Debug("Decoded QR image")
+	if len(values) == 0 {
+		return nil, errors.NewValidationError(fmt.Sprintf("no %s found in QR image", what), nil).
+			WithContext("path", path).
+			WithContext("qr_codes", len(payloads))
+	}
+	return values, nil
+}
+
+// readSingleQRImage is readQRImage for commands that take one value. An
+// image holding several different ones is rejected rather than guessed.
+func readSingleQRImage(path, what string, valid func(string) bool) (string, error) {
+	values, err := readQRImage(path, what, valid)
+	if err != nil {
+		return "", err
+	}
+	if len(values) > 1 {
+		return "", errors.NewValidationError(fmt.Sprintf("QR image holds %d different values that look like a %s", len(values), what), nil).
+			WithContext("path", path)
+	}
+	return values[0], nil
+}
@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/recovery"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover ENCRYPTED_KEY",
+	Short: "Search for a forgotten BIP38 passphrase",
+	Long: `Search candidate passphrases for a BIP38 encrypted key (6P...).
+
+Candidates come from wordlists (one passphrase per line), hashcat-style masks
+and arrangements of remembered fragments. Sources are tried in that order.
+Both non-EC and EC-multiply keys are supported.
+
+Mask placeholders: ?l lower, ?u upper, ?d digits, ?h/?H hex, ?s symbols,
+?a all of them, ?1-?4 custom charsets (--custom-charset, in order) and ??
+for a literal question mark.
+
+Fragments are combined in every order, using between --min-fragments and
+--max-fragments distinct pieces joined by each --separator.
+
+Progress and an ETA based on the measured scrypt speed are printed to stderr.
+With --checkpoint the position is saved periodically and on interrupt; running
+the same command again resumes where it stopped.
+
+Examples:
+  bip38cli recover --wordlist words.txt 6P...
+  bip38cli recover --mask 'Summer?d?d?d?d?s' 6P...
+  bip38cli recover --custom-charset '?l?d' --mask 'key?1?1?1' 6P...
+  bip38cli recover --fragment blue --fragment Horse --fragment 42 --separator '' --separator '-' 6P...
+  bip38cli recover --wordlist words.txt --checkpoint recover.json 6P...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRecover,
+}
+
+var (
+	recoverWordlists        []string
+	recoverMasks            []string
+	recoverCustomCharsets   []string
+	recoverFragments        []string
+	recoverMinFragments     int
+	recoverMaxFragments     int
+	recoverSeparators       []string
+	recoverWorkers          int
+	recoverCheckpoint       string
+	recoverRestart          bool
+	recoverProgressInterval = 10 * time.Second
+)
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+	addRecoverySearchFlags(recoverCmd)
+	recoverCmd.Flags().IntVar(&recoverWorkers, "workers", 0, "parallel workers (default: number of CPUs)")
+}
+
+// addRecoverySearchFlags registers the candidate source and checkpoint flags
+// shared by local and coordinated searches.
+func addRecoverySearchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&recoverWordlists, "wordlist", nil, "file with one candidate per line (repeatable)")
+	cmd.Flags().StringArrayVar(&recoverMasks, "mask", nil, "hashcat-style mask (repeatable)")
+	cmd.Flags().StringArrayVar(&recoverCustomCharsets, "custom-charset", nil, "charset for ?1-?4, in order (repeatable)")
+	cmd.Flags().StringArrayVar(&recoverFragments, "fragment", nil, "remembered passphrase fragment (repeatable)")
+	cmd.Flags().IntVar(&recoverMinFragments, "min-fragments", 1, "fewest fragments per candidate")
+	cmd.Flags().IntVar(&recoverMaxFragments, "max-fragments", 0, "most fragments per candidate (default: all)")
+	cmd.Flags().StringArrayVar(&recoverSeparators, "separator", nil, "separator between fragments (repeatable, default: none)")
+	cmd.Flags().StringVar(&recoverCheckpoint, "checkpoint", "", "file to save and resume progress")
+	cmd.Flags().BoolVar(&recoverRestart, "restart", false, "ignore an existing checkpoint and start over")
+	cmd.Flags().DurationVar(&recoverProgressInterval, "progress-interval", 10*time.Second, "how often to report progress and save the checkpoint")
+}
+
+func recoverySpec() recovery.Spec {
+	return recovery.Spec{
+		Wordlists:      recoverWordlists,
+		Masks:          recoverMasks,
+		CustomCharsets: recoverCustomCharsets,
+		Fragments:      recoverFragments,
+		MinFragments:   recoverMinFragments,
+		MaxFragments:   recoverMaxFragments,
+		Separators:     recoverSeparators,
+	}
+}
+
+func runRecover(cmd *cobra.Command, args []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	session, err := newRecoverySession(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := recovery.Run(ctx, recovery.Config{
+		EncryptedKey:   session.encryptedKey,
+		Space:          session.plan,
+		Start:          session.base.Next,
+		Workers:        recoverWorkers,
+		Report:         session.report,
+		ReportInterval: recoverProgressInterval,
+	})
+	return session.finish(cmd, result, err)
+}
+
+// recoverySession holds what local and coordinated searches share: the
+// candidate plan, the checkpoint and progress reporting.
+type recoverySession struct {
+	encryptedKey string
+	spec         recovery.Spec
+	plan         *recovery.Plan
+	base         recovery.Checkpoint
+	checkpoint   *recovery.Checkpoint
+	saveFailed   bool
+}
+
+func newRecoverySession(encryptedKey string) (*recoverySession, error) {
+	if !bip38.IsBIP38Format(encryptedKey) {
+		return nil, errors.NewValidationError("invalid BIP38 encrypted key format", nil)
+	}
+
+	spec := recoverySpec()
+	plan, err := spec.Build()
+	if err != nil {
+		return nil, errors.NewValidationError("invalid candidate sources", err)
+	}
+
+	checkpoint, err := loadRecoveryCheckpoint(encryptedKey, spec, plan)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Next > 0 {
+		logger.WithField("next", checkpoint.Next).WithField("total", checkpoint.Total).Info("Resuming from checkpoint")
+		fmt.Fprintf(os.Stderr, "Resuming at candidate %d of %d\n", checkpoint.Next, checkpoint.Total)
+	}
+
+	return &recoverySession{
+		encryptedKey: encryptedKey,
+		spec:         spec,
+		plan:         plan,
+		base:         *checkpoint,
+		checkpoint:   checkpoint,
+	}, nil
+}
+
+// report prints progress and saves the checkpoint.
+func (s *recoverySession) report(p recovery.Progress) {
+	s.checkpoint.Advance(&s.base, p)
+	printRecoveryProgress(s.checkpoint, p)
+	if recoverCheckpoint == "" {
+		return
+	}
+	if err := s.checkpoint.Save(recoverCheckpoint); err != nil && !s.saveFailed {
+		s.saveFailed = true
+		logger.WithError(err).Warn("Failed to save checkpoint")
+	}
+}
+
+// finish turns the outcome of a search into command output or an error.
+func (s *recoverySession) finish(cmd *cobra.Command, result *recovery.Result, err error) error {
+	if err != nil {
+		if stderrors.Is(err, context.Canceled) {
+			appErr := errors.NewSystemError("recovery interrupted", err).
+				WithContext("next", s.checkpoint.Next)
+			if recoverCheckpoint != "" {
+				appErr = appErr.WithContext("checkpoint", recoverCheckpoint)
+			}
+			return appErr
+		}
+		return errors.NewCryptoError("recovery failed", err)
+	}
+
+	if !result.Found {
+		return errors.NewCryptoError("passphrase not found", nil).
+			WithContext("tried", s.checkpoint.Tried)
+	}
+
+	if recoverCheckpoint != "" {
+		if err := os.Remove(recoverCheckpoint); err != nil && !stderrors.Is(err, fs.ErrNotExist) {
+			logger.WithError(err).Warn("Failed to remove checkpoint")
+		}
+	}
+
+	output := map[string]any{
+		"passphrase":  result.Passphrase,
+		"private_key": result.WIF.String(),
+		"compressed":  result.WIF.CompressPubKey,
+		"index":       result.Index,
+		"tried":       s.checkpoint.Tried,
+	}
+
+	switch outputFormat(cmd) {
+	case "json":
+		jsonOutput, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Passphrase: %s\n", result.Passphrase)
+		fmt.Printf("Private key (WIF): %s\n", result.WIF.String())
+		if isVerbose(cmd) {
+			fmt.Printf("Candidate index: %d\n", result.Index)
+			fmt.Printf("Attempts: %d\n", s.checkpoint.Tried)
+		}
+	}
+
+	return nil
+}
+
+// loadRecoveryCheckpoint resumes from --checkpoint when it matches this run,
+// or starts a fresh checkpoint.
+func loadRecoveryCheckpoint(encryptedKey string, spec recovery.Spec, plan *recovery.Plan) (*recovery.Checkpoint, error) {
+	fresh := recovery.NewCheckpoint(encryptedKey, spec, plan)
+	if recoverCheckpoint == "" || recoverRestart {
+		return fresh, nil
+	}
+
+	existing, err := recovery.LoadCheckpoint(recoverCheckpoint)
+	if stderrors.Is(err, fs.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, errors.NewInputError("failed to load checkpoint", err).
+			WithContext("path", recoverCheckpoint)
+	}
+	if err := existing.Matches(encryptedKey, plan); err != nil {
+		return nil, errors.NewValidationError("checkpoint does not match this search; use --restart to discard it", err).
+			WithContext("path", recoverCheckpoint)
+	}
+	return existing, nil
+}
+
+func printRecoveryProgress(checkpoint *recovery.Checkpoint, p recovery.Progress) {
+	percent := 100.0
+	if checkpoint.Total > 0 {
+		percent = float64(checkpoint.Next) / float64(checkpoint.Total) * 100
+	}
+	eta := "unknown"
+	if p.Rate > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "Progress: %d/%d (%.2f%%)  %.1f/s  ETA %s\n",
+		checkpoint.Next, checkpoint.Total, percent, p.Rate, eta)
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/recovery"
+	"github.com/spf13/cobra"
+)
+
+// recoverTokenEnv supplies the shared token without putting it on the command line.
+const recoverTokenEnv = "BIP38CLI_RECOVER_TOKEN"
+
+var recoverCoordinatorCmd = &cobra.Command{
+	Use:   "coordinator ENCRYPTED_KEY",
+	Short: "Serve a passphrase search to recover workers",
+	Long: `Split a passphrase search into shards and hand them to 'recover worker'
+processes over a TCP or Unix socket.
+
+The candidate flags are the same as for 'recover'; wordlists are read by the
+coordinator and sent to workers, so workers need no files. A shard only
+counts as searched once a worker reports it: shards held by a worker that
+fails, disconnects or stops sending heartbeats for --lease-timeout are handed
+out again. Workers report the index of a match and the coordinator verifies it.
+
+Addresses are host:port, tcp:host:port or unix:/path/to/socket. Unix sockets
+are created with owner-only permissions. Workers are sent the encrypted key
+and the search, so a TCP address other than loopback needs a shared token,
+set with --token or ` + recoverTokenEnv + `.
+
+Examples:
+  bip38cli recover coordinator --listen unix:/tmp/recover.sock --wordlist words.txt 6P...
+  bip38cli recover coordinator --listen 127.0.0.1:7838 --mask '?l?l?l?l?d?d' --checkpoint recover.json 6P...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRecoverCoordinator,
+}
+
+var recoverWorkerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Search shards served by a recover coordinator",
+	Long: `Connect to a 'recover coordinator', then search the shards it hands out
+until the passphrase is found or the candidates are exhausted.
+
+Examples:
+  bip38cli recover worker --connect unix:/tmp/recover.sock
+  bip38cli recover worker --connect 192.0.2.10:7838 --workers 8`,
+	Args: cobra.NoArgs,
+	RunE: runRecoverWorker,
+}
+
+var (
+	recoverListen       = "127.0.0.1:7838"
+	recoverShardSize    uint64
+	recoverLeaseTimeout = 2 * time.Minute
+	recoverToken        string
+	recoverConnect      string
+	recoverWorkerName   string
+)
+
+func init() {
+	recoverCmd.AddCommand(recoverCoordinatorCmd)
+	recoverCmd.AddCommand(recoverWorkerCmd)
+
+	addRecoverySearchFlags(recoverCoordinatorCmd)
+	recoverCoordinatorCmd.Flags().StringVar(&recoverListen, "listen", "127.0.0.1:7838", "address to serve workers on")
+	recoverCoordinatorCmd.Flags().Uint64Var(&recoverShardSize, "shard-size", 256, "candidates per shard")
+	recoverCoordinatorCmd.Flags().DurationVar(&recoverLeaseTimeout, "lease-timeout", 2*time.Minute, "reassign a shard after this long without a heartbeat")
+	recoverCoordinatorCmd.Flags().StringVar(&recoverToken, "token", "", "shared secret workers must present (default: $"+recoverTokenEnv+")")
+
+	recoverWorkerCmd.Flags().StringVar(&recoverConnect, "connect", "", "coordinator address")
+	recoverWorkerCmd.Flags().IntVar(&recoverWorkers, "workers", 0, "parallel workers (default: number of CPUs)")
+	recoverWorkerCmd.Flags().StringVar(&recoverWorkerName, "name", "", "worker name (default: hostname)")
+	recoverWorkerCmd.Flags().StringVar(&recoverToken, "token", "", "shared secret expected by the coordinator (default: $"+recoverTokenEnv+")")
+}
+
+func resolveRecoverToken() string {
+	if recoverToken != "" {
+		return recoverToken
+	}
+	return os.Getenv(recoverTokenEnv)
+}
+
+// checkRecoverListen refuses to serve the encrypted key and the search
+// without a token on a TCP address that other hosts can reach, and warns on
+// loopback, where any local user can still connect.
+func checkRecoverListen(listen, token string) error {
+	network, address, err := recovery.ParseAddress(listen)
+	if err != nil {
+		return errors.NewValidationError("invalid listen address", err).
+			WithContext("listen", listen)
+	}
+	if network != "tcp" || token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.NewValidationError("invalid listen address", err).
+			WithContext("listen", listen)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.NewValidationError("a token is required to serve workers on a non-loopback address (--token or $"+recoverTokenEnv+")", nil).
+			WithContext("listen", listen)
+	}
+	logger.Warn("Serving recovery shards on TCP without a token: any local user can fetch the encrypted key and the search")
+	return nil
+}
+
+func runRecoverCoordinator(cmd *cobra.Command, args []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	token := resolveRecoverToken()
+	if err := checkRecoverListen(recoverListen, token); err != nil {
+		return err
+	}
+
+	session, err := newRecoverySession(args[0])
+	if err != nil {
+		return err
+	}
+
+	coordinator, err := recovery.NewCoordinator(recovery.CoordinatorConfig{
+		EncryptedKey:   session.encryptedKey,
+		Spec:           session.spec,
+		Plan:           session.plan,
+		Start:          session.base.Next,
+		ShardSize:      recoverShardSize,
+		LeaseTimeout:   recoverLeaseTimeout,
+		Token:          token,
+		Report:         session.report,
+		ReportInterval: recoverProgressInterval,
+	})
+	if err != nil {
+		return errors.NewValidationError("invalid recovery setup", err)
+	}
+
+	ln, err := recovery.Listen(recoverListen)
+	if err != nil {
+		return errors.NewSystemError("failed to listen for workers", err).
+			WithContext("listen", recoverListen)
+	}
+	logger.WithField("listen", recoverListen).Info("Serving recovery shards")
+	fmt.Fprintf(os.Stderr, "Serving %d candidates on %s\n", session.plan.Len(), recoverListen)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := coordinator.Serve(ctx, ln)
+	return session.finish(cmd, result, err)
+}
+
+func runRecoverWorker(cmd *cobra.Command, _ []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	if strings.TrimSpace(recoverConnect) == "" {
+		return errors.NewValidationError("coordinator address is required (--connect)", nil)
+	}
+	name := recoverWorkerName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := recovery.Dial(recoverConnect)
+	if err != nil {
+		return errors.NewSystemError("failed to connect to coordinator", err).
+			WithContext("connect", recoverConnect)
+	}
+	defer func() { _ = conn.Close() }()
+
+	stats, err := recovery.RunWorker(ctx, conn, recovery.WorkerConfig{
+		Name:    name,
+		Token:   resolveRecoverToken(),
+		Workers: recoverWorkers,
+		OnShard: func(shard recovery.Shard, tried uint64, found bool) {
+			logger.WithField("start", shard.Start).WithField("end", shard.End).
+				WithField("tried", tried).WithField("found", found).Debug("Shard searched")
+		},
+	})
+	if err != nil {
+		return errors.NewSystemError("recovery worker stopped", err).
+			WithContext("shards", stats.Shards)
+	}
+
+	result := map[string]any{
+		"shards": stats.Shards,
+		"tried":  stats.Tried,
+	}
+	switch outputFormat(cmd) {
+	case "json":
+		jsonOutput, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %v", err)
+		}
+		fmt.Println(string(jsonOutput))
+	default:
+		fmt.Printf("Search finished: %d shards, %d candidates tried by this worker\n", stats.Shards, stats.Tried)
+	}
+	return nil
+}
@@ -25,11 +25,25 @@ Features:
 - Support for both compressed and uncompressed keys
 - Secure passphrase handling`,
 	Version: getVersionString(),
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		path, _ := cmd.Flags().GetString("network-file")
+		if err := loadNetworkFile(path); err != nil {
+			return err
+		}
+		if err := startMetricsStore(); err != nil {
+			return err
+		}
+		if err := startAuditLog(cmd.CommandPath()); err != nil {
+			return err
+		}
+		return startMetricsExport()
+	},
 }
 
 // Execute attaches all child commands to the root command and executes it.
 // This is the main entry point for the CLI application.
 func Execute() error {
+	defer stopMetricsExport()
 	return rootCmd.Execute()
 }
 
@@ -38,6 +52,7 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().String("output-format", "text", "output format (text|json)")
 	rootCmd.PersistentFlags().BoolP("compressed", "c", true, "use compressed public key format by default")
+	rootCmd.PersistentFlags().String("network-file", "", "JSON file with extra network definitions")
 
 	// Initialize logger with default settings
 	logger.Init(false)
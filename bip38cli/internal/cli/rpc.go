@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/rpc"
+	"github.com/spf13/cobra"
+)
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Speak JSON-RPC 2.0 on stdin and stdout",
+	Long: `Serve BIP38 operations as line-delimited JSON-RPC 2.0 on stdio, for tools
+that run bip38cli as a child process.
+
+Each request is one line on stdin; each response is one line on stdout.
+Batches (a JSON array on one line) and notifications (no "id") are
+supported. Params are named; results use the same field names as the
+matching command with --output-format json. Logs go to stderr. The process
+exits when stdin is closed.
+
+Methods and params:
+  encrypt                {"wif", "passphrase", "allow_weak", "network", "compressed"}
+  decrypt                {"encrypted_key", "passphrase", "network"}
+  wallet.generate        {"network", "compressed", "address_type", "show_address", "passphrase", "allow_weak", "show_wif"}
+  wallet.inspect         {"wif", "network", "address_type"}
+  intermediate.generate  {"passphrase", "allow_weak", "lot", "sequence"}
+  intermediate.validate  {"intermediate_code"}
+  intermediate.encrypt   {"intermediate_code", "compressed", "network"}
+  intermediate.confirm   {"confirmation_code", "passphrase", "network"}
+  metrics                {}
+
+wallet.generate encrypts the new key when a passphrase is given. A new
+passphrase below the minimum strength (` + minPassphraseBitsEnv + `,
+default 50 bits) is rejected unless allow_weak is true. Failures reported by
+a method use code -32000 with the error type, context and cause in "data";
+malformed params use -32602.
+
+Example:
+  echo '{"jsonrpc":"2.0","id":1,"method":"wallet.inspect","params":{"wif":"5K..."}}' | bip38cli rpc`,
+	Args: cobra.NoArgs,
+	RunE: runRPC,
+}
+
+func init() {
+	rootCmd.AddCommand(rpcCmd)
+}
+
+// newRPCServer registers every method.
+func newRPCServer() *rpc.Server {
+	srv := rpc.New()
+	for name, op := range map[string]apiOperation{
+		"encrypt":               apiEncrypt,
+		"decrypt":               apiDecrypt,
+		"wallet.generate":       apiGenerateWallet,
+		"wallet.inspect":        apiInspect,
+		"intermediate.generate": apiGenerateIntermediate,
+		"intermediate.validate": apiValidateIntermediate,
+		"intermediate.encrypt":  apiEncryptIntermediate,
+		"intermediate.confirm":  apiConfirmIntermediate,
+		"metrics":               apiMetrics,
+	} {
+		srv.Register(name, rpc.Method(op))
+	}
+	return srv
+}
+
+func runRPC(cmd *cobra.Command, _ []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	if err := newRPCServer().Serve(context.Background(), cmd.InOrStdin(), os.Stdout); err != nil {
+		return errors.NewSystemError("rpc session stopped", err)
+	}
+	return nil
+}
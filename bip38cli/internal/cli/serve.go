@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/batch"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// serveTokenEnv supplies the bearer token without putting it on the command line.
+const serveTokenEnv = "BIP38CLI_SERVE_TOKEN"
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve BIP38 operations as a local JSON API",
+	Long: `Expose encrypt, decrypt, intermediate generate/encrypt/confirm and inspect
+as JSON endpoints for other local services.
+
+The API listens on a Unix socket created with owner-only permissions. On
+Linux, connections are also checked with SO_PEERCRED and only the current
+user (or users added with --allow-uid) is accepted. --listen tcp:127.0.0.1:PORT
+serves loopback TCP instead; peer checks do not apply there, so set a bearer
+token with --token or ` + serveTokenEnv + `.
+
+Endpoints (POST with a JSON body unless noted):
+  GET  /v1/health
+  POST /v1/encrypt                 {"wif", "passphrase", "allow_weak", "network", "compressed"}
+  POST /v1/decrypt                 {"encrypted_key", "passphrase", "network"}
+  POST /v1/intermediate/generate   {"passphrase", "allow_weak", "lot", "sequence"}
+  POST /v1/intermediate/encrypt    {"intermediate_code", "compressed", "network"}
+  POST /v1/intermediate/confirm    {"confirmation_code", "passphrase", "network"}
+  POST /v1/inspect                 {"wif", "network", "address_type"}
+
+Each scrypt operation holds about 16 MiB, so at most --memory-budget worth
+run at once; other requests wait up to --queue-timeout and then get 503.
+A new passphrase below the minimum strength (` + minPassphraseBitsEnv + `,
+default 50 bits) is rejected unless allow_weak is true. Validation errors, a
+weak passphrase included, return 400, crypto failures such as a wrong
+passphrase 422 and oversized bodies 413.
+
+Examples:
+  bip38cli serve
+  bip38cli serve --listen unix:/run/user/1000/bip38.sock --memory-budget 512MiB
+  curl --unix-socket /run/user/1000/bip38.sock -d '{"encrypted_key":"6P...","passphrase":"..."}' http://bip38/v1/decrypt`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+var (
+	serveListen       string
+	serveMemoryBudget = "256MiB"
+	serveMaxBody      = "64KiB"
+	serveQueueTimeout = 30 * time.Second
+	serveAllowUIDs    []int
+	serveToken        string
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "unix:/path/to/socket or tcp:127.0.0.1:PORT (default: unix socket in $XDG_RUNTIME_DIR or the temp dir)")
+	serveCmd.Flags().StringVar(&serveMemoryBudget, "memory-budget", "256MiB", "memory available to concurrent scrypt operations")
+	serveCmd.Flags().StringVar(&serveMaxBody, "max-body", "64KiB", "largest accepted request body")
+	serveCmd.Flags().DurationVar(&serveQueueTimeout, "queue-timeout", 30*time.Second, "how long a request waits for a free slot")
+	serveCmd.Flags().IntSliceVar(&serveAllowUIDs, "allow-uid", nil, "extra user ids allowed on the Unix socket (repeatable)")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "bearer token clients must send (default: $"+serveTokenEnv+")")
+}
+
+// defaultServeAddress picks a per-user socket path.
+func defaultServeAddress() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return "unix:" + filepath.Join(dir, "bip38cli.sock")
+	}
+	return "unix:" + filepath.Join(os.TempDir(), fmt.Sprintf("bip38cli-%d.sock", os.Getuid()))
+}
+
+func runServe(cmd *cobra.Command, _ []string) error {
+	if isVerbose(cmd) {
+		logger.Init(true)
+	}
+
+	budget, err := batch.ParseSize(serveMemoryBudget)
+	if err != nil {
+		return errors.NewValidationError("invalid memory budget", err).
+			WithContext("memory_budget", serveMemoryBudget)
+	}
+	maxBody, err := batch.ParseSize(serveMaxBody)
+	if err != nil {
+		return errors.NewValidationError("invalid maximum body size", err).
+			WithContext("max_body", serveMaxBody)
+	}
+
+	token := serveToken
+	if token == "" {
+		token = os.Getenv(serveTokenEnv)
+	}
+	listen := serveListen
+	if listen == "" {
+		listen = defaultServeAddress()
+	}
+	if strings.HasPrefix(listen, "tcp:") && token == "" {
+		logger.Warn("Serving on TCP without a token: any local user can call the API")
+	}
+
+	srv := newServeServer(server.Config{
+		MaxBodyBytes:  int64(min(maxBody, 1<<30)),
+		MaxConcurrent: batch.WorkersForBudget(budget, runtime.NumCPU()),
+		QueueTimeout:  serveQueueTimeout,
+		Token:         token,
+	})
+
+	ln, err := server.Listen(listen, serveAllowUIDs)
+	if err != nil {
+		return errors.NewSystemError("failed to listen", err).
+			WithContext("listen", listen)
+	}
+	logger.WithField("listen", listen).Info("Serving BIP38 API")
+	fmt.Fprintf(os.Stderr, "Serving BIP38 API on %s\n", listen)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := srv.Serve(ctx, ln); err != nil {
+		return errors.NewSystemError("server stopped", err)
+	}
+	return nil
+}
+
+// newServeServer registers every endpoint on a server built from cfg.
+func newServeServer(cfg server.Config) *server.Server {
+	srv := server.New(cfg)
+	srv.Handle("GET /v1/health", func(*http.Request) (any, error) {
+		return map[string]any{"status": "ok", "version": version}, nil
+	})
+	srv.HandleScrypt("POST /v1/encrypt", serveOperation(apiEncrypt))
+	srv.HandleScrypt("POST /v1/decrypt", serveOperation(apiDecrypt))
+	srv.HandleScrypt("POST /v1/intermediate/generate", serveOperation(apiGenerateIntermediate))
+	srv.HandleScrypt("POST /v1/intermediate/encrypt", serveOperation(apiEncryptIntermediate))
+	srv.HandleScrypt("POST /v1/intermediate/confirm", serveOperation(apiConfirmIntermediate))
+	srv.Handle("POST /v1/inspect", serveOperation(apiInspect))
+	return srv
+}
+
+// serveOperation decodes the request body as the operation's parameters.
+func serveOperation(op apiOperation) server.HandlerFunc {
+	return func(r *http.Request) (any, error) {
+		return op(func(v any) error { return server.DecodeJSON(r, v) })
+	}
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/humanize"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/strength"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+	"github.com/spf13/cobra"
+)
+
+// minPassphraseBitsEnv sets the minimum strength when --min-passphrase-bits
+// is not given, so a site can raise or lower it for all commands.
+const minPassphraseBitsEnv = "BIP38CLI_MIN_PASSPHRASE_BITS"
+
+// defaultMinPassphraseBits keeps the average time to crack a passphrase at
+// months for a farm of 10,000 GPUs, and millennia for a single one.
+const defaultMinPassphraseBits = 50
+
+var (
+	allowWeakPassphrase bool
+	minPassphraseBits   float64
+)
+
+// addStrengthFlags registers the passphrase policy flags on cmd.
+func addStrengthFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.BoolVar(&allowWeakPassphrase, "allow-weak", false, "accept a passphrase weaker than the minimum strength")
+	flags.Float64Var(&minPassphraseBits, "min-passphrase-bits", defaultMinPassphraseBits, "minimum estimated passphrase strength in bits (overrides $"+minPassphraseBitsEnv+")")
+}
+
+// minimumPassphraseBits returns the minimum strength from the flag, the
+// environment or the default, in that order.
+func minimumPassphraseBits(cmd *cobra.Command) (float64, error) {
+	if cmd.Flags().Changed("min-passphrase-bits") {
+		return minPassphraseBits, nil
+	}
+	return defaultPassphraseBits()
+}
+
+// defaultPassphraseBits returns the minimum strength from the environment or
+// the default, for callers without flags such as serve and rpc.
+func defaultPassphraseBits() (float64, error) {
+	value := os.Getenv(minPassphraseBitsEnv)
+	if value == "" {
+		return defaultMinPassphraseBits, nil
+	}
+	bits, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, errors.NewValidationError("invalid minimum passphrase strength", err).
+			WithContext("variable", minPassphraseBitsEnv)
+	}
+	return bits, nil
+}
+
+// checkPassphraseStrength estimates how hard passphrase is to guess, reports
+// it with the offline cracking time on stderr, and rejects it when it is
+// below the minimum unless --allow-weak is given.
+func checkPassphraseStrength(cmd *cobra.Command, passphrase []byte) error {
+	minBits, err := minimumPassphraseBits(cmd)
+	if err != nil {
+		return err
+	}
+	result := strength.Estimate(passphrase)
+	weak := result.Bits < minBits
+	printPassphraseStrength(result, weak)
+
+	if !weak {
+		return nil
+	}
+	if allowWeakPassphrase {
+		logger.WithField("bits", math.Round(result.Bits*10)/10).
+			WithField("minimum", minBits).
+			Warn("Passphrase is weaker than the minimum strength; accepted because of --allow-weak")
+		return nil
+	}
+	return weakPassphraseError(result, minBits, "pass --allow-weak")
+}
+
+// weakPassphraseError rejects a passphrase estimated below minBits; override
+// tells the caller how to use it anyway.
+func weakPassphraseError(result strength.Result, minBits float64, override string) *errors.AppError {
+	appErr := errors.NewValidationError("passphrase is too weak; choose a stronger one, or "+override+" to use it anyway", nil).
+		WithContext("bits", math.Round(result.Bits*10)/10).
+		WithContext("minimum_bits", minBits)
+	if result.Warning != "" {
+		appErr = appErr.WithContext("warning", result.Warning)
+	}
+	return appErr
+}
+
+// printPassphraseStrength shows an estimate on stderr, with the average time
+// each kind of attacker needs to guess the passphrase from an encrypted key,
+// and for a weak passphrase what makes it weak.
+func printPassphraseStrength(result strength.Result, weak bool) {
+	fmt.Fprintf(os.Stderr, "Passphrase strength: %.1f bits (about %s guesses)\n", result.Bits, humanize.Count(result.Guesses))
+	fmt.Fprintf(os.Stderr, "Time to crack offline (scrypt N=%d r=%d p=%d, %d MiB of memory traffic per guess):\n",
+		bip38.ScryptN, bip38.ScryptR, bip38.ScryptP, strength.BytesPerGuess>>20)
+	for _, attacker := range strength.Attackers {
+		fmt.Fprintf(os.Stderr, "  %s at %s guesses/s: %s\n",
+			attacker.Name, humanize.Count(attacker.Rate()), humanize.Seconds(attacker.Seconds(result.Guesses)))
+	}
+	if !weak {
+		return
+	}
+	if result.Warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", result.Warning)
+	}
+	for _, suggestion := range result.Suggestions {
+		fmt.Fprintf(os.Stderr, "Suggestion: %s\n", suggestion)
+	}
+}
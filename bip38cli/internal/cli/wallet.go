@@ -2,16 +2,16 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/btcsuite/btcd/btcutil"
-	"github.com/carlosrabelo/bip38cli/bip38cli/internal/bip38"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
 	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
 	"github.com/spf13/cobra"
 )
 
@@ -24,6 +24,7 @@ var (
 	walletForceUncompressed  bool
 	walletAddressType        = "bip84"
 	walletInspectAddressType = "bip84"
+	walletInspectNetwork     string
 	generateWIF              = bip38.GenerateWIF
 )
 
@@ -45,7 +46,19 @@ var walletGenerateCmd = &cobra.Command{
 By default the command targets mainnet and produces a compressed key. The
 global --compressed flag may be used to opt into uncompressed format. Pass
 --encrypt to wrap the generated WIF in BIP38 using an interactive passphrase
-prompt.`,
+prompt, or a passphrase supplied by one of the --passphrase-* flags. The
+passphrase must be at least as strong as --min-passphrase-bits (default 50,
+or $BIP38CLI_MIN_PASSPHRASE_BITS) unless --allow-weak is given; its estimated
+strength and offline cracking time are printed to stderr.
+
+--vanity-prefix and --vanity-suffix search for a key whose address starts or
+ends with the given characters, for the selected --address-type. The search
+steps through consecutive keys on every core, adding one point per candidate,
+and prints the difficulty, the expected time and progress to stderr. Each
+extra character makes it about 58 times longer for bip44 addresses and 32
+times for bip84 ones, which are lowercase and so matched in any case;
+--vanity-ignore-case does the same for bip44. With --encrypt the passphrase
+is read before the search starts.`,
 	RunE: runWalletGenerate,
 }
 
@@ -66,15 +79,18 @@ func init() {
 	walletCmd.AddCommand(walletGenerateCmd)
 	walletCmd.AddCommand(walletInspectCmd)
 
-	walletGenerateCmd.Flags().StringVar(&walletNetwork, "network", "mainnet", "target network (mainnet|testnet|regtest|simnet|signet)")
+	walletGenerateCmd.Flags().StringVar(&walletNetwork, "network", "mainnet", "target network ("+networkChoices()+")")
 	walletGenerateCmd.Flags().BoolVar(&walletEncrypt, "encrypt", false, "encrypt generated key using BIP38")
 	walletGenerateCmd.Flags().BoolVar(&walletShowAddr, "show-address", false, "show the Bitcoin address for the generated key")
 	walletGenerateCmd.Flags().BoolVar(&walletShowWIF, "show-wif", false, "include plaintext WIF when --encrypt is set")
 	walletGenerateCmd.Flags().BoolVar(&walletForceCompressed, "compressed", false, "force compressed public key format")
 	walletGenerateCmd.Flags().BoolVar(&walletForceUncompressed, "uncompressed", false, "force uncompressed public key format")
 	walletGenerateCmd.Flags().StringVar(&walletAddressType, "address-type", "bip84", "address type (bip84|bip44)")
+	addPassphraseFlags(walletGenerateCmd)
+	addStrengthFlags(walletGenerateCmd)
 
 	walletInspectCmd.Flags().StringVar(&walletInspectAddressType, "address-type", "bip84", "address type (bip84|bip44)")
+	walletInspectCmd.Flags().StringVar(&walletInspectNetwork, "network", "", "network of the WIF ("+networkChoices()+"; default: detect)")
 }
 
 func runWalletGenerate(cmd *cobra.Command, _ []string) error { //nolint:gocyclo
@@ -104,23 +120,45 @@ func runWalletGenerate(cmd *cobra.Command, _ []string) error { //nolint:gocyclo
 			WithContext("network", walletNetwork)
 	}
 
-	wif, err := generateWIF(params, compressed)
-	if err != nil {
-		logger.WithError(err).Error("Failed to generate WIF")
-		return errors.NewCryptoError("failed to generate private key", err)
-	}
-
 	addrType, err := parseAddressType(walletAddressType)
 	if err != nil {
 		return errors.NewValidationError("invalid address type", err).
 			WithContext("address_type", walletAddressType)
 	}
 
-	effectiveType := addrType
-	if effectiveType == addressTypeBIP84 && !wif.CompressPubKey {
-		effectiveType = addressTypeBIP44
+	// Ask for the passphrase up front so a long vanity search is not
+	// followed by a prompt nobody is watching.
+	var passphrase []byte
+	if walletEncrypt {
+		passphrase, err = getNewPassphrase("Enter passphrase for encryption: ")
+		if err != nil {
+			return err
+		}
+		defer secureZero(passphrase)
+		if err := checkPassphraseStrength(cmd, passphrase); err != nil {
+			return err
+		}
+	}
+
+	var (
+		wif   *btcutil.WIF
+		found vanityStats
+	)
+	if wantsVanity() {
+		wif, found, err = generateVanityWIF(params, compressed, effectiveAddressType(addrType, compressed, params))
+		if err != nil {
+			return err
+		}
+	} else {
+		wif, err = generateWIF(params, compressed)
+		if err != nil {
+			logger.WithError(err).Error("Failed to generate WIF")
+			return errors.NewCryptoError("failed to generate private key", err)
+		}
 	}
 
+	effectiveType := effectiveAddressType(addrType, wif.CompressPubKey, params)
+
 	result := map[string]any{
 		"compressed":   wif.CompressPubKey,
 		"network":      params.Name,
@@ -132,42 +170,28 @@ func runWalletGenerate(cmd *cobra.Command, _ []string) error { //nolint:gocyclo
 		result["wif"] = wif.String()
 	}
 
-	if walletShowAddr {
-		address, err := addressForWIF(wif, effectiveType)
+	// The address is the point of a vanity key, so it is always shown.
+	showAddress := walletShowAddr || wantsVanity()
+	if showAddress {
+		address, err := addressForKey(wif, params, effectiveType)
 		if err != nil {
 			return fmt.Errorf("failed to derive address: %v", err)
 		}
 		result["address"] = address
 	}
+	if wantsVanity() {
+		result["tried"] = found.tried
+		result["elapsed_seconds"] = found.elapsed.Seconds()
+	}
 
 	if walletEncrypt {
-		passphrase, err := getPassphrase("Enter passphrase for encryption: ")
-		if err != nil {
-			return fmt.Errorf("failed to read passphrase: %v", err)
-		}
-		defer secureZero(passphrase)
-
-		if len(passphrase) == 0 {
-			return fmt.Errorf("passphrase cannot be empty")
-		}
-
-		confirmPassphrase, err := getPassphrase("Confirm passphrase: ")
-		if err != nil {
-			return fmt.Errorf("failed to read passphrase confirmation: %v", err)
-		}
-		defer secureZero(confirmPassphrase)
-
-		if !bytes.Equal(passphrase, confirmPassphrase) {
-			return fmt.Errorf("passphrases do not match")
-		}
-
-		encryptedKey, err := bip38.EncryptKey(wif, passphrase)
+		encrypted, err := bip38.Encrypt(bip38.EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
 		if err != nil {
 			logger.WithError(err).Error("Failed to encrypt generated WIF")
 			return errors.NewCryptoError("failed to encrypt generated key", err)
 		}
 
-		result["bip38_encrypted_key"] = encryptedKey
+		result["bip38_encrypted_key"] = encrypted.EncryptedKey
 	}
 
 	switch outputFormat(cmd) {
@@ -189,7 +213,7 @@ func runWalletGenerate(cmd *cobra.Command, _ []string) error { //nolint:gocyclo
 			fmt.Printf("Key format (%s): %s\n", params.Name, compression)
 		}
 
-		if walletShowAddr {
+		if showAddress {
 			fmt.Printf("Address (%s): %s\n", result["address_type"], result["address"])
 		}
 
@@ -231,10 +255,9 @@ func runWalletInspect(cmd *cobra.Command, args []string) error {
 		return errors.NewValidationError("invalid WIF private key", err)
 	}
 
-	params, err := bip38.NetworkFromWIF(wif)
+	params, err := inspectNetwork(wif)
 	if err != nil {
-		logger.WithError(err).Error("Unsupported WIF network")
-		return errors.NewValidationError("unsupported WIF network", err)
+		return err
 	}
 
 	addrType, err := parseAddressType(walletInspectAddressType)
@@ -243,12 +266,9 @@ func runWalletInspect(cmd *cobra.Command, args []string) error {
 			WithContext("address_type", walletInspectAddressType)
 	}
 
-	effectiveType := addrType
-	if effectiveType == addressTypeBIP84 && !wif.CompressPubKey {
-		effectiveType = addressTypeBIP44
-	}
+	effectiveType := effectiveAddressType(addrType, wif.CompressPubKey, params)
 
-	address, err := addressForWIF(wif, effectiveType)
+	address, err := addressForKey(wif, params, effectiveType)
 	if err != nil {
 		return fmt.Errorf("failed to derive address: %v", err)
 	}
@@ -280,3 +300,26 @@ func runWalletInspect(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// inspectNetwork returns the --network choice after checking it agrees with the
+// WIF version byte, or the first registered network matching the WIF.
+func inspectNetwork(wif *btcutil.WIF) (*chaincfg.Params, error) {
+	params, err := resolveNetworkFlag(walletInspectNetwork)
+	if err != nil {
+		return nil, err
+	}
+	if params != nil {
+		if !wif.IsForNet(params) {
+			return nil, errors.NewValidationError("WIF does not belong to the selected network", nil).
+				WithContext("network", params.Name)
+		}
+		return params, nil
+	}
+
+	params, err = bip38.NetworkFromWIF(wif)
+	if err != nil {
+		logger.WithError(err).Error("Unsupported WIF network")
+		return nil, errors.NewValidationError("unsupported WIF network", err)
+	}
+	return params, nil
+}
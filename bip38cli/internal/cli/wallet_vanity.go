@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/humanize"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/vanity"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+var (
+	walletVanityPrefix     string
+	walletVanitySuffix     string
+	walletVanityIgnoreCase bool
+	walletVanityWorkers    int
+	walletVanityTimeout    time.Duration
+)
+
+func init() {
+	flags := walletGenerateCmd.Flags()
+	flags.StringVar(&walletVanityPrefix, "vanity-prefix", "", "search for an address starting with this, such as 1Abc or bc1qxyz")
+	flags.StringVar(&walletVanitySuffix, "vanity-suffix", "", "search for an address ending in this")
+	flags.BoolVar(&walletVanityIgnoreCase, "vanity-ignore-case", false, "match bip44 addresses in either case (bip84 addresses always are)")
+	flags.IntVar(&walletVanityWorkers, "vanity-workers", 0, "parallel search workers (default: number of CPUs)")
+	flags.DurationVar(&walletVanityTimeout, "vanity-timeout", 0, "give up the search after this long (default: no limit)")
+}
+
+// wantsVanity reports whether wallet generate should search for the key.
+func wantsVanity() bool {
+	return walletVanityPrefix != "" || walletVanitySuffix != ""
+}
+
+// vanityStats is how long a vanity search took, for the output.
+type vanityStats struct {
+	tried   uint64
+	elapsed time.Duration
+}
+
+// generateVanityWIF searches for a key whose address of type mode matches
+// the vanity flags, printing the estimate and progress to stderr.
+func generateVanityWIF(params *chaincfg.Params, compressed bool, mode addressType) (*btcutil.WIF, vanityStats, error) {
+	spec := vanity.Spec{Prefix: walletVanityPrefix, Suffix: walletVanitySuffix, IgnoreCase: walletVanityIgnoreCase}
+
+	var (
+		pattern *vanity.Pattern
+		encode  vanity.Encoder
+		err     error
+	)
+	if mode == addressTypeBIP84 {
+		pattern, err = vanity.Bech32(params.Bech32HRPSegwit, spec)
+		encode = vanity.P2WPKH(params)
+	} else {
+		pattern, err = vanity.Base58(params.PubKeyHashAddrID, spec)
+		encode = vanity.P2PKH(params.PubKeyHashAddrID)
+	}
+	if err != nil {
+		return nil, vanityStats{}, errors.NewValidationError("invalid vanity pattern", err).
+			WithContext("address_type", string(mode)).
+			WithContext("network", params.Name)
+	}
+
+	search := vanity.NewKeySearch(compressed, encode, pattern)
+	workers := walletVanityWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	rate, err := vanity.Measure(search.Worker, vanityMeasureTime)
+	if err != nil {
+		return nil, vanityStats{}, errors.NewSystemError("failed to start vanity search", err)
+	}
+	rate *= float64(workers)
+	estimate := vanity.Estimate{Probability: pattern.Probability()}
+	printVanityEstimate(fmt.Sprintf("a %s %s address %s", params.Name, mode, pattern), estimate, rate, workers)
+
+	ctx, stop := vanityContext(walletVanityTimeout)
+	defer stop()
+
+	match, stats, err := vanity.Search(ctx, vanity.Options{
+		Workers:  workers,
+		Progress: func(s vanity.Stats) { printVanityProgress(s, estimate) },
+	}, search.Worker)
+	if err != nil {
+		return nil, vanityStats{}, errors.NewSystemError("vanity search stopped before a match was found", err).
+			WithContext("tried", stats.Tried).
+			WithContext("elapsed", stats.Elapsed.Round(time.Second).String())
+	}
+	defer secureZero(match.Key)
+
+	wif, err := bip38.WIFFromKey(match.Key, params, compressed)
+	if err != nil {
+		return nil, vanityStats{}, errors.NewCryptoError("failed to encode private key", err)
+	}
+	address, err := addressForKey(wif, params, mode)
+	if err != nil {
+		return nil, vanityStats{}, fmt.Errorf("failed to derive address: %v", err)
+	}
+	if address != match.Address {
+		return nil, vanityStats{}, errors.NewCryptoError("generated key does not have the address the search found", nil).
+			WithContext("found", match.Address).
+			WithContext("derived", address)
+	}
+
+	logger.WithField("tried", stats.Tried).Info("Found vanity key")
+	fmt.Fprintf(os.Stderr, "Found after %s keys in %s\n", humanize.Count(float64(stats.Tried)), humanize.Seconds(stats.Elapsed.Seconds()))
+	return wif, vanityStats{tried: stats.Tried, elapsed: stats.Elapsed}, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+// Package filelock takes advisory locks on files shared between processes.
+package filelock
+
+import "os"
+
+// Lock is a no-op where flock is unavailable; single-line appends are
+// still written with one call, so concurrent runs rarely interleave.
+func Lock(*os.File, bool) error {
+	return nil
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(*os.File) error {
+	return nil
+}
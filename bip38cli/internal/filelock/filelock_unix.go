@@ -0,0 +1,23 @@
+//go:build unix
+
+// Package filelock takes advisory locks on files shared between processes.
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock takes an advisory flock on f, blocking until it is granted.
+func Lock(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(f.Fd()), how) //nolint:gosec
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //nolint:gosec
+}
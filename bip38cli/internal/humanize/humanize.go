@@ -0,0 +1,53 @@
+// Package humanize renders search estimates for people: large counts and
+// durations that may run to millions of years.
+package humanize
+
+import (
+	"fmt"
+	"math"
+)
+
+// Seconds renders a duration estimate coarsely: precision beyond two
+// units would be false anyway.
+func Seconds(seconds float64) string {
+	const (
+		minute = 60
+		hour   = 60 * minute
+		day    = 24 * hour
+		year   = 365.25 * day
+	)
+	switch {
+	case math.IsInf(seconds, 1) || seconds > 1e6*year:
+		return "more than a million years"
+	case seconds >= year:
+		return fmt.Sprintf("%.1f years", seconds/year)
+	case seconds >= day:
+		return fmt.Sprintf("%dd %dh", int(seconds/day), int(math.Mod(seconds, day)/hour))
+	case seconds >= hour:
+		return fmt.Sprintf("%dh %dm", int(seconds/hour), int(math.Mod(seconds, hour)/minute))
+	case seconds >= minute:
+		return fmt.Sprintf("%dm %ds", int(seconds/minute), int(math.Mod(seconds, minute)))
+	case seconds >= 1:
+		return fmt.Sprintf("%.0fs", seconds)
+	default:
+		return "under a second"
+	}
+}
+
+// Count renders a large count with a magnitude word.
+func Count(n float64) string {
+	switch {
+	case n >= 1e18:
+		return fmt.Sprintf("%.3g", n)
+	case n >= 1e15:
+		return fmt.Sprintf("%.1f quadrillion", n/1e15)
+	case n >= 1e12:
+		return fmt.Sprintf("%.1f trillion", n/1e12)
+	case n >= 1e9:
+		return fmt.Sprintf("%.1f billion", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f million", n/1e6)
+	default:
+		return fmt.Sprintf("%.0f", n)
+	}
+}
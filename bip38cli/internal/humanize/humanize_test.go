@@ -0,0 +1,19 @@
+package humanize
+
+import "testing"
+
+func TestSeconds(t *testing.T) {
+	for seconds, want := range map[float64]string{0.2: "under a second", 75: "1m 15s", 7300: "2h 1m", 3 * 86400: "3d 0h", 1e300: "more than a million years"} {
+		if got := Seconds(seconds); got != want {
+			t.Fatalf("Seconds(%g) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	for n, want := range map[float64]string{42: "42", 4.2e6: "4.2 million", 3e12: "3.0 trillion", 5e20: "5e+20"} {
+		if got := Count(n); got != want {
+			t.Fatalf("Count(%g) = %q, want %q", n, got, want)
+		}
+	}
+}
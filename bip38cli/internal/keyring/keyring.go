@@ -0,0 +1,43 @@
+// Package keyring keeps secrets in the Linux kernel keyring, where they live
+// in kernel memory, are never written to disk and can expire on their own.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ring is a keyring that keys are stored in or looked up from.
+type Ring string
+
+const (
+	// Session is shared by the processes of one login session.
+	Session Ring = "session"
+	// User is shared by every process of the user and lives until the
+	// user's last process exits.
+	User Ring = "user"
+)
+
+// ErrNotFound is returned when no key has the description, or it expired.
+var ErrNotFound = errors.New("key not found in keyring")
+
+// ErrUnsupported is returned on systems without a kernel keyring.
+var ErrUnsupported = errors.New("the kernel keyring is only available on Linux")
+
+// ParseRef splits a reference such as "session:name", "user:name" or plain
+// "name" into its ring and key description. Without a ring, ring is "" and
+// lookups try the session keyring and then the user keyring.
+func ParseRef(ref string) (Ring, string, error) {
+	ring, description := Ring(""), ref
+	if prefix, rest, ok := strings.Cut(ref, ":"); ok {
+		switch Ring(prefix) {
+		case Session, User:
+			ring, description = Ring(prefix), rest
+		}
+	}
+	if description == "" {
+		return "", "", fmt.Errorf("keyring reference %q has no key description", ref)
+	}
+	return ring, description, nil
+}
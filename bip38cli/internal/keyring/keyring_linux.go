@@ -0,0 +1,128 @@
+//go:build linux
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyType is the kernel key type for arbitrary secrets readable by their
+// owner.
+const keyType = "user"
+
+func ringID(ring Ring) int {
+	if ring == User {
+		return unix.KEY_SPEC_USER_KEYRING
+	}
+	return unix.KEY_SPEC_SESSION_KEYRING
+}
+
+// storeRingID is ringID for adding keys. A process outside any login session
+// has no session keyring: adding to it would create one private to this
+// process, gone when it exits, while lookups in other processes fall back to
+// the user's default session keyring. Store there instead.
+func storeRingID(ring Ring) int {
+	if ring == User {
+		return unix.KEY_SPEC_USER_KEYRING
+	}
+	// Without a session keyring, looking it up returns the default one.
+	session, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, false)
+	if err != nil {
+		return unix.KEY_SPEC_USER_SESSION_KEYRING
+	}
+	if fallback, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_USER_SESSION_KEYRING, false); err == nil && fallback == session {
+		return unix.KEY_SPEC_USER_SESSION_KEYRING
+	}
+	return unix.KEY_SPEC_SESSION_KEYRING
+}
+
+// search finds the key in ring, or in the session keyring and then the user
+// keyring when ring is "". Searching a keyring includes the keyrings linked
+// from it.
+func search(ring Ring, description string) (int, error) {
+	rings := []Ring{ring}
+	if ring == "" {
+		rings = []Ring{Session, User}
+	}
+	for _, r := range rings {
+		id, err := unix.KeyctlSearch(ringID(r), keyType, description, 0)
+		switch {
+		case err == nil:
+			return id, nil
+		case errors.Is(err, unix.ENOKEY), errors.Is(err, unix.EKEYEXPIRED), errors.Is(err, unix.EKEYREVOKED):
+			continue
+		default:
+			return 0, fmt.Errorf("failed to search %s keyring: %w", r, err)
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// Read returns a copy of the key's payload. The caller should wipe it.
+func Read(ring Ring, description string) ([]byte, error) {
+	id, err := search(ring, description)
+	if err != nil {
+		return nil, err
+	}
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", description, err)
+	}
+	buf := make([]byte, size)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil || n != size {
+		wipe(buf)
+		if err == nil {
+			// The key was updated between the calls.
+			err = errors.New("key changed while reading")
+		}
+		return nil, fmt.Errorf("failed to read key %s: %w", description, err)
+	}
+	return buf, nil
+}
+
+// Store adds the secret to ring under description, replacing any key with
+// the same description there. With a positive ttl the kernel expires the
+// key after that long; otherwise it lasts as long as the keyring.
+func Store(ring Ring, description string, secret []byte, ttl time.Duration) error {
+	if ring == "" {
+		ring = Session
+	}
+	id, err := unix.AddKey(keyType, description, secret, storeRingID(ring))
+	if err != nil {
+		return fmt.Errorf("failed to add key to %s keyring: %w", ring, err)
+	}
+	// Always set the timeout: updating an existing key keeps its old one,
+	// and zero clears it.
+	seconds := 0
+	if ttl > 0 {
+		seconds = int((ttl + time.Second - 1) / time.Second)
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, seconds, 0, 0); err != nil {
+		_, _ = unix.KeyctlInt(unix.KEYCTL_REVOKE, id, 0, 0, 0)
+		return fmt.Errorf("failed to set key timeout: %w", err)
+	}
+	return nil
+}
+
+// Remove revokes the key, so no process can read it any more.
+func Remove(ring Ring, description string) error {
+	id, err := search(ring, description)
+	if err != nil {
+		return err
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_REVOKE, id, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to revoke key %s: %w", description, err)
+	}
+	return nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
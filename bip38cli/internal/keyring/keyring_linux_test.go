@@ -0,0 +1,62 @@
+//go:build linux
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestStoreReadRemove(t *testing.T) {
+	description := fmt.Sprintf("bip38cli-test:%d", os.Getpid())
+	if err := Store(Session, description, []byte("secret"), time.Minute); err != nil {
+		if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) {
+			t.Skipf("kernel keyring unavailable: %v", err)
+		}
+		t.Fatalf("Store: %v", err)
+	}
+	defer func() { _ = Remove(Session, description) }()
+
+	for _, ring := range []Ring{Session, ""} {
+		got, err := Read(ring, description)
+		if err != nil || string(got) != "secret" {
+			t.Fatalf("Read(%q): got %q, %v", ring, got, err)
+		}
+	}
+
+	// Storing again replaces the payload.
+	if err := Store(Session, description, []byte("replaced"), time.Minute); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if got, err := Read("", description); err != nil || string(got) != "replaced" {
+		t.Fatalf("Read after replace: got %q, %v", got, err)
+	}
+
+	if err := Remove("", description); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := Read("", description); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read after Remove: %v, want ErrNotFound", err)
+	}
+	if err := Remove("", description); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Remove: %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreExpires(t *testing.T) {
+	description := fmt.Sprintf("bip38cli-test-ttl:%d", os.Getpid())
+	if err := Store(Session, description, []byte("secret"), time.Second); err != nil {
+		t.Skipf("kernel keyring unavailable: %v", err)
+	}
+	defer func() { _ = Remove(Session, description) }()
+
+	time.Sleep(2 * time.Second)
+	if _, err := Read(Session, description); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read after the timeout: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package keyring
+
+import "time"
+
+// Read is unavailable without a kernel keyring.
+func Read(Ring, string) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Store is unavailable without a kernel keyring.
+func Store(Ring, string, []byte, time.Duration) error {
+	return ErrUnsupported
+}
+
+// Remove is unavailable without a kernel keyring.
+func Remove(Ring, string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,27 @@
+package keyring
+
+import "testing"
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref         string
+		ring        Ring
+		description string
+		err         bool
+	}{
+		{ref: "bip38cli:default", description: "bip38cli:default"},
+		{ref: "session:bip38cli:default", ring: Session, description: "bip38cli:default"},
+		{ref: "user:cold", ring: User, description: "cold"},
+		{ref: "user:", err: true},
+		{ref: "", err: true},
+	}
+	for _, tt := range tests {
+		ring, description, err := ParseRef(tt.ref)
+		if (err != nil) != tt.err {
+			t.Fatalf("ParseRef(%q): error %v", tt.ref, err)
+		}
+		if err == nil && (ring != tt.ring || description != tt.description) {
+			t.Fatalf("ParseRef(%q) = %q, %q; want %q, %q", tt.ref, ring, description, tt.ring, tt.description)
+		}
+	}
+}
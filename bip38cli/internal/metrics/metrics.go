@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -36,6 +38,37 @@ type Metrics struct {
 	// System metrics
 	StartTime time.Time     `json:"start_time"`
 	Uptime    time.Duration `json:"uptime"`
+
+	// series holds every operation, keyed by operation name and labels.
+	// The fields above mirror the unlabelled totals of encrypt, decrypt
+	// and intermediate.
+	series map[string]*series
+}
+
+// Labels qualify an operation, e.g. network, ec_multiply and compressed.
+type Labels map[string]string
+
+// series accumulates one operation under one label set.
+type series struct {
+	operation  string
+	labels     Labels
+	count      int64
+	errors     int64
+	duration   time.Duration
+	errorTypes map[string]int64
+	histogram  histogram
+}
+
+// OperationStats summarises one operation under one label set.
+type OperationStats struct {
+	Operation       string           `json:"operation"`
+	Labels          Labels           `json:"labels,omitempty"`
+	Count           int64            `json:"count"`
+	Errors          int64            `json:"errors"`
+	ErrorTypes      map[string]int64 `json:"error_types,omitempty"`
+	Duration        time.Duration    `json:"duration_total"`
+	AverageDuration time.Duration    `json:"average_duration"`
+	SuccessRate     float64          `json:"success_rate"`
 }
 
 // MarshalJSON implements json.Marshaler to avoid copying the mutex during serialization.
@@ -55,6 +88,7 @@ func (m *Metrics) MarshalJSON() ([]byte, error) {
 		"average_intermediate_time":   m.AverageIntermediateTime,
 		"start_time":                  m.StartTime,
 		"uptime":                      m.Uptime,
+		"operations":                  m.Operations(),
 	})
 }
 
@@ -74,43 +108,194 @@ func GetMetrics() *Metrics {
 	return defaultMetrics
 }
 
-// RecordEncrypt records an encryption operation
-func (m *Metrics) RecordEncrypt(duration time.Duration, success bool) {
+// Record adds one completed operation. Any operation name is accepted;
+// encrypt, decrypt and intermediate also update the legacy totals.
+func (m *Metrics) Record(e Event) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.EncryptCount++
-	m.EncryptDuration += duration
-	if !success {
-		m.EncryptErrors++
+	m.record(e)
+}
+
+// record does the work of Record. Callers hold m.mu.
+func (m *Metrics) record(e Event) {
+	key := seriesKey(e.Operation, e.Labels)
+	if m.series == nil {
+		m.series = make(map[string]*series)
+	}
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{operation: e.Operation, labels: copyLabels(e.Labels)}
+		m.series[key] = s
+	}
+	s.count++
+	s.duration += e.Duration
+	s.histogram.observe(e.Duration)
+	if !e.Success {
+		s.errors++
+		errorType := e.ErrorType
+		if errorType == "" {
+			errorType = unknownErrorType
+		}
+		if s.errorTypes == nil {
+			s.errorTypes = make(map[string]int64)
+		}
+		s.errorTypes[errorType]++
+	}
+
+	switch e.Operation {
+	case "encrypt":
+		m.EncryptCount++
+		m.EncryptDuration += e.Duration
+		if !e.Success {
+			m.EncryptErrors++
+		}
+		m.AverageEncryptTime = m.EncryptDuration / time.Duration(m.EncryptCount)
+	case "decrypt":
+		m.DecryptCount++
+		m.DecryptDuration += e.Duration
+		if !e.Success {
+			m.DecryptErrors++
+		}
+		m.AverageDecryptTime = m.DecryptDuration / time.Duration(m.DecryptCount)
+	case "intermediate":
+		m.IntermediateCount++
+		m.IntermediateDuration += e.Duration
+		if !e.Success {
+			m.IntermediateErrors++
+		}
+		m.AverageIntermediateTime = m.IntermediateDuration / time.Duration(m.IntermediateCount)
 	}
-	m.AverageEncryptTime = m.EncryptDuration / time.Duration(m.EncryptCount)
 }
 
-// RecordDecrypt records a decryption operation
-func (m *Metrics) RecordDecrypt(duration time.Duration, success bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// seriesKey identifies an operation and label set independent of map order.
+func seriesKey(operation string, labels Labels) string {
+	var b strings.Builder
+	b.WriteString(operation)
+	for _, name := range labelNames(labels) {
+		b.WriteByte(0)
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+	}
+	return b.String()
+}
 
-	m.DecryptCount++
-	m.DecryptDuration += duration
-	if !success {
-		m.DecryptErrors++
+func labelNames(labels Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
 	}
-	m.AverageDecryptTime = m.DecryptDuration / time.Duration(m.DecryptCount)
+	sort.Strings(names)
+	return names
+}
+
+func copyLabels(labels Labels) Labels {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(Labels, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return copied
+}
+
+// RecordEncrypt records an encryption operation
+func (m *Metrics) RecordEncrypt(duration time.Duration, success bool) {
+	m.Record(Event{Operation: "encrypt", Duration: duration, Success: success})
+}
+
+// RecordDecrypt records a decryption operation
+func (m *Metrics) RecordDecrypt(duration time.Duration, success bool) {
+	m.Record(Event{Operation: "decrypt", Duration: duration, Success: success})
 }
 
 // RecordIntermediate records an intermediate code generation operation
 func (m *Metrics) RecordIntermediate(duration time.Duration, success bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.Record(Event{Operation: "intermediate", Duration: duration, Success: success})
+}
+
+// Operations returns every recorded operation and label set, sorted by
+// operation and then labels.
+func (m *Metrics) Operations() []OperationStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	stats := make([]OperationStats, 0, len(keys))
+	for _, key := range keys {
+		s := m.series[key]
+		entry := OperationStats{
+			Operation:       s.operation,
+			Labels:          copyLabels(s.labels),
+			Count:           s.count,
+			Errors:          s.errors,
+			Duration:        s.duration,
+			AverageDuration: s.duration / time.Duration(s.count),
+			SuccessRate:     successRate(s.count, s.errors),
+		}
+		if len(s.errorTypes) > 0 {
+			entry.ErrorTypes = make(map[string]int64, len(s.errorTypes))
+			for name, n := range s.errorTypes {
+				entry.ErrorTypes[name] = n
+			}
+		}
+		stats = append(stats, entry)
+	}
+	return stats
+}
 
-	m.IntermediateCount++
-	m.IntermediateDuration += duration
-	if !success {
-		m.IntermediateErrors++
+// OperationNames returns the recorded operation names in sorted order.
+func (m *Metrics) OperationNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range m.series {
+		if !seen[s.operation] {
+			seen[s.operation] = true
+			names = append(names, s.operation)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Totals returns the count, errors and total duration of an operation
+// across all of its label sets.
+func (m *Metrics) Totals(operation string) (count, errors int64, duration time.Duration) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.series {
+		if s.operation == operation {
+			count += s.count
+			errors += s.errors
+			duration += s.duration
+		}
+	}
+	return count, errors, duration
+}
+
+// SuccessRate returns the success rate of an operation across all of its
+// label sets (0-100), or 0 when it never ran.
+func (m *Metrics) SuccessRate(operation string) float64 {
+	count, errors, _ := m.Totals(operation)
+	return successRate(count, errors)
+}
+
+func successRate(count, errors int64) float64 {
+	if count == 0 {
+		return 0
 	}
-	m.AverageIntermediateTime = m.IntermediateDuration / time.Duration(m.IntermediateCount)
+	return roundToTwoDecimals(float64(count-errors) / float64(count) * 100)
 }
 
 // UpdateUptime updates the uptime duration
@@ -143,9 +328,30 @@ func (m *Metrics) GetSnapshot() Metrics {
 		AverageIntermediateTime: m.AverageIntermediateTime,
 		StartTime:               m.StartTime,
 		Uptime:                  m.Uptime,
+		series:                  m.copySeries(),
 	}
 }
 
+func (m *Metrics) copySeries() map[string]*series {
+	if m.series == nil {
+		return nil
+	}
+	copied := make(map[string]*series, len(m.series))
+	for key, s := range m.series {
+		c := *s
+		c.labels = copyLabels(s.labels)
+		c.histogram.counts = append([]uint64(nil), s.histogram.counts...)
+		if s.errorTypes != nil {
+			c.errorTypes = make(map[string]int64, len(s.errorTypes))
+			for name, n := range s.errorTypes {
+				c.errorTypes[name] = n
+			}
+		}
+		copied[key] = &c
+	}
+	return copied
+}
+
 // Reset resets all fields of this Metrics instance to zero and updates StartTime.
 // When called on the global singleton it also replaces the singleton pointer so
 // that GetMetrics() returns a fresh instance on the next call.
@@ -165,6 +371,7 @@ func (m *Metrics) Reset() {
 	m.AverageIntermediateTime = 0
 	m.StartTime = time.Now()
 	m.Uptime = 0
+	m.series = nil
 	m.mu.Unlock()
 
 	// If this is the global singleton, replace it so GetMetrics() creates a new one.
@@ -177,38 +384,17 @@ func (m *Metrics) Reset() {
 
 // EncryptSuccessRate returns the success rate for encrypt operations (0-100)
 func (m *Metrics) EncryptSuccessRate() float64 {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if m.EncryptCount == 0 {
-		return 0
-	}
-	return roundToTwoDecimals(float64(m.EncryptCount-m.EncryptErrors) /
-		float64(m.EncryptCount) * 100)
+	return m.SuccessRate("encrypt")
 }
 
 // DecryptSuccessRate returns the success rate for decrypt operations (0-100)
 func (m *Metrics) DecryptSuccessRate() float64 {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if m.DecryptCount == 0 {
-		return 0
-	}
-	return roundToTwoDecimals(float64(m.DecryptCount-m.DecryptErrors) /
-		float64(m.DecryptCount) * 100)
+	return m.SuccessRate("decrypt")
 }
 
 // IntermediateSuccessRate returns the success rate for intermediate operations (0-100)
 func (m *Metrics) IntermediateSuccessRate() float64 {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if m.IntermediateCount == 0 {
-		return 0
-	}
-	return roundToTwoDecimals(float64(m.IntermediateCount-m.IntermediateErrors) /
-		float64(m.IntermediateCount) * 100)
+	return m.SuccessRate("intermediate")
 }
 
 func roundToTwoDecimals(value float64) float64 {
@@ -220,6 +406,7 @@ type Timer struct {
 	start     time.Time
 	metrics   *Metrics
 	operation string
+	labels    Labels
 }
 
 // NewTimer creates a new timer for the given operation
@@ -231,18 +418,33 @@ func NewTimer(operation string) *Timer {
 	}
 }
 
+// WithLabels sets the labels the operation is recorded under.
+func (t *Timer) WithLabels(labels Labels) *Timer {
+	t.labels = labels
+	return t
+}
+
 // Stop stops the timer and records the metric
 func (t *Timer) Stop(success bool) {
-	duration := time.Since(t.start)
+	t.finish(Event{Success: success})
+}
 
-	switch t.operation {
-	case "encrypt":
-		t.metrics.RecordEncrypt(duration, success)
-	case "decrypt":
-		t.metrics.RecordDecrypt(duration, success)
-	case "intermediate":
-		t.metrics.RecordIntermediate(duration, success)
+// StopWithError stops the timer and records the metric, counting a non-nil
+// err as a failure under its errors.ErrorType.
+func (t *Timer) StopWithError(err error) {
+	event := Event{Success: err == nil}
+	if err != nil {
+		event.ErrorType = errorTypeOf(err)
 	}
+	t.finish(event)
+}
+
+func (t *Timer) finish(event Event) {
+	event.Operation = t.operation
+	event.Labels = t.labels
+	event.Duration = time.Since(t.start)
+	t.metrics.Record(event)
+	dispatch(event)
 }
 
 // ContextTimer is a timer that works with context cancellation
@@ -272,6 +474,13 @@ func (t *ContextTimer) Stop(success bool) {
 
 // Helper functions for global metrics instance
 
+// Publish records an operation timed elsewhere, e.g. by a library event, in
+// the global metrics and hands it to every sink.
+func Publish(e Event) {
+	GetMetrics().Record(e)
+	dispatch(e)
+}
+
 // RecordEncrypt records an encryption operation using the global metrics instance
 func RecordEncrypt(duration time.Duration, success bool) {
 	GetMetrics().RecordEncrypt(duration, success)
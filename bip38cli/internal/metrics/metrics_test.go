@@ -2,10 +2,17 @@ package metrics
 
 import (
 	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/filelock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -441,3 +448,286 @@ func TestRealWorldScenario(t *testing.T) {
 	assert.Equal(t, float64(0), snapshot.DecryptSuccessRate())
 	assert.Equal(t, float64(100), snapshot.IntermediateSuccessRate())
 }
+
+func TestWritePrometheus(t *testing.T) {
+	metrics := &Metrics{StartTime: time.Unix(1700000000, 0)}
+	metrics.RecordDecrypt(300*time.Millisecond, true)
+	metrics.RecordDecrypt(3*time.Second, false)
+	metrics.Record(Event{Operation: "decrypt", Duration: time.Minute, ErrorType: errorTypeOf(errors.NewCryptoError("wrong passphrase", nil))})
+
+	var out strings.Builder
+	require.NoError(t, metrics.WritePrometheus(&out))
+	text := out.String()
+
+	for _, line := range []string{
+		"# TYPE bip38cli_operations_total counter",
+		`bip38cli_operations_total{operation="decrypt"} 3`,
+		`bip38cli_operations_total{operation="encrypt"} 0`,
+		`bip38cli_operation_errors_total{operation="decrypt",type="crypto"} 1`,
+		`bip38cli_operation_errors_total{operation="decrypt",type="unknown"} 1`,
+		"# TYPE bip38cli_operation_duration_seconds histogram",
+		`bip38cli_operation_duration_seconds_bucket{operation="decrypt",le="0.25"} 0`,
+		`bip38cli_operation_duration_seconds_bucket{operation="decrypt",le="0.5"} 1`,
+		`bip38cli_operation_duration_seconds_bucket{operation="decrypt",le="4"} 2`,
+		`bip38cli_operation_duration_seconds_bucket{operation="decrypt",le="32"} 2`,
+		`bip38cli_operation_duration_seconds_bucket{operation="decrypt",le="+Inf"} 3`,
+		`bip38cli_operation_duration_seconds_sum{operation="decrypt"} 63.3`,
+		`bip38cli_operation_duration_seconds_count{operation="intermediate"} 0`,
+		"bip38cli_start_time_seconds 1.7e+09",
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+	assert.NotContains(t, text, `operation="encrypt",type=`)
+}
+
+func TestTimerStopWithError(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	NewTimer("encrypt").StopWithError(nil)
+	NewTimer("encrypt").StopWithError(errors.NewValidationError("bad key", nil))
+	NewTimer("encrypt").StopWithError(context.Canceled)
+
+	snapshot := GetSnapshot()
+	assert.Equal(t, int64(3), snapshot.EncryptCount)
+	assert.Equal(t, int64(2), snapshot.EncryptErrors)
+
+	var out strings.Builder
+	require.NoError(t, WritePrometheus(&out))
+	assert.Contains(t, out.String(), `bip38cli_operation_errors_total{operation="encrypt",type="validation"} 1`)
+	assert.Contains(t, out.String(), `bip38cli_operation_errors_total{operation="encrypt",type="unknown"} 1`)
+}
+
+func TestWriteTextfileAndHandler(t *testing.T) {
+	Reset()
+	defer Reset()
+	RecordIntermediate(time.Second, true)
+
+	path := filepath.Join(t.TempDir(), "bip38cli.prom")
+	require.NoError(t, WriteTextfile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `bip38cli_operations_total{operation="intermediate"} 1`)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files must not be left behind")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, string(data), rec.Body.String())
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+}
+
+func TestStoreAppendReadReset(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "state", "metrics.jsonl"))
+	require.NoError(t, err)
+
+	events, err := store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, events, "a missing store reads as empty")
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Append(
+		Event{Time: base, Operation: "encrypt", Duration: time.Second, Success: true},
+		Event{Time: base.Add(time.Hour), Operation: "decrypt", Duration: 2 * time.Second, ErrorType: "crypto"},
+		Event{Time: base.Add(2 * time.Hour), Operation: "decrypt", Duration: time.Second, Success: true},
+	))
+
+	info, err := os.Stat(store.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	events, err = store.Read(base.Add(time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	events, err = store.Read(time.Time{}, base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "encrypt", events[0].Operation)
+
+	removed, err := store.Reset(time.Time{}, base.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	events, err = store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.True(t, events[0].Time.Equal(base.Add(2*time.Hour)))
+
+	removed, err = store.Reset(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	events, err = store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestStoreConcurrentAppends(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "metrics.jsonl"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Append(Event{Time: time.Now(), Operation: "encrypt", Success: true}))
+		}()
+	}
+	wg.Wait()
+
+	events, err := store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, events, 20)
+}
+
+func TestStoreResetKeepsWaitingWriters(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "metrics.jsonl"))
+	require.NoError(t, err)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Append(Event{Time: base, Operation: "encrypt", Success: true}))
+	before, err := os.Stat(store.Path())
+	require.NoError(t, err)
+
+	// Hold the lock so the append and the reset both queue on the old file.
+	held, err := os.Open(store.Path())
+	require.NoError(t, err)
+	require.NoError(t, filelock.Lock(held, true))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, store.Append(Event{Time: base.Add(time.Hour), Operation: "decrypt", Success: true}))
+	}()
+	go func() {
+		defer wg.Done()
+		removed, err := store.Reset(time.Time{}, base.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, filelock.Unlock(held))
+	require.NoError(t, held.Close())
+	wg.Wait()
+
+	events, err := store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, events, 1, "the append queued behind the reset must reach the new file")
+	assert.Equal(t, "decrypt", events[0].Operation)
+
+	after, err := os.Stat(store.Path())
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(before, after), "reset replaces the file")
+	assert.Equal(t, os.FileMode(0o600), after.Mode().Perm())
+}
+
+func TestTimersPersistToStore(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "metrics.jsonl"))
+	require.NoError(t, err)
+	SetStore(store)
+	defer SetStore(nil)
+
+	NewTimer("intermediate").Stop(true)
+	NewTimer("decrypt").StopWithError(errors.NewCryptoError("wrong passphrase", nil))
+
+	events, err := store.Read(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "intermediate", events[0].Operation)
+	assert.True(t, events[0].Success)
+	assert.Equal(t, "crypto", events[1].ErrorType)
+
+	aggregated := Aggregate(events, time.Time{})
+	assert.Equal(t, int64(1), aggregated.IntermediateCount)
+	assert.Equal(t, int64(1), aggregated.DecryptErrors)
+	assert.Equal(t, events[0].Time, aggregated.StartTime)
+
+	var out strings.Builder
+	require.NoError(t, aggregated.WritePrometheus(&out))
+	assert.Contains(t, out.String(), `bip38cli_operation_errors_total{operation="decrypt",type="crypto"} 1`)
+}
+
+func TestRecordLabelledOperations(t *testing.T) {
+	metrics := &Metrics{StartTime: time.Unix(1700000000, 0)}
+	ec := Labels{"network": "mainnet", "ec_multiply": "true", "compressed": "true"}
+	plain := Labels{"compressed": "false", "ec_multiply": "false", "network": "mainnet"}
+
+	metrics.Record(Event{Operation: "encrypt", Labels: plain, Duration: time.Second, Success: true})
+	metrics.Record(Event{Operation: "encrypt", Labels: ec, Duration: 3 * time.Second, Success: true})
+	metrics.Record(Event{Operation: "encrypt", Labels: Labels{"ec_multiply": "true", "compressed": "true", "network": "mainnet"}, Duration: time.Second, ErrorType: "crypto"})
+	metrics.Record(Event{Operation: "confirm", Duration: time.Second, ErrorType: "crypto"})
+	metrics.Record(Event{Operation: "generate_wif", Labels: Labels{"network": "testnet3"}, Success: true})
+
+	assert.Equal(t, int64(3), metrics.EncryptCount, "labelled encrypt events update the legacy totals")
+	assert.Equal(t, float64(66.67), metrics.EncryptSuccessRate())
+	assert.Equal(t, float64(0), metrics.SuccessRate("confirm"))
+	assert.Equal(t, float64(100), metrics.SuccessRate("generate_wif"))
+	assert.Equal(t, []string{"confirm", "encrypt", "generate_wif"}, metrics.OperationNames())
+
+	stats := metrics.Operations()
+	require.Len(t, stats, 4, "label order must not split a series")
+	assert.Equal(t, "confirm", stats[0].Operation)
+	assert.Equal(t, map[string]int64{"crypto": 1}, stats[0].ErrorTypes)
+	assert.Equal(t, plain, stats[1].Labels)
+	assert.Equal(t, ec, stats[2].Labels)
+	assert.Equal(t, int64(2), stats[2].Count)
+	assert.Equal(t, 2*time.Second, stats[2].AverageDuration)
+	assert.Equal(t, float64(50), stats[2].SuccessRate)
+
+	snapshot := metrics.GetSnapshot()
+	metrics.Record(Event{Operation: "confirm", Success: true})
+	count, _, _ := snapshot.Totals("confirm")
+	assert.Equal(t, int64(1), count, "snapshots do not share series with the live metrics")
+
+	data, err := json.Marshal(&snapshot)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"operation":"generate_wif","labels":{"network":"testnet3"},"count":1`)
+
+	var out strings.Builder
+	require.NoError(t, metrics.WritePrometheus(&out))
+	text := out.String()
+	for _, line := range []string{
+		`bip38cli_operations_total{operation="encrypt",compressed="true",ec_multiply="true",network="mainnet"} 2`,
+		`bip38cli_operation_errors_total{operation="encrypt",compressed="true",ec_multiply="true",network="mainnet",type="crypto"} 1`,
+		`bip38cli_operations_total{operation="confirm"} 2`,
+		`bip38cli_operation_duration_seconds_count{operation="generate_wif",network="testnet3"} 1`,
+		`bip38cli_operations_total{operation="decrypt"} 0`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+	assert.NotContains(t, text, `bip38cli_operations_total{operation="encrypt"} `, "encrypt has labelled series")
+}
+
+func TestSinks(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	var mu sync.Mutex
+	var received []Event
+	remove := AddSink(SinkFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e)
+	}))
+
+	Publish(Event{Operation: "confirm", Labels: Labels{"network": "mainnet"}, Duration: time.Second, Success: true})
+	NewTimer("generate_wif").WithLabels(Labels{"compressed": "true"}).StopWithError(errors.NewSystemError("no entropy", nil))
+	remove()
+	Publish(Event{Operation: "confirm", Success: true})
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "confirm", received[0].Operation)
+	assert.False(t, received[0].Time.IsZero(), "dispatch stamps the event time")
+	assert.Equal(t, Labels{"compressed": "true"}, received[1].Labels)
+	assert.Equal(t, "system", received[1].ErrorType)
+
+	count, errs, _ := GetMetrics().Totals("confirm")
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(0), errs)
+	assert.Equal(t, float64(0), GetMetrics().SuccessRate("generate_wif"))
+}
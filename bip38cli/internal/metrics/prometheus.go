@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the operation duration
+// histograms. One BIP38 scrypt derivation takes from a fraction of a second
+// to a few seconds depending on the machine, and EC-multiply operations run
+// two, so the buckets concentrate there.
+var DurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32}
+
+// operations are always exposed, with zero values until they first run, so
+// dashboards and alerts see them from the start.
+var operations = []string{"encrypt", "decrypt", "intermediate"}
+
+// unknownErrorType labels failures recorded without an error, e.g. Stop(false).
+const unknownErrorType = "unknown"
+
+// histogram counts observations per bucket (not cumulative).
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(DurationBuckets))
+	}
+	seconds := duration.Seconds()
+	h.sum += seconds
+	h.count++
+	if i := sort.SearchFloat64s(DurationBuckets, seconds); i < len(DurationBuckets) {
+		h.counts[i]++
+	}
+}
+
+func errorTypeOf(err error) string {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) && appErr.Type != "" {
+		return string(appErr.Type)
+	}
+	return unknownErrorType
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+// Each operation and label set is one series; failures recorded without an
+// error (Stop(false), RecordX) are reported with type "unknown".
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	var b bytes.Buffer
+
+	m.mu.RLock()
+	all := make(map[string]*series, len(m.series)+len(operations))
+	for key, s := range m.series {
+		all[key] = s
+	}
+	for _, op := range operations {
+		if _, ok := all[op]; !ok && !m.hasOperation(op) {
+			all[op] = &series{operation: op}
+		}
+	}
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeHeader(&b, "bip38cli_operations_total", "counter", "Operations performed, including failures.")
+	for _, key := range keys {
+		s := all[key]
+		fmt.Fprintf(&b, "bip38cli_operations_total{%s} %d\n", promLabels(s), s.count)
+	}
+
+	writeHeader(&b, "bip38cli_operation_errors_total", "counter", "Failed operations by error type.")
+	for _, key := range keys {
+		s := all[key]
+		names := make([]string, 0, len(s.errorTypes))
+		for name := range s.errorTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "bip38cli_operation_errors_total{%s,type=%q} %d\n", promLabels(s), name, s.errorTypes[name])
+		}
+	}
+
+	writeHeader(&b, "bip38cli_operation_duration_seconds", "histogram", "Operation latency, including scrypt.")
+	for _, key := range keys {
+		s := all[key]
+		labels := promLabels(s)
+		var cumulative uint64
+		for i, le := range DurationBuckets {
+			if s.histogram.counts != nil {
+				cumulative += s.histogram.counts[i]
+			}
+			fmt.Fprintf(&b, "bip38cli_operation_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(&b, "bip38cli_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.histogram.count)
+		fmt.Fprintf(&b, "bip38cli_operation_duration_seconds_sum{%s} %s\n", labels, formatFloat(s.histogram.sum))
+		fmt.Fprintf(&b, "bip38cli_operation_duration_seconds_count{%s} %d\n", labels, s.histogram.count)
+	}
+
+	writeHeader(&b, "bip38cli_start_time_seconds", "gauge", "Unix time the metrics were started or last reset.")
+	fmt.Fprintf(&b, "bip38cli_start_time_seconds %s\n", formatFloat(float64(m.StartTime.UnixNano())/1e9))
+	m.mu.RUnlock()
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// hasOperation reports whether any label set of operation was recorded.
+// Callers hold m.mu.
+func (m *Metrics) hasOperation(operation string) bool {
+	for _, s := range m.series {
+		if s.operation == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// promLabels renders operation followed by the series labels in name order.
+func promLabels(s *series) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "operation=%q", s.operation)
+	for _, name := range labelNames(s.labels) {
+		fmt.Fprintf(&b, ",%s=%q", name, s.labels[name])
+	}
+	return b.String()
+}
+
+func writeHeader(b *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteTextfile atomically replaces path with the metrics in the Prometheus
+// text format, for node_exporter's textfile collector. The collector only
+// reads files ending in .prom. The file is world-readable since the exporter
+// usually runs as another user; it holds no key material.
+func (m *Metrics) WriteTextfile(path string) error {
+	var b bytes.Buffer
+	if err := m.WritePrometheus(&b); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+// Handler serves the global metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the global metrics in the Prometheus text format.
+func WritePrometheus(w io.Writer) error {
+	return GetMetrics().WritePrometheus(w)
+}
+
+// WriteTextfile writes the global metrics to path for the textfile collector.
+func WriteTextfile(path string) error {
+	return GetMetrics().WriteTextfile(path)
+}
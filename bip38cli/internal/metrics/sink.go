@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Sink receives every event recorded through a Timer or Publish, after the
+// in-process metrics are updated. Record runs on the goroutine that finished
+// the operation and must be safe for concurrent use.
+type Sink interface {
+	Record(Event)
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(Event)
+
+// Record calls f(e).
+func (f SinkFunc) Record(e Event) {
+	f(e)
+}
+
+type sinkEntry struct {
+	sink Sink
+}
+
+var (
+	sinks   []*sinkEntry
+	sinksMu sync.RWMutex
+)
+
+// AddSink registers s and returns a function that removes it again.
+func AddSink(s Sink) (remove func()) {
+	entry := &sinkEntry{sink: s}
+	sinksMu.Lock()
+	sinks = append(sinks, entry)
+	sinksMu.Unlock()
+
+	return func() {
+		sinksMu.Lock()
+		defer sinksMu.Unlock()
+		for i, existing := range sinks {
+			if existing == entry {
+				sinks = append(sinks[:i:i], sinks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// dispatch stamps the event and hands it to every sink.
+func dispatch(event Event) {
+	sinksMu.RLock()
+	current := sinks
+	sinksMu.RUnlock()
+	if len(current) == 0 {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, entry := range current {
+		entry.sink.Record(event)
+	}
+}
@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/filelock"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+)
+
+// Event is one timed operation, as recorded by Metrics and kept in a Store.
+type Event struct {
+	Time      time.Time     `json:"time"`
+	Operation string        `json:"operation"`
+	Labels    Labels        `json:"labels,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+	Success   bool          `json:"success"`
+	ErrorType string        `json:"error_type,omitempty"`
+}
+
+// Store is an append-only JSONL file of events shared by every invocation
+// on the machine. Each write opens the file and holds an exclusive lock, so
+// concurrent processes and goroutines never interleave lines; reads hold a
+// shared lock. Reset replaces the file, so whoever opened the old one before
+// taking the lock opens the store again.
+type Store struct {
+	path string
+}
+
+// DefaultStorePath returns bip38cli/metrics.jsonl under $XDG_STATE_HOME,
+// falling back to ~/.local/state.
+func DefaultStorePath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate state directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "bip38cli", "metrics.jsonl"), nil
+}
+
+// OpenStore returns the store at path, creating its directory with
+// owner-only permissions. The file itself is created on first write.
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create metrics store directory: %w", err)
+	}
+	return &Store{path: path}, nil
+}
+
+// Path returns the file backing the store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append adds events to the end of the store.
+func (s *Store) Append(events ...Event) error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode metrics event: %w", err)
+		}
+	}
+
+	f, err := s.openLocked(os.O_WRONLY|os.O_APPEND|os.O_CREATE, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	defer func() { _ = filelock.Unlock(f) }()
+
+	if _, err := f.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write metrics store: %w", err)
+	}
+	return nil
+}
+
+// Read returns the events with since <= Time < until. A zero bound is open.
+// Lines that fail to parse, e.g. a write cut short by a crash, are skipped.
+func (s *Store) Read(since, until time.Time) ([]Event, error) {
+	f, err := s.openLocked(os.O_RDONLY, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	defer func() { _ = filelock.Unlock(f) }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if inWindow(event.Time, since, until) {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics store: %w", err)
+	}
+	return events, nil
+}
+
+// Reset removes the events with since <= Time < until, keeping the rest, and
+// returns how many were removed. With both bounds zero the store is emptied.
+func (s *Store) Reset(since, until time.Time) (int, error) {
+	f, err := s.openLocked(os.O_RDONLY, true)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	defer func() { _ = filelock.Unlock(f) }()
+
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil && inWindow(event.Time, since, until) {
+			removed++
+			continue
+		}
+		kept.Write(scanner.Bytes())
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read metrics store: %w", err)
+	}
+
+	// Write the kept events to a new file and rename it over the store while
+	// still holding the lock, so a crash leaves either the old events or the
+	// new ones. Writers waiting on the old file notice and reopen.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset metrics store: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("failed to reset metrics store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("failed to reset metrics store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to reset metrics store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return 0, fmt.Errorf("failed to reset metrics store: %w", err)
+	}
+	return removed, nil
+}
+
+// openLocked opens the store and locks it. When Reset replaced the file
+// while we waited for the lock, the old one is dropped and the new one
+// opened instead.
+func (s *Store) openLocked(flag int, exclusive bool) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(s.path, flag, 0o600) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("failed to open metrics store: %w", err)
+		}
+		if err := filelock.Lock(f, exclusive); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock metrics store: %w", err)
+		}
+
+		opened, err := f.Stat()
+		if err != nil {
+			_ = filelock.Unlock(f)
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to open metrics store: %w", err)
+		}
+		current, err := os.Stat(s.path)
+		if err == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+		_ = filelock.Unlock(f)
+		_ = f.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to open metrics store: %w", err)
+		}
+	}
+}
+
+func inWindow(t, since, until time.Time) bool {
+	return (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+}
+
+// Aggregate replays events into a fresh Metrics. StartTime is the first
+// event, or since when given.
+func Aggregate(events []Event, since time.Time) *Metrics {
+	m := &Metrics{StartTime: since}
+	for _, event := range events {
+		if m.StartTime.IsZero() || event.Time.Before(m.StartTime) {
+			m.StartTime = event.Time
+		}
+		m.record(event)
+	}
+	if m.StartTime.IsZero() {
+		m.StartTime = time.Now()
+	}
+	return m
+}
+
+// Record appends one event, implementing Sink. Failures are logged rather
+// than failing the operation that was measured.
+func (s *Store) Record(event Event) {
+	if err := s.Append(event); err != nil {
+		logger.WithError(err).Warn("Failed to persist metrics")
+	}
+}
+
+var (
+	removeStoreSink func()
+	activeStoreMu   sync.Mutex
+)
+
+// SetStore makes timers append their events to s; nil stops persisting.
+func SetStore(s *Store) {
+	activeStoreMu.Lock()
+	defer activeStoreMu.Unlock()
+	if removeStoreSink != nil {
+		removeStoreSink()
+		removeStoreSink = nil
+	}
+	if s != nil {
+		removeStoreSink = AddSink(s)
+	}
+}
@@ -0,0 +1,242 @@
+// Package paper renders paper wallets: a page holding an address and a BIP38
+// encrypted key as text and QR codes, drawn from a layout template. Output
+// depends only on the layout, the wallet and the QR error correction level,
+// so rendering the same inputs twice produces identical files.
+package paper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+// Element types of a layout.
+const (
+	TypeQR   = "qr"
+	TypeText = "text"
+	TypeRect = "rect"
+	TypeLine = "line"
+)
+
+// Layout describes a page. Lengths are in millimetres from the top left
+// corner; font sizes are in points.
+type Layout struct {
+	Width    float64   `json:"width"`
+	Height   float64   `json:"height"`
+	Elements []Element `json:"elements"`
+}
+
+// Element is one thing drawn on the page.
+//
+// Value may reference wallet fields as {address}, {encrypted_key},
+// {confirmation_code}, {lot}, {sequence}, {network} and {label}; an element
+// referencing a field the wallet lacks is left out, as is an element whose
+// When names such a field.
+type Element struct {
+	Type string  `json:"type"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+
+	// qr: Size is the edge of the symbol including its quiet zone. Level
+	// overrides the error correction level chosen at render time.
+	Size  float64 `json:"size,omitempty"`
+	Level string  `json:"level,omitempty"`
+
+	// text: Y is the baseline of the first line. Lines longer than MaxWidth
+	// are wrapped.
+	FontSize float64 `json:"font_size,omitempty"`
+	Bold     bool    `json:"bold,omitempty"`
+	Align    string  `json:"align,omitempty"`
+	MaxWidth float64 `json:"max_width,omitempty"`
+
+	// rect and line: Width and Height size a rectangle, X2 and Y2 end a
+	// line, Stroke is the line width. A rect without a stroke is filled.
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+	X2     float64 `json:"x2,omitempty"`
+	Y2     float64 `json:"y2,omitempty"`
+	Stroke float64 `json:"stroke,omitempty"`
+
+	Value string `json:"value,omitempty"`
+	When  string `json:"when,omitempty"`
+}
+
+// Fields a layout can reference.
+var fieldNames = []string{"address", "encrypted_key", "confirmation_code", "lot", "sequence", "network", "label"}
+
+var placeholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// defaultLayout is a 210 x 99 mm slip, a third of an A4 sheet: the address
+// on the left, the encrypted key on the right and EC-multiply details in
+// between.
+const defaultLayout = `{
+  "width": 210,
+  "height": 99,
+  "elements": [
+    {"type": "rect", "x": 5, "y": 5, "width": 200, "height": 89, "stroke": 0.3},
+    {"type": "text", "x": 105, "y": 14, "font_size": 12, "bold": true, "align": "center", "max_width": 90, "value": "{label}"},
+
+    {"type": "text", "x": 30, "y": 20, "font_size": 9, "bold": true, "align": "center", "value": "ADDRESS"},
+    {"type": "qr", "x": 10, "y": 23, "size": 40, "value": "{address}"},
+    {"type": "text", "x": 30, "y": 69, "font_size": 6, "align": "center", "max_width": 44, "value": "{address}"},
+    {"type": "text", "x": 30, "y": 86, "font_size": 7, "align": "center", "value": "{network}"},
+
+    {"type": "text", "x": 180, "y": 20, "font_size": 9, "bold": true, "align": "center", "value": "ENCRYPTED KEY"},
+    {"type": "qr", "x": 160, "y": 23, "size": 40, "value": "{encrypted_key}"},
+    {"type": "text", "x": 180, "y": 69, "font_size": 6, "align": "center", "max_width": 44, "value": "{encrypted_key}"},
+    {"type": "text", "x": 180, "y": 86, "font_size": 7, "align": "center", "value": "BIP38"},
+
+    {"type": "line", "x": 55, "y": 10, "x2": 55, "y2": 89, "stroke": 0.2},
+    {"type": "line", "x": 155, "y": 10, "x2": 155, "y2": 89, "stroke": 0.2},
+    {"type": "text", "x": 105, "y": 26, "font_size": 8, "align": "center", "max_width": 90, "value": "Fund the address freely. Spending needs the encrypted key and its passphrase; keep both private and apart."},
+    {"type": "text", "x": 105, "y": 50, "font_size": 8, "bold": true, "align": "center", "value": "CONFIRMATION CODE", "when": "confirmation_code"},
+    {"type": "text", "x": 105, "y": 55, "font_size": 7, "align": "center", "max_width": 90, "value": "{confirmation_code}"},
+    {"type": "text", "x": 105, "y": 80, "font_size": 8, "align": "center", "value": "Lot {lot}  Sequence {sequence}"}
+  ]
+}
+`
+
+// DefaultLayout returns the built-in layout.
+func DefaultLayout() *Layout {
+	layout, err := ParseLayout(strings.NewReader(defaultLayout))
+	if err != nil {
+		panic("paper: invalid default layout: " + err.Error())
+	}
+	return layout
+}
+
+// DefaultLayoutJSON returns the built-in layout as a starting point for
+// templates.
+func DefaultLayoutJSON() string {
+	return defaultLayout
+}
+
+// ParseLayout reads a JSON layout template and validates it.
+func ParseLayout(r io.Reader) (*Layout, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var layout Layout
+	if err := decoder.Decode(&layout); err != nil {
+		return nil, fmt.Errorf("invalid layout: %w", err)
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+// Validate checks sizes, element types and placeholders.
+func (l *Layout) Validate() error { //nolint:gocyclo
+	if l.Width <= 0 || l.Height <= 0 {
+		return fmt.Errorf("layout width and height must be positive")
+	}
+	for i, e := range l.Elements {
+		var err error
+		switch e.Type {
+		case TypeQR:
+			if e.Size <= 0 {
+				err = fmt.Errorf("size must be positive")
+			} else if e.Value == "" {
+				err = fmt.Errorf("value is required")
+			}
+			if e.Level != "" && err == nil {
+				_, err = qr.ParseLevel(e.Level)
+			}
+		case TypeText:
+			if e.FontSize <= 0 {
+				err = fmt.Errorf("font_size must be positive")
+			} else if e.Align != "" && e.Align != "left" && e.Align != "center" && e.Align != "right" {
+				err = fmt.Errorf("align must be left, center or right")
+			} else if e.MaxWidth < 0 {
+				err = fmt.Errorf("max_width must not be negative")
+			}
+		case TypeRect:
+			if e.Width <= 0 || e.Height <= 0 {
+				err = fmt.Errorf("width and height must be positive")
+			}
+		case TypeLine:
+			if e.Stroke <= 0 {
+				err = fmt.Errorf("stroke must be positive")
+			}
+		default:
+			err = fmt.Errorf("unknown type %q", e.Type)
+		}
+		if err == nil && e.Stroke < 0 {
+			err = fmt.Errorf("stroke must not be negative")
+		}
+		if err == nil {
+			err = checkPlaceholders(e.Value)
+		}
+		if err == nil && e.When != "" && !knownField(e.When) {
+			err = fmt.Errorf("unknown field %q in when", e.When)
+		}
+		if err != nil {
+			return fmt.Errorf("layout element %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func checkPlaceholders(value string) error {
+	for _, match := range placeholder.FindAllStringSubmatch(value, -1) {
+		if !knownField(match[1]) {
+			return fmt.Errorf("unknown placeholder {%s}", match[1])
+		}
+	}
+	return nil
+}
+
+func knownField(name string) bool {
+	for _, known := range fieldNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Wallet holds the values printed on the page. Empty fields and nil lot and
+// sequence numbers leave out the elements that reference them.
+type Wallet struct {
+	Address          string
+	EncryptedKey     string
+	ConfirmationCode string
+	Network          string
+	Label            string
+	Lot              *uint32
+	Sequence         *uint32
+}
+
+func (w Wallet) fields() map[string]string {
+	fields := map[string]string{
+		"address":           w.Address,
+		"encrypted_key":     w.EncryptedKey,
+		"confirmation_code": w.ConfirmationCode,
+		"network":           w.Network,
+		"label":             w.Label,
+	}
+	if w.Lot != nil && w.Sequence != nil {
+		fields["lot"] = strconv.FormatUint(uint64(*w.Lot), 10)
+		fields["sequence"] = strconv.FormatUint(uint64(*w.Sequence), 10)
+	}
+	return fields
+}
+
+// expand substitutes the wallet fields in value. ok is false when a
+// referenced field is empty.
+func expand(value string, fields map[string]string) (result string, ok bool) {
+	ok = true
+	result = placeholder.ReplaceAllStringFunc(value, func(match string) string {
+		v := fields[match[1:len(match)-1]]
+		if v == "" {
+			ok = false
+		}
+		return v
+	})
+	return result, ok
+}
@@ -0,0 +1,221 @@
+package paper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+var ecWallet = Wallet{
+	Address:          "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh",
+	EncryptedKey:     "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j",
+	ConfirmationCode: "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD",
+	Network:          "mainnet",
+	Label:            "Cold storage (1)",
+	Lot:              uint32Ptr(263183),
+	Sequence:         uint32Ptr(1),
+}
+
+func uint32Ptr(v uint32) *uint32 { return &v }
+
+type renderer func(io.Writer, *Layout, Wallet, qr.Level) error
+
+func render(t *testing.T, r renderer, layout *Layout, wallet Wallet) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := r(&buf, layout, wallet, qr.M); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	return buf.String()
+}
+
+func TestRenderIsReproducible(t *testing.T) {
+	for name, r := range map[string]renderer{"svg": RenderSVG, "pdf": RenderPDF} {
+		t.Run(name, func(t *testing.T) {
+			first := render(t, r, DefaultLayout(), ecWallet)
+			if second := render(t, r, DefaultLayout(), ecWallet); first != second {
+				t.Fatal("rendering the same wallet twice differs")
+			}
+			other := ecWallet
+			other.Label = "Cold storage (2)"
+			if render(t, r, DefaultLayout(), other) == first {
+				t.Fatal("a different label rendered the same output")
+			}
+		})
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	svg := render(t, RenderSVG, DefaultLayout(), ecWallet)
+
+	for _, want := range []string{
+		`width="210mm" height="99mm" viewBox="0 0 210 99"`,
+		">Cold storage (1)</text>",
+		">1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh</text>",
+		">CONFIRMATION CODE</text>",
+		">Lot 263183  Sequence 1</text>",
+	} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("SVG lacks %q", want)
+		}
+	}
+	if n := strings.Count(svg, "<path "); n != 2 {
+		t.Fatalf("SVG has %d QR paths, want 2", n)
+	}
+
+	// The 58 character key does not fit 44 mm at 6 pt and is wrapped.
+	if strings.Contains(svg, ">"+ecWallet.EncryptedKey+"<") {
+		t.Fatal("encrypted key was not wrapped")
+	}
+	if !strings.Contains(svg, ">"+ecWallet.EncryptedKey[:34]+"</text>") {
+		t.Fatal("encrypted key wrapped at the wrong column")
+	}
+}
+
+func TestRenderSkipsMissingFields(t *testing.T) {
+	plain := Wallet{
+		Address:      "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB",
+		EncryptedKey: "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+		Network:      "mainnet",
+	}
+	svg := render(t, RenderSVG, DefaultLayout(), plain)
+	for _, unwanted := range []string{"CONFIRMATION CODE", "Lot ", "cfrm38"} {
+		if strings.Contains(svg, unwanted) {
+			t.Fatalf("SVG of a wallet without confirmation code mentions %q", unwanted)
+		}
+	}
+	if !strings.Contains(svg, ">ENCRYPTED KEY</text>") {
+		t.Fatal("static text is missing")
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	pdf := render(t, RenderPDF, DefaultLayout(), ecWallet)
+
+	if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("not a PDF file")
+	}
+	for _, want := range []string{
+		"/MediaBox [0 0 595.276 280.63]",
+		"/BaseFont /Courier ",
+		"(Cold storage \\(1\\)) Tj",
+		"(Lot 263183  Sequence 1) Tj",
+	} {
+		if !strings.Contains(pdf, want) {
+			t.Fatalf("PDF lacks %q", want)
+		}
+	}
+	for _, unwanted := range []string{"/CreationDate", "/ID", "/Filter"} {
+		if strings.Contains(pdf, unwanted) {
+			t.Fatalf("PDF contains %s", unwanted)
+		}
+	}
+
+	// Every cross-reference entry points at its object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(pdf[xref:], "xref\n") {
+		t.Fatal("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[xref:], -1)
+	if len(entries) != 6 {
+		t.Fatalf("xref has %d objects, want 6", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if !strings.HasPrefix(pdf[offset:], fmt.Sprintf("%d 0 obj\n", i+1)) {
+			t.Fatalf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+
+	length := regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`).FindStringSubmatchIndex(pdf)
+	n, _ := strconv.Atoi(pdf[length[2]:length[3]])
+	if !strings.HasPrefix(pdf[length[1]+n:], "endstream") {
+		t.Fatal("content stream length is wrong")
+	}
+}
+
+func TestQRModulesMatchCode(t *testing.T) {
+	layout := &Layout{Width: 50, Height: 50, Elements: []Element{
+		{Type: TypeQR, X: 5, Y: 5, Size: 40, Value: "{address}", Level: "H"},
+	}}
+	svg := render(t, RenderSVG, layout, ecWallet)
+
+	code, err := qr.Encode([]byte(ecWallet.Address), qr.H)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	dark := 0
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				dark++
+			}
+		}
+	}
+	if runs := darkRuns(code); len(runs) != strings.Count(svg, "M") {
+		t.Fatalf("SVG path has %d runs, want %d", strings.Count(svg, "M"), len(runs))
+	} else {
+		total := 0
+		for _, r := range runs {
+			total += r.length
+		}
+		if total != dark {
+			t.Fatalf("runs cover %d modules, want %d", total, dark)
+		}
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	if _, err := ParseLayout(strings.NewReader(DefaultLayoutJSON())); err != nil {
+		t.Fatalf("default layout: %v", err)
+	}
+
+	tests := []struct {
+		name, layout, want string
+	}{
+		{"unknown field", `{"width": 10, "height": 10, "colour": "red"}`, "unknown field"},
+		{"no size", `{"width": 0, "height": 10}`, "must be positive"},
+		{"unknown type", `{"width": 10, "height": 10, "elements": [{"type": "circle"}]}`, `element 1: unknown type "circle"`},
+		{"unknown placeholder", `{"width": 10, "height": 10, "elements": [{"type": "text", "font_size": 8, "value": "{wif}"}]}`, "unknown placeholder {wif}"},
+		{"unknown when", `{"width": 10, "height": 10, "elements": [{"type": "text", "font_size": 8, "value": "x", "when": "wif"}]}`, `unknown field "wif"`},
+		{"bad level", `{"width": 10, "height": 10, "elements": [{"type": "qr", "size": 5, "value": "{address}", "level": "X"}]}`, "error correction level"},
+		{"bad align", `{"width": 10, "height": 10, "elements": [{"type": "text", "font_size": 8, "align": "justify"}]}`, "align"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLayout(strings.NewReader(tt.layout))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseLayout = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	// 10 pt Courier is 2.117 mm a character, so 22 mm holds 10.
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"short", []string{"short"}},
+		{"two words and more", []string{"two words", "and more"}},
+		{"abcdefghijklmnopqrstuvw", []string{"abcdefghij", "klmnopqrst", "uvw"}},
+		{"one\ntwo", []string{"one", "two"}},
+		{"a  b", []string{"a  b"}},
+	}
+	for _, tt := range tests {
+		if got := wrap(tt.text, 22, 10); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Fatalf("wrap(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got := wrap("no limit at all here", 0, 10); len(got) != 1 {
+		t.Fatalf("wrap without max width = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package paper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+// pointsPerMM converts layout millimetres to PDF points.
+const pointsPerMM = 72 / 25.4
+
+// RenderPDF draws the wallet on layout as a one-page PDF 1.4 document. The
+// content stream is uncompressed and the file carries no creation date or
+// document ID, so it is reproducible; text uses the standard Courier fonts,
+// which viewers provide without embedding.
+func RenderPDF(w io.Writer, layout *Layout, wallet Wallet, level qr.Level) error {
+	items, err := compose(layout, wallet, level)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	for _, it := range items {
+		switch it.Type {
+		case TypeRect:
+			x, y := pdfPoint(layout, it.X, it.Y+it.Height)
+			rect := x + " " + y + " " + num(it.Width*pointsPerMM) + " " + num(it.Height*pointsPerMM) + " re"
+			if it.Stroke > 0 {
+				content.WriteString("0 G " + num(it.Stroke*pointsPerMM) + " w " + rect + " S\n")
+			} else {
+				content.WriteString("0 g " + rect + " f\n")
+			}
+		case TypeLine:
+			x1, y1 := pdfPoint(layout, it.X, it.Y)
+			x2, y2 := pdfPoint(layout, it.X2, it.Y2)
+			content.WriteString("0 G " + num(it.Stroke*pointsPerMM) + " w " + x1 + " " + y1 + " m " + x2 + " " + y2 + " l S\n")
+		case TypeText:
+			font := "/F1"
+			if it.Bold {
+				font = "/F2"
+			}
+			for n, line := range it.lines {
+				if line == "" {
+					continue
+				}
+				x, y := pdfPoint(layout, it.lineStart(line), it.baseline(n))
+				content.WriteString("BT 0 g " + font + " " + num(it.FontSize) + " Tf " + x + " " + y + " Td (" + pdfString(line) + ") Tj ET\n")
+			}
+		case TypeQR:
+			m := it.module()
+			content.WriteString("0 g\n")
+			for _, r := range darkRuns(it.code) {
+				x, y := pdfPoint(layout, it.X+(quietZone+float64(r.x))*m, it.Y+(quietZone+float64(r.y)+1)*m)
+				content.WriteString(x + " " + y + " " + num(float64(r.length)*m*pointsPerMM) + " " + num(m*pointsPerMM) + " re\n")
+			}
+			content.WriteString("f\n")
+		}
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 " + num(layout.Width*pointsPerMM) + " " + num(layout.Height*pointsPerMM) +
+			"] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err = w.Write(doc.Bytes())
+	return err
+}
+
+// pdfPoint converts a layout position to PDF coordinates, whose origin is
+// the bottom left corner.
+func pdfPoint(layout *Layout, x, y float64) (string, string) {
+	return num(x * pointsPerMM), num((layout.Height - y) * pointsPerMM)
+}
+
+// pdfString escapes line for a literal string in WinAnsiEncoding; characters
+// outside Latin-1 print as '?'.
+func pdfString(line string) string {
+	var b strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7F:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package paper
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+const (
+	// Text is set in Courier, whose glyphs all advance 0.6 em, so line
+	// widths are known without font metrics.
+	charWidth  = 0.6
+	lineHeight = 1.2
+	mmPerPoint = 25.4 / 72
+	// quietZone is the light border around a QR symbol, in modules.
+	quietZone = 4
+)
+
+// item is an element resolved against a wallet.
+type item struct {
+	Element
+	lines []string
+	code  *qr.Code
+}
+
+// compose resolves the layout's placeholders, wraps text and encodes QR
+// symbols, leaving out elements that reference missing fields.
+func compose(layout *Layout, wallet Wallet, level qr.Level) ([]item, error) {
+	fields := wallet.fields()
+	var items []item
+	for i, e := range layout.Elements {
+		if e.When != "" && fields[e.When] == "" {
+			continue
+		}
+		value, ok := expand(e.Value, fields)
+		if !ok {
+			continue
+		}
+
+		it := item{Element: e}
+		switch e.Type {
+		case TypeQR:
+			elementLevel := level
+			if e.Level != "" {
+				parsed, err := qr.ParseLevel(e.Level)
+				if err != nil {
+					return nil, fmt.Errorf("layout element %d: %w", i+1, err)
+				}
+				elementLevel = parsed
+			}
+			code, err := qr.Encode([]byte(value), elementLevel)
+			if err != nil {
+				return nil, fmt.Errorf("layout element %d: %w", i+1, err)
+			}
+			it.code = code
+		case TypeText:
+			it.lines = wrap(value, e.MaxWidth, e.FontSize)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// wrap splits text at newlines and then at spaces so no line is wider than
+// maxWidth millimetres; words that do not fit alone are broken. Lines that
+// fit are kept as they are. A zero maxWidth only splits at newlines.
+func wrap(text string, maxWidth, fontSize float64) []string {
+	limit := math.MaxInt
+	if maxWidth > 0 {
+		limit = max(1, int(maxWidth/(fontSize*mmPerPoint*charWidth)))
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		if utf8.RuneCountInString(paragraph) <= limit {
+			lines = append(lines, paragraph)
+			continue
+		}
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > limit {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:limit]))
+				word = string(runes[limit:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= limit:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// textWidth is the width of line in millimetres.
+func textWidth(line string, fontSize float64) float64 {
+	return float64(utf8.RuneCountInString(line)) * fontSize * mmPerPoint * charWidth
+}
+
+// lineStart is the left edge of a line of text placed with the element's
+// alignment.
+func (it item) lineStart(line string) float64 {
+	switch it.Align {
+	case "center":
+		return it.X - textWidth(line, it.FontSize)/2
+	case "right":
+		return it.X - textWidth(line, it.FontSize)
+	}
+	return it.X
+}
+
+// baseline is the baseline of the n-th line of a text item.
+func (it item) baseline(n int) float64 {
+	return it.Y + float64(n)*it.FontSize*mmPerPoint*lineHeight
+}
+
+// module is the edge of one QR module in millimetres.
+func (it item) module() float64 {
+	return it.Size / float64(it.code.Size+2*quietZone)
+}
+
+// run is a horizontal stretch of dark modules.
+type run struct {
+	x, y, length int
+}
+
+func darkRuns(code *qr.Code) []run {
+	var runs []run
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Black(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < code.Size && code.Black(x, y) {
+				x++
+			}
+			runs = append(runs, run{x: start, y: y, length: x - start})
+		}
+	}
+	return runs
+}
+
+// num formats a coordinate with at most three decimals, so output does not
+// depend on floating point noise.
+func num(v float64) string {
+	v = math.Round(v*1000) / 1000
+	if v == 0 {
+		v = 0 // no negative zero
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,86 @@
+package paper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/qr"
+)
+
+// RenderSVG draws the wallet on layout as an SVG document whose user unit is
+// one millimetre.
+func RenderSVG(w io.Writer, layout *Layout, wallet Wallet, level qr.Level) error {
+	items, err := compose(layout, wallet, level)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	out.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + num(layout.Width) + `mm" height="` + num(layout.Height) +
+		`mm" viewBox="0 0 ` + num(layout.Width) + ` ` + num(layout.Height) + `">` + "\n")
+	out.WriteString(`<rect width="` + num(layout.Width) + `" height="` + num(layout.Height) + `" fill="#fff"/>` + "\n")
+
+	for _, it := range items {
+		switch it.Type {
+		case TypeRect:
+			out.WriteString(`<rect x="` + num(it.X) + `" y="` + num(it.Y) + `" width="` + num(it.Width) + `" height="` + num(it.Height) + `"`)
+			if it.Stroke > 0 {
+				out.WriteString(` fill="none" stroke="#000" stroke-width="` + num(it.Stroke) + `"/>` + "\n")
+			} else {
+				out.WriteString(` fill="#000"/>` + "\n")
+			}
+		case TypeLine:
+			out.WriteString(`<line x1="` + num(it.X) + `" y1="` + num(it.Y) + `" x2="` + num(it.X2) + `" y2="` + num(it.Y2) +
+				`" stroke="#000" stroke-width="` + num(it.Stroke) + `"/>` + "\n")
+		case TypeText:
+			writeSVGText(&out, it)
+		case TypeQR:
+			writeSVGCode(&out, it)
+		}
+	}
+
+	out.WriteString("</svg>\n")
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+func writeSVGText(out *bytes.Buffer, it item) {
+	anchor := ""
+	switch it.Align {
+	case "center":
+		anchor = ` text-anchor="middle"`
+	case "right":
+		anchor = ` text-anchor="end"`
+	}
+	weight := ""
+	if it.Bold {
+		weight = ` font-weight="bold"`
+	}
+	for n, line := range it.lines {
+		if line == "" {
+			continue
+		}
+		out.WriteString(`<text x="` + num(it.X) + `" y="` + num(it.baseline(n)) + `" font-family="Courier, monospace" font-size="` +
+			num(it.FontSize*mmPerPoint) + `"` + weight + anchor + ` xml:space="preserve">`)
+		_ = xml.EscapeText(out, []byte(line))
+		out.WriteString("</text>\n")
+	}
+}
+
+// writeSVGCode draws the dark modules of a QR symbol as a single path.
+func writeSVGCode(out *bytes.Buffer, it item) {
+	m := it.module()
+	originX := it.X + quietZone*m
+	originY := it.Y + quietZone*m
+
+	var d strings.Builder
+	for _, r := range darkRuns(it.code) {
+		d.WriteString("M" + num(originX+float64(r.x)*m) + " " + num(originY+float64(r.y)*m) +
+			"h" + num(float64(r.length)*m) + "v" + num(m) + "h" + num(-float64(r.length)*m) + "z")
+	}
+	out.WriteString(`<rect x="` + num(it.X) + `" y="` + num(it.Y) + `" width="` + num(it.Size) + `" height="` + num(it.Size) + `" fill="#fff"/>` + "\n")
+	out.WriteString(`<path d="` + d.String() + `" fill="#000" shape-rendering="crispEdges"/>` + "\n")
+}
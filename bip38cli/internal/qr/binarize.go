@@ -0,0 +1,166 @@
+package qr
+
+import (
+	"image"
+	"image/color"
+)
+
+// bitMatrix is a black and white image, true where black.
+type bitMatrix struct {
+	width, height int
+	bits          []bool
+}
+
+func (m *bitMatrix) get(x, y int) bool {
+	return m.bits[y*m.width+x]
+}
+
+// luminance converts img to 8-bit grey levels, compositing transparent
+// pixels over white as a viewer would show them.
+func luminance(img image.Image) ([]byte, int, int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]byte, w*h)
+
+	switch src := img.(type) {
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			copy(lum[y*w:(y+1)*w], src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):])
+		}
+	case *image.YCbCr:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				lum[y*w+x] = src.Y[src.YOffset(b.Min.X+x, b.Min.Y+y)]
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := color.NRGBA64Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA64)
+				grey := (uint32(c.R) + 2*uint32(c.G) + uint32(c.B)) / 4
+				a := uint32(c.A)
+				grey = (grey*a + 0xFFFF*(0xFFFF-a)) / 0xFFFF
+				lum[y*w+x] = byte(grey >> 8)
+			}
+		}
+	}
+	return lum, w, h
+}
+
+const (
+	blockSize = 8
+	// minDynamicRange is the smallest contrast within a block for it to be
+	// thresholded on its own rather than taken from its neighbours.
+	minDynamicRange = 24
+	// minLocalDimension is the smallest image thresholded by block.
+	minLocalDimension = 5 * blockSize
+)
+
+// binarize thresholds img. Larger images use a local threshold per 8x8
+// block averaged over its 5x5 neighbourhood, which copes with uneven
+// lighting; small ones use a single global threshold.
+func binarize(img image.Image) *bitMatrix {
+	lum, w, h := luminance(img)
+	m := &bitMatrix{width: w, height: h, bits: make([]bool, w*h)}
+	if w < minLocalDimension || h < minLocalDimension {
+		threshold := otsu(lum)
+		for i, v := range lum {
+			m.bits[i] = v <= threshold
+		}
+		return m
+	}
+
+	subW := (w + blockSize - 1) / blockSize
+	subH := (h + blockSize - 1) / blockSize
+	points := blackPoints(lum, w, h, subW, subH)
+	for by := 0; by < subH; by++ {
+		top := min(by*blockSize, h-blockSize)
+		cy := clamp(by, 2, subH-3)
+		for bx := 0; bx < subW; bx++ {
+			left := min(bx*blockSize, w-blockSize)
+			cx := clamp(bx, 2, subW-3)
+			sum := 0
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					sum += points[(cy+dy)*subW+cx+dx]
+				}
+			}
+			threshold := sum / 25
+			for y := top; y < top+blockSize; y++ {
+				for x := left; x < left+blockSize; x++ {
+					m.bits[y*w+x] = int(lum[y*w+x]) <= threshold
+				}
+			}
+		}
+	}
+	return m
+}
+
+// blackPoints estimates the threshold of every block. A block without
+// enough contrast is assumed light unless its neighbours say otherwise.
+func blackPoints(lum []byte, w, h, subW, subH int) []int {
+	points := make([]int, subW*subH)
+	for by := 0; by < subH; by++ {
+		top := min(by*blockSize, h-blockSize)
+		for bx := 0; bx < subW; bx++ {
+			left := min(bx*blockSize, w-blockSize)
+			sum, lo, hi := 0, 255, 0
+			for y := top; y < top+blockSize; y++ {
+				for x := left; x < left+blockSize; x++ {
+					v := int(lum[y*w+x])
+					sum += v
+					lo = min(lo, v)
+					hi = max(hi, v)
+				}
+			}
+
+			average := sum / (blockSize * blockSize)
+			if hi-lo <= minDynamicRange {
+				average = lo / 2
+				if by > 0 && bx > 0 {
+					neighbours := (points[(by-1)*subW+bx] + 2*points[by*subW+bx-1] + points[(by-1)*subW+bx-1]) / 4
+					if lo < neighbours {
+						average = neighbours
+					}
+				}
+			}
+			points[by*subW+bx] = average
+		}
+	}
+	return points
+}
+
+// otsu picks the threshold that best separates the histogram of lum into
+// two classes.
+func otsu(lum []byte) byte {
+	var histogram [256]int
+	for _, v := range lum {
+		histogram[v]++
+	}
+	total, sum := len(lum), 0
+	for i, n := range histogram {
+		sum += i * n
+	}
+
+	best, bestVariance := 127, -1.0
+	below, belowSum := 0, 0
+	for t := 0; t < 255; t++ {
+		below += histogram[t]
+		belowSum += t * histogram[t]
+		above := total - below
+		if below == 0 || above == 0 {
+			continue
+		}
+		meanBelow := float64(belowSum) / float64(below)
+		meanAbove := float64(sum-belowSum) / float64(above)
+		variance := float64(below) * float64(above) * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if variance > bestVariance {
+			best, bestVariance = t, variance
+		}
+	}
+	return byte(best)
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
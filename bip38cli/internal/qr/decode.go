@@ -0,0 +1,362 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+)
+
+// grid is a symbol sampled from an image: Size by Size modules, true where
+// dark.
+type grid struct {
+	size int
+	dark []bool
+}
+
+func (g *grid) at(x, y int) bool {
+	return g.dark[y*g.size+x]
+}
+
+// transposed mirrors the grid about its main diagonal, which is how a
+// symbol printed or scanned mirror-image is sampled.
+func (g *grid) transposed() *grid {
+	t := &grid{size: g.size, dark: make([]bool, len(g.dark))}
+	for y := 0; y < g.size; y++ {
+		for x := 0; x < g.size; x++ {
+			t.dark[x*g.size+y] = g.at(x, y)
+		}
+	}
+	return t
+}
+
+var (
+	errFormatInfo  = errors.New("unreadable format information")
+	errVersionInfo = errors.New("version information does not match the symbol size")
+	errTruncated   = errors.New("data ends in the middle of a segment")
+)
+
+// decodeGrid reads the data held by a sampled symbol, correcting errors.
+func decodeGrid(g *grid) ([]byte, error) {
+	version := (g.size - 17) / 4
+	if version < MinVersion || version > MaxVersion || g.size != version*4+17 {
+		return nil, fmt.Errorf("invalid symbol size %d", g.size)
+	}
+
+	level, mask, ok := readFormat(g)
+	if !ok {
+		return nil, errFormatInfo
+	}
+	if version >= 7 {
+		if v, ok := readVersion(g); !ok || v != version {
+			return nil, errVersionInfo
+		}
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	raw := make([]byte, numRawDataModules(version)/8)
+	i := 0
+	c.forEachDataModule(func(x, y int) {
+		if i < len(raw)*8 {
+			if g.at(x, y) != maskBit(mask, x, y) {
+				raw[i>>3] |= 1 << (7 - i&7)
+			}
+			i++
+		}
+	})
+
+	data, err := correctCodewords(raw, version, level)
+	if err != nil {
+		return nil, err
+	}
+	return parseSegments(data, version)
+}
+
+// readFormat decodes the format information from whichever copy is closest
+// to a valid code word, tolerating up to three wrong bits.
+func readFormat(g *grid) (Level, int, bool) {
+	var first, second int
+	for i := 0; i < 6; i++ {
+		first |= bitOf(g.at(8, i)) << i
+	}
+	first |= bitOf(g.at(8, 7))<<6 | bitOf(g.at(8, 8))<<7 | bitOf(g.at(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		first |= bitOf(g.at(14-i, 8)) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= bitOf(g.at(g.size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= bitOf(g.at(8, g.size-15+i)) << i
+	}
+
+	bestLevel, bestMask, bestDistance := L, 0, 16
+	for level := L; level <= H; level++ {
+		for mask := 0; mask < 8; mask++ {
+			want := formatInfo(level, mask)
+			distance := min(bits.OnesCount(uint(first^want)), bits.OnesCount(uint(second^want)))
+			if distance < bestDistance {
+				bestLevel, bestMask, bestDistance = level, mask, distance
+			}
+		}
+	}
+	return bestLevel, bestMask, bestDistance <= 3
+}
+
+// readVersion decodes the version information of symbols from version 7 on.
+func readVersion(g *grid) (int, bool) {
+	var first, second int
+	for i := 0; i < 18; i++ {
+		a, b := g.size-11+i%3, i/3
+		first |= bitOf(g.at(a, b)) << i
+		second |= bitOf(g.at(b, a)) << i
+	}
+
+	best, bestDistance := 0, 19
+	for version := 7; version <= MaxVersion; version++ {
+		want := versionInfo(version)
+		distance := min(bits.OnesCount(uint(first^want)), bits.OnesCount(uint(second^want)))
+		if distance < bestDistance {
+			best, bestDistance = version, distance
+		}
+	}
+	return best, bestDistance <= 3
+}
+
+// correctCodewords undoes the interleaving of addECCAndInterleave, corrects
+// each block and returns the data codewords.
+func correctCodewords(raw []byte, version int, level Level) ([]byte, error) {
+	layout := layoutFor(version, level)
+	blocks := make([][]byte, layout.blocks)
+	k := 0
+	for i := 0; i <= layout.dataPerShortBlock; i++ {
+		for j := range blocks {
+			if i < layout.dataPerShortBlock || j >= layout.shortBlocks {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < layout.eccPerBlock; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for _, block := range blocks {
+		if _, err := rsCorrect(block, layout.eccPerBlock); err != nil {
+			return nil, err
+		}
+		data = append(data, block[:len(block)-layout.eccPerBlock]...)
+	}
+	return data, nil
+}
+
+// bitReader reads big-endian bit fields.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (int, error) {
+	if n > r.remaining() {
+		return 0, errTruncated
+	}
+	value := 0
+	for i := 0; i < n; i++ {
+		value = value<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return value, nil
+}
+
+const alphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// parseSegments concatenates the payload of every segment. ECI designators
+// are skipped and Kanji is returned as Shift JIS.
+func parseSegments(data []byte, version int) ([]byte, error) { //nolint:gocyclo
+	r := &bitReader{data: data}
+	var out []byte
+	for r.remaining() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case modeTerminator:
+			return out, nil
+		case modeFNC1First:
+		case modeFNC1Second:
+			if _, err := r.read(8); err != nil {
+				return nil, err
+			}
+		case modeStructAppend:
+			if _, err := r.read(16); err != nil {
+				return nil, err
+			}
+		case modeECI:
+			first, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case first&0x80 == 0:
+			case first&0xC0 == 0x80:
+				_, err = r.read(8)
+			case first&0xE0 == 0xC0:
+				_, err = r.read(16)
+			default:
+				err = fmt.Errorf("invalid ECI designator")
+			}
+			if err != nil {
+				return nil, err
+			}
+		case modeNumeric, modeAlphanumeric, modeByte, modeKanji:
+			count, err := r.read(charCountBits(mode, version))
+			if err != nil {
+				return nil, err
+			}
+			if out, err = appendSegment(out, r, mode, count); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported segment mode %d", mode)
+		}
+	}
+	return out, nil
+}
+
+func appendSegment(out []byte, r *bitReader, mode, count int) ([]byte, error) { //nolint:gocyclo
+	switch mode {
+	case modeNumeric:
+		for ; count >= 3; count -= 3 {
+			v, err := r.read(10)
+			if err != nil || v >= 1000 {
+				return nil, orInvalid(err, "numeric")
+			}
+			out = append(out, byte('0'+v/100), byte('0'+v/10%10), byte('0'+v%10))
+		}
+		if count == 2 {
+			v, err := r.read(7)
+			if err != nil || v >= 100 {
+				return nil, orInvalid(err, "numeric")
+			}
+			out = append(out, byte('0'+v/10), byte('0'+v%10))
+		} else if count == 1 {
+			v, err := r.read(4)
+			if err != nil || v >= 10 {
+				return nil, orInvalid(err, "numeric")
+			}
+			out = append(out, byte('0'+v))
+		}
+	case modeAlphanumeric:
+		for ; count >= 2; count -= 2 {
+			v, err := r.read(11)
+			if err != nil || v >= 45*45 {
+				return nil, orInvalid(err, "alphanumeric")
+			}
+			out = append(out, alphanumericChars[v/45], alphanumericChars[v%45])
+		}
+		if count == 1 {
+			v, err := r.read(6)
+			if err != nil || v >= 45 {
+				return nil, orInvalid(err, "alphanumeric")
+			}
+			out = append(out, alphanumericChars[v])
+		}
+	case modeByte:
+		for ; count > 0; count-- {
+			v, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, byte(v))
+		}
+	case modeKanji:
+		for ; count > 0; count-- {
+			v, err := r.read(13)
+			if err != nil {
+				return nil, err
+			}
+			sjis := v/0xC0<<8 | v%0xC0
+			if sjis < 0x1F00 {
+				sjis += 0x8140
+			} else {
+				sjis += 0xC140
+			}
+			out = append(out, byte(sjis>>8), byte(sjis))
+		}
+	}
+	return out, nil
+}
+
+func orInvalid(err error, mode string) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("invalid %s segment", mode)
+}
+
+func bitOf(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+// ErrNotFound is returned by DecodeImage when no readable QR code is found.
+var ErrNotFound = errors.New("no QR code found in image")
+
+// DecodeImage finds and decodes every QR code in img, returning the
+// distinct payloads in the order found. Mirrored symbols are read too.
+func DecodeImage(img image.Image) ([][]byte, error) {
+	bin := binarize(img)
+	d := &detector{image: bin}
+	used := make(map[*pattern]bool)
+	seen := make(map[string]bool)
+	var payloads [][]byte
+
+	for _, t := range selectTriples(findFinderPatterns(bin)) {
+		bottomLeft, topLeft, topRight := t[0], t[1], t[2]
+		if used[bottomLeft] || used[topLeft] || used[topRight] {
+			continue
+		}
+		moduleSize := d.moduleSize(topLeft, topRight, bottomLeft)
+		if moduleSize < 1 || math.IsNaN(moduleSize) {
+			continue
+		}
+		if data, ok := d.decodeTriple(topLeft, topRight, bottomLeft, moduleSize); ok {
+			used[bottomLeft], used[topLeft], used[topRight] = true, true, true
+			if !seen[string(data)] {
+				seen[string(data)] = true
+				payloads = append(payloads, data)
+			}
+		}
+	}
+	if len(payloads) == 0 {
+		return nil, ErrNotFound
+	}
+	return payloads, nil
+}
+
+// decodeTriple tries the likely sizes and samplings of the symbol located
+// by a triple of finder patterns until one decodes.
+func (d *detector) decodeTriple(topLeft, topRight, bottomLeft *pattern, moduleSize float64) ([]byte, bool) {
+	for _, dimension := range dimensions(topLeft, topRight, bottomLeft, moduleSize) {
+		for _, g := range d.samples(topLeft, topRight, bottomLeft, moduleSize, dimension) {
+			data, err := decodeGrid(g)
+			if err != nil {
+				data, err = decodeGrid(g.transposed())
+			}
+			if err == nil {
+				return data, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,296 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// draw renders the codes side by side on a white image, scale pixels a
+// module, each with a quiet zone.
+func draw(scale int, codes ...*Code) *image.Gray {
+	width, height := 0, 0
+	for _, c := range codes {
+		width += (c.Size + 2*quietZone) * scale
+		height = max(height, (c.Size+2*quietZone)*scale)
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	left := 0
+	for _, c := range codes {
+		for y := 0; y < c.Size; y++ {
+			for x := 0; x < c.Size; x++ {
+				if !c.Black(x, y) {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.SetGray(left+(x+quietZone)*scale+dx, (y+quietZone)*scale+dy, color.Gray{})
+					}
+				}
+			}
+		}
+		left += (c.Size + 2*quietZone) * scale
+	}
+	return img
+}
+
+const quietZone = 4
+
+// rotate turns img by angle radians about its centre on a larger white
+// canvas, interpolating bilinearly.
+func rotate(img *image.Gray, angle float64) *image.Gray {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	side := int(math.Hypot(float64(w), float64(h))) + 2
+	out := image.NewGray(image.Rect(0, 0, side, side))
+	sin, cos := math.Sincos(angle)
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 255
+		}
+		return float64(img.GrayAt(x, y).Y)
+	}
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			dx, dy := float64(x)-float64(side)/2, float64(y)-float64(side)/2
+			sx := cos*dx + sin*dy + float64(w)/2
+			sy := -sin*dx + cos*dy + float64(h)/2
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			v := at(x0, y0)*(1-fx)*(1-fy) + at(x0+1, y0)*fx*(1-fy) + at(x0, y0+1)*(1-fx)*fy + at(x0+1, y0+1)*fx*fy
+			out.SetGray(x, y, color.Gray{Y: uint8(math.Round(v))})
+		}
+	}
+	return out
+}
+
+func mustEncode(t *testing.T, data string, level Level) *Code {
+	t.Helper()
+	c, err := Encode([]byte(data), level)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return c
+}
+
+func decodeOne(t *testing.T, img image.Image) string {
+	t.Helper()
+	payloads, err := DecodeImage(img)
+	if err != nil {
+		t.Fatalf("DecodeImage: %v", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("DecodeImage found %d codes, want 1", len(payloads))
+	}
+	return string(payloads[0])
+}
+
+const testKey = "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j"
+
+func TestRSCorrect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 500; trial++ {
+		ecc := []int{7, 10, 18, 22, 30}[trial%5]
+		data := make([]byte, 5+rng.Intn(100))
+		rng.Read(data)
+		block := append(append([]byte(nil), data...), rsRemainder(data, rsDivisor(ecc))...)
+		want := append([]byte(nil), block...)
+
+		errs := rng.Intn(ecc/2 + 1)
+		for _, p := range rng.Perm(len(block))[:errs] {
+			block[p] ^= byte(1 + rng.Intn(255))
+		}
+		fixed, err := rsCorrect(block, ecc)
+		if err != nil || fixed != errs || !bytes.Equal(block, want) {
+			t.Fatalf("trial %d: corrected %d of %d errors, err %v", trial, fixed, errs, err)
+		}
+	}
+
+	block := []byte("too many errors")
+	block = append(block, rsRemainder(block, rsDivisor(4))...)
+	for i := 0; i < 6; i++ {
+		block[i] ^= 0x55
+	}
+	if _, err := rsCorrect(block, 4); err == nil {
+		t.Fatal("rsCorrect accepted a block with more errors than it can correct")
+	}
+}
+
+func TestDecodeGridRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for level := L; level <= H; level++ {
+		for _, n := range []int{1, 20, 58, 150, 600, 1200} {
+			data := make([]byte, n)
+			rng.Read(data)
+			c, err := Encode(data, level)
+			if err != nil {
+				continue
+			}
+			g := &grid{size: c.Size, dark: append([]bool(nil), c.modules...)}
+			got, err := decodeGrid(g)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("level %s, %d bytes: %v", level, n, err)
+			}
+		}
+	}
+}
+
+func TestDecodeGridCorrectsErrors(t *testing.T) {
+	c := mustEncode(t, testKey, H)
+	g := &grid{size: c.Size, dark: append([]bool(nil), c.modules...)}
+	// Smudge a 4x4 patch in the data area and a few format bits.
+	for y := 12; y < 16; y++ {
+		for x := 12; x < 16; x++ {
+			g.dark[y*g.size+x] = !g.dark[y*g.size+x]
+		}
+	}
+	g.dark[8*g.size+0] = !g.dark[8*g.size+0]
+	g.dark[1*g.size+8] = !g.dark[1*g.size+8]
+
+	got, err := decodeGrid(g)
+	if err != nil || string(got) != testKey {
+		t.Fatalf("decodeGrid = %q, %v", got, err)
+	}
+}
+
+func TestParseSegments(t *testing.T) {
+	var bb bitBuffer
+	bb.append(modeNumeric, 4)
+	bb.append(5, charCountBits(modeNumeric, 1))
+	bb.append(123, 10)
+	bb.append(45, 7)
+	bb.append(modeAlphanumeric, 4)
+	bb.append(3, charCountBits(modeAlphanumeric, 1))
+	bb.append(10*45+36, 11) // "A "
+	bb.append(44, 6)        // ":"
+	bb.append(modeECI, 4)
+	bb.append(26, 8)
+	bb.append(modeByte, 4)
+	bb.append(2, charCountBits(modeByte, 1))
+	bb.append('h', 8)
+	bb.append('i', 8)
+	bb.append(modeTerminator, 4)
+	for len(bb)%8 != 0 {
+		bb = append(bb, false)
+	}
+	data := make([]byte, len(bb)/8)
+	for i, b := range bb {
+		if b {
+			data[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	got, err := parseSegments(data, 1)
+	if err != nil || string(got) != "12345A :hi" {
+		t.Fatalf("parseSegments = %q, %v", got, err)
+	}
+	if _, err := parseSegments(data[:3], 1); err == nil {
+		t.Fatal("parseSegments accepted truncated data")
+	}
+}
+
+func TestTransformMapsCorners(t *testing.T) {
+	src := [4][2]float64{{3.5, 3.5}, {21.5, 3.5}, {18.5, 18.5}, {3.5, 21.5}}
+	dst := [4][2]float64{{40, 52}, {230, 31}, {215, 190}, {60, 260}}
+	tr := quadToQuad(src, dst)
+	for i := range src {
+		x, y := tr.apply(src[i][0], src[i][1])
+		if math.Abs(x-dst[i][0]) > 1e-6 || math.Abs(y-dst[i][1]) > 1e-6 {
+			t.Fatalf("corner %d maps to (%f, %f), want %v", i, x, y, dst[i])
+		}
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		level Level
+		scale int
+	}{
+		{"small modules", testKey, M, 2},
+		{"large modules", testKey, L, 9},
+		{"high level", testKey, H, 4},
+		{"version 1", "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh", L, 3},
+		{"version 10", string(bytes.Repeat([]byte(testKey), 4)), Q, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := draw(tt.scale, mustEncode(t, tt.data, tt.level))
+			if got := decodeOne(t, img); got != tt.data {
+				t.Fatalf("decoded %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeImageRotated(t *testing.T) {
+	code := mustEncode(t, testKey, M)
+	for _, degrees := range []float64{90, 30, -17, 180} {
+		img := rotate(draw(6, code), degrees*math.Pi/180)
+		if got := decodeOne(t, img); got != testKey {
+			t.Fatalf("rotated %v°: decoded %q", degrees, got)
+		}
+	}
+}
+
+func TestDecodeImageJPEG(t *testing.T) {
+	img := rotate(draw(4, mustEncode(t, testKey, M)), 0.4)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("jpeg.Decode: %v", err)
+	}
+	if got := decodeOne(t, decoded); got != testKey {
+		t.Fatalf("decoded %q", got)
+	}
+}
+
+func TestDecodeImageMirrored(t *testing.T) {
+	img := draw(4, mustEncode(t, testKey, M))
+	b := img.Bounds()
+	mirrored := image.NewGray(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			mirrored.SetGray(b.Dx()-1-x, y, img.GrayAt(x, y))
+		}
+	}
+	if got := decodeOne(t, mirrored); got != testKey {
+		t.Fatalf("decoded %q", got)
+	}
+}
+
+func TestDecodeImageSeveralCodes(t *testing.T) {
+	codes := []string{testKey, "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh", testKey}
+	img := draw(4, mustEncode(t, codes[0], M), mustEncode(t, codes[1], M), mustEncode(t, codes[2], H))
+	payloads, err := DecodeImage(img)
+	if err != nil {
+		t.Fatalf("DecodeImage: %v", err)
+	}
+	got := map[string]bool{}
+	for _, p := range payloads {
+		got[string(p)] = true
+	}
+	if len(payloads) != 2 || !got[codes[0]] || !got[codes[1]] {
+		t.Fatalf("DecodeImage = %q, want the two distinct payloads", payloads)
+	}
+}
+
+func TestDecodeImageNotFound(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 120, 80))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	if _, err := DecodeImage(img); err != ErrNotFound {
+		t.Fatalf("DecodeImage = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,397 @@
+package qr
+
+import "math"
+
+// transform is a perspective transform between two planes, mapping (x, y)
+// to ((a11x + a21y + a31) / d, (a12x + a22y + a32) / d) with
+// d = a13x + a23y + a33.
+type transform struct {
+	a11, a21, a31 float64
+	a12, a22, a32 float64
+	a13, a23, a33 float64
+}
+
+func (t transform) apply(x, y float64) (float64, float64) {
+	d := t.a13*x + t.a23*y + t.a33
+	return (t.a11*x + t.a21*y + t.a31) / d, (t.a12*x + t.a22*y + t.a32) / d
+}
+
+// quadToQuad maps the quadrilateral src onto dst, each given as four
+// corners in order around it.
+func quadToQuad(src, dst [4][2]float64) transform {
+	return squareToQuad(dst).times(squareToQuad(src).adjoint())
+}
+
+// squareToQuad maps the unit square's corners (0,0), (1,0), (1,1) and
+// (0,1) onto q.
+func squareToQuad(q [4][2]float64) transform {
+	x0, y0, x1, y1, x2, y2, x3, y3 := q[0][0], q[0][1], q[1][0], q[1][1], q[2][0], q[2][1], q[3][0], q[3][1]
+	dx3 := x0 - x1 + x2 - x3
+	dy3 := y0 - y1 + y2 - y3
+	if dx3 == 0 && dy3 == 0 {
+		return transform{x1 - x0, x2 - x1, x0, y1 - y0, y2 - y1, y0, 0, 0, 1}
+	}
+	dx1, dx2 := x1-x2, x3-x2
+	dy1, dy2 := y1-y2, y3-y2
+	d := dx1*dy2 - dx2*dy1
+	a13 := (dx3*dy2 - dx2*dy3) / d
+	a23 := (dx1*dy3 - dx3*dy1) / d
+	return transform{x1 - x0 + a13*x1, x3 - x0 + a23*x3, x0, y1 - y0 + a13*y1, y3 - y0 + a23*y3, y0, a13, a23, 1}
+}
+
+// adjoint is the inverse of t up to a scale factor, which a projective
+// transform ignores.
+func (t transform) adjoint() transform {
+	return transform{
+		t.a22*t.a33 - t.a23*t.a32, t.a23*t.a31 - t.a21*t.a33, t.a21*t.a32 - t.a22*t.a31,
+		t.a13*t.a32 - t.a12*t.a33, t.a11*t.a33 - t.a13*t.a31, t.a12*t.a31 - t.a11*t.a32,
+		t.a12*t.a23 - t.a13*t.a22, t.a13*t.a21 - t.a11*t.a23, t.a11*t.a22 - t.a12*t.a21,
+	}
+}
+
+// times composes the transforms, applying o first.
+func (t transform) times(o transform) transform {
+	return transform{
+		t.a11*o.a11 + t.a21*o.a12 + t.a31*o.a13,
+		t.a11*o.a21 + t.a21*o.a22 + t.a31*o.a23,
+		t.a11*o.a31 + t.a21*o.a32 + t.a31*o.a33,
+		t.a12*o.a11 + t.a22*o.a12 + t.a32*o.a13,
+		t.a12*o.a21 + t.a22*o.a22 + t.a32*o.a23,
+		t.a12*o.a31 + t.a22*o.a32 + t.a32*o.a33,
+		t.a13*o.a11 + t.a23*o.a12 + t.a33*o.a13,
+		t.a13*o.a21 + t.a23*o.a22 + t.a33*o.a23,
+		t.a13*o.a31 + t.a23*o.a32 + t.a33*o.a33,
+	}
+}
+
+// detector locates symbols in a binarized image.
+type detector struct {
+	image *bitMatrix
+}
+
+// moduleSize estimates the module size from the finder pattern runs along
+// the sides of the triangle.
+func (d *detector) moduleSize(topLeft, topRight, bottomLeft *pattern) float64 {
+	return (d.moduleSizeOneWay(topLeft, topRight) + d.moduleSizeOneWay(topLeft, bottomLeft)) / 2
+}
+
+func (d *detector) moduleSizeOneWay(p, other *pattern) float64 {
+	a := d.runBothWays(int(p.x), int(p.y), int(other.x), int(other.y))
+	b := d.runBothWays(int(other.x), int(other.y), int(p.x), int(p.y))
+	switch {
+	case math.IsNaN(a):
+		return b / 7
+	case math.IsNaN(b):
+		return a / 7
+	}
+	return (a + b) / 14
+}
+
+// runBothWays measures a finder pattern across its centre at (fromX,
+// fromY): the dark-light-dark run towards (toX, toY) plus the one in the
+// opposite direction, clipped to the image.
+func (d *detector) runBothWays(fromX, fromY, toX, toY int) float64 {
+	result := d.run(fromX, fromY, toX, toY)
+
+	scale := 1.0
+	otherX := fromX - (toX - fromX)
+	if otherX < 0 {
+		scale = float64(fromX) / float64(fromX-otherX)
+		otherX = 0
+	} else if otherX >= d.image.width {
+		scale = float64(d.image.width-1-fromX) / float64(otherX-fromX)
+		otherX = d.image.width - 1
+	}
+	otherY := int(float64(fromY) - float64(toY-fromY)*scale)
+
+	scale = 1.0
+	if otherY < 0 {
+		scale = float64(fromY) / float64(fromY-otherY)
+		otherY = 0
+	} else if otherY >= d.image.height {
+		scale = float64(d.image.height-1-fromY) / float64(otherY-fromY)
+		otherY = d.image.height - 1
+	}
+	otherX = int(float64(fromX) + float64(otherX-fromX)*scale)
+
+	// The centre pixel is counted by both runs.
+	return result + d.run(fromX, fromY, otherX, otherY) - 1
+}
+
+// run walks the line from (fromX, fromY) towards (toX, toY) and returns
+// the distance to the end of the first dark-light-dark sequence, or NaN.
+func (d *detector) run(fromX, fromY, toX, toY int) float64 {
+	steep := abs(toY-fromY) > abs(toX-fromX)
+	if steep {
+		fromX, fromY = fromY, fromX
+		toX, toY = toY, toX
+	}
+	dx, dy := abs(toX-fromX), abs(toY-fromY)
+	xStep, yStep := 1, 1
+	if fromX > toX {
+		xStep = -1
+	}
+	if fromY > toY {
+		yStep = -1
+	}
+
+	state := 0
+	errAcc := -dx / 2
+	for x, y := fromX, fromY; x != toX+xStep; x += xStep {
+		realX, realY := x, y
+		if steep {
+			realX, realY = y, x
+		}
+		// State 1 looks for dark pixels, states 0 and 2 for light ones.
+		if (state == 1) == d.image.get(realX, realY) {
+			if state == 2 {
+				return math.Hypot(float64(x-fromX), float64(y-fromY))
+			}
+			state++
+		}
+		errAcc += dy
+		if errAcc > 0 {
+			if y == toY {
+				break
+			}
+			y += yStep
+			errAcc -= dx
+		}
+	}
+	if state == 2 {
+		return math.Hypot(float64(toX+xStep-fromX), float64(toY-fromY))
+	}
+	return math.NaN()
+}
+
+// dimensions returns the likely symbol sizes for a triple, the best guess
+// first. The estimate is rounded to a valid size, with the neighbouring
+// versions as fallbacks.
+func dimensions(topLeft, topRight, bottomLeft *pattern, moduleSize float64) []int {
+	across := math.Round(distance(topLeft, topRight) / moduleSize)
+	down := math.Round(distance(topLeft, bottomLeft) / moduleSize)
+	estimate := int(across+down)/2 + 7
+
+	var candidates []int
+	switch estimate & 3 {
+	case 0:
+		candidates = []int{estimate + 1}
+	case 1:
+		candidates = []int{estimate}
+	case 2:
+		candidates = []int{estimate - 1}
+	case 3:
+		candidates = []int{estimate - 2, estimate + 2}
+	}
+	candidates = append(candidates, candidates[0]-4, candidates[len(candidates)-1]+4)
+
+	var valid []int
+	for _, c := range candidates {
+		if v := (c - 17) / 4; c >= 21 && v <= MaxVersion && c == v*4+17 {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+// samples reads the modules of a dimension by dimension symbol whose
+// finder patterns are at topLeft, topRight and bottomLeft. When an
+// alignment pattern is found the grid corrected for perspective with it
+// comes first; the grid assuming a parallelogram always follows, in case
+// the alignment pattern was a false match.
+func (d *detector) samples(topLeft, topRight, bottomLeft *pattern, moduleSize float64, dimension int) []*grid {
+	last := float64(dimension) - 3.5
+	src := [4][2]float64{{3.5, 3.5}, {last, 3.5}, {last, last}, {3.5, last}}
+	dst := [4][2]float64{{topLeft.x, topLeft.y}, {topRight.x, topRight.y},
+		{topRight.x - topLeft.x + bottomLeft.x, topRight.y - topLeft.y + bottomLeft.y}, {bottomLeft.x, bottomLeft.y}}
+
+	var grids []*grid
+	if version := (dimension - 17) / 4; version >= 2 {
+		// The bottom-right alignment pattern is three modules in from the
+		// corner the finder patterns imply.
+		correction := 1 - 3/float64(dimension-7)
+		estX := int(topLeft.x + correction*(dst[2][0]-topLeft.x))
+		estY := int(topLeft.y + correction*(dst[2][1]-topLeft.y))
+		for allowance := 4; allowance <= 16; allowance <<= 1 {
+			if p := d.findAlignment(moduleSize, estX, estY, float64(allowance)); p != nil {
+				aligned, alignedDst := src, dst
+				aligned[2] = [2]float64{last - 3, last - 3}
+				alignedDst[2] = [2]float64{p.x, p.y}
+				if g := d.sample(quadToQuad(aligned, alignedDst), dimension); g != nil {
+					grids = append(grids, g)
+				}
+				break
+			}
+		}
+	}
+	if g := d.sample(quadToQuad(src, dst), dimension); g != nil {
+		grids = append(grids, g)
+	}
+	return grids
+}
+
+// sample reads the module centres through t, which maps symbol coordinates
+// to image pixels. It returns nil if the symbol runs off the image.
+func (d *detector) sample(t transform, dimension int) *grid {
+	g := &grid{size: dimension, dark: make([]bool, dimension*dimension)}
+	for y := 0; y < dimension; y++ {
+		for x := 0; x < dimension; x++ {
+			px, py := t.apply(float64(x)+0.5, float64(y)+0.5)
+			ix, iy := int(math.Floor(px)), int(math.Floor(py))
+			// Points just outside the image are nudged back in.
+			if ix < -1 || iy < -1 || ix > d.image.width || iy > d.image.height || math.IsNaN(px) || math.IsNaN(py) {
+				return nil
+			}
+			ix = clamp(ix, 0, d.image.width-1)
+			iy = clamp(iy, 0, d.image.height-1)
+			g.dark[y*dimension+x] = d.image.get(ix, iy)
+		}
+	}
+	return g
+}
+
+// findAlignment looks for an alignment pattern within allowance modules of
+// the estimated centre, returning nil if there is none.
+func (d *detector) findAlignment(moduleSize float64, estX, estY int, allowance float64) *pattern {
+	reach := int(allowance * moduleSize)
+	left := max(0, estX-reach)
+	right := min(d.image.width-1, estX+reach)
+	top := max(0, estY-reach)
+	bottom := min(d.image.height-1, estY+reach)
+	if float64(right-left) < moduleSize*3 || float64(bottom-top) < moduleSize*3 {
+		return nil
+	}
+
+	a := &alignmentFinder{image: d.image, moduleSize: moduleSize}
+	height := bottom - top
+	middle := top + height/2
+	for n := 0; n < height; n++ {
+		// Scan outwards from the middle row.
+		y := middle + (n+1)/2
+		if n&1 == 1 {
+			y = middle - (n+1)/2
+		}
+		if p := a.scanRow(y, left, right); p != nil {
+			return p
+		}
+	}
+	if len(a.centers) > 0 {
+		return a.centers[0]
+	}
+	return nil
+}
+
+// alignmentFinder looks for the light-dark-light 1:1:1 runs across the
+// centre of an alignment pattern. A centre seen twice is accepted.
+type alignmentFinder struct {
+	image      *bitMatrix
+	moduleSize float64
+	centers    []*pattern
+}
+
+func (a *alignmentFinder) scanRow(y, left, right int) *pattern {
+	x := left
+	for x <= right && !a.image.get(x, y) {
+		x++
+	}
+	var counts [3]int
+	state := 0
+	for ; x <= right; x++ {
+		if !a.image.get(x, y) {
+			if state == 1 {
+				state++
+			}
+			counts[state]++
+			continue
+		}
+		if state == 1 {
+			counts[1]++
+			continue
+		}
+		if state == 0 {
+			state = 1
+			counts[1]++
+			continue
+		}
+		if a.ratio(counts) {
+			if p := a.confirm(counts, y, x); p != nil {
+				return p
+			}
+		}
+		counts = [3]int{counts[2], 1, 0}
+		state = 1
+	}
+	if a.ratio(counts) {
+		return a.confirm(counts, y, right+1)
+	}
+	return nil
+}
+
+func (a *alignmentFinder) ratio(counts [3]int) bool {
+	variance := a.moduleSize / 2
+	for _, c := range counts {
+		if math.Abs(a.moduleSize-float64(c)) >= variance {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *alignmentFinder) confirm(counts [3]int, row, end int) *pattern {
+	total := sum(counts[:])
+	x := centerFromEnd(counts[:], end)
+	y := a.crossCheckVertical(row, int(x), 2*counts[1], total)
+	if math.IsNaN(y) {
+		return nil
+	}
+	module := float64(total) / 3
+	for _, c := range a.centers {
+		if c.aboutEquals(module, x, y) {
+			c.combine(module, x, y)
+			return c
+		}
+	}
+	a.centers = append(a.centers, &pattern{x: x, y: y, moduleSize: module, count: 1})
+	return nil
+}
+
+func (a *alignmentFinder) crossCheckVertical(startY, x, maxCount, originalTotal int) float64 {
+	img := a.image
+	var counts [3]int
+	y := startY
+	for y >= 0 && img.get(x, y) && counts[1] <= maxCount {
+		counts[1]++
+		y--
+	}
+	if y < 0 || counts[1] > maxCount {
+		return math.NaN()
+	}
+	for y >= 0 && !img.get(x, y) && counts[0] <= maxCount {
+		counts[0]++
+		y--
+	}
+	if counts[0] > maxCount {
+		return math.NaN()
+	}
+
+	y = startY + 1
+	for y < img.height && img.get(x, y) && counts[1] <= maxCount {
+		counts[1]++
+		y++
+	}
+	if y == img.height || counts[1] > maxCount {
+		return math.NaN()
+	}
+	for y < img.height && !img.get(x, y) && counts[2] <= maxCount {
+		counts[2]++
+		y++
+	}
+	if counts[2] > maxCount {
+		return math.NaN()
+	}
+
+	if 5*abs(sum(counts[:])-originalTotal) >= 2*originalTotal || !a.ratio(counts) {
+		return math.NaN()
+	}
+	return centerFromEnd(counts[:], y)
+}
@@ -0,0 +1,254 @@
+package qr
+
+import "errors"
+
+// eccCodewordsPerBlock and numECCBlocks are indexed by level, then version;
+// index 0 is unused.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numECCBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// numRawDataModules is the number of modules left for codewords and
+// remainder bits once the function patterns are drawn.
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		n := version/7 + 2
+		result -= (25*n-10)*n - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// numDataCodewords is the number of 8-bit data codewords of a symbol.
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numECCBlocks[level][version]
+}
+
+// blockLayout describes how a symbol's codewords split into blocks: the
+// first shortBlocks blocks hold dataPerShortBlock data codewords and the
+// rest one more, each followed by eccPerBlock error correction codewords.
+type blockLayout struct {
+	blocks            int
+	shortBlocks       int
+	dataPerShortBlock int
+	eccPerBlock       int
+}
+
+// layoutFor returns the block structure of version at level.
+func layoutFor(version int, level Level) blockLayout {
+	blocks := numECCBlocks[level][version]
+	ecc := eccCodewordsPerBlock[level][version]
+	raw := numRawDataModules(version) / 8
+	return blockLayout{
+		blocks:            blocks,
+		shortBlocks:       blocks - raw%blocks,
+		dataPerShortBlock: raw/blocks - ecc,
+		eccPerBlock:       ecc,
+	}
+}
+
+// addECCAndInterleave splits data into blocks, appends each block's error
+// correction codewords and interleaves the result.
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	layout := layoutFor(version, level)
+	divisor := rsDivisor(layout.eccPerBlock)
+
+	blocks := make([][]byte, layout.blocks)
+	k := 0
+	for i := range blocks {
+		n := layout.dataPerShortBlock
+		if i >= layout.shortBlocks {
+			n++
+		}
+		blocks[i] = append(append([]byte(nil), data[k:k+n]...), rsRemainder(data[k:k+n], divisor)...)
+		k += n
+	}
+
+	result := make([]byte, 0, numRawDataModules(version)/8)
+	for i := 0; i <= layout.dataPerShortBlock; i++ {
+		for j, block := range blocks {
+			if i < layout.dataPerShortBlock || j >= layout.shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.eccPerBlock; i++ {
+		for _, block := range blocks {
+			result = append(result, block[len(block)-layout.eccPerBlock+i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the generator polynomial of the given degree, highest
+// coefficient first with the leading 1 dropped.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfExp and gfLog are the powers and logarithms of the generator 2 in
+// GF(2^8); gfExp is doubled so sums of two logarithms need no reduction.
+var (
+	gfExp [510]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i], gfExp[i+255] = byte(x), byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+}
+
+func gfInverse(x byte) byte {
+	return gfExp[255-gfLog[x]]
+}
+
+// gfEval evaluates a polynomial with coefficients in ascending order.
+func gfEval(poly []byte, x byte) byte {
+	var result byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		result = gfMultiply(result, x) ^ poly[i]
+	}
+	return result
+}
+
+// errTooManyErrors is returned for blocks beyond the error correction
+// capacity.
+var errTooManyErrors = errors.New("too many errors to correct")
+
+// rsCorrect repairs block, data codewords followed by ecc error correction
+// codewords, in place and returns the number of codewords it changed. It
+// finds up to ecc/2 errors with the Berlekamp-Massey algorithm, a Chien
+// search and Forney's formula.
+func rsCorrect(block []byte, ecc int) (int, error) { //nolint:gocyclo
+	n := len(block)
+	syndromes := make([]byte, ecc)
+	clean := true
+	for j := range syndromes {
+		for _, c := range block {
+			syndromes[j] = gfMultiply(syndromes[j], gfExp[j]) ^ c
+		}
+		clean = clean && syndromes[j] == 0
+	}
+	if clean {
+		return 0, nil
+	}
+
+	// Berlekamp-Massey: the shortest error locator generating the syndromes.
+	locator, prev := []byte{1}, []byte{1}
+	errs, shift, lastDiscrepancy := 0, 1, byte(1)
+	for r := 0; r < ecc; r++ {
+		discrepancy := syndromes[r]
+		for i := 1; i <= errs && i < len(locator); i++ {
+			discrepancy ^= gfMultiply(locator[i], syndromes[r-i])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		coef := gfMultiply(discrepancy, gfInverse(lastDiscrepancy))
+		next := append([]byte(nil), locator...)
+		for len(next) < len(prev)+shift {
+			next = append(next, 0)
+		}
+		for i, p := range prev {
+			next[i+shift] ^= gfMultiply(coef, p)
+		}
+		if 2*errs <= r {
+			prev, errs, lastDiscrepancy, shift = locator, r+1-errs, discrepancy, 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if errs > ecc/2 {
+		return 0, errTooManyErrors
+	}
+
+	// Chien search: errors sit where the locator has roots 2^-p.
+	var powers []int
+	for p := 0; p < n; p++ {
+		if gfEval(locator, gfExp[(255-p%255)%255]) == 0 {
+			powers = append(powers, p)
+		}
+	}
+	if len(powers) != errs {
+		return 0, errTooManyErrors
+	}
+
+	// Forney: the error evaluator gives the magnitude at each position.
+	evaluator := make([]byte, ecc)
+	for i := range evaluator {
+		for j := 0; j <= i && j < len(locator); j++ {
+			evaluator[i] ^= gfMultiply(locator[j], syndromes[i-j])
+		}
+	}
+	for _, p := range powers {
+		x := gfExp[p%255]
+		xInverse := gfInverse(x)
+		var derivative byte
+		for i := 1; i < len(locator); i += 2 {
+			derivative ^= gfMultiply(locator[i], gfExp[gfLog[xInverse]*(i-1)%255])
+		}
+		if derivative == 0 {
+			return 0, errTooManyErrors
+		}
+		block[n-1-p] ^= gfMultiply(x, gfMultiply(gfEval(evaluator, xInverse), gfInverse(derivative)))
+	}
+	return len(powers), nil
+}
@@ -0,0 +1,384 @@
+package qr
+
+import (
+	"math"
+	"sort"
+)
+
+// pattern is a candidate finder or alignment pattern centre in image
+// pixels, with the number of scans that agreed on it.
+type pattern struct {
+	x, y       float64
+	moduleSize float64
+	count      int
+}
+
+func (p *pattern) aboutEquals(moduleSize, x, y float64) bool {
+	if math.Abs(y-p.y) > moduleSize || math.Abs(x-p.x) > moduleSize {
+		return false
+	}
+	diff := math.Abs(moduleSize - p.moduleSize)
+	return diff <= 1 || diff <= p.moduleSize
+}
+
+func (p *pattern) combine(moduleSize, x, y float64) {
+	n := float64(p.count)
+	p.x = (n*p.x + x) / (n + 1)
+	p.y = (n*p.y + y) / (n + 1)
+	p.moduleSize = (n*p.moduleSize + moduleSize) / (n + 1)
+	p.count++
+}
+
+func distance(a, b *pattern) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// finderFinder looks for the 1:1:3:1:1 dark-light-dark-light-dark runs of
+// finder patterns along every row, confirming each hit vertically and
+// diagonally.
+type finderFinder struct {
+	image   *bitMatrix
+	centers []*pattern
+}
+
+func findFinderPatterns(image *bitMatrix) []*pattern {
+	f := &finderFinder{image: image}
+	for y := 0; y < image.height; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x < image.width; x++ {
+			if image.get(x, y) {
+				if state&1 == 1 {
+					state++
+				}
+				counts[state]++
+				continue
+			}
+			if state&1 == 1 {
+				counts[state]++
+				continue
+			}
+			if state < 4 {
+				state++
+				counts[state]++
+				continue
+			}
+			if finderRatio(counts, 2) && f.confirm(counts, y, x) {
+				counts, state = [5]int{}, 0
+				continue
+			}
+			counts = [5]int{counts[2], counts[3], counts[4], 1, 0}
+			state = 3
+		}
+		if finderRatio(counts, 2) {
+			f.confirm(counts, y, image.width)
+		}
+	}
+	for _, c := range f.centers {
+		f.refine(c)
+	}
+	return f.centers
+}
+
+// refine moves a centre to the centroid of the pattern's dark 3x3 core.
+// Row scans place centres of rotated patterns a pixel or two off, which
+// adds up across the larger versions; the centroid is unaffected by
+// rotation. The centre is left alone if the core is not cleanly separated
+// from its ring.
+func (f *finderFinder) refine(c *pattern) {
+	img := f.image
+	x0, y0 := int(c.x), int(c.y)
+	if !img.get(x0, y0) {
+		return
+	}
+	limit := int(math.Ceil(25 * c.moduleSize * c.moduleSize))
+	seen := map[int]bool{y0*img.width + x0: true}
+	stack := []int{y0*img.width + x0}
+	var sumX, sumY float64
+	for len(stack) > 0 {
+		if len(seen) > limit {
+			return
+		}
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%img.width, i/img.width
+		sumX += float64(x)
+		sumY += float64(y)
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= img.width || n[1] >= img.height {
+				return
+			}
+			j := n[1]*img.width + n[0]
+			if !seen[j] && img.get(n[0], n[1]) {
+				seen[j] = true
+				stack = append(stack, j)
+			}
+		}
+	}
+	// Pixel centres are at half coordinates.
+	c.x = sumX/float64(len(seen)) + 0.5
+	c.y = sumY/float64(len(seen)) + 0.5
+}
+
+// finderRatio reports whether counts are close to 1:1:3:1:1. Each run may
+// be off by a module divided by tolerance.
+func finderRatio(counts [5]int, tolerance float64) bool {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return false
+		}
+		total += c
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	variance := module / tolerance
+	return math.Abs(module-float64(counts[0])) < variance &&
+		math.Abs(module-float64(counts[1])) < variance &&
+		math.Abs(3*module-float64(counts[2])) < 3*variance &&
+		math.Abs(module-float64(counts[3])) < variance &&
+		math.Abs(module-float64(counts[4])) < variance
+}
+
+func centerFromEnd(counts []int, end int) float64 {
+	n := len(counts)
+	center := float64(end) - float64(counts[n/2])/2
+	for _, c := range counts[n/2+1:] {
+		center -= float64(c)
+	}
+	return center
+}
+
+func sum(counts []int) int {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
+
+// confirm cross-checks a horizontal hit ending at column end and records
+// the centre if it holds.
+func (f *finderFinder) confirm(counts [5]int, row, end int) bool {
+	total := sum(counts[:])
+	x := centerFromEnd(counts[:], end)
+	y := f.crossCheck(int(x), row, 0, 1, counts[2], total, 0.4)
+	if math.IsNaN(y) {
+		return false
+	}
+	x = f.crossCheck(int(x), int(y), 1, 0, counts[2], total, 0.2)
+	if math.IsNaN(x) || !f.crossCheckDiagonal(int(x), int(y)) {
+		return false
+	}
+
+	module := float64(total) / 7
+	for _, c := range f.centers {
+		if c.aboutEquals(module, x, y) {
+			c.combine(module, x, y)
+			return true
+		}
+	}
+	f.centers = append(f.centers, &pattern{x: x, y: y, moduleSize: module, count: 1})
+	return true
+}
+
+// crossCheck measures the pattern through (x, y) along the direction
+// (dx, dy) and returns the coordinate of its centre along that direction,
+// or NaN. Its length may differ from the original scan's by less than the
+// fraction slack.
+func (f *finderFinder) crossCheck(x, y, dx, dy, maxCount, originalTotal int, slack float64) float64 {
+	img := f.image
+	inside := func(i int) bool {
+		px, py := x+i*dx, y+i*dy
+		return px >= 0 && py >= 0 && px < img.width && py < img.height
+	}
+	dark := func(i int) bool {
+		return img.get(x+i*dx, y+i*dy)
+	}
+
+	var counts [5]int
+	i := 0
+	for inside(i) && dark(i) {
+		counts[2]++
+		i--
+	}
+	if !inside(i) {
+		return math.NaN()
+	}
+	for inside(i) && !dark(i) && counts[1] <= maxCount {
+		counts[1]++
+		i--
+	}
+	if !inside(i) || counts[1] > maxCount {
+		return math.NaN()
+	}
+	for inside(i) && dark(i) && counts[0] <= maxCount {
+		counts[0]++
+		i--
+	}
+	if counts[0] > maxCount {
+		return math.NaN()
+	}
+
+	i = 1
+	for inside(i) && dark(i) {
+		counts[2]++
+		i++
+	}
+	if !inside(i) {
+		return math.NaN()
+	}
+	for inside(i) && !dark(i) && counts[3] < maxCount {
+		counts[3]++
+		i++
+	}
+	if !inside(i) || counts[3] >= maxCount {
+		return math.NaN()
+	}
+	for inside(i) && dark(i) && counts[4] < maxCount {
+		counts[4]++
+		i++
+	}
+	if counts[4] >= maxCount {
+		return math.NaN()
+	}
+
+	if float64(abs(sum(counts[:])-originalTotal)) >= slack*float64(originalTotal) {
+		return math.NaN()
+	}
+	if !finderRatio(counts, 2) {
+		return math.NaN()
+	}
+	start := x*dx + y*dy
+	return centerFromEnd(counts[:], start+i)
+}
+
+// crossCheckDiagonal confirms the pattern along the falling diagonal
+// through (x, y), with a looser tolerance as the runs there are longer.
+func (f *finderFinder) crossCheckDiagonal(x, y int) bool {
+	img := f.image
+	var counts [5]int
+	i := 0
+	for x >= i && y >= i && img.get(x-i, y-i) {
+		counts[2]++
+		i++
+	}
+	for _, state := range []int{1, 0} {
+		for x >= i && y >= i && img.get(x-i, y-i) == (state == 0) {
+			counts[state]++
+			i++
+		}
+		if counts[state] == 0 {
+			return false
+		}
+	}
+	if counts[2] == 0 {
+		return false
+	}
+
+	i = 1
+	for x+i < img.width && y+i < img.height && img.get(x+i, y+i) {
+		counts[2]++
+		i++
+	}
+	for _, state := range []int{3, 4} {
+		for x+i < img.width && y+i < img.height && img.get(x+i, y+i) == (state == 4) {
+			counts[state]++
+			i++
+		}
+		if counts[state] == 0 {
+			return false
+		}
+	}
+	return finderRatio(counts, 1.333)
+}
+
+const (
+	// Finder patterns of one symbol have about the same module size.
+	moduleSizeSlack        = 0.5
+	moduleSizeSlackPercent = 0.05
+	minModulesPerEdge      = 9
+	maxModulesPerEdge      = 180
+	// maxCandidates bounds the cubic search for triples in noisy images.
+	maxCandidates = 40
+)
+
+// selectTriples groups finder pattern centres into plausible symbols: three
+// centres of similar module size forming a right isosceles triangle. Each
+// triple is ordered bottom-left, top-left, top-right.
+func selectTriples(centers []*pattern) [][3]*pattern { //nolint:gocyclo
+	var confirmed []*pattern
+	for _, c := range centers {
+		if c.count >= 2 {
+			confirmed = append(confirmed, c)
+		}
+	}
+	if len(confirmed) >= 3 {
+		centers = confirmed
+	}
+	if len(centers) > maxCandidates {
+		centers = append([]*pattern(nil), centers...)
+		sort.SliceStable(centers, func(i, j int) bool { return centers[i].count > centers[j].count })
+		centers = centers[:maxCandidates]
+	}
+	centers = append([]*pattern(nil), centers...)
+	sort.SliceStable(centers, func(i, j int) bool { return centers[i].moduleSize < centers[j].moduleSize })
+
+	similar := func(a, b *pattern) bool {
+		diff := math.Abs(a.moduleSize - b.moduleSize)
+		return diff <= moduleSizeSlack || diff/math.Min(a.moduleSize, b.moduleSize) < moduleSizeSlackPercent
+	}
+
+	var triples [][3]*pattern
+	for i := 0; i < len(centers)-2; i++ {
+		for j := i + 1; j < len(centers)-1; j++ {
+			if !similar(centers[i], centers[j]) {
+				break
+			}
+			for k := j + 1; k < len(centers); k++ {
+				if !similar(centers[j], centers[k]) {
+					break
+				}
+				t := orderPatterns(centers[i], centers[j], centers[k])
+				dA := distance(t[1], t[0])
+				dB := distance(t[1], t[2])
+				dC := distance(t[2], t[0])
+				modules := (dA + dB) / (2 * centers[i].moduleSize)
+				if modules < minModulesPerEdge || modules > maxModulesPerEdge {
+					continue
+				}
+				if math.Abs(dA-dB)/math.Min(dA, dB) >= 0.1 {
+					continue
+				}
+				hypotenuse := math.Hypot(dA, dB)
+				if math.Abs(dC-hypotenuse)/math.Min(dC, hypotenuse) >= 0.1 {
+					continue
+				}
+				triples = append(triples, t)
+			}
+		}
+	}
+	return triples
+}
+
+// orderPatterns returns the three centres as bottom-left, top-left and
+// top-right: the top-left one is opposite the longest side, and the others
+// are told apart by the handedness of the triangle.
+func orderPatterns(p0, p1, p2 *pattern) [3]*pattern {
+	d01, d12, d02 := distance(p0, p1), distance(p1, p2), distance(p0, p2)
+	var a, b, c *pattern
+	switch {
+	case d12 >= d01 && d12 >= d02:
+		b, a, c = p0, p1, p2
+	case d02 >= d12 && d02 >= d01:
+		b, a, c = p1, p0, p2
+	default:
+		b, a, c = p2, p0, p1
+	}
+	if (c.x-b.x)*(a.y-b.y)-(c.y-b.y)*(a.x-b.x) < 0 {
+		a, c = c, a
+	}
+	return [3]*pattern{a, b, c}
+}
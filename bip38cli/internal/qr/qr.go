@@ -0,0 +1,471 @@
+// Package qr encodes and decodes QR Code Model 2 symbols (ISO/IEC 18004).
+// Encoding uses byte mode, which is all that printing addresses and
+// encrypted keys needs; the symbol depends only on the data and error
+// correction level, so the same input always yields the same modules.
+// Decoding finds symbols in scanned or photographed images and reads every
+// mode a key or code could have been printed in.
+package qr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Level is the error correction level.
+type Level int
+
+// Error correction levels, recovering about 7, 15, 25 and 30% of the symbol.
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// ParseLevel accepts L, M, Q or H.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "L", "l":
+		return L, nil
+	case "M", "m":
+		return M, nil
+	case "Q", "q":
+		return Q, nil
+	case "H", "h":
+		return H, nil
+	}
+	return 0, fmt.Errorf("unknown error correction level %q (use L, M, Q or H)", s)
+}
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// formatBits are the two error correction bits of the format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// Limits of the version number.
+const (
+	MinVersion = 1
+	MaxVersion = 40
+)
+
+// ErrTooLong is returned when the data does not fit in a version 40 symbol.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// Code is an encoded symbol. Module (0, 0) is the top left corner; the
+// quiet zone is not included.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+	Size    int
+
+	modules  []bool
+	function []bool
+}
+
+// Black reports whether the module at column x, row y is dark. Coordinates
+// outside the symbol are light, as in the quiet zone.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y*c.Size+x]
+}
+
+// Encode returns the smallest symbol holding data in byte mode at level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, fmt.Errorf("invalid error correction level %d", level)
+	}
+
+	version := MinVersion
+	for ; ; version++ {
+		if version > MaxVersion {
+			return nil, ErrTooLong
+		}
+		if 4+charCountBits(modeByte, version)+8*len(data) <= 8*numDataCodewords(version, level) {
+			break
+		}
+	}
+
+	var bits bitBuffer
+	bits.append(modeByte, 4)
+	bits.append(len(data), charCountBits(modeByte, version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * numDataCodewords(version, level)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addECCAndInterleave(codewords, version, level))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // XOR again to undo
+	}
+	c.Mask = best
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	c.function = nil
+	return c, nil
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	return &Code{
+		Version:  version,
+		Level:    level,
+		Size:     size,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+}
+
+// Segment modes.
+const (
+	modeTerminator   = 0x0
+	modeNumeric      = 0x1
+	modeAlphanumeric = 0x2
+	modeStructAppend = 0x3
+	modeByte         = 0x4
+	modeFNC1First    = 0x5
+	modeECI          = 0x7
+	modeKanji        = 0x8
+	modeFNC1Second   = 0x9
+)
+
+// charCountBits is the length of a segment's character count.
+func charCountBits(mode, version int) int {
+	column := 0
+	switch {
+	case version >= 27:
+		column = 2
+	case version >= 10:
+		column = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return [...]int{10, 12, 14}[column]
+	case modeAlphanumeric:
+		return [...]int{9, 11, 13}[column]
+	case modeKanji:
+		return [...]int{8, 10, 12}[column]
+	default:
+		return [...]int{8, 16, 16}[column]
+	}
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 != 0)
+	}
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+	c.function[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(c.Version)
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue // overlaps a finder
+			}
+			c.drawAlignment(positions[i], positions[j])
+		}
+	}
+
+	c.drawFormatBits(0) // reserve the area; overwritten once the mask is chosen
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centred on (x, y).
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < c.Size && yy >= 0 && yy < c.Size {
+				dist := max(abs(dx), abs(dy))
+				c.setFunction(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the centre coordinates of the alignment
+// patterns along each axis.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatInfo returns the 15-bit format information for level and mask,
+// BCH-coded and masked.
+func formatInfo(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInfo(c.Level, mask)
+	for i := 0; i < 6; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // always dark
+}
+
+// versionInfo returns the 18-bit version information, used from version 7.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords fills the data area; modules past the last codeword are
+// remainder bits and stay light.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	c.forEachDataModule(func(x, y int) {
+		if i < len(data)*8 {
+			c.modules[y*c.Size+x] = data[i>>3]>>(7-i&7)&1 != 0
+			i++
+		}
+	})
+}
+
+// forEachDataModule visits the modules outside function patterns in the
+// zigzag order of the standard: two-module columns from the right, going
+// up and down in turn.
+func (c *Code) forEachDataModule(fn func(x, y int)) {
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert // upward column
+				}
+				if !c.function[y*c.Size+x] {
+					fn(x, y)
+				}
+			}
+		}
+	}
+}
+
+// maskBit reports whether mask inverts the module at column x, row y.
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y*c.Size+x] && maskBit(mask, x, y) {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+// Penalty weights of the mask evaluation rules.
+const (
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+// penalty scores the current modules; the mask with the lowest score wins.
+func (c *Code) penalty() int {
+	result := 0
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.Size; a++ {
+			runColor := false
+			run := 0
+			var history [7]int
+			for b := 0; b < c.Size; b++ {
+				x, y := b, a
+				if vertical {
+					x, y = a, b
+				}
+				if c.modules[y*c.Size+x] == runColor {
+					run++
+					if run == 5 {
+						result += penaltyN1
+					} else if run > 5 {
+						result++
+					}
+					continue
+				}
+				c.addHistory(run, &history)
+				if !runColor {
+					result += countFinderLike(&history) * penaltyN3
+				}
+				runColor = c.modules[y*c.Size+x]
+				run = 1
+			}
+			if runColor {
+				c.addHistory(run, &history)
+				run = 0
+			}
+			run += c.Size // light border after the last run
+			c.addHistory(run, &history)
+			result += countFinderLike(&history) * penaltyN3
+		}
+	}
+
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			color := c.modules[y*c.Size+x]
+			if color == c.modules[y*c.Size+x+1] && color == c.modules[(y+1)*c.Size+x] && color == c.modules[(y+1)*c.Size+x+1] {
+				result += penaltyN2
+			}
+		}
+	}
+
+	dark := 0
+	for _, m := range c.modules {
+		if m {
+			dark++
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * penaltyN4
+	return result
+}
+
+func (c *Code) addHistory(run int, history *[7]int) {
+	if history[0] == 0 {
+		run += c.Size // light border before the first run
+	}
+	copy(history[1:], history[:6])
+	history[0] = run
+}
+
+// countFinderLike counts 1:1:3:1:1 patterns with light space on one side.
+func countFinderLike(h *[7]int) int {
+	n := h[1]
+	core := n > 0 && h[2] == n && h[3] == n*3 && h[4] == n && h[5] == n
+	count := 0
+	if core && h[0] >= n*4 && h[6] >= n {
+		count++
+	}
+	if core && h[6] >= n*4 && h[0] >= n {
+		count++
+	}
+	return count
+}
+
+func bit(x, i int) bool {
+	return x>>i&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
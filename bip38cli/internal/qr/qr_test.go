@@ -0,0 +1,184 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonVectors(t *testing.T) {
+	// Version 1-M codewords of "HELLO WORLD" and of the ISO/IEC 18004
+	// Annex I example "01234567".
+	tests := []struct {
+		data, ecc []byte
+	}{
+		{
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+		{
+			data: []byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.ecc))); !bytes.Equal(got, tt.ecc) {
+			t.Fatalf("rsRemainder(%v) = %v, want %v", tt.data, got, tt.ecc)
+		}
+	}
+}
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	formats := []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{M, 0, 0b101010000010010},
+		{L, 0, 0b111011111000100},
+		{L, 4, 0b110011000101111},
+		{H, 7, 0b000100000111011},
+	}
+	for _, tt := range formats {
+		if got := formatInfo(tt.level, tt.mask); got != tt.want {
+			t.Fatalf("formatInfo(%s, %d) = %015b, want %015b", tt.level, tt.mask, got, tt.want)
+		}
+	}
+	if got := versionInfo(7); got != 0b000111110010010100 {
+		t.Fatalf("versionInfo(7) = %018b", got)
+	}
+}
+
+func TestCapacities(t *testing.T) {
+	// Byte mode capacities from the standard's tables.
+	tests := []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{1, L, 17}, {1, M, 14}, {1, Q, 11}, {1, H, 7},
+		{5, M, 84}, {10, M, 213}, {40, L, 2953}, {40, H, 1273},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte{'a'}, tt.bytes), tt.level)
+		if err != nil || c.Version != tt.version {
+			t.Fatalf("%d bytes at %s: version %v, %v; want %d", tt.bytes, tt.level, c, err, tt.version)
+		}
+		c, err = Encode(bytes.Repeat([]byte{'a'}, tt.bytes+1), tt.level)
+		if err == nil && c.Version == tt.version {
+			t.Fatalf("%d bytes at %s still fit version %d", tt.bytes+1, tt.level, tt.version)
+		}
+	}
+	if _, err := Encode(make([]byte, 2954), L); err != ErrTooLong {
+		t.Fatalf("oversized data: %v", err)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range tests {
+		got := alignmentPositions(version)
+		if len(got) != len(want) {
+			t.Fatalf("alignmentPositions(%d) = %v, want %v", version, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("alignmentPositions(%d) = %v, want %v", version, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeStructure(t *testing.T) {
+	key := "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+	c, err := Encode([]byte(key), M)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if c.Version != 4 || c.Size != 33 {
+		t.Fatalf("58 bytes at M: version %d size %d, want 4 and 33", c.Version, c.Size)
+	}
+
+	finder := []string{
+		"#######.",
+		"#.....#.",
+		"#.###.#.",
+		"#.###.#.",
+		"#.###.#.",
+		"#.....#.",
+		"#######.",
+		"........",
+	}
+	for y, row := range finder {
+		for x, cell := range row {
+			want := cell == '#'
+			if c.Black(x, y) != want || c.Black(c.Size-1-x, y) != want || c.Black(x, c.Size-1-y) != want {
+				t.Fatalf("finder module (%d, %d) is not %q", x, y, cell)
+			}
+		}
+	}
+	for i := 8; i < c.Size-8; i++ {
+		if c.Black(i, 6) != (i%2 == 0) || c.Black(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+	if !c.Black(8, c.Size-8) {
+		t.Fatal("dark module missing")
+	}
+
+	// Both copies of the format information carry the chosen mask.
+	format := formatInfo(M, c.Mask)
+	for i := 0; i < 8; i++ {
+		if c.Black(c.Size-1-i, 8) != bit(format, i) {
+			t.Fatalf("format bit %d wrong", i)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		if c.Black(8, i) != bit(format, i) {
+			t.Fatalf("format bit %d wrong in the first copy", i)
+		}
+	}
+
+	again, _ := Encode([]byte(key), M)
+	if render(c) != render(again) {
+		t.Fatal("encoding is not deterministic")
+	}
+}
+
+func TestVersionInfoPlacement(t *testing.T) {
+	c, err := Encode(bytes.Repeat([]byte{'x'}, 200), L)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if c.Version < 7 {
+		t.Fatalf("version %d has no version information", c.Version)
+	}
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		if c.Black(a, b) != bit(bits, i) || c.Black(b, a) != bit(bits, i) {
+			t.Fatalf("version bit %d wrong", i)
+		}
+	}
+}
+
+func render(c *Code) string {
+	var b strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package recovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointVersion is bumped whenever the candidate ordering changes.
+const checkpointVersion = 1
+
+// Checkpoint records how far a search got. It holds the search spec, whose
+// words, masks and fragments may give away most of the passphrase, so Save
+// writes it owner-only (0600).
+type Checkpoint struct {
+	Version      int       `json:"version"`
+	EncryptedKey string    `json:"encrypted_key"`
+	Fingerprint  string    `json:"fingerprint"`
+	Spec         Spec      `json:"spec"`
+	Total        uint64    `json:"total"`
+	Next         uint64    `json:"next"`
+	Tried        uint64    `json:"tried"`
+	Elapsed      float64   `json:"elapsed_seconds"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NewCheckpoint starts a checkpoint for a search that has not run yet.
+func NewCheckpoint(encryptedKey string, spec Spec, plan *Plan) *Checkpoint {
+	return &Checkpoint{
+		Version:      checkpointVersion,
+		EncryptedKey: encryptedKey,
+		Fingerprint:  plan.Fingerprint,
+		Spec:         spec,
+		Total:        plan.Len(),
+	}
+}
+
+// LoadCheckpoint reads a checkpoint file. The error wraps os.ErrNotExist when
+// there is nothing to resume.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", cp.Version)
+	}
+	if cp.Next > cp.Total {
+		return nil, fmt.Errorf("checkpoint position %d is beyond its %d candidates", cp.Next, cp.Total)
+	}
+	return &cp, nil
+}
+
+// Matches reports whether the checkpoint belongs to this key and plan.
+func (c *Checkpoint) Matches(encryptedKey string, plan *Plan) error {
+	if c.EncryptedKey != encryptedKey {
+		return errors.New("checkpoint belongs to a different encrypted key")
+	}
+	if c.Fingerprint != plan.Fingerprint || c.Total != plan.Len() {
+		return errors.New("checkpoint was created for different candidates")
+	}
+	return nil
+}
+
+// Advance folds the progress of one run into the checkpoint.
+func (c *Checkpoint) Advance(base *Checkpoint, p Progress) {
+	c.Next = p.Next
+	c.Tried = base.Tried + p.Tried
+	c.Elapsed = base.Elapsed + p.Elapsed.Seconds()
+	c.UpdatedAt = time.Now().UTC()
+}
+
+// Save writes the checkpoint atomically with owner-only permissions.
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+const (
+	defaultShardSize    = 256
+	defaultLeaseTimeout = 2 * time.Minute
+	waitRetry           = time.Second
+)
+
+// CoordinatorConfig controls a sharded search.
+type CoordinatorConfig struct {
+	EncryptedKey string
+	// Spec is sent to workers with its wordlists inlined; Plan must be built from it.
+	Spec Spec
+	Plan *Plan
+	// Start is the first index to hand out, normally Checkpoint.Next.
+	Start uint64
+	// ShardSize is the number of candidates per shard.
+	ShardSize uint64
+	// LeaseTimeout is how long a shard may go without a heartbeat before it
+	// is handed to another worker. Workers heartbeat at a third of it.
+	LeaseTimeout time.Duration
+	// Token, when set, must be presented by workers.
+	Token string
+	// Try verifies a reported match; it defaults to bip38.DecryptKey.
+	Try TryFunc
+	// Report, when set, is called every ReportInterval and once at the end.
+	Report         func(Progress)
+	ReportInterval time.Duration
+}
+
+type lease struct {
+	shard    Shard
+	owner    uint64
+	deadline time.Time
+}
+
+// Coordinator splits a candidate space into shards and serves them to
+// workers. A shard only counts as searched once a worker reports it, so
+// shards held by a crashed or silent worker are handed out again.
+type Coordinator struct {
+	cfg       CoordinatorConfig
+	job       job
+	try       TryFunc
+	heartbeat time.Duration
+
+	mu       sync.Mutex
+	next     uint64  // first index never handed out
+	requeued []Shard // shards returned by lost workers, sorted by Start
+	leases   map[uint64]*lease
+	mark     *watermark
+	tried    uint64
+	result   *Result
+	runErr   error
+	finished chan struct{}
+	closed   bool
+}
+
+// NewCoordinator prepares a coordinator; call Serve to run it.
+func NewCoordinator(cfg CoordinatorConfig) (*Coordinator, error) {
+	if cfg.Plan == nil {
+		return nil, errors.New("candidate plan is required")
+	}
+	total := cfg.Plan.Len()
+	if cfg.Start > total {
+		return nil, fmt.Errorf("start index %d is beyond the %d candidates", cfg.Start, total)
+	}
+	if cfg.ShardSize == 0 {
+		cfg.ShardSize = defaultShardSize
+	}
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = defaultLeaseTimeout
+	}
+	if cfg.ReportInterval <= 0 {
+		cfg.ReportInterval = defaultReportInterval
+	}
+
+	inline, err := cfg.Spec.Inline()
+	if err != nil {
+		return nil, err
+	}
+	inlinePlan, err := inline.Build()
+	if err != nil {
+		return nil, err
+	}
+	if inlinePlan.Len() != total {
+		return nil, errors.New("wordlists changed while starting the coordinator")
+	}
+
+	try := cfg.Try
+	if try == nil {
+		key := cfg.EncryptedKey
+		try = func(passphrase []byte) (*btcutil.WIF, error) {
+			return bip38.DecryptKey(key, passphrase)
+		}
+	}
+
+	c := &Coordinator{
+		cfg:       cfg,
+		try:       try,
+		heartbeat: cfg.LeaseTimeout / 3,
+		next:      cfg.Start,
+		leases:    make(map[uint64]*lease),
+		mark:      &watermark{next: cfg.Start, pending: make(map[uint64]uint64)},
+		finished:  make(chan struct{}),
+	}
+	c.job = job{
+		EncryptedKey: cfg.EncryptedKey,
+		Spec:         inline,
+		Fingerprint:  inlinePlan.Fingerprint,
+		Total:        total,
+		HeartbeatMS:  durationMS(c.heartbeat),
+	}
+	if cfg.Start == total {
+		c.finish(nil, nil)
+	}
+	return c, nil
+}
+
+// Serve accepts workers on ln until the passphrase is found, every shard has
+// been searched or ctx is cancelled. Workers still connected are told to stop
+// on their next message and are disconnected after a grace period. The
+// Result carries the final progress so callers can checkpoint it.
+func (c *Coordinator) Serve(ctx context.Context, ln net.Listener) (*Result, error) { //nolint:gocyclo
+	started := time.Now()
+
+	var (
+		wg      sync.WaitGroup
+		connsMu sync.Mutex
+		conns   = make(map[net.Conn]struct{})
+		ownerID uint64
+	)
+	accepting := make(chan struct{})
+	go func() {
+		defer close(accepting)
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			connsMu.Lock()
+			conns[raw] = struct{}{}
+			ownerID++
+			owner := ownerID
+			connsMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					connsMu.Lock()
+					delete(conns, raw)
+					connsMu.Unlock()
+					_ = raw.Close()
+				}()
+				c.handle(newConn(raw), owner)
+			}()
+		}
+	}()
+
+	snapshot := func() Progress {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		total := c.job.Total
+		p := Progress{
+			Total:   total,
+			Next:    c.mark.value(),
+			Tried:   c.tried,
+			Elapsed: time.Since(started),
+		}
+		if seconds := p.Elapsed.Seconds(); seconds > 0 && p.Tried > 0 {
+			p.Rate = float64(p.Tried) / seconds
+			remaining := total - c.cfg.Start - min(p.Tried, total-c.cfg.Start)
+			p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+		}
+		return p
+	}
+
+	ticker := time.NewTicker(c.cfg.ReportInterval)
+	defer ticker.Stop()
+	var ctxErr error
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			if c.cfg.Report != nil {
+				c.cfg.Report(snapshot())
+			}
+		case <-c.finished:
+			running = false
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			c.finish(nil, nil)
+			running = false
+		}
+	}
+	_ = ln.Close()
+	<-accepting
+
+	// Let connected workers learn that the search is over before disconnecting them.
+	idle := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(idle)
+	}()
+	grace := 2 * c.heartbeat
+	if ctxErr != nil {
+		grace = 0
+	}
+	select {
+	case <-idle:
+	case <-time.After(grace):
+	}
+	connsMu.Lock()
+	for raw := range conns {
+		_ = raw.Close()
+	}
+	connsMu.Unlock()
+	<-idle
+
+	c.mu.Lock()
+	result := &Result{}
+	if c.result != nil {
+		result = c.result
+	}
+	runErr := c.runErr
+	c.mu.Unlock()
+
+	result.Progress = snapshot()
+	if c.cfg.Report != nil {
+		c.cfg.Report(result.Progress)
+	}
+	if runErr != nil {
+		return result, runErr
+	}
+	if ctxErr != nil && !result.Found && result.Progress.Next < result.Progress.Total {
+		return result, ctxErr
+	}
+	return result, nil
+}
+
+// handle serves one worker connection.
+func (c *Coordinator) handle(wc *conn, owner uint64) {
+	defer c.release(owner)
+
+	hello, err := wc.receive()
+	if err != nil {
+		return
+	}
+	switch {
+	case hello.Type != msgHello:
+		_ = wc.send(message{Type: msgError, Error: "expected hello"})
+		return
+	case hello.Version != protocolVersion:
+		_ = wc.send(message{Type: msgError, Error: fmt.Sprintf("unsupported protocol version %d", hello.Version)})
+		return
+	case c.cfg.Token != "" && !tokenMatches(c.cfg.Token, hello.Token):
+		_ = wc.send(message{Type: msgError, Error: "invalid token"})
+		return
+	}
+	job := c.job
+	if err := wc.send(message{Type: msgJob, Version: protocolVersion, Job: &job}); err != nil {
+		return
+	}
+
+	for {
+		msg, err := wc.receive()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !c.isFinished() {
+				_ = wc.send(message{Type: msgError, Error: err.Error()})
+			}
+			return
+		}
+
+		var reply message
+		switch msg.Type {
+		case msgRequest:
+			reply = c.assign(owner)
+		case msgHeartbeat:
+			reply = c.renew(owner, msg.Shard)
+		case msgResult:
+			reply = c.complete(owner, msg)
+		default:
+			_ = wc.send(message{Type: msgError, Error: fmt.Sprintf("unexpected message %q", msg.Type)})
+			return
+		}
+		if err := wc.send(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Coordinator) isFinished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// finish records the outcome once and wakes Serve. Use finishLocked when
+// c.mu is already held.
+func (c *Coordinator) finish(result *Result, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finishLocked(result, err)
+}
+
+func (c *Coordinator) finishLocked(result *Result, err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.result = result
+	c.runErr = err
+	close(c.finished)
+}
+
+// assign hands out the lowest unsearched shard, reclaiming expired leases first.
+func (c *Coordinator) assign(owner uint64) message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return message{Type: msgDone}
+	}
+
+	now := time.Now()
+	for start, l := range c.leases {
+		if now.After(l.deadline) {
+			delete(c.leases, start)
+			c.requeueLocked(l.shard)
+		}
+	}
+
+	var shard Shard
+	switch {
+	case len(c.requeued) > 0:
+		shard = c.requeued[0]
+		c.requeued = c.requeued[1:]
+	case c.next < c.job.Total:
+		end := c.next + c.cfg.ShardSize
+		if end > c.job.Total || end < c.next {
+			end = c.job.Total
+		}
+		shard = Shard{Start: c.next, End: end}
+		c.next = end
+	default:
+		return message{Type: msgWait, RetryMS: durationMS(waitRetry)}
+	}
+
+	c.leases[shard.Start] = &lease{shard: shard, owner: owner, deadline: now.Add(c.cfg.LeaseTimeout)}
+	return message{Type: msgShard, Shard: &shard}
+}
+
+// renew extends a lease. A worker whose lease already expired may reclaim
+// the shard if nobody else picked it up.
+func (c *Coordinator) renew(owner uint64, shard *Shard) message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return message{Type: msgDone}
+	}
+	if shard == nil {
+		return message{Type: msgAck}
+	}
+
+	deadline := time.Now().Add(c.cfg.LeaseTimeout)
+	if l, ok := c.leases[shard.Start]; ok {
+		if l.owner == owner {
+			l.deadline = deadline
+		}
+		return message{Type: msgAck}
+	}
+	for i, queued := range c.requeued {
+		if queued == *shard {
+			c.requeued = append(c.requeued[:i], c.requeued[i+1:]...)
+			c.leases[shard.Start] = &lease{shard: *shard, owner: owner, deadline: deadline}
+			break
+		}
+	}
+	return message{Type: msgAck}
+}
+
+// complete records a shard searched by owner and verifies any reported
+// match. Only the owner's own lease or a requeued shard counts as searched,
+// so a stale or bogus report cannot move the watermark or the tried count.
+// A verified match is taken from any shard: it decrypts the key.
+func (c *Coordinator) complete(owner uint64, msg message) message {
+	if msg.Shard == nil {
+		return message{Type: msgError, Error: "result without shard"}
+	}
+	shard := *msg.Shard
+
+	if msg.Error != "" {
+		return c.fail(owner, shard)
+	}
+
+	var found *Result
+	if msg.Found {
+		if msg.Index < shard.Start || msg.Index >= shard.End {
+			return message{Type: msgError, Error: "match outside its shard"}
+		}
+		passphrase := c.cfg.Plan.At(msg.Index)
+		wif, err := c.try([]byte(passphrase))
+		if err != nil {
+			return message{Type: msgError, Error: "reported match does not decrypt the key"}
+		}
+		found = &Result{Found: true, Passphrase: passphrase, Index: msg.Index, WIF: wif}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if found != nil {
+		c.tried += msg.Tried
+		c.finishLocked(found, nil)
+		return message{Type: msgDone}
+	}
+	if c.closed {
+		return message{Type: msgDone}
+	}
+
+	if l, ok := c.leases[shard.Start]; ok && l.shard == shard && l.owner == owner {
+		delete(c.leases, shard.Start)
+	} else if !c.dequeueLocked(shard) {
+		return message{Type: msgError, Error: fmt.Sprintf("shard %d-%d is not leased to this worker", shard.Start, shard.End)}
+	}
+	c.tried += msg.Tried
+	c.mark.complete(chunk{start: shard.Start, end: shard.End})
+	if c.mark.value() >= c.job.Total {
+		c.finishLocked(nil, nil)
+		return message{Type: msgDone}
+	}
+	return message{Type: msgAck}
+}
+
+// fail requeues a shard its owner could not search, so another worker picks
+// it up, and tells the owner to stop. Like a result, a failure only counts
+// from the worker holding the lease.
+func (c *Coordinator) fail(owner uint64, shard Shard) message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return message{Type: msgDone}
+	}
+	l, ok := c.leases[shard.Start]
+	if !ok || l.shard != shard || l.owner != owner {
+		return message{Type: msgError, Error: fmt.Sprintf("shard %d-%d is not leased to this worker", shard.Start, shard.End)}
+	}
+	delete(c.leases, shard.Start)
+	c.requeueLocked(shard)
+	return message{Type: msgDone}
+}
+
+// release requeues every shard leased to a disconnected worker.
+func (c *Coordinator) release(owner uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for start, l := range c.leases {
+		if l.owner == owner {
+			delete(c.leases, start)
+			c.requeueLocked(l.shard)
+		}
+	}
+}
+
+func (c *Coordinator) requeueLocked(shard Shard) {
+	i := sort.Search(len(c.requeued), func(i int) bool { return c.requeued[i].Start >= shard.Start })
+	c.requeued = append(c.requeued, Shard{})
+	copy(c.requeued[i+1:], c.requeued[i:])
+	c.requeued[i] = shard
+}
+
+func (c *Coordinator) dequeueLocked(shard Shard) bool {
+	for i, queued := range c.requeued {
+		if queued == shard {
+			c.requeued = append(c.requeued[:i], c.requeued[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
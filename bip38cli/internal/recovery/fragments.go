@@ -0,0 +1,107 @@
+package recovery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxFragments keeps arrangement counts and unranking cheap.
+const maxFragments = 16
+
+// Fragments is a Space of ordered arrangements of remembered fragments: every
+// way of picking between min and max distinct fragments, in any order, joined
+// by each separator. Shorter arrangements come first.
+type Fragments struct {
+	fragments  []string
+	separators []string
+	min, max   int
+	// counts[k] is the number of arrangements of k fragments for one separator.
+	counts []uint64
+	total  uint64
+}
+
+// NewFragments builds the arrangement space. A zero min defaults to 1 and a
+// zero max to the number of fragments. With no separators fragments are
+// concatenated directly.
+func NewFragments(fragments []string, minParts, maxParts int, separators []string) (*Fragments, error) {
+	n := len(fragments)
+	if n == 0 {
+		return nil, errors.New("no fragments given")
+	}
+	if n > maxFragments {
+		return nil, fmt.Errorf("at most %d fragments are supported", maxFragments)
+	}
+	if minParts == 0 {
+		minParts = 1
+	}
+	if maxParts == 0 {
+		maxParts = n
+	}
+	if minParts < 1 || maxParts > n || minParts > maxParts {
+		return nil, fmt.Errorf("fragment count range %d-%d is invalid for %d fragments", minParts, maxParts, n)
+	}
+	if len(separators) == 0 {
+		separators = []string{""}
+	}
+
+	f := &Fragments{
+		fragments:  append([]string{}, fragments...),
+		separators: append([]string{}, separators...),
+		min:        minParts,
+		max:        maxParts,
+		counts:     make([]uint64, maxParts+1),
+	}
+
+	seps := uint64(len(separators))
+	for k := minParts; k <= maxParts; k++ {
+		// n!/(n-k)! arrangements of k fragments; cannot overflow for n <= 16.
+		count := uint64(1)
+		for i := 0; i < k; i++ {
+			count *= uint64(n - i)
+		}
+		f.counts[k] = count
+		if count > math.MaxUint64/seps || f.total > math.MaxUint64-count*seps {
+			return nil, errors.New("too many fragment arrangements")
+		}
+		f.total += count * seps
+	}
+	return f, nil
+}
+
+// Len implements Space.
+func (f *Fragments) Len() uint64 { return f.total }
+
+// At implements Space.
+func (f *Fragments) At(i uint64) string {
+	seps := uint64(len(f.separators))
+	for k := f.min; k <= f.max; k++ {
+		block := f.counts[k] * seps
+		if i >= block {
+			i -= block
+			continue
+		}
+		separator := f.separators[i/f.counts[k]]
+		return strings.Join(f.arrangement(k, i%f.counts[k]), separator)
+	}
+	panic(fmt.Sprintf("recovery: index %d out of range", i))
+}
+
+// arrangement unranks the rank-th ordered selection of k fragments.
+func (f *Fragments) arrangement(k int, rank uint64) []string {
+	available := append([]string{}, f.fragments...)
+	out := make([]string, 0, k)
+	for pos := 0; pos < k; pos++ {
+		// Arrangements that share the first pos+1 choices.
+		remaining := uint64(1)
+		for i := 1; i < k-pos; i++ {
+			remaining *= uint64(len(available) - i)
+		}
+		pick := rank / remaining
+		rank %= remaining
+		out = append(out, available[pick])
+		available = append(available[:pick], available[pick+1:]...)
+	}
+	return out
+}
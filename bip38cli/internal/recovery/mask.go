@@ -0,0 +1,148 @@
+package recovery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Built-in charsets, named as in hashcat.
+var builtinCharsets = map[rune]string{
+	'l': "abcdefghijklmnopqrstuvwxyz",
+	'u': "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	'd': "0123456789",
+	'h': "0123456789abcdef",
+	'H': "0123456789ABCDEF",
+	's': " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+func init() {
+	builtinCharsets['a'] = builtinCharsets['l'] + builtinCharsets['u'] + builtinCharsets['d'] + builtinCharsets['s']
+}
+
+// maxCustomCharsets is the number of ?1..?N placeholders a mask may use.
+const maxCustomCharsets = 4
+
+// Mask is a Space generated from a hashcat-style mask such as "Summer?d?d?s".
+// Supported placeholders are ?l ?u ?d ?h ?H ?s ?a, the custom charsets ?1 to
+// ?4 and ?? for a literal question mark. The last position changes fastest.
+type Mask struct {
+	pattern   string
+	positions [][]rune
+	total     uint64
+}
+
+// ParseMask compiles pattern. Custom charsets are written with the same
+// placeholders, for example "?l?d" or "aeiou".
+func ParseMask(pattern string, customCharsets []string) (*Mask, error) {
+	if pattern == "" {
+		return nil, errors.New("mask is empty")
+	}
+	if len(customCharsets) > maxCustomCharsets {
+		return nil, fmt.Errorf("at most %d custom charsets are supported", maxCustomCharsets)
+	}
+
+	custom := make([][]rune, len(customCharsets))
+	for i, definition := range customCharsets {
+		expanded, err := expandCharset(definition)
+		if err != nil {
+			return nil, fmt.Errorf("custom charset %d: %w", i+1, err)
+		}
+		if len(expanded) == 0 {
+			return nil, fmt.Errorf("custom charset %d is empty", i+1)
+		}
+		custom[i] = expanded
+	}
+
+	mask := &Mask{pattern: pattern, total: 1}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		var position []rune
+		if runes[i] != '?' {
+			position = []rune{runes[i]}
+		} else {
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("mask %q ends with a bare '?'", pattern)
+			}
+			i++
+			switch name := runes[i]; {
+			case name == '?':
+				position = []rune{'?'}
+			case name >= '1' && name <= '0'+maxCustomCharsets:
+				index := int(name - '1')
+				if index >= len(custom) {
+					return nil, fmt.Errorf("mask %q uses ?%c but custom charset %d is not defined", pattern, name, index+1)
+				}
+				position = custom[index]
+			default:
+				charset, ok := builtinCharsets[name]
+				if !ok {
+					return nil, fmt.Errorf("mask %q uses unknown charset ?%c", pattern, name)
+				}
+				position = []rune(charset)
+			}
+		}
+
+		size := uint64(len(position))
+		if mask.total > math.MaxUint64/size {
+			return nil, fmt.Errorf("mask %q has too many candidates", pattern)
+		}
+		mask.total *= size
+		mask.positions = append(mask.positions, position)
+	}
+	return mask, nil
+}
+
+// expandCharset resolves built-in placeholders inside a custom charset
+// definition and removes duplicate characters, keeping first occurrences.
+func expandCharset(definition string) ([]rune, error) {
+	var expanded strings.Builder
+	runes := []rune(definition)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '?' {
+			expanded.WriteRune(runes[i])
+			continue
+		}
+		if i+1 == len(runes) {
+			return nil, fmt.Errorf("charset %q ends with a bare '?'", definition)
+		}
+		i++
+		if runes[i] == '?' {
+			expanded.WriteRune('?')
+			continue
+		}
+		charset, ok := builtinCharsets[runes[i]]
+		if !ok {
+			return nil, fmt.Errorf("charset %q uses unknown placeholder ?%c", definition, runes[i])
+		}
+		expanded.WriteString(charset)
+	}
+
+	seen := make(map[rune]bool)
+	var unique []rune
+	for _, r := range expanded.String() {
+		if !seen[r] {
+			seen[r] = true
+			unique = append(unique, r)
+		}
+	}
+	return unique, nil
+}
+
+// Len implements Space.
+func (m *Mask) Len() uint64 { return m.total }
+
+// At implements Space.
+func (m *Mask) At(i uint64) string {
+	out := make([]rune, len(m.positions))
+	for p := len(m.positions) - 1; p >= 0; p-- {
+		size := uint64(len(m.positions[p]))
+		out[p] = m.positions[p][i%size]
+		i /= size
+	}
+	return string(out)
+}
+
+// String returns the original mask.
+func (m *Mask) String() string { return m.pattern }
@@ -0,0 +1,164 @@
+package recovery
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/unixsock"
+)
+
+// The coordinator and its workers exchange newline-delimited JSON messages.
+// Workers always speak first and every worker message gets exactly one reply:
+//
+//	hello     -> job | error
+//	request   -> shard | wait | done
+//	heartbeat -> ack | done
+//	result    -> ack | done
+//
+// Workers report the index of a match, never the passphrase; the coordinator
+// re-derives and verifies it.
+const (
+	msgHello     = "hello"
+	msgJob       = "job"
+	msgRequest   = "request"
+	msgShard     = "shard"
+	msgWait      = "wait"
+	msgDone      = "done"
+	msgHeartbeat = "heartbeat"
+	msgResult    = "result"
+	msgAck       = "ack"
+	msgError     = "error"
+)
+
+// protocolVersion guards against mixing incompatible binaries.
+const protocolVersion = 1
+
+type message struct {
+	Type    string `json:"type"`
+	Version int    `json:"version,omitempty"`
+	Worker  string `json:"worker,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Job     *job   `json:"job,omitempty"`
+	Shard   *Shard `json:"shard,omitempty"`
+	Found   bool   `json:"found,omitempty"`
+	Index   uint64 `json:"index,omitempty"`
+	Tried   uint64 `json:"tried,omitempty"`
+	RetryMS int64  `json:"retry_ms,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// job tells a worker what to search. Wordlists are sent inline so workers do
+// not need the coordinator's files.
+type job struct {
+	EncryptedKey string `json:"encrypted_key"`
+	Spec         Spec   `json:"spec"`
+	Fingerprint  string `json:"fingerprint"`
+	Total        uint64 `json:"total"`
+	HeartbeatMS  int64  `json:"heartbeat_ms"`
+}
+
+// Shard is a contiguous range [Start, End) of the candidate space.
+type Shard struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// conn frames messages on a stream connection.
+type conn struct {
+	raw net.Conn
+	dec *json.Decoder
+	enc *json.Encoder
+}
+
+func newConn(raw net.Conn) *conn {
+	return &conn{raw: raw, dec: json.NewDecoder(raw), enc: json.NewEncoder(raw)}
+}
+
+func (c *conn) send(m message) error {
+	return c.enc.Encode(m)
+}
+
+func (c *conn) receive() (message, error) {
+	var m message
+	if err := c.dec.Decode(&m); err != nil {
+		if err == io.EOF {
+			return m, io.EOF
+		}
+		return m, fmt.Errorf("failed to read message: %w", err)
+	}
+	return m, nil
+}
+
+// roundTrip sends m and waits for the reply, turning error replies into errors.
+func (c *conn) roundTrip(m message) (message, error) {
+	if err := c.send(m); err != nil {
+		return message{}, fmt.Errorf("failed to send %s: %w", m.Type, err)
+	}
+	reply, err := c.receive()
+	if err != nil {
+		return reply, err
+	}
+	if reply.Type == msgError {
+		return reply, fmt.Errorf("coordinator: %s", reply.Error)
+	}
+	return reply, nil
+}
+
+func tokenMatches(want, got string) bool {
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+func durationMS(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+// ParseAddress splits an address such as "unix:/run/recover.sock",
+// "tcp:127.0.0.1:7838" or plain "127.0.0.1:7838" into a network and address.
+func ParseAddress(addr string) (string, string, error) {
+	addr = strings.TrimSpace(addr)
+	switch {
+	case addr == "":
+		return "", "", fmt.Errorf("address is required")
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+		if path == "" {
+			return "", "", fmt.Errorf("unix socket path is required")
+		}
+		return "unix", path, nil
+	case strings.HasPrefix(addr, "tcp:"):
+		return "tcp", strings.TrimPrefix(strings.TrimPrefix(addr, "tcp:"), "//"), nil
+	default:
+		return "tcp", addr, nil
+	}
+}
+
+// Listen opens a coordinator listener. Unix sockets are created owner-only,
+// replacing a stale socket left by a previous run.
+func Listen(addr string) (net.Listener, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if info, statErr := os.Lstat(address); statErr == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+		return unixsock.Listen(address)
+	}
+	return net.Listen(network, address)
+}
+
+// Dial connects a worker to a coordinator address accepted by ParseAddress.
+func Dial(addr string) (net.Conn, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial(network, address)
+}
@@ -0,0 +1,744 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+func collect(space Space) []string {
+	out := make([]string, 0, space.Len())
+	for i := uint64(0); i < space.Len(); i++ {
+		out = append(out, space.At(i))
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		custom  []string
+		len     uint64
+		first   string
+		last    string
+	}{
+		{name: "literal", pattern: "abc", len: 1, first: "abc", last: "abc"},
+		{name: "digits", pattern: "pin?d?d", len: 100, first: "pin00", last: "pin99"},
+		{name: "escaped question mark", pattern: "why??", len: 1, first: "why?", last: "why?"},
+		{name: "all printable", pattern: "?a", len: 95, first: "a", last: "~"},
+		{name: "upper hex", pattern: "?H?u", len: 16 * 26, first: "0A", last: "FZ"},
+		{name: "custom", pattern: "?1?2", custom: []string{"xy", "?dz?d"}, len: 2 * 11, first: "x0", last: "yz"},
+		{name: "unicode", pattern: "café?1", custom: []string{"éè"}, len: 2, first: "caféé", last: "caféè"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask, err := ParseMask(tt.pattern, tt.custom)
+			if err != nil {
+				t.Fatalf("ParseMask: %v", err)
+			}
+			if mask.Len() != tt.len {
+				t.Fatalf("Len() = %d, want %d", mask.Len(), tt.len)
+			}
+			if got := mask.At(0); got != tt.first {
+				t.Fatalf("At(0) = %q, want %q", got, tt.first)
+			}
+			if got := mask.At(mask.Len() - 1); got != tt.last {
+				t.Fatalf("At(last) = %q, want %q", got, tt.last)
+			}
+		})
+	}
+}
+
+func TestParseMaskErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		custom  []string
+	}{
+		{pattern: ""},
+		{pattern: "abc?"},
+		{pattern: "?x"},
+		{pattern: "?1"},
+		{pattern: "?1", custom: []string{""}},
+		{pattern: "?1", custom: []string{"?q"}},
+		{pattern: "a", custom: []string{"a", "b", "c", "d", "e"}},
+		{pattern: "?a?a?a?a?a?a?a?a?a?a?a"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseMask(tt.pattern, tt.custom); err == nil {
+			t.Errorf("ParseMask(%q, %q) should fail", tt.pattern, tt.custom)
+		}
+	}
+}
+
+func TestFragments(t *testing.T) {
+	space, err := NewFragments([]string{"a", "b", "c"}, 2, 3, []string{"", "-"})
+	if err != nil {
+		t.Fatalf("NewFragments: %v", err)
+	}
+
+	// 3*2 pairs and 3*2*1 triples, each with two separators.
+	if space.Len() != 24 {
+		t.Fatalf("Len() = %d, want 24", space.Len())
+	}
+
+	got := collect(space)
+	want := []string{"ab", "ac", "ba", "bc", "ca", "cb", "a-b", "a-c", "b-a", "b-c", "c-a", "c-b"}
+	if !equalStrings(got[:12], want) {
+		t.Fatalf("pairs = %v, want %v", got[:12], want)
+	}
+	if got[12] != "abc" || got[17] != "cba" || got[23] != "c-b-a" {
+		t.Fatalf("unexpected triples: %v", got[12:])
+	}
+
+	seen := make(map[string]bool)
+	for _, candidate := range got {
+		if seen[candidate] {
+			t.Fatalf("duplicate candidate %q", candidate)
+		}
+		seen[candidate] = true
+	}
+
+	for _, bad := range [][2]int{{0, 4}, {3, 2}, {-1, 2}} {
+		if _, err := NewFragments([]string{"a", "b", "c"}, bad[0], bad[1], nil); err == nil {
+			t.Errorf("range %v should be rejected", bad)
+		}
+	}
+}
+
+func TestSpecBuild(t *testing.T) {
+	dir := t.TempDir()
+	wordlist := filepath.Join(dir, "words.txt")
+	if err := os.WriteFile(wordlist, []byte("alpha\r\n\n beta \ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	spec := Spec{
+		Words:     []string{"first"},
+		Wordlists: []string{wordlist},
+		Masks:     []string{"x?d"},
+		Fragments: []string{"p", "q"},
+	}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	got := collect(plan)
+	if len(got) != 1+3+10+4 {
+		t.Fatalf("got %d candidates: %v", len(got), got)
+	}
+	if !equalStrings(got[:5], []string{"first", "alpha", " beta ", "gamma", "x0"}) {
+		t.Fatalf("unexpected order: %v", got[:5])
+	}
+	if got[len(got)-1] != "qp" {
+		t.Fatalf("last candidate = %q, want qp", got[len(got)-1])
+	}
+
+	again, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if again.Fingerprint != plan.Fingerprint {
+		t.Fatal("fingerprint must be stable for identical input")
+	}
+
+	if err := os.WriteFile(wordlist, []byte("alpha\nbeta\ngamma\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	changed, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if changed.Fingerprint == plan.Fingerprint {
+		t.Fatal("fingerprint must change with wordlist contents")
+	}
+
+	if _, err := (Spec{}).Build(); err == nil {
+		t.Fatal("empty spec should be rejected")
+	}
+	if _, err := (Spec{Wordlists: []string{filepath.Join(dir, "missing.txt")}}).Build(); err == nil {
+		t.Fatal("missing wordlist should be rejected")
+	}
+}
+
+// stubTry accepts a single passphrase without running scrypt.
+func stubTry(secret string, calls *atomic.Uint64) TryFunc {
+	return func(passphrase []byte) (*btcutil.WIF, error) {
+		calls.Add(1)
+		if string(passphrase) == secret {
+			return &btcutil.WIF{}, nil
+		}
+		return nil, bip38.ErrIncorrectPassphrase
+	}
+}
+
+func TestRunFindsPassphrase(t *testing.T) {
+	mask, err := ParseMask("?d?d?d", nil)
+	if err != nil {
+		t.Fatalf("ParseMask: %v", err)
+	}
+
+	var calls atomic.Uint64
+	var reports int
+	result, err := Run(context.Background(), Config{
+		Space:     mask,
+		Workers:   4,
+		ChunkSize: 7,
+		Try:       stubTry("421", &calls),
+		Report:    func(Progress) { reports++ },
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !result.Found || result.Passphrase != "421" || result.Index != 421 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.Progress.Tried != calls.Load() {
+		t.Fatalf("Tried = %d, calls = %d", result.Progress.Tried, calls.Load())
+	}
+	if result.Progress.Next > 421 {
+		t.Fatalf("watermark %d passed the match before it was confirmed", result.Progress.Next)
+	}
+	if reports == 0 {
+		t.Fatal("expected a final progress report")
+	}
+}
+
+func TestRunExhaustsFromStart(t *testing.T) {
+	var calls atomic.Uint64
+	result, err := Run(context.Background(), Config{
+		Space:   Words{"a", "b", "c", "d", "e"},
+		Start:   2,
+		Workers: 2,
+		Try:     stubTry("a", &calls),
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Found {
+		t.Fatal("candidate before Start must not be tried")
+	}
+	if calls.Load() != 3 || result.Progress.Next != 5 || result.Progress.Total != 5 {
+		t.Fatalf("calls = %d, progress = %+v", calls.Load(), result.Progress)
+	}
+
+	if _, err := Run(context.Background(), Config{Space: Words{"a"}, Start: 2}); err == nil {
+		t.Fatal("start beyond the space should be rejected")
+	}
+}
+
+func TestRunStopsOnCancelAndUnexpectedErrors(t *testing.T) {
+	mask, err := ParseMask("?d?d?d?d", nil)
+	if err != nil {
+		t.Fatalf("ParseMask: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Uint64
+	result, err := Run(ctx, Config{
+		Space:   mask,
+		Workers: 2,
+		Try: func(passphrase []byte) (*btcutil.WIF, error) {
+			if calls.Add(1) == 50 {
+				cancel()
+			}
+			time.Sleep(time.Millisecond)
+			return nil, bip38.ErrIncorrectPassphrase
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if result.Progress.Next >= mask.Len() || result.Progress.Next > result.Progress.Tried {
+		t.Fatalf("unexpected progress after cancel: %+v", result.Progress)
+	}
+
+	boom := errors.New("boom")
+	_, err = Run(context.Background(), Config{
+		Space: Words{"a", "b"},
+		Try:   func([]byte) (*btcutil.WIF, error) { return nil, boom },
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected unexpected error to abort the run, got %v", err)
+	}
+}
+
+func TestRunDecryptsRealKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		encrypted string
+		secret    string
+		wif       string
+	}{
+		{
+			name:      "non-EC",
+			encrypted: "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+			secret:    "TestingOneTwoThree",
+			wif:       "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR",
+		},
+		{
+			name:      "EC-multiply",
+			encrypted: "6PfLGnQs6VZnrNpmVKfjotbnQuaJK4KZoPFrAjx1JMJUa1Ft8gnf5WxfKd",
+			secret:    "Satoshi",
+			wif:       "5KJ51SgxWaAYR13zd9ReMhJpwrcX47xTJh2D3fGPG9CM8vkv5sH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fragments, err := NewFragments([]string{"Testing", "One", "Two", "Three", "Satoshi"}, 1, 1, nil)
+			if err != nil {
+				t.Fatalf("NewFragments: %v", err)
+			}
+			space, err := NewUnion(Words{"wrong"}, fragments, Words{tt.secret})
+			if err != nil {
+				t.Fatalf("NewUnion: %v", err)
+			}
+
+			result, err := Run(context.Background(), Config{
+				EncryptedKey: tt.encrypted,
+				Space:        space,
+				Workers:      4,
+				ChunkSize:    1,
+			})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !result.Found || result.Passphrase != tt.secret || result.WIF.String() != tt.wif {
+				t.Fatalf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestCheckpointRoundtrip(t *testing.T) {
+	spec := Spec{Masks: []string{"?d?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	const key = "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg"
+	base := NewCheckpoint(key, spec, plan)
+	base.Tried = 10
+	base.Elapsed = 1.5
+
+	cp := *base
+	cp.Advance(base, Progress{Next: 40, Tried: 30, Elapsed: 2 * time.Second})
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := cp.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("checkpoint mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	if loaded.Next != 40 || loaded.Tried != 40 || loaded.Elapsed != 3.5 {
+		t.Fatalf("unexpected checkpoint: %+v", loaded)
+	}
+	if err := loaded.Matches(key, plan); err != nil {
+		t.Fatalf("Matches: %v", err)
+	}
+	if err := loaded.Matches("6Pother", plan); err == nil {
+		t.Fatal("checkpoint for another key must not match")
+	}
+
+	other, err := Spec{Masks: []string{"?d?d?d"}}.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := loaded.Matches(key, other); err == nil {
+		t.Fatal("checkpoint for other candidates must not match")
+	}
+
+	if _, err := LoadCheckpoint(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+// startCoordinator serves cfg on addr and returns a function waiting for the outcome.
+func startCoordinator(t *testing.T, addr string, cfg CoordinatorConfig) (string, func() (*Result, error)) {
+	t.Helper()
+	coordinator, err := NewCoordinator(cfg)
+	if err != nil {
+		t.Fatalf("NewCoordinator: %v", err)
+	}
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	type outcome struct {
+		result *Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := coordinator.Serve(context.Background(), ln)
+		done <- outcome{result, err}
+	}()
+
+	dialAddr := ln.Addr().Network() + ":" + ln.Addr().String()
+	return dialAddr, func() (*Result, error) {
+		select {
+		case o := <-done:
+			return o.result, o.err
+		case <-time.After(30 * time.Second):
+			t.Fatal("coordinator did not finish")
+			return nil, nil
+		}
+	}
+}
+
+func dialWorker(t *testing.T, addr string) *conn {
+	t.Helper()
+	raw, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = raw.Close() })
+	wc := newConn(raw)
+	if reply, err := wc.roundTrip(message{Type: msgHello, Version: protocolVersion}); err != nil || reply.Type != msgJob {
+		t.Fatalf("hello failed: %v %+v", err, reply)
+	}
+	return wc
+}
+
+func TestCoordinatorWorkersFindPassphrase(t *testing.T) {
+	spec := Spec{Masks: []string{"?d?d?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var calls atomic.Uint64
+	addr, wait := startCoordinator(t, "unix:"+filepath.Join(t.TempDir(), "recover.sock"), CoordinatorConfig{
+		Spec:         spec,
+		Plan:         plan,
+		Start:        100,
+		ShardSize:    50,
+		LeaseTimeout: 300 * time.Millisecond,
+		Try:          stubTry("777", &calls),
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			raw, err := Dial(addr)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer func() { _ = raw.Close() }()
+			_, errs[i] = RunWorker(context.Background(), raw, WorkerConfig{
+				Workers: 2,
+				Try:     stubTry("777", &calls),
+				OnShard: func(shard Shard, _ uint64, _ bool) {
+					if shard.Start < 100 {
+						t.Errorf("shard %+v starts before the checkpoint", shard)
+					}
+				},
+			})
+		}(i)
+	}
+
+	result, err := wait()
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("worker %d: %v", i, err)
+		}
+	}
+	if !result.Found || result.Passphrase != "777" || result.Index != 777 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestCoordinatorReassignsLostShards(t *testing.T) {
+	spec := Spec{Masks: []string{"?d?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var calls atomic.Uint64
+	addr, wait := startCoordinator(t, "tcp:127.0.0.1:0", CoordinatorConfig{
+		Spec:         spec,
+		Plan:         plan,
+		ShardSize:    10,
+		LeaseTimeout: 300 * time.Millisecond,
+		Try:          stubTry("none", &calls),
+	})
+
+	// One worker crashes holding shard 0, another stalls holding shard 1.
+	crashed := dialWorker(t, addr)
+	if reply, err := crashed.roundTrip(message{Type: msgRequest}); err != nil || reply.Shard.Start != 0 {
+		t.Fatalf("expected shard 0, got %+v (%v)", reply, err)
+	}
+	_ = crashed.raw.Close()
+
+	stalled := dialWorker(t, addr)
+	reply, err := stalled.roundTrip(message{Type: msgRequest})
+	if err != nil || reply.Shard == nil {
+		t.Fatalf("expected a shard, got %+v (%v)", reply, err)
+	}
+	stalledShard := *reply.Shard
+
+	var mu sync.Mutex
+	seen := make(map[Shard]bool)
+	raw, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	stats, err := RunWorker(context.Background(), raw, WorkerConfig{
+		Workers: 2,
+		Try:     stubTry("none", &calls),
+		OnShard: func(shard Shard, _ uint64, _ bool) {
+			mu.Lock()
+			seen[shard] = true
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorker: %v", err)
+	}
+
+	result, err := wait()
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if result.Found || result.Progress.Next != 100 {
+		t.Fatalf("expected exhausted search, got %+v", result)
+	}
+	if stats.Shards != 10 || stats.Tried != 100 {
+		t.Fatalf("expected the worker to cover all 10 shards, got %+v", stats)
+	}
+	if !seen[Shard{Start: 0, End: 10}] || !seen[stalledShard] {
+		t.Fatalf("lost shards were not reassigned: %v", seen)
+	}
+}
+
+func TestCoordinatorRejectsUnleasedResults(t *testing.T) {
+	spec := Spec{Masks: []string{"?d?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var calls atomic.Uint64
+	addr, wait := startCoordinator(t, "tcp:127.0.0.1:0", CoordinatorConfig{
+		Spec:         spec,
+		Plan:         plan,
+		ShardSize:    10,
+		LeaseTimeout: 300 * time.Millisecond,
+		Try:          stubTry("none", &calls),
+	})
+
+	// A worker reports the whole space without having been given any of it,
+	// and then a shard leased to somebody else.
+	rogue := dialWorker(t, addr)
+	if _, err := rogue.roundTrip(message{Type: msgResult, Shard: &Shard{Start: 0, End: 100}, Tried: 100}); err == nil || !strings.Contains(err.Error(), "not leased") {
+		t.Fatalf("expected a report of an unleased shard to be rejected, got %v", err)
+	}
+	holder := dialWorker(t, addr)
+	reply, err := holder.roundTrip(message{Type: msgRequest})
+	if err != nil || reply.Shard == nil {
+		t.Fatalf("expected a shard, got %+v (%v)", reply, err)
+	}
+	if _, err := rogue.roundTrip(message{Type: msgResult, Shard: reply.Shard, Tried: 10}); err == nil {
+		t.Fatal("expected a report of another worker's shard to be rejected")
+	}
+	if _, err := holder.roundTrip(message{Type: msgResult, Shard: reply.Shard, Tried: 10}); err != nil {
+		t.Fatalf("holder's report rejected: %v", err)
+	}
+
+	raw, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	stats, err := RunWorker(context.Background(), raw, WorkerConfig{Workers: 2, Try: stubTry("none", &calls)})
+	if err != nil {
+		t.Fatalf("RunWorker: %v", err)
+	}
+	_ = rogue.raw.Close()
+	_ = holder.raw.Close()
+
+	result, err := wait()
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if result.Found || result.Progress.Next != 100 || stats.Tried != 90 {
+		t.Fatalf("expected the search to run to the end, got %+v after %+v", result, stats)
+	}
+	if result.Progress.Tried != 100 {
+		t.Fatalf("tried = %d, want 100: rejected reports must not count", result.Progress.Tried)
+	}
+}
+
+func TestCoordinatorRequeuesFailedShards(t *testing.T) {
+	spec := Spec{Masks: []string{"?d?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	var calls atomic.Uint64
+	addr, wait := startCoordinator(t, "tcp:127.0.0.1:0", CoordinatorConfig{
+		Spec:         spec,
+		Plan:         plan,
+		ShardSize:    10,
+		LeaseTimeout: 300 * time.Millisecond,
+		Try:          stubTry("none", &calls),
+	})
+
+	// A failure reported for somebody else's shard is rejected; the holder's
+	// own failure stops that worker but not the search.
+	failing := dialWorker(t, addr)
+	reply, err := failing.roundTrip(message{Type: msgRequest})
+	if err != nil || reply.Shard == nil {
+		t.Fatalf("expected a shard, got %+v (%v)", reply, err)
+	}
+	failedShard := *reply.Shard
+	rogue := dialWorker(t, addr)
+	if _, err := rogue.roundTrip(message{Type: msgResult, Shard: &failedShard, Error: "boom"}); err == nil || !strings.Contains(err.Error(), "not leased") {
+		t.Fatalf("expected a failure for another worker's shard to be rejected, got %v", err)
+	}
+	if reply, err := failing.roundTrip(message{Type: msgResult, Shard: &failedShard, Tried: 3, Error: "boom"}); err != nil || reply.Type != msgDone {
+		t.Fatalf("expected the failing worker to be stopped, got %+v (%v)", reply, err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[Shard]bool)
+	raw, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	stats, err := RunWorker(context.Background(), raw, WorkerConfig{
+		Workers: 2,
+		Try:     stubTry("none", &calls),
+		OnShard: func(shard Shard, _ uint64, _ bool) {
+			mu.Lock()
+			seen[shard] = true
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorker: %v", err)
+	}
+	_ = failing.raw.Close()
+	_ = rogue.raw.Close()
+
+	result, err := wait()
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if result.Found || result.Progress.Next != 100 || stats.Tried != 100 {
+		t.Fatalf("expected the search to run to the end, got %+v after %+v", result, stats)
+	}
+	if !seen[failedShard] || result.Progress.Tried != 100 {
+		t.Fatalf("failed shard was not searched again (tried %d): %v", result.Progress.Tried, seen)
+	}
+}
+
+func TestCoordinatorRejectsBadWorkers(t *testing.T) {
+	spec := Spec{Masks: []string{"?d"}}
+	plan, err := spec.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	coordinator, err := NewCoordinator(CoordinatorConfig{Spec: spec, Plan: plan, Token: "secret"})
+	if err != nil {
+		t.Fatalf("NewCoordinator: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		_, err := coordinator.Serve(ctx, ln)
+		served <- err
+	}()
+
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = raw.Close() }()
+	if _, err := RunWorker(context.Background(), raw, WorkerConfig{Token: "wrong"}); err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Fatalf("expected token rejection, got %v", err)
+	}
+
+	cancel()
+	if err := <-served; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled coordinator, got %v", err)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		address string
+	}{
+		{addr: "127.0.0.1:7838", network: "tcp", address: "127.0.0.1:7838"},
+		{addr: "tcp://[::1]:7838", network: "tcp", address: "[::1]:7838"},
+		{addr: "unix:/run/recover.sock", network: "unix", address: "/run/recover.sock"},
+		{addr: "unix:///run/recover.sock", network: "unix", address: "/run/recover.sock"},
+	}
+	for _, tt := range tests {
+		network, address, err := ParseAddress(tt.addr)
+		if err != nil || network != tt.network || address != tt.address {
+			t.Errorf("ParseAddress(%q) = %q, %q, %v", tt.addr, network, address, err)
+		}
+	}
+	if _, _, err := ParseAddress("unix:"); err == nil {
+		t.Error("empty unix path should be rejected")
+	}
+}
@@ -0,0 +1,238 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+const (
+	defaultChunkSize      = 8
+	defaultReportInterval = 10 * time.Second
+)
+
+// TryFunc attempts one passphrase. It must return an error wrapping
+// bip38.ErrIncorrectPassphrase for a wrong guess; any other error aborts the run.
+type TryFunc func(passphrase []byte) (*btcutil.WIF, error)
+
+// Config controls a recovery run.
+type Config struct {
+	EncryptedKey string
+	Space        Space
+	// Start is the first index to try, normally Checkpoint.Next.
+	Start uint64
+	// Workers defaults to the number of CPUs.
+	Workers int
+	// ChunkSize is the number of candidates handed to a worker at once.
+	ChunkSize uint64
+	// Try defaults to bip38.DecryptKey on EncryptedKey, which handles both
+	// non-EC and EC-multiply keys.
+	Try TryFunc
+	// Report, when set, is called every ReportInterval and once at the end.
+	Report         func(Progress)
+	ReportInterval time.Duration
+}
+
+// Progress is a snapshot of a running search.
+type Progress struct {
+	Total uint64
+	// Next is the checkpoint watermark: every index below it has been tried.
+	Next uint64
+	// Tried counts attempts made by this run.
+	Tried   uint64
+	Elapsed time.Duration
+	// Rate is the measured number of attempts per second in this run.
+	Rate float64
+	// ETA estimates the time to exhaust the space at Rate; zero when unknown.
+	ETA time.Duration
+}
+
+// Result describes how a run ended.
+type Result struct {
+	Found      bool
+	Passphrase string
+	Index      uint64
+	WIF        *btcutil.WIF
+	Progress   Progress
+}
+
+type chunk struct{ start, end uint64 }
+
+// watermark tracks completed chunks and the lowest index not yet covered.
+type watermark struct {
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]uint64
+}
+
+func (w *watermark) complete(c chunk) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[c.start] = c.end
+	for {
+		end, ok := w.pending[w.next]
+		if !ok {
+			return
+		}
+		delete(w.pending, w.next)
+		w.next = end
+	}
+}
+
+func (w *watermark) value() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.next
+}
+
+// Run searches cfg.Space from cfg.Start until the passphrase is found, the
+// space is exhausted, ctx is cancelled or Try fails unexpectedly. The returned
+// Result always carries the final progress so callers can checkpoint it.
+func Run(ctx context.Context, cfg Config) (*Result, error) { //nolint:gocyclo
+	if cfg.Space == nil {
+		return nil, errors.New("candidate space is required")
+	}
+	total := cfg.Space.Len()
+	if cfg.Start > total {
+		return nil, fmt.Errorf("start index %d is beyond the %d candidates", cfg.Start, total)
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	chunkSize := cfg.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	interval := cfg.ReportInterval
+	if interval <= 0 {
+		interval = defaultReportInterval
+	}
+	try := cfg.Try
+	if try == nil {
+		key := cfg.EncryptedKey
+		try = func(passphrase []byte) (*btcutil.WIF, error) {
+			return bip38.DecryptKey(key, passphrase)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan chunk)
+	go func() {
+		defer close(chunks)
+		for start := cfg.Start; start < total; {
+			end := start + chunkSize
+			if end > total || end < start {
+				end = total
+			}
+			select {
+			case chunks <- chunk{start, end}:
+			case <-ctx.Done():
+				return
+			}
+			start = end
+		}
+	}()
+
+	mark := &watermark{next: cfg.Start, pending: make(map[uint64]uint64)}
+	var (
+		tried    atomic.Uint64
+		once     sync.Once
+		result   = &Result{}
+		runErr   error
+		wg       sync.WaitGroup
+		finished = make(chan struct{})
+	)
+	stop := func(found *Result, err error) {
+		once.Do(func() {
+			if found != nil {
+				result = found
+			}
+			runErr = err
+			cancel()
+		})
+	}
+
+	started := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				for i := c.start; i < c.end; i++ {
+					if ctx.Err() != nil {
+						return
+					}
+					candidate := cfg.Space.At(i)
+					wif, err := try([]byte(candidate))
+					tried.Add(1)
+					if err == nil {
+						stop(&Result{Found: true, Passphrase: candidate, Index: i, WIF: wif}, nil)
+						return
+					}
+					if !errors.Is(err, bip38.ErrIncorrectPassphrase) {
+						stop(nil, fmt.Errorf("candidate %d: %w", i, err))
+						return
+					}
+				}
+				mark.complete(c)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	snapshot := func() Progress {
+		p := Progress{
+			Total:   total,
+			Next:    mark.value(),
+			Tried:   tried.Load(),
+			Elapsed: time.Since(started),
+		}
+		if seconds := p.Elapsed.Seconds(); seconds > 0 && p.Tried > 0 {
+			p.Rate = float64(p.Tried) / seconds
+			remaining := total - cfg.Start - min(p.Tried, total-cfg.Start)
+			p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+		}
+		return p
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			if cfg.Report != nil {
+				cfg.Report(snapshot())
+			}
+		case <-finished:
+			running = false
+		}
+	}
+
+	result.Progress = snapshot()
+	if cfg.Report != nil {
+		cfg.Report(result.Progress)
+	}
+	if runErr != nil {
+		return result, runErr
+	}
+	if !result.Found && result.Progress.Next < total {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
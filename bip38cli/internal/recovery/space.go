@@ -0,0 +1,194 @@
+// Package recovery searches candidate passphrases for a BIP38 encrypted key.
+//
+// Candidates come from wordlists, hashcat-style masks and arrangements of
+// remembered fragments. Every source is an indexable Space, so a search can be
+// split into ranges, run in parallel and resumed from a checkpoint index.
+package recovery
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Space is an ordered, indexable set of candidate passphrases.
+type Space interface {
+	// Len returns the number of candidates.
+	Len() uint64
+	// At returns candidate i, for 0 <= i < Len().
+	At(i uint64) string
+}
+
+// Words is a Space backed by an explicit list of candidates.
+type Words []string
+
+// Len implements Space.
+func (w Words) Len() uint64 { return uint64(len(w)) }
+
+// At implements Space.
+func (w Words) At(i uint64) string { return w[i] }
+
+// Union concatenates spaces in order.
+type Union struct {
+	parts []Space
+	total uint64
+}
+
+// NewUnion joins spaces, skipping empty ones.
+func NewUnion(parts ...Space) (*Union, error) {
+	u := &Union{}
+	for _, part := range parts {
+		n := part.Len()
+		if n == 0 {
+			continue
+		}
+		if u.total > math.MaxUint64-n {
+			return nil, errors.New("candidate space is too large")
+		}
+		u.parts = append(u.parts, part)
+		u.total += n
+	}
+	return u, nil
+}
+
+// Len implements Space.
+func (u *Union) Len() uint64 { return u.total }
+
+// At implements Space.
+func (u *Union) At(i uint64) string {
+	for _, part := range u.parts {
+		n := part.Len()
+		if i < n {
+			return part.At(i)
+		}
+		i -= n
+	}
+	panic(fmt.Sprintf("recovery: index %d out of range", i))
+}
+
+// Range is the sub-space [Start, End) of another Space.
+type Range struct {
+	Space      Space
+	Start, End uint64
+}
+
+// Len implements Space.
+func (r Range) Len() uint64 { return r.End - r.Start }
+
+// At implements Space.
+func (r Range) At(i uint64) string { return r.Space.At(r.Start + i) }
+
+// Spec describes where candidates come from. Sources are searched in field
+// order: inline words, wordlists, masks, then fragment arrangements.
+type Spec struct {
+	Words          []string `json:"words,omitempty"`
+	Wordlists      []string `json:"wordlists,omitempty"`
+	Masks          []string `json:"masks,omitempty"`
+	CustomCharsets []string `json:"custom_charsets,omitempty"`
+	Fragments      []string `json:"fragments,omitempty"`
+	MinFragments   int      `json:"min_fragments,omitempty"`
+	MaxFragments   int      `json:"max_fragments,omitempty"`
+	Separators     []string `json:"separators,omitempty"`
+}
+
+// Plan is a built Spec: the candidate space and a fingerprint that changes
+// whenever the candidates or their order do, including wordlist contents.
+type Plan struct {
+	Space
+	Fingerprint string
+}
+
+// Build loads wordlists and compiles masks and fragments into a Plan.
+func (s Spec) Build() (*Plan, error) {
+	digest := sha256.New()
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+	_, _ = digest.Write(encoded)
+
+	var parts []Space
+	if len(s.Words) > 0 {
+		parts = append(parts, Words(s.Words))
+	}
+	for _, path := range s.Wordlists {
+		words, err := readWordlist(path, digest)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, words)
+	}
+	for _, pattern := range s.Masks {
+		mask, err := ParseMask(pattern, s.CustomCharsets)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, mask)
+	}
+	if len(s.Fragments) > 0 {
+		fragments, err := NewFragments(s.Fragments, s.MinFragments, s.MaxFragments, s.Separators)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, fragments)
+	}
+
+	space, err := NewUnion(parts...)
+	if err != nil {
+		return nil, err
+	}
+	if space.Len() == 0 {
+		return nil, errors.New("no candidates: add words, a wordlist, a mask or fragments")
+	}
+	return &Plan{Space: space, Fingerprint: hex.EncodeToString(digest.Sum(nil))}, nil
+}
+
+// Inline returns a copy of the spec with wordlist contents moved into Words,
+// so it can be rebuilt on a machine without the files. The candidate order
+// is unchanged.
+func (s Spec) Inline() (Spec, error) {
+	inline := s
+	inline.Words = append([]string{}, s.Words...)
+	inline.Wordlists = nil
+	for _, path := range s.Wordlists {
+		words, err := readWordlist(path, io.Discard)
+		if err != nil {
+			return Spec{}, err
+		}
+		inline.Words = append(inline.Words, words...)
+	}
+	return inline, nil
+}
+
+// readWordlist reads one candidate per line. Lines are kept verbatim apart
+// from the line ending, since leading or trailing spaces may be part of a
+// passphrase; empty lines are skipped.
+func readWordlist(path string, digest io.Writer) (Words, error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wordlist: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var words Words
+	scanner := bufio.NewScanner(io.TeeReader(file, digest))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read wordlist %s: %w", path, err)
+	}
+	return words, nil
+}
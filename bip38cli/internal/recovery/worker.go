@@ -0,0 +1,168 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+// WorkerConfig controls a worker process.
+type WorkerConfig struct {
+	// Name identifies the worker in coordinator logs.
+	Name  string
+	Token string
+	// Workers is the local parallelism and defaults to the number of CPUs.
+	Workers int
+	// Try defaults to bip38.DecryptKey on the coordinator's key.
+	Try TryFunc
+	// OnShard, when set, is called after each shard with its outcome.
+	OnShard func(shard Shard, tried uint64, found bool)
+}
+
+// WorkerStats summarises what a worker searched.
+type WorkerStats struct {
+	Shards uint64
+	Tried  uint64
+}
+
+// RunWorker pulls shards from the coordinator on c until it reports that the
+// search is over or ctx is cancelled. Matches are reported by index only.
+func RunWorker(ctx context.Context, c net.Conn, cfg WorkerConfig) (WorkerStats, error) { //nolint:gocyclo
+	var stats WorkerStats
+	wc := newConn(c)
+
+	// Unblock pending reads and writes when the caller gives up.
+	stopWatch := context.AfterFunc(ctx, func() { _ = c.Close() })
+	defer stopWatch()
+
+	reply, err := wc.roundTrip(message{Type: msgHello, Version: protocolVersion, Worker: cfg.Name, Token: cfg.Token})
+	if err != nil {
+		return stats, workerErr(ctx, err)
+	}
+	if reply.Type != msgJob || reply.Job == nil {
+		return stats, fmt.Errorf("expected job, got %q", reply.Type)
+	}
+	work := *reply.Job
+
+	plan, err := work.Spec.Build()
+	if err != nil {
+		return stats, fmt.Errorf("failed to build candidates: %w", err)
+	}
+	if plan.Fingerprint != work.Fingerprint || plan.Len() != work.Total {
+		return stats, errors.New("candidate space differs from the coordinator's")
+	}
+
+	try := cfg.Try
+	if try == nil {
+		key := work.EncryptedKey
+		try = func(passphrase []byte) (*btcutil.WIF, error) {
+			return bip38.DecryptKey(key, passphrase)
+		}
+	}
+	heartbeat := time.Duration(work.HeartbeatMS) * time.Millisecond
+
+	for {
+		reply, err := wc.roundTrip(message{Type: msgRequest})
+		if err != nil {
+			return stats, workerErr(ctx, err)
+		}
+
+		switch reply.Type {
+		case msgDone:
+			return stats, nil
+		case msgWait:
+			select {
+			case <-time.After(time.Duration(reply.RetryMS) * time.Millisecond):
+				continue
+			case <-ctx.Done():
+				return stats, ctx.Err()
+			}
+		case msgShard:
+			if reply.Shard == nil || reply.Shard.Start >= reply.Shard.End || reply.Shard.End > work.Total {
+				return stats, errors.New("coordinator sent an invalid shard")
+			}
+		default:
+			return stats, fmt.Errorf("unexpected reply %q", reply.Type)
+		}
+
+		shard := *reply.Shard
+		shardCtx, cancel := context.WithCancel(ctx)
+		var (
+			ioErr   error
+			stopped bool
+		)
+		result, runErr := Run(shardCtx, Config{
+			Space:   Range{Space: plan, Start: shard.Start, End: shard.End},
+			Workers: cfg.Workers,
+			Try:     try,
+			Report: func(Progress) {
+				if ioErr != nil || stopped {
+					return
+				}
+				ack, err := wc.roundTrip(message{Type: msgHeartbeat, Shard: &shard})
+				switch {
+				case err != nil:
+					ioErr = err
+					cancel()
+				case ack.Type == msgDone:
+					stopped = true
+					cancel()
+				}
+			},
+			ReportInterval: heartbeat,
+		})
+		cancel()
+
+		if ioErr != nil {
+			return stats, workerErr(ctx, ioErr)
+		}
+		if stopped {
+			return stats, nil
+		}
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+
+		report := message{Type: msgResult, Shard: &shard}
+		if result != nil {
+			report.Tried = result.Progress.Tried
+			stats.Tried += result.Progress.Tried
+			if result.Found {
+				report.Found = true
+				report.Index = shard.Start + result.Index
+			}
+		}
+		if runErr != nil {
+			report.Error = runErr.Error()
+		}
+		stats.Shards++
+		if cfg.OnShard != nil {
+			cfg.OnShard(shard, report.Tried, report.Found)
+		}
+
+		ack, err := wc.roundTrip(report)
+		if err != nil {
+			return stats, workerErr(ctx, err)
+		}
+		if runErr != nil {
+			return stats, runErr
+		}
+		if ack.Type == msgDone {
+			return stats, nil
+		}
+	}
+}
+
+// workerErr prefers the cancellation cause over the I/O error it provoked.
+func workerErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+// Package rpc speaks line-delimited JSON-RPC 2.0 over a pair of streams,
+// typically stdin and stdout of a child process. Each line holds one request
+// or one batch; each answer is written as a single line. Requests are served
+// in order, one at a time. The methods themselves are registered by the
+// caller.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+)
+
+// Standard JSON-RPC 2.0 error codes, plus CodeApplicationError for failures
+// reported by a method as an errors.AppError.
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeApplicationError = -32000
+)
+
+// MaxLineBytes caps a single request line.
+const MaxLineBytes = 1 << 20
+
+const version = "2.0"
+
+// Method serves one call. decode fills v from the request params, rejecting
+// unknown fields; absent params decode as an empty object.
+type Method func(decode func(v any) error) (any, error)
+
+// Server dispatches requests to registered methods.
+type Server struct {
+	methods map[string]Method
+}
+
+// New returns a Server with no methods.
+func New() *Server {
+	return &Server{methods: make(map[string]Method)}
+}
+
+// Register adds a method under name, replacing any previous one.
+func (s *Server) Register(name string, m Method) {
+	s.methods[name] = m
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is the error member of a response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Serve reads requests from r and writes responses to w until r reaches EOF
+// or ctx is cancelled. Notifications (requests without an id) are executed
+// but not answered. It returns nil at EOF.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxLineBytes)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		reply := s.handleLine(line)
+		if reply == nil {
+			continue
+		}
+		if err := encoder.Encode(reply); err != nil {
+			return fmt.Errorf("write response: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if stderrors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("request line exceeds %d bytes", MaxLineBytes)
+		}
+		return fmt.Errorf("read request: %w", err)
+	}
+	return nil
+}
+
+// handleLine answers one line, which holds either a request or a batch. It
+// returns nil when nothing should be written back.
+func (s *Server) handleLine(line []byte) any {
+	if line[0] != '[' {
+		var raw json.RawMessage
+		if err := json.Unmarshal(line, &raw); err != nil {
+			return errorResponse(nil, &Error{Code: CodeParseError, Message: "parse error"})
+		}
+		if resp := s.handle(raw); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return errorResponse(nil, &Error{Code: CodeParseError, Message: "parse error"})
+	}
+	if len(batch) == 0 {
+		return errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: "empty batch"})
+	}
+	replies := make([]*response, 0, len(batch))
+	for _, raw := range batch {
+		if resp := s.handle(raw); resp != nil {
+			replies = append(replies, resp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	return replies
+}
+
+// handle runs a single request and returns its response, or nil for a
+// notification.
+func (s *Server) handle(raw json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != version || req.Method == "" {
+		return errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: "invalid request"})
+	}
+	notification := req.ID == nil
+
+	method, ok := s.methods[req.Method]
+	if !ok {
+		if notification {
+			return nil
+		}
+		return errorResponse(req.ID, &Error{
+			Code:    CodeMethodNotFound,
+			Message: "method not found",
+			Data:    map[string]any{"method": req.Method},
+		})
+	}
+
+	started := time.Now()
+	result, rpcErr := call(method, req.Params)
+	entry := logger.WithField("method", req.Method).WithField("duration", time.Since(started))
+	if rpcErr != nil {
+		entry.WithField("code", rpcErr.Code).Debug("Call failed")
+	} else {
+		entry.Debug("Call served")
+	}
+
+	if notification {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+	return &response{JSONRPC: version, Result: result, ID: req.ID}
+}
+
+// call runs method with params, converting failures and panics to an Error.
+func call(method Method, params json.RawMessage) (result any, rpcErr *Error) {
+	defer func() {
+		if p := recover(); p != nil {
+			result, rpcErr = nil, &Error{Code: CodeInternalError, Message: fmt.Sprintf("internal error: %v", p)}
+		}
+	}()
+
+	var decodeErr error
+	decode := func(v any) error {
+		decodeErr = decodeParams(params, v)
+		return decodeErr
+	}
+	result, err := method(decode)
+	switch {
+	case err == nil:
+		return result, nil
+	case decodeErr != nil:
+		return nil, errorFor(err, CodeInvalidParams)
+	default:
+		return nil, errorFor(err, CodeApplicationError)
+	}
+}
+
+// decodeParams decodes named params into v. Positional (array) params are
+// not supported.
+func decodeParams(params json.RawMessage, v any) error {
+	trimmed := bytes.TrimSpace(params)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		trimmed = []byte("{}")
+	}
+	if trimmed[0] != '{' {
+		return errors.NewValidationError("params must be a JSON object", nil)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errors.NewValidationError("invalid params", err)
+	}
+	return nil
+}
+
+// errorFor converts err to a response error. An errors.AppError keeps its
+// message and carries its type, context and cause in data under the given
+// code; any other error is reported as an internal error.
+func errorFor(err error, code int) *Error {
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) {
+		return &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	data := map[string]any{"type": string(appErr.Type)}
+	if appErr.Cause != nil {
+		data["cause"] = appErr.Cause.Error()
+	}
+	if len(appErr.Context) > 0 {
+		data["context"] = appErr.Context
+	}
+	return &Error{Code: code, Message: appErr.Message, Data: data}
+}
+
+func errorResponse(id json.RawMessage, rpcErr *Error) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: version, Error: rpcErr, ID: id}
+}
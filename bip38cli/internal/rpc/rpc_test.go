@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+)
+
+func newEchoServer() *Server {
+	srv := New()
+	srv.Register("echo", func(decode func(v any) error) (any, error) {
+		var params struct {
+			Value string `json:"value"`
+		}
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		if params.Value == "" {
+			return nil, errors.NewCryptoError("empty value", nil).WithContext("field", "value")
+		}
+		return map[string]string{"value": params.Value}, nil
+	})
+	srv.Register("panic", func(func(v any) error) (any, error) {
+		panic("boom")
+	})
+	return srv
+}
+
+func serveLines(t *testing.T, srv *Server, lines ...string) []json.RawMessage {
+	t.Helper()
+	var out bytes.Buffer
+	if err := srv.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var replies []json.RawMessage
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line != "" {
+			replies = append(replies, json.RawMessage(line))
+		}
+	}
+	return replies
+}
+
+type reply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int            `json:"code"`
+		Message string         `json:"message"`
+		Data    map[string]any `json:"data"`
+	} `json:"error"`
+	ID json.RawMessage `json:"id"`
+}
+
+func decodeReply(t *testing.T, raw json.RawMessage) reply {
+	t.Helper()
+	var r reply
+	if err := json.Unmarshal(raw, &r); err != nil {
+		t.Fatalf("invalid reply %s: %v", raw, err)
+	}
+	if r.JSONRPC != "2.0" {
+		t.Fatalf("reply %s lacks jsonrpc 2.0", raw)
+	}
+	return r
+}
+
+func TestServeRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		result    string
+		code      int
+		errorType string
+		id        string
+	}{
+		{name: "ok", line: `{"jsonrpc":"2.0","method":"echo","params":{"value":"hi"},"id":1}`, result: `{"value":"hi"}`, id: "1"},
+		{name: "string id", line: `{"jsonrpc":"2.0","method":"echo","params":{"value":"hi"},"id":"a"}`, result: `{"value":"hi"}`, id: `"a"`},
+		{name: "app error", line: `{"jsonrpc":"2.0","method":"echo","params":{},"id":2}`, code: CodeApplicationError, errorType: "crypto", id: "2"},
+		{name: "unknown param", line: `{"jsonrpc":"2.0","method":"echo","params":{"value":"hi","x":1},"id":3}`, code: CodeInvalidParams, errorType: "validation", id: "3"},
+		{name: "positional params", line: `{"jsonrpc":"2.0","method":"echo","params":["hi"],"id":4}`, code: CodeInvalidParams, errorType: "validation", id: "4"},
+		{name: "unknown method", line: `{"jsonrpc":"2.0","method":"nope","id":5}`, code: CodeMethodNotFound, id: "5"},
+		{name: "wrong version", line: `{"jsonrpc":"1.0","method":"echo","id":6}`, code: CodeInvalidRequest, id: "null"},
+		{name: "parse error", line: `{"jsonrpc":`, code: CodeParseError, id: "null"},
+		{name: "panic", line: `{"jsonrpc":"2.0","method":"panic","id":7}`, code: CodeInternalError, id: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := serveLines(t, newEchoServer(), tt.line)
+			if len(replies) != 1 {
+				t.Fatalf("got %d replies, want 1", len(replies))
+			}
+			r := decodeReply(t, replies[0])
+			if string(r.ID) != tt.id {
+				t.Fatalf("id = %s, want %s", r.ID, tt.id)
+			}
+			if tt.code == 0 {
+				if r.Error != nil || string(r.Result) != tt.result {
+					t.Fatalf("reply %s, want result %s", replies[0], tt.result)
+				}
+				return
+			}
+			if r.Error == nil || r.Error.Code != tt.code {
+				t.Fatalf("reply %s, want error code %d", replies[0], tt.code)
+			}
+			if tt.errorType != "" && r.Error.Data["type"] != tt.errorType {
+				t.Fatalf("error type = %v, want %s", r.Error.Data["type"], tt.errorType)
+			}
+		})
+	}
+}
+
+func TestServeCarriesErrorContext(t *testing.T) {
+	replies := serveLines(t, newEchoServer(), `{"jsonrpc":"2.0","method":"echo","params":{"value":""},"id":1}`)
+	r := decodeReply(t, replies[0])
+	context, _ := r.Error.Data["context"].(map[string]any)
+	if r.Error.Message != "empty value" || context["field"] != "value" {
+		t.Fatalf("error %+v lacks message or context", r.Error)
+	}
+}
+
+func TestServeNotificationsAndBatches(t *testing.T) {
+	replies := serveLines(t, newEchoServer(),
+		`{"jsonrpc":"2.0","method":"echo","params":{"value":"quiet"}}`,
+		"",
+		`[{"jsonrpc":"2.0","method":"echo","params":{"value":"a"},"id":1},{"jsonrpc":"2.0","method":"echo","params":{"value":"n"}},{"jsonrpc":"2.0","method":"nope","id":2}]`,
+		`[{"jsonrpc":"2.0","method":"echo","params":{"value":"n"}}]`,
+		`[]`,
+	)
+	if len(replies) != 2 {
+		t.Fatalf("got %d replies, want batch and empty-batch error: %s", len(replies), replies)
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(replies[0], &batch); err != nil || len(batch) != 2 {
+		t.Fatalf("batch reply %s, want two entries", replies[0])
+	}
+	if r := decodeReply(t, batch[0]); string(r.Result) != `{"value":"a"}` {
+		t.Fatalf("first batch reply %s", batch[0])
+	}
+	if r := decodeReply(t, batch[1]); r.Error == nil || r.Error.Code != CodeMethodNotFound {
+		t.Fatalf("second batch reply %s", batch[1])
+	}
+	if r := decodeReply(t, replies[1]); r.Error == nil || r.Error.Code != CodeInvalidRequest {
+		t.Fatalf("empty batch reply %s", replies[1])
+	}
+}
+
+func TestServeRejectsOversizedLines(t *testing.T) {
+	line := `{"jsonrpc":"2.0","method":"echo","params":{"value":"` + strings.Repeat("x", MaxLineBytes) + `"},"id":1}`
+	var out bytes.Buffer
+	if err := newEchoServer().Serve(context.Background(), strings.NewReader(line), &out); err == nil {
+		t.Fatal("expected an error for an oversized line")
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/unixsock"
+)
+
+// errPeerCredUnsupported is returned by peerUID where the platform cannot
+// report the user on the other end of a Unix socket.
+var errPeerCredUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// Listen opens addr, which is unix:/path/to/socket or tcp:host:port. Unix
+// sockets are created with owner-only permissions and only accept peers whose
+// user id is in allowedUIDs (the current user when empty). TCP is limited to
+// loopback addresses.
+func Listen(addr string, allowedUIDs []int) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return listenUnix(strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//"), allowedUIDs)
+	case strings.HasPrefix(addr, "tcp:"):
+		return listenLoopback(strings.TrimPrefix(addr, "tcp:"))
+	default:
+		return nil, fmt.Errorf("address must start with unix: or tcp: (got %q)", addr)
+	}
+}
+
+func listenUnix(path string, allowedUIDs []int) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("socket path is required")
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		_ = os.Remove(path)
+	}
+
+	ln, err := unixsock.Listen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allowedUIDs) == 0 {
+		allowedUIDs = []int{os.Getuid()}
+	}
+	return &peerListener{Listener: ln, allowed: allowedUIDs}, nil
+}
+
+func listenLoopback(address string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("TCP listening is limited to loopback addresses (got %s)", host)
+		}
+	}
+	return net.Listen("tcp", address)
+}
+
+// peerListener drops Unix socket connections from users that are not allowed.
+type peerListener struct {
+	net.Listener
+	allowed []int
+	warned  bool
+}
+
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		uid, err := peerUID(conn)
+		switch {
+		case errors.Is(err, errPeerCredUnsupported):
+			if !l.warned {
+				l.warned = true
+				logger.Warn("Peer credentials unavailable; relying on socket permissions")
+			}
+			return conn, nil
+		case err != nil:
+			logger.WithError(err).Warn("Rejected connection: cannot read peer credentials")
+		case !l.allows(uid):
+			logger.WithField("uid", uid).Warn("Rejected connection from disallowed user")
+		default:
+			return conn, nil
+		}
+		_ = conn.Close()
+	}
+}
+
+func (l *peerListener) allows(uid int) bool {
+	for _, allowed := range l.allowed {
+		if uid == allowed {
+			return true
+		}
+	}
+	return false
+}
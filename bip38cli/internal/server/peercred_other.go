@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "net"
+
+// peerUID is not implemented off Linux; socket permissions still apply.
+func peerUID(net.Conn) (int, error) {
+	return 0, errPeerCredUnsupported
+}
@@ -0,0 +1,224 @@
+// Package server hosts JSON endpoints for local clients. It owns the
+// transport concerns: listeners, peer checks, request size and concurrency
+// limits, and mapping errors.AppError types to HTTP status codes. The
+// operations themselves are registered by the caller.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/logger"
+)
+
+const (
+	defaultMaxBodyBytes = 64 << 10
+	defaultQueueTimeout = 30 * time.Second
+	shutdownGrace       = 5 * time.Second
+)
+
+// HandlerFunc serves one request and returns the value to encode as JSON.
+type HandlerFunc func(r *http.Request) (any, error)
+
+// Config controls a Server.
+type Config struct {
+	// MaxBodyBytes caps request bodies; defaults to 64 KiB.
+	MaxBodyBytes int64
+	// MaxConcurrent bounds handlers registered with HandleScrypt, since each
+	// holds about 16 MiB of scrypt state. Defaults to 1.
+	MaxConcurrent int
+	// QueueTimeout is how long a request waits for a free slot before the
+	// server answers 503. Defaults to 30s.
+	QueueTimeout time.Duration
+	// Token, when set, must be presented as "Authorization: Bearer <token>".
+	Token string
+}
+
+// Server routes requests to registered handlers.
+type Server struct {
+	cfg   Config
+	mux   *http.ServeMux
+	slots chan struct{}
+}
+
+// New returns a Server with no routes.
+func New(cfg Config) *Server {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 1
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = defaultQueueTimeout
+	}
+	return &Server{
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		slots: make(chan struct{}, cfg.MaxConcurrent),
+	}
+}
+
+// Handle registers a cheap handler for pattern, e.g. "GET /v1/health".
+func (s *Server) Handle(pattern string, h HandlerFunc) {
+	s.mux.Handle(pattern, s.wrap(h, false))
+}
+
+// HandleScrypt registers a handler that runs under the concurrency limit.
+func (s *Server) HandleScrypt(pattern string, h HandlerFunc) {
+	s.mux.Handle(pattern, s.wrap(h, true))
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Token != "" && !s.authorized(r) {
+		writeError(w, errors.NewValidationError("missing or invalid bearer token", nil), http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) == 1
+}
+
+func (s *Server) wrap(h HandlerFunc, limited bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+
+		if limited {
+			release, err := s.acquire(r.Context())
+			if err != nil {
+				writeError(w, err, http.StatusServiceUnavailable)
+				return
+			}
+			defer release()
+		}
+
+		started := time.Now()
+		result, err := h(r)
+		entry := logger.WithField("path", r.URL.Path).WithField("duration", time.Since(started))
+		if err != nil {
+			status := StatusCode(err)
+			entry.WithField("status", status).WithError(err).Debug("Request failed")
+			writeError(w, err, status)
+			return
+		}
+		entry.WithField("status", http.StatusOK).Debug("Request served")
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// acquire waits for a free slot, giving up after QueueTimeout.
+func (s *Server) acquire(ctx context.Context) (func(), error) {
+	timer := time.NewTimer(s.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, nil
+	case <-timer.C:
+		return nil, errors.NewSystemError("server busy, try again later", nil).
+			WithContext("max_concurrent", s.cfg.MaxConcurrent)
+	case <-ctx.Done():
+		return nil, errors.NewSystemError("request cancelled while queued", ctx.Err())
+	}
+}
+
+// Serve answers requests on ln until ctx is cancelled, then shuts down
+// gracefully. It returns nil after a clean shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("shutdown: %w", err)
+		}
+		if err := <-served; err != nil && !stderrors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// DecodeJSON reads a single JSON object from the request body into v.
+// Unknown fields are rejected so typos do not silently change behaviour.
+func DecodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errors.NewValidationError("invalid JSON request body", err)
+	}
+	if decoder.More() {
+		return errors.NewValidationError("request body must hold a single JSON object", nil)
+	}
+	return nil
+}
+
+// StatusCode maps an error to an HTTP status: validation and input errors
+// are the client's (400), crypto errors such as a wrong passphrase are
+// unprocessable (422), oversized bodies are 413 and anything else is 500.
+func StatusCode(err error) int {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) {
+		return http.StatusInternalServerError
+	}
+	switch appErr.Type {
+	case errors.ValidationError, errors.InputError:
+		return http.StatusBadRequest
+	case errors.CryptoError:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, err error, status int) {
+	body := map[string]any{"message": err.Error()}
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		body["type"] = string(appErr.Type)
+		body["message"] = appErr.Message
+		if appErr.Cause != nil {
+			body["cause"] = appErr.Cause.Error()
+		}
+		if len(appErr.Context) > 0 {
+			body["context"] = appErr.Context
+		}
+	}
+	writeJSON(w, status, map[string]any{"error": body})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WithError(err).Debug("Failed to write response")
+	}
+}
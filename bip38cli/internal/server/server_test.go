@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/internal/errors"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "validation", err: errors.NewValidationError("bad", nil), want: http.StatusBadRequest},
+		{name: "input", err: errors.NewInputError("bad", nil), want: http.StatusBadRequest},
+		{name: "crypto", err: errors.NewCryptoError("wrong passphrase", nil), want: http.StatusUnprocessableEntity},
+		{name: "config", err: errors.NewConfigError("broken", nil), want: http.StatusInternalServerError},
+		{name: "system", err: errors.NewSystemError("broken", nil), want: http.StatusInternalServerError},
+		{name: "wrapped", err: fmt.Errorf("outer: %w", errors.NewCryptoError("inner", nil)), want: http.StatusUnprocessableEntity},
+		{name: "plain", err: stderrors.New("boom"), want: http.StatusInternalServerError},
+		{name: "too large", err: errors.NewValidationError("invalid body", &http.MaxBytesError{Limit: 1}), want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusCode(tt.err); got != tt.want {
+				t.Fatalf("StatusCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+type echoRequest struct {
+	Value string `json:"value"`
+}
+
+func newEchoServer(cfg Config) *Server {
+	srv := New(cfg)
+	srv.Handle("POST /echo", func(r *http.Request) (any, error) {
+		var req echoRequest
+		if err := DecodeJSON(r, &req); err != nil {
+			return nil, err
+		}
+		if req.Value == "" {
+			return nil, errors.NewCryptoError("empty value", nil).WithContext("field", "value")
+		}
+		return map[string]string{"value": req.Value}, nil
+	})
+	return srv
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string, header http.Header) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var payload map[string]any
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code, payload
+}
+
+func TestServerRequests(t *testing.T) {
+	srv := newEchoServer(Config{MaxBodyBytes: 64})
+
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		status    int
+		errorType string
+	}{
+		{name: "ok", method: http.MethodPost, body: `{"value":"hi"}`, status: http.StatusOK},
+		{name: "app error", method: http.MethodPost, body: `{"value":""}`, status: http.StatusUnprocessableEntity, errorType: "crypto"},
+		{name: "unknown field", method: http.MethodPost, body: `{"value":"hi","extra":1}`, status: http.StatusBadRequest, errorType: "validation"},
+		{name: "trailing data", method: http.MethodPost, body: `{"value":"a"}{"value":"b"}`, status: http.StatusBadRequest, errorType: "validation"},
+		{name: "too large", method: http.MethodPost, body: `{"value":"` + strings.Repeat("x", 100) + `"}`, status: http.StatusRequestEntityTooLarge, errorType: "validation"},
+		{name: "wrong method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, payload := do(t, srv, tt.method, "/echo", tt.body, nil)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%v)", status, tt.status, payload)
+			}
+			if tt.errorType == "" {
+				return
+			}
+			errBody, _ := payload["error"].(map[string]any)
+			if errBody["type"] != tt.errorType {
+				t.Fatalf("error type = %v, want %s", errBody["type"], tt.errorType)
+			}
+		})
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	srv := newEchoServer(Config{Token: "s3cret"})
+
+	if status, _ := do(t, srv, http.MethodPost, "/echo", `{"value":"hi"}`, nil); status != http.StatusUnauthorized {
+		t.Fatalf("missing token: status = %d, want 401", status)
+	}
+	wrong := http.Header{"Authorization": {"Bearer nope"}}
+	if status, _ := do(t, srv, http.MethodPost, "/echo", `{"value":"hi"}`, wrong); status != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status = %d, want 401", status)
+	}
+	right := http.Header{"Authorization": {"Bearer s3cret"}}
+	if status, _ := do(t, srv, http.MethodPost, "/echo", `{"value":"hi"}`, right); status != http.StatusOK {
+		t.Fatalf("right token: status = %d, want 200", status)
+	}
+}
+
+func TestServerConcurrencyLimit(t *testing.T) {
+	srv := New(Config{MaxConcurrent: 1, QueueTimeout: 50 * time.Millisecond})
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv.HandleScrypt("POST /slow", func(*http.Request) (any, error) {
+		entered <- struct{}{}
+		<-release
+		return map[string]bool{"ok": true}, nil
+	})
+	srv.Handle("GET /cheap", func(*http.Request) (any, error) {
+		return map[string]bool{"ok": true}, nil
+	})
+
+	first := make(chan int, 1)
+	go func() {
+		status, _ := do(t, srv, http.MethodPost, "/slow", "", nil)
+		first <- status
+	}()
+	<-entered
+
+	if status, payload := do(t, srv, http.MethodPost, "/slow", "", nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("queued request: status = %d, want 503 (%v)", status, payload)
+	}
+	if status, _ := do(t, srv, http.MethodGet, "/cheap", "", nil); status != http.StatusOK {
+		t.Fatalf("unlimited handler: status = %d, want 200", status)
+	}
+
+	close(release)
+	if status := <-first; status != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", status)
+	}
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := Listen("unix:"+path, nil)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket permissions = %o, want 600", info.Mode().Perm())
+	}
+	// The socket is created in a private directory and linked into place.
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil || len(entries) != 1 {
+		t.Fatalf("socket directory holds %v (%v), want only the socket", entries, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- newEchoServer(Config{}).Serve(ctx, ln) }()
+
+	resp, err := unixClient(path).Post("http://local/echo", "application/json", strings.NewReader(`{"value":"hi"}`))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"hi"`) {
+		t.Fatalf("response %d %s", resp.StatusCode, body)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not stop after cancel")
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket left behind after Serve: %v", err)
+	}
+}
+
+func TestServeRejectsDisallowedPeers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only checked on Linux")
+	}
+
+	path := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := Listen("unix:"+path, []int{os.Getuid() + 1})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = newEchoServer(Config{}).Serve(ctx, ln) }()
+
+	client := unixClient(path)
+	client.Timeout = 5 * time.Second
+	resp, err := client.Post("http://local/echo", "application/json", strings.NewReader(`{"value":"hi"}`))
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("expected the connection to be dropped, got status %d", resp.StatusCode)
+	}
+}
+
+func TestListenRejectsUnsafeAddresses(t *testing.T) {
+	for _, addr := range []string{"tcp:0.0.0.0:0", "tcp:192.0.2.1:8080", "127.0.0.1:8080", "unix:"} {
+		if ln, err := Listen(addr, nil); err == nil {
+			_ = ln.Close()
+			t.Fatalf("Listen(%q) succeeded, want error", addr)
+		}
+	}
+
+	ln, err := Listen("tcp:127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("Listen loopback: %v", err)
+	}
+	_ = ln.Close()
+
+	notSocket := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notSocket, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if ln, err := Listen("unix:"+notSocket, nil); err == nil {
+		_ = ln.Close()
+		t.Fatal("Listen over a regular file succeeded, want error")
+	}
+}
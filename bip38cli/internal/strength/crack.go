@@ -0,0 +1,36 @@
+package strength
+
+import "github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+
+// BytesPerGuess is the memory traffic of one BIP38 passphrase guess. Each
+// guess runs scrypt with the BIP38 parameters, whose ROMix writes and then
+// reads back N blocks of 128*r bytes for each of p lanes. Memory bandwidth,
+// not arithmetic, bounds how fast this goes on any hardware; the rest of a
+// guess (AES and one address derivation) is noise next to it.
+const BytesPerGuess = 2 * 128 * bip38.ScryptR * bip38.ScryptN * bip38.ScryptP
+
+// Attacker is a class of offline attacker, by the memory bandwidth they can
+// put into scrypt.
+type Attacker struct {
+	Name      string
+	Bandwidth float64 // bytes per second
+}
+
+// Attackers are the scenarios crack times are given for, from a single
+// computer to a well-funded GPU farm.
+var Attackers = []Attacker{
+	{Name: "desktop CPU", Bandwidth: 50e9},
+	{Name: "high-end GPU", Bandwidth: 1e12},
+	{Name: "farm of 10,000 GPUs", Bandwidth: 1e16},
+}
+
+// Rate is the guesses per second the attacker can try.
+func (a Attacker) Rate() float64 {
+	return a.Bandwidth / BytesPerGuess
+}
+
+// Seconds is the expected time for the attacker to find a passphrase that
+// takes guesses guesses: on average, half of them.
+func (a Attacker) Seconds(guesses float64) float64 {
+	return guesses / 2 / a.Rate()
+}
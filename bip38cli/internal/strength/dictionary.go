@@ -0,0 +1,268 @@
+package strength
+
+import (
+	"bufio"
+	"embed"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The word lists are ranked, most common first: common passwords, common
+// English words, and common first names and surnames.
+//
+//go:embed lists/*.txt
+var listFiles embed.FS
+
+type wordList struct {
+	name   string
+	ranks  map[string]int
+	maxLen int // in runes
+}
+
+var wordLists = []*wordList{
+	loadList("passwords"),
+	loadList("english"),
+	loadList("names"),
+}
+
+func loadList(name string) *wordList {
+	file, err := listFiles.Open("lists/" + name + ".txt")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	list := &wordList{name: name, ranks: map[string]int{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := scanner.Text()
+		if word == "" {
+			continue
+		}
+		if _, ok := list.ranks[word]; !ok {
+			list.ranks[word] = len(list.ranks) + 1
+		}
+		list.maxLen = max(list.maxLen, utf8.RuneCountInString(word))
+	}
+	return list
+}
+
+// l33tTable lists the letters each substitution can stand for.
+var l33tTable = map[rune][]rune{
+	'4': {'a'}, '@': {'a'},
+	'8': {'b'},
+	'(': {'c'}, '{': {'c'}, '[': {'c'}, '<': {'c'},
+	'3': {'e'},
+	'6': {'g'}, '9': {'g'},
+	'1': {'i', 'l'}, '!': {'i'}, '|': {'i', 'l'},
+	'7': {'l', 't'},
+	'0': {'o'},
+	'$': {'s'}, '5': {'s'},
+	'+': {'t'},
+	'%': {'x'},
+	'2': {'z'},
+}
+
+// analyzer finds the matches in a passphrase. It keeps its copies of the
+// passphrase so wipe can clear them.
+type analyzer struct {
+	runes []rune // as typed
+	lower []rune
+	buf   []byte // UTF-8 scratch for map lookups
+}
+
+func newAnalyzer(runes []rune) *analyzer {
+	a := &analyzer{runes: runes, lower: make([]rune, len(runes))}
+	for i, r := range runes {
+		a.lower[i] = unicode.ToLower(r)
+	}
+	return a
+}
+
+func (a *analyzer) wipe() {
+	wipeRunes(a.lower)
+	clear(a.buf[:cap(a.buf)])
+}
+
+func (a *analyzer) matches() []Match {
+	var matches []Match
+	matches = append(matches, a.dictionaryMatches()...)
+	matches = append(matches, a.reversedMatches()...)
+	matches = append(matches, a.l33tMatches()...)
+	matches = append(matches, keyboardMatches(a.runes)...)
+	matches = append(matches, sequenceMatches(a.runes)...)
+	matches = append(matches, repeatMatches(a.runes)...)
+	matches = append(matches, dateMatches(a.runes)...)
+	return matches
+}
+
+// lookup finds word in list. Converting the scratch buffer in the map
+// index does not allocate, so no unwipeable string of the word is made.
+func (a *analyzer) lookup(list *wordList, word []rune) (int, bool) {
+	a.buf = a.buf[:0]
+	for _, r := range word {
+		a.buf = utf8.AppendRune(a.buf, r)
+	}
+	rank, ok := list.ranks[string(a.buf)]
+	return rank, ok
+}
+
+// wordMatches finds the words of the lists in lower, a lowercased form of
+// the passphrase, and prices them by rank and capitals of the original.
+func (a *analyzer) wordMatches(lower, original []rune) []Match {
+	var matches []Match
+	for _, list := range wordLists {
+		for i := range lower {
+			for j := i + 1; j <= len(lower) && j-i <= list.maxLen; j++ {
+				rank, ok := a.lookup(list, lower[i:j])
+				if !ok {
+					continue
+				}
+				caps := capitalsOf(original[i:j])
+				matches = append(matches, Match{
+					Pattern:  Dictionary,
+					Start:    i,
+					End:      j,
+					Guesses:  float64(rank) * capitalVariations(original[i:j], caps),
+					List:     list.name,
+					Rank:     rank,
+					capitals: caps,
+				})
+			}
+		}
+	}
+	return matches
+}
+
+func (a *analyzer) dictionaryMatches() []Match {
+	return a.wordMatches(a.lower, a.runes)
+}
+
+// reversedMatches finds words typed backwards, which double the guesses.
+func (a *analyzer) reversedMatches() []Match {
+	lower, original := slices.Clone(a.lower), slices.Clone(a.runes)
+	defer wipeRunes(lower)
+	defer wipeRunes(original)
+	slices.Reverse(lower)
+	slices.Reverse(original)
+
+	n := len(lower)
+	matches := a.wordMatches(lower, original)
+	for i := range matches {
+		m := &matches[i]
+		m.Start, m.End = n-m.End, n-m.Start
+		m.Reversed = true
+		m.Guesses *= 2
+	}
+	return matches
+}
+
+// l33tMatches finds words with letters replaced by look-alikes, such as
+// p@ssw0rd, trying each reading of the ambiguous substitutions.
+func (a *analyzer) l33tMatches() []Match {
+	var subs []rune
+	for _, r := range a.lower {
+		if _, ok := l33tTable[r]; ok && !slices.Contains(subs, r) {
+			subs = append(subs, r)
+		}
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	var matches []Match
+	translated := make([]rune, len(a.lower))
+	defer wipeRunes(translated)
+	table := map[rune]rune{}
+	var try func(int)
+	try = func(next int) {
+		if next < len(subs) {
+			for _, letter := range l33tTable[subs[next]] {
+				table[subs[next]] = letter
+				try(next + 1)
+			}
+			return
+		}
+		for i, r := range a.lower {
+			translated[i] = r
+			if letter, ok := table[r]; ok {
+				translated[i] = letter
+			}
+		}
+		for _, m := range a.wordMatches(translated, a.runes) {
+			if m.Len() < 2 || slices.Equal(translated[m.Start:m.End], a.lower[m.Start:m.End]) {
+				continue
+			}
+			m.L33t = true
+			m.Guesses *= l33tVariations(a.lower[m.Start:m.End], table)
+			matches = append(matches, m)
+		}
+	}
+	try(0)
+	return matches
+}
+
+// l33tVariations counts the ways the substitutions in word could have been
+// made: for each one, which of the letters it stands for were replaced.
+func l33tVariations(word []rune, table map[rune]rune) float64 {
+	v := 1.0
+	for sub, letter := range table {
+		subbed, unsubbed := 0, 0
+		for _, r := range word {
+			switch r {
+			case sub:
+				subbed++
+			case letter:
+				unsubbed++
+			}
+		}
+		if subbed > 0 {
+			v *= variations(subbed, unsubbed)
+		}
+	}
+	return v
+}
+
+func capitalsOf(word []rune) capitals {
+	upper, lower := countCase(word)
+	switch {
+	case upper == 0:
+		return noCapitals
+	case lower == 0:
+		return allCapitals
+	case upper == 1 && unicode.IsUpper(word[0]):
+		return firstCapital
+	default:
+		return mixedCapitals
+	}
+}
+
+func countCase(word []rune) (upper, lower int) {
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	return upper, lower
+}
+
+// capitalVariations counts the ways to capitalize word the way it is:
+// capitalizing the first or last letter, or all of them, only doubles the
+// guesses.
+func capitalVariations(word []rune, caps capitals) float64 {
+	switch caps {
+	case noCapitals:
+		return 1
+	case firstCapital, allCapitals:
+		return 2
+	}
+	upper, lower := countCase(word)
+	if upper == 1 && unicode.IsUpper(word[len(word)-1]) {
+		return 2
+	}
+	return variations(upper, lower)
+}
@@ -0,0 +1,82 @@
+package strength
+
+// feedback explains the weakest-looking part of a split, the longest match,
+// and suggests what to do instead.
+func feedback(matches []Match, n int) (string, []string) {
+	suggestions := []string{"Use a few words, avoid common phrases", "No need for symbols, digits, or uppercase letters"}
+	if len(matches) == 0 {
+		return "", suggestions
+	}
+
+	longest := matches[0]
+	for _, m := range matches[1:] {
+		if m.Len() > longest.Len() {
+			longest = m
+		}
+	}
+	suggestions = []string{"Add another word or two. Uncommon words are better."}
+	sole := len(matches) == 1 && longest.Len() == n
+
+	switch longest.Pattern {
+	case Dictionary:
+		return dictionaryFeedback(longest, sole, suggestions)
+	case Keyboard:
+		warning := "Short keyboard patterns are easy to guess"
+		if longest.Turns == 1 {
+			warning = "Straight rows of keys are easy to guess"
+		}
+		return warning, append(suggestions, "Use a longer keyboard pattern with more turns")
+	case Repeat:
+		warning := `Repeats like "abcabc" are only slightly harder to guess than "abc"`
+		if longest.Len() == longest.Repeats {
+			warning = `Repeats like "aaa" are easy to guess`
+		}
+		return warning, append(suggestions, "Avoid repeated words and characters")
+	case Sequence:
+		return "Sequences like abc or 6543 are easy to guess", append(suggestions, "Avoid sequences")
+	case Date:
+		return "Dates and years are often easy to guess",
+			append(suggestions, "Avoid dates and years that are associated with you")
+	}
+	return "", suggestions
+}
+
+func dictionaryFeedback(m Match, sole bool, suggestions []string) (string, []string) {
+	var warning string
+	switch m.List {
+	case "passwords":
+		switch {
+		case sole && !m.L33t && !m.Reversed && m.Rank <= 10:
+			warning = "This is a top-10 common password"
+		case sole && !m.L33t && !m.Reversed && m.Rank <= 100:
+			warning = "This is a top-100 common password"
+		case sole:
+			warning = "This is a very common password"
+		default:
+			warning = "This is similar to a commonly used password"
+		}
+	case "english":
+		if sole {
+			warning = "A word by itself is easy to guess"
+		}
+	case "names":
+		warning = "Common names and surnames are easy to guess"
+		if sole {
+			warning = "Names and surnames by themselves are easy to guess"
+		}
+	}
+
+	switch m.capitals {
+	case firstCapital:
+		suggestions = append(suggestions, "Capitalization doesn't help very much")
+	case allCapitals:
+		suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+	}
+	if m.Reversed {
+		suggestions = append(suggestions, "Reversed words aren't much harder to guess")
+	}
+	if m.L33t {
+		suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+	}
+	return warning, suggestions
+}
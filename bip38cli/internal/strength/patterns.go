@@ -0,0 +1,342 @@
+package strength
+
+import (
+	"math"
+	"slices"
+	"time"
+	"unicode"
+)
+
+// key is where a character sits on a QWERTY keyboard, with each row offset
+// by its stagger so that neighbours are one key apart in a row and half a
+// key apart between rows.
+type key struct {
+	row     int
+	x       float64
+	shifted bool
+}
+
+var qwerty = func() map[rune]key {
+	rows := []struct {
+		offset         float64
+		plain, shifted string
+	}{
+		{0, "`1234567890-=", "~!@#$%^&*()_+"},
+		{1.5, "qwertyuiop[]\\", "QWERTYUIOP{}|"},
+		{2, "asdfghjkl;'", "ASDFGHJKL:\""},
+		{2.5, "zxcvbnm,./", "ZXCVBNM<>?"},
+	}
+	keys := map[rune]key{}
+	for row, r := range rows {
+		shifted := []rune(r.shifted)
+		for i, c := range []rune(r.plain) {
+			x := r.offset + float64(i)
+			keys[c] = key{row: row, x: x}
+			keys[shifted[i]] = key{row: row, x: x, shifted: true}
+		}
+	}
+	return keys
+}()
+
+// direction returns which way b is from a, or -1 when b is not next to a.
+func direction(a, b key) int {
+	dx := b.x - a.x
+	switch {
+	case a.row == b.row && math.Abs(dx) == 1:
+		return int(dx+1) / 2 // 0 left, 1 right
+	case math.Abs(float64(b.row-a.row)) == 1 && math.Abs(dx) == 0.5:
+		return 2 + (b.row - a.row + 1) + int(dx+0.5) // 2-5: the four diagonals
+	}
+	return -1
+}
+
+// keyboardStarts and keyboardDegree are the keys a walk can start on and
+// how many neighbours a key has on average.
+var keyboardStarts, keyboardDegree = func() (float64, float64) {
+	keys, neighbours := 0, 0
+	for _, a := range qwerty {
+		if a.shifted {
+			continue
+		}
+		keys++
+		for _, b := range qwerty {
+			if !b.shifted && direction(a, b) >= 0 {
+				neighbours++
+			}
+		}
+	}
+	return float64(keys), float64(neighbours) / float64(keys)
+}()
+
+// keyboardMatches finds walks of three or more neighbouring keys, such as
+// qwerty or 1qaz2wsx.
+func keyboardMatches(runes []rune) []Match {
+	var matches []Match
+	for i := 0; i < len(runes); {
+		j, turns, last := i+1, 0, -1
+		for ; j < len(runes); j++ {
+			a, okA := qwerty[runes[j-1]]
+			b, okB := qwerty[runes[j]]
+			if !okA || !okB {
+				break
+			}
+			dir := direction(a, b)
+			if dir < 0 {
+				break
+			}
+			if dir != last {
+				turns++
+				last = dir
+			}
+		}
+		if j-i >= 3 {
+			matches = append(matches, Match{
+				Pattern: Keyboard,
+				Start:   i,
+				End:     j,
+				Guesses: keyboardGuesses(runes[i:j], turns),
+				Turns:   turns,
+			})
+		}
+		i = j
+	}
+	return matches
+}
+
+// keyboardGuesses counts the walks of the same length with up to as many
+// turns from any key, times the ways to hold shift on some of the keys.
+func keyboardGuesses(walk []rune, turns int) float64 {
+	guesses := 0.0
+	for length := 2; length <= len(walk); length++ {
+		for t := 1; t <= min(turns, length-1); t++ {
+			guesses += binomial(length-1, t-1) * keyboardStarts * math.Pow(keyboardDegree, float64(t))
+		}
+	}
+	shifted := 0
+	for _, r := range walk {
+		if qwerty[r].shifted {
+			shifted++
+		}
+	}
+	if shifted > 0 {
+		guesses *= variations(shifted, len(walk)-shifted)
+	}
+	return guesses
+}
+
+// maxSequenceStep is the largest step between the characters of a
+// sequence, so that aceg counts but not azaz.
+const maxSequenceStep = 5
+
+// sequenceMatches finds runs of three or more letters or digits a fixed
+// step apart, such as abcd, 9876 or acegi.
+func sequenceMatches(runes []rune) []Match {
+	var matches []Match
+	for i := 0; i+2 < len(runes); {
+		step := runes[i+1] - runes[i]
+		j := i + 2
+		for j < len(runes) && runes[j]-runes[j-1] == step {
+			j++
+		}
+		if j-i >= 3 && step != 0 && abs(step) <= maxSequenceStep && sameClass(runes[i:j]) {
+			matches = append(matches, Match{
+				Pattern: Sequence,
+				Start:   i,
+				End:     j,
+				Guesses: sequenceGuesses(runes[i:j], step > 0),
+			})
+		}
+		i = j - 1
+	}
+	return matches
+}
+
+func sameClass(runes []rune) bool {
+	for _, class := range []func(rune) bool{unicode.IsLower, unicode.IsUpper, unicode.IsDigit} {
+		if !slices.ContainsFunc(runes, func(r rune) bool { return !class(r) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceGuesses prices a sequence by how obvious its start is, its
+// direction and its length.
+func sequenceGuesses(seq []rune, ascending bool) float64 {
+	var base float64
+	switch first := seq[0]; {
+	case slices.Contains([]rune("aAzZ019"), first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if !ascending {
+		base *= 2
+	}
+	return base * float64(len(seq))
+}
+
+func abs(r rune) rune {
+	if r < 0 {
+		return -r
+	}
+	return r
+}
+
+// repeatMatches finds a base repeated two or more times, such as aaaa or
+// abcabc, taking the longest repeat at each position.
+func repeatMatches(runes []rune) []Match {
+	var matches []Match
+	for i := 0; i < len(runes); {
+		unit, count := 0, 0
+		for u := 1; i+2*u <= len(runes); u++ {
+			c := 1
+			for i+(c+1)*u <= len(runes) && slices.Equal(runes[i:i+u], runes[i+c*u:i+(c+1)*u]) {
+				c++
+			}
+			if c >= 2 && c*u > unit*count {
+				unit, count = u, c
+			}
+		}
+		if count == 0 {
+			i++
+			continue
+		}
+		base := estimateRunes(runes[i : i+unit])
+		matches = append(matches, Match{
+			Pattern: Repeat,
+			Start:   i,
+			End:     i + unit*count,
+			Guesses: base.Guesses * float64(count),
+			Repeats: count,
+		})
+		i += unit * count
+	}
+	return matches
+}
+
+// referenceYear is the year dates are judged against: recent years are the
+// ones people pick.
+var referenceYear = time.Now().Year()
+
+// minYearSpace keeps years close to referenceYear from looking too cheap.
+const minYearSpace = 20
+
+func yearSpace(year int) float64 {
+	return float64(max(absInt(year-referenceYear), minYearSpace))
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dateSplits lists where a date of digits alone may divide into its three
+// parts, by length.
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+// dateMatches finds years from 1900 to 2099, and dates of day, month and
+// year with or without separators, such as 13041987 or 4.7.76.
+func dateMatches(runes []rune) []Match { //nolint:gocyclo
+	var matches []Match
+	for i := range runes {
+		for j := i + 4; j <= min(len(runes), i+10); j++ {
+			token := runes[i:j]
+			if j-i == 4 && allDigits(token) {
+				if year := atoi(token); year >= 1900 && year <= 2099 {
+					matches = append(matches, Match{Pattern: Date, Start: i, End: j, Guesses: yearSpace(year), Year: year})
+				}
+			}
+
+			year, found, separator := 0, false, false
+			if splits, ok := dateSplits[j-i]; ok && allDigits(token) {
+				for _, s := range splits {
+					if y, ok := dmy(token[:s[0]], token[s[0]:s[1]], token[s[1]:]); ok && (!found || yearSpace(y) < yearSpace(year)) {
+						year, found = y, true
+					}
+				}
+			} else if j-i >= 6 {
+				if a, b, c, ok := splitDate(token); ok {
+					year, found = dmy(a, b, c)
+					separator = true
+				}
+			}
+			if !found {
+				continue
+			}
+			guesses := yearSpace(year) * 365
+			if separator {
+				guesses *= 4
+			}
+			matches = append(matches, Match{Pattern: Date, Start: i, End: j, Guesses: guesses, Year: year})
+		}
+	}
+	return matches
+}
+
+// splitDate splits a date such as 13-04-1987 at its two separators, which
+// must be the same.
+func splitDate(token []rune) (a, b, c []rune, ok bool) {
+	first := slices.IndexFunc(token, func(r rune) bool { return !unicode.IsDigit(r) })
+	if first < 1 || !slices.Contains([]rune(" /\\_.-"), token[first]) {
+		return nil, nil, nil, false
+	}
+	second := first + 1 + slices.Index(token[first+1:], token[first])
+	if second <= first+1 {
+		return nil, nil, nil, false
+	}
+	a, b, c = token[:first], token[first+1:second], token[second+1:]
+	if len(a) > 4 || len(b) > 2 || len(c) < 1 || len(c) > 4 || !allDigits(a) || !allDigits(b) || !allDigits(c) {
+		return nil, nil, nil, false
+	}
+	return a, b, c, true
+}
+
+// dmy reads three groups of digits as a date with the year first or last
+// and the day and month in either order, returning the year.
+func dmy(a, b, c []rune) (int, bool) {
+	for _, order := range [][3][]rune{{a, b, c}, {b, a, c}, {c, b, a}, {b, c, a}} {
+		day, month, year := order[0], order[1], order[2]
+		if len(day) > 2 || len(month) > 2 {
+			continue
+		}
+		d, m := atoi(day), atoi(month)
+		if d < 1 || d > 31 || m < 1 || m > 12 {
+			continue
+		}
+		switch y := atoi(year); len(year) {
+		case 2:
+			if y > 50 {
+				return 1900 + y, true
+			}
+			return 2000 + y, true
+		case 4:
+			if y >= 1000 && y <= 2050 {
+				return y, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func allDigits(runes []rune) bool {
+	return len(runes) > 0 && !slices.ContainsFunc(runes, func(r rune) bool { return r < '0' || r > '9' })
+}
+
+func atoi(digits []rune) int {
+	n := 0
+	for _, r := range digits {
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
@@ -0,0 +1,240 @@
+// Package strength estimates how many guesses an attacker needs to find a
+// passphrase, in the manner of zxcvbn: the passphrase is split into the
+// patterns people use (common passwords and words, keyboard walks, dates,
+// repeats and sequences) and the cheapest way to guess the whole is counted.
+package strength
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// Pattern names a kind of match.
+type Pattern string
+
+const (
+	Dictionary Pattern = "dictionary"
+	Keyboard   Pattern = "keyboard"
+	Date       Pattern = "date"
+	Repeat     Pattern = "repeat"
+	Sequence   Pattern = "sequence"
+	BruteForce Pattern = "bruteforce"
+)
+
+// maxRunes is how much of a passphrase is analysed. Anything longer is far
+// beyond any policy unless it is a pattern, which shows in the first part.
+const maxRunes = 100
+
+// Match is a part of the passphrase guessable as a pattern. It holds
+// positions rather than the matched text, so results carry no secrets.
+type Match struct {
+	Pattern Pattern
+	Start   int // first rune
+	End     int // rune after the last
+	Guesses float64
+
+	List     string // Dictionary: word list the word is in
+	Rank     int    // Dictionary: position in the list, from 1
+	Reversed bool   // Dictionary: matched backwards
+	L33t     bool   // Dictionary: matched after undoing substitutions
+	Turns    int    // Keyboard: number of straight runs
+	Repeats  int    // Repeat: times the base repeats
+	Year     int    // Date: the year, alone or in a date
+
+	capitals capitals
+}
+
+// Len is the number of runes the match covers.
+func (m Match) Len() int {
+	return m.End - m.Start
+}
+
+// capitals describes the uppercase letters of a dictionary match.
+type capitals int
+
+const (
+	noCapitals capitals = iota
+	firstCapital
+	allCapitals
+	mixedCapitals
+)
+
+// Result is the estimate for a passphrase.
+type Result struct {
+	Guesses     float64 // expected guesses of an attacker who knows the patterns
+	Bits        float64 // log2(Guesses)
+	Matches     []Match // the cheapest split of the passphrase
+	Warning     string  // what makes the passphrase weak, if anything stands out
+	Suggestions []string
+}
+
+// Estimate analyses passphrase. It works on copies it wipes before
+// returning; passphrase itself is left alone.
+func Estimate(passphrase []byte) Result {
+	runes := make([]rune, 0, maxRunes)
+	for len(passphrase) > 0 && len(runes) < maxRunes {
+		r, size := utf8.DecodeRune(passphrase)
+		runes = append(runes, r)
+		passphrase = passphrase[size:]
+	}
+	defer wipeRunes(runes)
+
+	result := estimateRunes(runes)
+	result.Warning, result.Suggestions = feedback(result.Matches, len(runes))
+	return result
+}
+
+func estimateRunes(runes []rune) Result {
+	if len(runes) == 0 {
+		return Result{Guesses: 1}
+	}
+	a := newAnalyzer(runes)
+	defer a.wipe()
+
+	guesses, matches := cheapest(len(runes), a.matches())
+	return Result{Guesses: guesses, Bits: math.Log2(guesses), Matches: matches}
+}
+
+// minGuessesBeforeGrowing is the price zxcvbn puts on each extra match in a
+// split, so a passphrase is not judged as many tiny guessable pieces.
+const minGuessesBeforeGrowing = 10000
+
+// cheapest finds the split of n runes into matches and brute-forced gaps
+// with the fewest guesses. An attacker has to try the patterns of a split
+// in any order, hence the factorial, and to guess how many there are.
+func cheapest(n int, matches []Match) (float64, []Match) { //nolint:gocyclo
+	byEnd := make([][]Match, n)
+	for _, m := range matches {
+		m.Guesses = minimumGuesses(m, n)
+		byEnd[m.End-1] = append(byEnd[m.End-1], m)
+	}
+
+	// best[k][l] is the best split of runes[:k+1] into l matches.
+	type step struct {
+		match Match
+		pi    float64 // product of the guesses of the l matches
+		g     float64 // guesses for the split
+	}
+	best := make([]map[int]step, n)
+	for k := range best {
+		best[k] = map[int]step{}
+	}
+	update := func(m Match, l int) {
+		k := m.End - 1
+		pi := m.Guesses
+		if l > 1 {
+			pi *= best[m.Start-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowing, float64(l-1))
+		for other, s := range best[k] {
+			if other <= l && s.g <= g {
+				return
+			}
+		}
+		best[k][l] = step{match: m, pi: pi, g: g}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range byEnd[k] {
+			if m.Start == 0 {
+				update(m, 1)
+				continue
+			}
+			for l := range best[m.Start-1] {
+				update(m, l+1)
+			}
+		}
+		// Brute force from the start, or after a match that is not itself
+		// brute force: two adjacent gaps would be one longer gap.
+		update(bruteForce(0, k+1, n), 1)
+		for i := 1; i <= k; i++ {
+			for l, s := range best[i-1] {
+				if s.match.Pattern != BruteForce {
+					update(bruteForce(i, k+1, n), l+1)
+				}
+			}
+		}
+	}
+
+	length, guesses := 0, math.Inf(1)
+	for l, s := range best[n-1] {
+		if s.g < guesses || (s.g == guesses && l < length) {
+			length, guesses = l, s.g
+		}
+	}
+	split := make([]Match, length)
+	for k, l := n-1, length; l > 0; l-- {
+		s := best[k][l]
+		split[l-1] = s.match
+		k = s.match.Start - 1
+	}
+	return guesses, split
+}
+
+func bruteForce(start, end, n int) Match {
+	m := Match{Pattern: BruteForce, Start: start, End: end}
+	m.Guesses = minimumGuesses(m, n)
+	return m
+}
+
+// bruteForceCardinality is the guesses per brute-forced rune zxcvbn settled
+// on: passwords mostly use fewer characters than the keyboard offers.
+const bruteForceCardinality = 10
+
+// minimumGuesses raises the guesses of m to what guessing its length would
+// take anyway: a single rune is not cheaper than the ten digits.
+func minimumGuesses(m Match, n int) float64 {
+	guesses := m.Guesses
+	if m.Pattern == BruteForce {
+		guesses = math.Pow(bruteForceCardinality, float64(m.Len()))
+		if m.Len() == 1 {
+			guesses = math.Max(guesses, 11)
+		} else {
+			guesses = math.Max(guesses, 51)
+		}
+	}
+	if m.Len() < n {
+		if m.Len() == 1 {
+			return math.Max(guesses, 10)
+		}
+		return math.Max(guesses, 50)
+	}
+	return guesses
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
+
+// binomial is n choose k.
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	c := 1.0
+	for i := 1; i <= k; i++ {
+		c = c * float64(n-k+i) / float64(i)
+	}
+	return c
+}
+
+// variations counts the ways to mark up to min(marked, unmarked) of
+// marked+unmarked runes, such as which letters are capitals.
+func variations(marked, unmarked int) float64 {
+	if marked == 0 || unmarked == 0 {
+		return 2
+	}
+	sum := 0.0
+	for i := 1; i <= min(marked, unmarked); i++ {
+		sum += binomial(marked+unmarked, i)
+	}
+	return sum
+}
+
+func wipeRunes(runes []rune) {
+	clear(runes[:cap(runes)])
+}
@@ -0,0 +1,116 @@
+package strength
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimatePatterns(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		pattern    Pattern // of the longest match
+		maxBits    float64
+		check      func(Match) bool
+	}{
+		{"password", Dictionary, 4, func(m Match) bool { return m.List == "passwords" && m.Rank == 2 }},
+		{"P@ssw0rd", Dictionary, 8, func(m Match) bool { return m.L33t && m.capitals == firstCapital }},
+		{"drowssap", Dictionary, 4, func(m Match) bool { return m.Reversed }},
+		{"butterfly", Dictionary, 8, func(m Match) bool { return m.Rank > 0 }},
+		{"zxcvbnm,./", Keyboard, 16, func(m Match) bool { return m.Turns == 1 }},
+		{"qazxswedcvfr", Keyboard, 32, func(m Match) bool { return m.Turns > 1 }},
+		{"ghjkl;'", Keyboard, 16, nil},
+		{"13/04/1987", Date, 20, func(m Match) bool { return m.Year == 1987 }},
+		{"130487", Date, 16, func(m Match) bool { return m.Year == 1987 }},
+		{"1987", Date, 8, func(m Match) bool { return m.Year == 1987 }},
+		{"zzzzzzzzzzzz", Repeat, 8, func(m Match) bool { return m.Repeats == 12 }},
+		{"xq9xq9xq9xq9", Repeat, 16, func(m Match) bool { return m.Repeats == 4 }},
+		{"abcdefghijk", Sequence, 8, nil},
+		{"97531", Sequence, 8, nil},
+	}
+	for _, tt := range tests {
+		result := Estimate([]byte(tt.passphrase))
+		if result.Bits > tt.maxBits {
+			t.Errorf("%q: %.1f bits, want at most %.0f", tt.passphrase, result.Bits, tt.maxBits)
+		}
+		if len(result.Matches) == 0 {
+			t.Fatalf("%q: no matches", tt.passphrase)
+		}
+		longest := result.Matches[0]
+		for _, m := range result.Matches {
+			if m.Len() > longest.Len() {
+				longest = m
+			}
+		}
+		if longest.Pattern != tt.pattern || (tt.check != nil && !tt.check(longest)) {
+			t.Errorf("%q: longest match %+v, want a %s match", tt.passphrase, longest, tt.pattern)
+		}
+		if result.Warning == "" {
+			t.Errorf("%q: no warning", tt.passphrase)
+		}
+	}
+}
+
+func TestEstimateOrdersPassphrases(t *testing.T) {
+	// Each passphrase should take more guesses than the one before.
+	ordered := []string{
+		"",
+		"123456",
+		"monkey1",
+		"Tr0ub4dor",
+		"gX7#qP2v$Lm9!wZ4",
+		"correct horse battery staple",
+		"plinth-cobalt-marmoset-quibble-ferrule-yodel",
+	}
+	last := -1.0
+	for _, passphrase := range ordered {
+		result := Estimate([]byte(passphrase))
+		if result.Guesses <= last {
+			t.Fatalf("%q: %g guesses, not more than the weaker passphrase before it (%g)", passphrase, result.Guesses, last)
+		}
+		if want := math.Log2(result.Guesses); result.Bits != want {
+			t.Fatalf("%q: %g bits, want log2(guesses) = %g", passphrase, result.Bits, want)
+		}
+		last = result.Guesses
+	}
+}
+
+func TestEstimateSplitsPassphrase(t *testing.T) {
+	passphrase := []byte("Monkey1987qwerty")
+	result := Estimate(passphrase)
+	var patterns []Pattern
+	end := 0
+	for _, m := range result.Matches {
+		if m.Start != end {
+			t.Fatalf("match %+v does not follow the previous one, ending at %d", m, end)
+		}
+		end = m.End
+		patterns = append(patterns, m.Pattern)
+	}
+	if end != len(passphrase) {
+		t.Fatalf("matches end at %d, want %d", end, len(passphrase))
+	}
+	want := []Pattern{Dictionary, Date, Dictionary}
+	if len(patterns) != len(want) {
+		t.Fatalf("patterns %v, want %v", patterns, want)
+	}
+	for i := range want {
+		if patterns[i] != want[i] {
+			t.Fatalf("patterns %v, want %v", patterns, want)
+		}
+	}
+	if string(passphrase) != "Monkey1987qwerty" {
+		t.Fatal("Estimate modified the passphrase")
+	}
+}
+
+func TestAttackerSeconds(t *testing.T) {
+	if BytesPerGuess != 256<<20 {
+		t.Fatalf("BytesPerGuess = %d, want 256 MiB", BytesPerGuess)
+	}
+	for _, attacker := range Attackers {
+		rate := attacker.Rate()
+		if got := attacker.Seconds(2 * rate); math.Abs(got-1) > 1e-9 {
+			t.Fatalf("%s: %g seconds for twice the guesses per second, want 1 (half the space on average)", attacker.Name, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package unixsock creates Unix sockets that only their owner can reach.
+package unixsock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Listen creates a Unix socket at path with owner-only permissions. The
+// socket is bound inside a fresh 0700 directory, restricted, and only then
+// linked into place, so it is never reachable with the umask's permissions.
+// An existing file at path is left alone and reported as an error.
+func Listen(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	private := filepath.Join(dir, "sock")
+	ln, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	unixLn, ok := ln.(*net.UnixListener)
+	if !ok {
+		_ = ln.Close()
+		return nil, errors.New("unexpected listener type for a Unix socket")
+	}
+	// The private name goes away with its directory; Close removes path instead.
+	unixLn.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(private, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	if err := os.Link(private, path); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return &listener{UnixListener: unixLn, path: path}, nil
+}
+
+// listener reports the path it was linked to as its address and removes it
+// on the first Close.
+type listener struct {
+	*net.UnixListener
+	path   string
+	remove sync.Once
+}
+
+func (l *listener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *listener) Close() error {
+	err := l.UnixListener.Close()
+	l.remove.Do(func() { _ = os.Remove(l.path) })
+	return err
+}
@@ -0,0 +1,47 @@
+package vanity
+
+import (
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Encoder turns the HASH160 of a public key into an address.
+type Encoder func(hash []byte) string
+
+// P2PKH encodes legacy pay-to-pubkey-hash addresses with the given version.
+func P2PKH(version byte) Encoder {
+	return func(hash []byte) string {
+		return base58.CheckEncode(hash, version)
+	}
+}
+
+// P2WPKH encodes native segwit addresses of the network.
+func P2WPKH(params *chaincfg.Params) Encoder {
+	return func(hash []byte) string {
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(hash, params)
+		if err != nil {
+			return "" // only for a hash that is not 20 bytes
+		}
+		return addr.EncodeAddress()
+	}
+}
+
+// serializePoint appends the SEC encoding of an affine point to buf.
+func serializePoint(buf []byte, point *btcec.JacobianPoint, compressed bool) []byte {
+	point.X.Normalize()
+	point.Y.Normalize()
+	var x [32]byte
+	point.X.PutBytes(&x)
+	if compressed {
+		prefix := byte(0x02)
+		if point.Y.IsOdd() {
+			prefix = 0x03
+		}
+		return append(append(buf, prefix), x[:]...)
+	}
+	var y [32]byte
+	point.Y.PutBytes(&y)
+	return append(append(append(buf, 0x04), x[:]...), y[:]...)
+}
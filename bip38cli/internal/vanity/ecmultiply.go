@@ -0,0 +1,105 @@
+package vanity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// ECMatch is a seedb whose EC-multiply key has a matching address.
+type ECMatch struct {
+	Seed    []byte
+	Address string
+}
+
+// ECMultiplySearch looks for a BIP38 seedb whose key, passpoint*factorb
+// with factorb = SHA256(SHA256(seedb)), has a P2PKH address matching a
+// pattern. Only the passpoint from the owner's intermediate code is
+// involved, so the key itself stays unknown to the searcher.
+//
+// factorb is a hash, so consecutive candidates are unrelated points and
+// cannot be reached by adding one point to the last. Instead the multiples
+// passpoint*d*256^i are computed once for every byte value d and position
+// i, and each candidate is assembled from at most 32 point additions
+// rather than a full scalar multiplication.
+type ECMultiplySearch struct {
+	table      *[32][255]btcec.JacobianPoint
+	compressed bool
+	encode     Encoder
+	pattern    *Pattern
+}
+
+// NewECMultiplySearch prepares a search for keys of the intermediate code's
+// passpoint. BIP38 keys commit to a P2PKH address, so encode should be
+// P2PKH with the network's version.
+func NewECMultiplySearch(passpoint []byte, compressed bool, encode Encoder, pattern *Pattern) (*ECMultiplySearch, error) {
+	point, err := btcec.ParsePubKey(passpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid passpoint: %w", err)
+	}
+
+	var base, next btcec.JacobianPoint
+	point.AsJacobian(&base)
+	table := new([32][255]btcec.JacobianPoint)
+	for i := range table {
+		table[i][0] = base
+		for d := 1; d < 255; d++ {
+			btcec.AddNonConst(&table[i][d-1], &base, &table[i][d])
+			table[i][d].ToAffine()
+		}
+		btcec.AddNonConst(&table[i][254], &base, &next)
+		next.ToAffine()
+		base = next
+	}
+	return &ECMultiplySearch{table: table, compressed: compressed, encode: encode, pattern: pattern}, nil
+}
+
+// Worker returns a worker that counts seedb up from a random start.
+func (s *ECMultiplySearch) Worker() (Worker[ECMatch], error) {
+	w := &ecWorker{search: s}
+	if _, err := rand.Read(w.seed[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate seedb: %w", err)
+	}
+	return w, nil
+}
+
+type ecWorker struct {
+	search *ECMultiplySearch
+	seed   [24]byte
+	pubKey [65]byte
+}
+
+func (w *ecWorker) Next() (ECMatch, bool) {
+	for i := len(w.seed) - 1; i >= 0; i-- {
+		w.seed[i]++
+		if w.seed[i] != 0 {
+			break
+		}
+	}
+
+	h1 := sha256.Sum256(w.seed[:])
+	factorb := sha256.Sum256(h1[:])
+	var scalar btcec.ModNScalar
+	if scalar.SetBytes(&factorb) != 0 || scalar.IsZero() {
+		// ECMultiply rejects such a factorb; it occurs with probability 2^-127.
+		return ECMatch{}, false
+	}
+
+	var point, sum btcec.JacobianPoint
+	for i := 0; i < 32; i++ {
+		if d := factorb[31-i]; d != 0 {
+			btcec.AddNonConst(&point, &w.search.table[i][d-1], &sum)
+			point, sum = sum, point
+		}
+	}
+	point.ToAffine()
+
+	address := w.search.encode(btcutil.Hash160(serializePoint(w.pubKey[:0], &point, w.search.compressed)))
+	if !w.search.pattern.Match(address) {
+		return ECMatch{}, false
+	}
+	return ECMatch{Seed: append([]byte(nil), w.seed[:]...), Address: address}, true
+}
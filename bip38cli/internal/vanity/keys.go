@@ -0,0 +1,127 @@
+package vanity
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// KeyMatch is a private key whose address matches.
+type KeyMatch struct {
+	Key     []byte // 32-byte big-endian private key
+	Address string
+}
+
+// KeySearch looks for a private key whose address matches a pattern. Each
+// worker starts from a random key k and tries k+1, k+2, ..., so every
+// candidate's public key is the previous one plus the generator: one point
+// addition instead of a scalar multiplication.
+type KeySearch struct {
+	compressed bool
+	encode     Encoder
+	pattern    *Pattern
+}
+
+// NewKeySearch prepares a search for keys serialized compressed or not and
+// encoded into addresses by encode.
+func NewKeySearch(compressed bool, encode Encoder, pattern *Pattern) *KeySearch {
+	return &KeySearch{compressed: compressed, encode: encode, pattern: pattern}
+}
+
+// keyBatch is how many points a worker brings to affine form at once,
+// sharing one field inversion between them.
+const keyBatch = 256
+
+// Worker returns a worker starting from a random key.
+func (s *KeySearch) Worker() (Worker[KeyMatch], error) {
+	w := &keyWorker{search: s}
+	for {
+		var seed [32]byte
+		if _, err := rand.Read(seed[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		if w.start.SetBytes(&seed) == 0 && !w.start.IsZero() {
+			break
+		}
+	}
+	btcec.ScalarBaseMultNonConst(&w.start, &w.point)
+	w.point.ToAffine()
+
+	var one btcec.ModNScalar
+	one.SetInt(1)
+	btcec.ScalarBaseMultNonConst(&one, &w.generator)
+	w.generator.ToAffine()
+	w.next = keyBatch
+	return w, nil
+}
+
+type keyWorker struct {
+	search    *KeySearch
+	start     btcec.ModNScalar // key of the point before the first candidate
+	tried     uint64           // candidates handed out so far
+	point     btcec.JacobianPoint
+	generator btcec.JacobianPoint
+	batch     [keyBatch]btcec.JacobianPoint
+	products  [keyBatch]btcec.FieldVal
+	next      int
+	pubKey    [65]byte
+}
+
+func (w *keyWorker) Next() (KeyMatch, bool) {
+	if w.next == keyBatch {
+		w.fill()
+	}
+	point := &w.batch[w.next]
+	w.next++
+	w.tried++
+
+	address := w.search.encode(btcutil.Hash160(serializePoint(w.pubKey[:0], point, w.search.compressed)))
+	if !w.search.pattern.Match(address) {
+		return KeyMatch{}, false
+	}
+
+	var offset [32]byte
+	binary.BigEndian.PutUint64(offset[24:], w.tried)
+	var key btcec.ModNScalar
+	key.SetBytes(&offset)
+	key.Add(&w.start)
+	bytes := key.Bytes()
+	return KeyMatch{Key: bytes[:], Address: address}, true
+}
+
+// fill computes the next keyBatch points by adding the generator and brings
+// them to affine form with a single inversion (Montgomery's trick).
+func (w *keyWorker) fill() {
+	for i := range w.batch {
+		btcec.AddNonConst(&w.point, &w.generator, &w.batch[i])
+		w.point = w.batch[i]
+	}
+
+	// products[i] is the product of the first i+1 Z coordinates.
+	w.products[0] = w.batch[0].Z
+	for i := 1; i < keyBatch; i++ {
+		w.products[i].Mul2(&w.products[i-1], &w.batch[i].Z).Normalize()
+	}
+	var inv btcec.FieldVal
+	inv.Set(&w.products[keyBatch-1]).Inverse()
+
+	for i := keyBatch - 1; i >= 0; i-- {
+		var zInv, zInv2, zInv3 btcec.FieldVal
+		if i > 0 {
+			zInv.Mul2(&inv, &w.products[i-1]).Normalize()
+			inv.Mul(&w.batch[i].Z).Normalize()
+		} else {
+			zInv.Set(&inv)
+		}
+		zInv2.SquareVal(&zInv)
+		zInv3.Mul2(&zInv2, &zInv)
+		p := &w.batch[i]
+		p.X.Mul(&zInv2).Normalize()
+		p.Y.Mul(&zInv3).Normalize()
+		p.Z.SetInt(1)
+	}
+	w.next = 0
+}
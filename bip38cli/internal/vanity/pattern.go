@@ -0,0 +1,274 @@
+// Package vanity searches for keys whose address matches a pattern, and
+// estimates how long such a search takes.
+package vanity
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	bech32Charset  = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// maxCaseVariants bounds how many spellings of a case-insensitive Base58
+// prefix are counted for the estimate.
+const maxCaseVariants = 1 << 16
+
+// Spec is what the user asks for: an address prefix, suffix or both.
+type Spec struct {
+	Prefix string
+	Suffix string
+	// IgnoreCase matches Base58 letters in either case. Bech32 addresses
+	// are lowercase, so they are always matched without regard to case.
+	IgnoreCase bool
+}
+
+// Pattern is an address pattern together with the chance that a random
+// address matches it.
+type Pattern struct {
+	prefix      string
+	suffix      string
+	fold        bool
+	probability float64
+}
+
+// Base58 returns the pattern for Base58Check addresses with the given
+// version byte, such as P2PKH addresses. The prefix covers the whole
+// address, including the leading character set by the version.
+func Base58(version byte, spec Spec) (*Pattern, error) {
+	if spec.Prefix == "" && spec.Suffix == "" {
+		return nil, fmt.Errorf("prefix and suffix are both empty")
+	}
+	suffixForms := 1.0
+	for _, part := range []string{spec.Prefix, spec.Suffix} {
+		for _, c := range part {
+			forms := base58Forms(c, spec.IgnoreCase)
+			if len(forms) == 0 {
+				return nil, fmt.Errorf("%q contains %q, which is not in the Base58 alphabet (no 0, O, I or l)", part, c)
+			}
+		}
+	}
+	for _, c := range spec.Suffix {
+		suffixForms *= float64(len(base58Forms(c, spec.IgnoreCase)))
+	}
+
+	p := 1.0
+	if spec.Prefix != "" {
+		variants := []string{""}
+		for _, c := range spec.Prefix {
+			forms := base58Forms(c, spec.IgnoreCase)
+			if len(variants)*len(forms) > maxCaseVariants {
+				return nil, fmt.Errorf("prefix %q has too many case variants", spec.Prefix)
+			}
+			next := make([]string, 0, len(variants)*len(forms))
+			for _, v := range variants {
+				for _, f := range forms {
+					next = append(next, v+string(f))
+				}
+			}
+			variants = next
+		}
+		// Different spellings of the prefix match disjoint sets of addresses.
+		p = 0
+		for _, v := range variants {
+			p += base58PrefixProbability(version, v)
+		}
+		if p == 0 {
+			return nil, fmt.Errorf("no address with version %d can start with %q", version, spec.Prefix)
+		}
+	}
+	// The last characters come from the checksum, which is uniformly spread.
+	p *= suffixForms * math.Pow(58, -float64(len(spec.Suffix)))
+	return &Pattern{prefix: spec.Prefix, suffix: spec.Suffix, fold: spec.IgnoreCase, probability: p}, nil
+}
+
+// base58Forms returns the spellings of c in the Base58 alphabet.
+func base58Forms(c rune, ignoreCase bool) []rune {
+	candidates := []rune{c}
+	if ignoreCase {
+		candidates = []rune{unicode.ToUpper(c), unicode.ToLower(c)}
+		if candidates[0] == candidates[1] {
+			candidates = candidates[:1]
+		}
+	}
+	var forms []rune
+	for _, f := range candidates {
+		if strings.ContainsRune(base58Alphabet, f) {
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+// Bech32 returns the pattern for native segwit P2WPKH addresses with the
+// given human-readable part. The prefix covers the whole address, so it
+// starts with the part and "1q", such as bc1q.
+func Bech32(hrp string, spec Spec) (*Pattern, error) {
+	if spec.Prefix == "" && spec.Suffix == "" {
+		return nil, fmt.Errorf("prefix and suffix are both empty")
+	}
+	// A P2WPKH address is hrp, "1", the witness version "q", 32 characters
+	// of program and a 6-character checksum.
+	head := strings.ToLower(hrp) + "1q"
+	const body = 32 + 6
+
+	prefix, suffix := strings.ToLower(spec.Prefix), strings.ToLower(spec.Suffix)
+	data := prefix
+	if prefix != "" {
+		if !strings.HasPrefix(prefix, head) && !strings.HasPrefix(head, prefix) {
+			return nil, fmt.Errorf("P2WPKH addresses start with %s, so they cannot start with %q", head, spec.Prefix)
+		}
+		data = strings.TrimPrefix(prefix, head)
+		if len(prefix) < len(head) {
+			data = ""
+		}
+	}
+	for _, part := range []string{data, suffix} {
+		for _, c := range part {
+			if !strings.ContainsRune(bech32Charset, c) {
+				return nil, fmt.Errorf("%q contains %q, which is not in the bech32 character set (no 1, b, i or o)", part, c)
+			}
+		}
+	}
+	if len(data)+len(suffix) > body {
+		return nil, fmt.Errorf("P2WPKH addresses only have %d characters after %s", body, head)
+	}
+
+	p := math.Pow(32, -float64(len(data)+len(suffix)))
+	return &Pattern{prefix: prefix, suffix: suffix, fold: true, probability: p}, nil
+}
+
+// Match reports whether address matches the pattern.
+func (p *Pattern) Match(address string) bool {
+	if len(address) < len(p.prefix)+len(p.suffix) {
+		return false
+	}
+	head, tail := address[:len(p.prefix)], address[len(address)-len(p.suffix):]
+	if p.fold {
+		return strings.EqualFold(head, p.prefix) && strings.EqualFold(tail, p.suffix)
+	}
+	return head == p.prefix && tail == p.suffix
+}
+
+// Probability is the chance that one random key matches.
+func (p *Pattern) Probability() float64 {
+	return p.probability
+}
+
+// String describes the pattern, as in "starting with 1Abc and ending in xyz".
+func (p *Pattern) String() string {
+	var parts []string
+	if p.prefix != "" {
+		parts = append(parts, "starting with "+p.prefix)
+	}
+	if p.suffix != "" {
+		parts = append(parts, "ending in "+p.suffix)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// base58PrefixProbability returns the fraction of 25-byte Base58Check
+// payloads starting with version whose encoding starts with prefix. The 24
+// bytes after the version are taken as uniformly random, which the hash and
+// checksum make them.
+func base58PrefixProbability(version byte, prefix string) float64 {
+	const randomBits = 24 * 8
+
+	if version != 0 {
+		lo := new(big.Int).Lsh(big.NewInt(int64(version)), randomBits)
+		hi := new(big.Int).Lsh(big.NewInt(int64(version)+1), randomBits)
+		return ratio(base58Measure(lo, hi, prefix), new(big.Int).Lsh(big.NewInt(1), randomBits))
+	}
+
+	// A zero version byte encodes as a leading '1', and every further zero
+	// byte of the payload as another one; the remaining digits encode the
+	// payload as a number with no leading zeros.
+	if prefix[0] != '1' {
+		return 0
+	}
+	rest := prefix[1:]
+	ones := len(rest) - len(strings.TrimLeft(rest, "1"))
+	if ones > 24 {
+		return 0
+	}
+	total := new(big.Int).Lsh(big.NewInt(1), randomBits)
+	if ones == len(rest) {
+		// Only the run of ones is fixed: the first ones bytes are zero.
+		return math.Pow(256, -float64(ones))
+	}
+
+	// Exactly ones zero bytes, then a number whose digits start with the rest.
+	hi := new(big.Int).Lsh(big.NewInt(1), uint(8*(24-ones)))
+	lo := new(big.Int).Rsh(hi, 8)
+	return ratio(base58Measure(lo, hi, rest[ones:]), total)
+}
+
+// base58Measure counts the integers in [lo, hi) whose Base58 digits start
+// with digits, which must not start with the zero digit '1'.
+func base58Measure(lo, hi *big.Int, digits string) *big.Int {
+	if digits[0] == '1' {
+		return new(big.Int)
+	}
+	value := new(big.Int)
+	for _, c := range digits {
+		value.Mul(value, big.NewInt(58))
+		value.Add(value, big.NewInt(int64(strings.IndexRune(base58Alphabet, c))))
+	}
+
+	// A number with the digits as prefix lies in [value, value+1) * 58^k,
+	// where k is the number of digits that follow.
+	count := new(big.Int)
+	scale := big.NewInt(1)
+	for {
+		start := new(big.Int).Mul(value, scale)
+		if start.Cmp(hi) >= 0 {
+			return count
+		}
+		end := new(big.Int).Add(start, scale)
+		if start.Cmp(lo) < 0 {
+			start = lo
+		}
+		if end.Cmp(hi) > 0 {
+			end = hi
+		}
+		if end.Cmp(start) > 0 {
+			count.Add(count, end.Sub(end, start))
+		}
+		scale.Mul(scale, big.NewInt(58))
+	}
+}
+
+func ratio(count, total *big.Int) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(count), new(big.Float).SetInt(total)).Float64()
+	return f
+}
+
+// Estimate is the expected cost of finding a match with probability p per
+// key.
+type Estimate struct {
+	Probability float64
+}
+
+// Difficulty is the expected number of keys to try.
+func (e Estimate) Difficulty() float64 {
+	return 1 / e.Probability
+}
+
+// Tries is the number of keys after which a match has been found with the
+// given confidence, such as 0.5 or 0.9.
+func (e Estimate) Tries(confidence float64) float64 {
+	return math.Log1p(-confidence) / math.Log1p(-e.Probability)
+}
+
+// Seconds is Tries at rate keys per second.
+func (e Estimate) Seconds(confidence, rate float64) float64 {
+	if rate <= 0 {
+		return math.Inf(1)
+	}
+	return e.Tries(confidence) / rate
+}
@@ -0,0 +1,137 @@
+package vanity
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Worker tries keys one at a time. Next checks the next candidate and
+// returns the match when there is one. A Worker is used by one goroutine.
+type Worker[T any] interface {
+	Next() (T, bool)
+}
+
+// Stats describes a search in progress or finished.
+type Stats struct {
+	Tried   uint64
+	Elapsed time.Duration
+}
+
+// Rate is the number of keys tried per second.
+func (s Stats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Tried) / s.Elapsed.Seconds()
+}
+
+// Options configures Search.
+type Options struct {
+	// Workers is the number of goroutines, each with its own Worker.
+	Workers int
+	// Progress, when set, is called every Interval while the search runs.
+	Progress func(Stats)
+	// Interval defaults to five seconds.
+	Interval time.Duration
+}
+
+// flushEvery is how many keys a worker tries between updates of the shared
+// counter and checks for cancellation.
+const flushEvery = 256
+
+// Search runs workers until one finds a match or ctx is done, in which case
+// the context's error is returned.
+func Search[T any](ctx context.Context, opts Options, newWorker func() (Worker[T], error)) (T, Stats, error) { //nolint:gocyclo
+	var zero T
+	workers := max(opts.Workers, 1)
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	pool := make([]Worker[T], workers)
+	for i := range pool {
+		w, err := newWorker()
+		if err != nil {
+			return zero, Stats{}, err
+		}
+		pool[i] = w
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := time.Now()
+	var tried atomic.Uint64
+	found := make(chan T, 1)
+	var wg sync.WaitGroup
+	for _, w := range pool {
+		wg.Add(1)
+		go func(w Worker[T]) {
+			defer wg.Done()
+			for {
+				for i := 0; i < flushEvery; i++ {
+					if match, ok := w.Next(); ok {
+						tried.Add(uint64(i + 1))
+						select {
+						case found <- match:
+							cancel()
+						default:
+						}
+						return
+					}
+				}
+				tried.Add(flushEvery)
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	stats := func() Stats {
+		return Stats{Tried: tried.Load(), Elapsed: time.Since(started)}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			select {
+			case match := <-found:
+				return match, stats(), nil
+			default:
+				return zero, stats(), context.Cause(ctx)
+			}
+		case <-ticker.C:
+			if opts.Progress != nil {
+				opts.Progress(stats())
+			}
+		}
+	}
+}
+
+// Measure runs one worker for about d and returns the keys it tried per
+// second, for estimates made before a search starts.
+func Measure[T any](newWorker func() (Worker[T], error), d time.Duration) (float64, error) {
+	w, err := newWorker()
+	if err != nil {
+		return 0, err
+	}
+	started := time.Now()
+	tried := 0
+	for time.Since(started) < d {
+		for i := 0; i < flushEvery; i++ {
+			w.Next()
+		}
+		tried += flushEvery
+	}
+	return Stats{Tried: uint64(tried), Elapsed: time.Since(started)}.Rate(), nil
+}
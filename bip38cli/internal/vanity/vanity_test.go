@@ -0,0 +1,307 @@
+package vanity
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+func TestBase58PrefixProbability(t *testing.T) {
+	// Count matches among random payloads; the computed probability must
+	// agree within a few standard deviations.
+	rng := rand.New(rand.NewSource(1))
+	const samples = 200000
+	payloads := make([]string, samples)
+	testnet := make([]string, samples)
+	for i := range payloads {
+		hash := make([]byte, 20)
+		rng.Read(hash)
+		payloads[i] = base58.CheckEncode(hash, 0x00)
+		testnet[i] = base58.CheckEncode(hash, 0x6f)
+	}
+
+	tests := []struct {
+		version  byte
+		prefix   string
+		addrs    []string // samples to count matches in, nil for too rare a pattern
+		estimate float64  // exact probability, 0 to only compare with the count
+	}{
+		{0x00, "1", payloads, 1},
+		{0x00, "1A", payloads, 0},
+		{0x00, "1z", payloads, 0},
+		{0x00, "1Bc", payloads, 0},
+		{0x00, "11", nil, 1.0 / 256},
+		{0x00, "111", nil, 1.0 / 65536},
+		{0x6f, "m", testnet, 0},
+		{0x6f, "n", testnet, 0},
+		{0x6f, "mz", testnet, 0},
+	}
+	for _, tt := range tests {
+		pattern, err := Base58(tt.version, Spec{Prefix: tt.prefix})
+		if err != nil {
+			t.Fatalf("Base58(%d, Spec{Prefix: %q}): %v", tt.version, tt.prefix, err)
+		}
+		if tt.estimate != 0 && math.Abs(pattern.Probability()-tt.estimate) > 1e-12 {
+			t.Fatalf("%q: probability %g, want %g", tt.prefix, pattern.Probability(), tt.estimate)
+		}
+		if tt.addrs == nil {
+			continue
+		}
+		matches := 0
+		for _, addr := range tt.addrs {
+			if pattern.Match(addr) {
+				matches++
+			}
+		}
+		p := pattern.Probability()
+		if sigma := math.Sqrt(samples * p * (1 - p)); math.Abs(float64(matches)-samples*p) > 5*sigma+1 {
+			t.Fatalf("%q: %d of %d matched, probability %g predicts %.0f", tt.prefix, matches, samples, p, samples*p)
+		}
+	}
+
+	m, _ := Base58(0x6f, Spec{Prefix: "m"})
+	n, _ := Base58(0x6f, Spec{Prefix: "n"})
+	if math.Abs(m.Probability()+n.Probability()-1) > 1e-9 {
+		t.Fatalf("testnet m and n cover %g of addresses", m.Probability()+n.Probability())
+	}
+
+	for _, prefix := range []string{"", "2abc", "1O", "mzz"} {
+		if _, err := Base58(0x00, Spec{Prefix: prefix}); err == nil {
+			t.Fatalf("Base58 accepted %q for mainnet", prefix)
+		}
+	}
+	if _, err := Base58(0x6f, Spec{Prefix: "mA"}); err == nil {
+		t.Fatal("Base58 accepted mA for testnet, whose addresses start at mf")
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	e := Estimate{Probability: 1e-6}
+	if e.Difficulty() != 1e6 {
+		t.Fatalf("Difficulty = %g", e.Difficulty())
+	}
+	if got := e.Tries(0.5); math.Abs(got-math.Ln2*1e6) > 1 {
+		t.Fatalf("Tries(0.5) = %g", got)
+	}
+	if got := e.Seconds(0.5, 1e3); math.Abs(got-math.Ln2*1e3) > 1e-3 {
+		t.Fatalf("Seconds(0.5, 1000) = %g", got)
+	}
+}
+
+// Intermediate code for "MOLON LABE" with lot 263183, sequence 1.
+const testIntermediate = "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvuR1hy25aTu5sX"
+
+func TestECMultiplySearchMatchesECMultiply(t *testing.T) {
+	code, err := bip38.ParseIntermediateCode(testIntermediate)
+	if err != nil {
+		t.Fatalf("ParseIntermediateCode: %v", err)
+	}
+	for _, compressed := range []bool{true, false} {
+		// "1" matches every mainnet address, so every candidate is returned.
+		anything, _ := Base58(0x00, Spec{Prefix: "1"})
+		search, err := NewECMultiplySearch(code.PassPoint, compressed, P2PKH(chaincfg.MainNetParams.PubKeyHashAddrID), anything)
+		if err != nil {
+			t.Fatalf("NewECMultiplySearch: %v", err)
+		}
+		w, err := search.Worker()
+		if err != nil {
+			t.Fatalf("Worker: %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			match, ok := w.Next()
+			if !ok {
+				t.Fatal("worker skipped a candidate")
+			}
+			minted, err := bip38.ECMultiply(bip38.ECMultiplyOptions{IntermediateCode: testIntermediate, Compressed: compressed, Seed: match.Seed})
+			if err != nil {
+				t.Fatalf("ECMultiply: %v", err)
+			}
+			if minted.Address != match.Address {
+				t.Fatalf("compressed=%t: search found %s, ECMultiply mints %s", compressed, match.Address, minted.Address)
+			}
+		}
+	}
+}
+
+func TestSearchFindsPrefix(t *testing.T) {
+	code, _ := bip38.ParseIntermediateCode(testIntermediate)
+	pattern, err := Base58(0x6f, Spec{Prefix: "mz"})
+	if err != nil {
+		t.Fatalf("Base58: %v", err)
+	}
+	search, err := NewECMultiplySearch(code.PassPoint, true, P2PKH(chaincfg.TestNet3Params.PubKeyHashAddrID), pattern)
+	if err != nil {
+		t.Fatalf("NewECMultiplySearch: %v", err)
+	}
+
+	match, stats, err := Search(context.Background(), Options{Workers: 4}, search.Worker)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if !strings.HasPrefix(match.Address, "mz") || stats.Tried == 0 {
+		t.Fatalf("Search = %s after %d tries", match.Address, stats.Tried)
+	}
+	minted, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: testIntermediate, Compressed: true, Network: &chaincfg.TestNet3Params, Seed: match.Seed,
+	})
+	if err != nil || minted.Address != match.Address {
+		t.Fatalf("ECMultiply from the found seed: %v, %v", minted, err)
+	}
+}
+
+type neverWorker struct{}
+
+func (neverWorker) Next() (int, bool) { return 0, false }
+
+func TestSearchStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	progress := 0
+	_, stats, err := Search(ctx, Options{Workers: 2, Interval: 10 * time.Millisecond, Progress: func(Stats) { progress++ }},
+		func() (Worker[int], error) { return neverWorker{}, nil })
+	if err != context.DeadlineExceeded || stats.Tried == 0 || progress == 0 {
+		t.Fatalf("Search = %v after %d tries and %d progress calls", err, stats.Tried, progress)
+	}
+
+	rate, err := Measure(func() (Worker[int], error) { return neverWorker{}, nil }, 10*time.Millisecond)
+	if err != nil || rate <= 0 {
+		t.Fatalf("Measure = %g, %v", rate, err)
+	}
+}
+
+func TestKeySearchMatchesKeys(t *testing.T) {
+	anything := &Pattern{probability: 1}
+	encoders := map[string]func(*btcutil.WIF) (string, error){
+		"bip44": func(wif *btcutil.WIF) (string, error) {
+			addr, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), &chaincfg.MainNetParams)
+			if err != nil {
+				return "", err
+			}
+			return addr.EncodeAddress(), nil
+		},
+		"bip84": func(wif *btcutil.WIF) (string, error) {
+			addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), &chaincfg.MainNetParams)
+			if err != nil {
+				return "", err
+			}
+			return addr.EncodeAddress(), nil
+		},
+	}
+	searches := []struct {
+		name       string
+		compressed bool
+		search     *KeySearch
+	}{
+		{"bip44", false, NewKeySearch(false, P2PKH(chaincfg.MainNetParams.PubKeyHashAddrID), anything)},
+		{"bip44", true, NewKeySearch(true, P2PKH(chaincfg.MainNetParams.PubKeyHashAddrID), anything)},
+		{"bip84", true, NewKeySearch(true, P2WPKH(&chaincfg.MainNetParams), anything)},
+	}
+	for _, tt := range searches {
+		w, err := tt.search.Worker()
+		if err != nil {
+			t.Fatalf("Worker: %v", err)
+		}
+		var previous []byte
+		// Cross a batch boundary and check a sample of keys on either side.
+		for i := 0; i < keyBatch+10; i++ {
+			match, ok := w.Next()
+			if !ok {
+				t.Fatal("worker skipped a candidate")
+			}
+			if previous != nil {
+				var a, b big.Int
+				a.SetBytes(previous)
+				b.SetBytes(match.Key)
+				if b.Sub(&b, &a).Int64() != 1 {
+					t.Fatalf("%s: candidate %d is not the previous key plus one", tt.name, i)
+				}
+			}
+			previous = match.Key
+			if i%37 != 0 && i != keyBatch-1 && i != keyBatch {
+				continue
+			}
+			priv, _ := btcec.PrivKeyFromBytes(match.Key)
+			wif, err := btcutil.NewWIF(priv, &chaincfg.MainNetParams, tt.compressed)
+			if err != nil {
+				t.Fatalf("NewWIF: %v", err)
+			}
+			want, err := encoders[tt.name](wif)
+			if err != nil || match.Address != want {
+				t.Fatalf("%s compressed=%t candidate %d: address %s, key gives %s (%v)", tt.name, tt.compressed, i, match.Address, want, err)
+			}
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern func() (*Pattern, error)
+		matches []string
+		misses  []string
+		p       float64 // 0 to skip the check
+	}{
+		{"base58 suffix", func() (*Pattern, error) { return Base58(0, Spec{Suffix: "xY"}) },
+			[]string{"1Jscj8ALrYu2y9TD8NrpvDBugPedmbjxY"}, []string{"1Jscj8ALrYu2y9TD8NrpvDBugPedmbjxy"}, 1.0 / (58 * 58)},
+		{"base58 any case", func() (*Pattern, error) { return Base58(0, Spec{Prefix: "1ab", Suffix: "Lo", IgnoreCase: true}) },
+			[]string{"1ABcj8ALrYu2y9TD8NrpvDBugPedmbjLo", "1aBcj8ALrYu2y9TD8NrpvDBugPedmbjLo"}, []string{"1Acj8ALrYu2y9TD8NrpvDBugPedmbjLo"}, 0},
+		{"bech32 prefix", func() (*Pattern, error) { return Bech32("bc", Spec{Prefix: "BC1QACV"}) },
+			[]string{"bc1qacvtm2hdz8xqlt0h4rhuc8f7dg6ptm59vwxmcw"}, []string{"bc1qxyzm2hdz8xqlt0h4rhuc8f7dg6ptm59vwxmcw"}, 0},
+		{"bech32 prefix and suffix", func() (*Pattern, error) { return Bech32("bc", Spec{Prefix: "bc1qa", Suffix: "mcw"}) },
+			[]string{"bc1qacvtm2hdz8xqlt0h4rhuc8f7dg6ptm59vwxmcw"}, []string{"bc1qacvtm2hdz8xqlt0h4rhuc8f7dg6ptm59vwxmca"}, 1.0 / (32 * 32 * 32 * 32)},
+		{"bech32 suffix only", func() (*Pattern, error) { return Bech32("tb", Spec{Suffix: "q"}) },
+			[]string{"tb1qacvtm2hdz8xqlt0h4rhuc8f7dg6ptm59vwxmcq"}, nil, 1.0 / 32},
+	}
+	for _, tt := range tests {
+		pattern, err := tt.pattern()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, addr := range tt.matches {
+			if !pattern.Match(addr) {
+				t.Fatalf("%s: %s does not match", tt.name, addr)
+			}
+		}
+		for _, addr := range tt.misses {
+			if pattern.Match(addr) {
+				t.Fatalf("%s: %s matches", tt.name, addr)
+			}
+		}
+		if tt.p != 0 && math.Abs(pattern.Probability()-tt.p)/tt.p > 1e-9 {
+			t.Fatalf("%s: probability %g, want %g", tt.name, pattern.Probability(), tt.p)
+		}
+	}
+
+	// Case-insensitive 1ab covers 1ab, 1aB, 1Ab and 1AB.
+	folded, _ := Base58(0, Spec{Prefix: "1ab", IgnoreCase: true})
+	sum := 0.0
+	for _, v := range []string{"1ab", "1aB", "1Ab", "1AB"} {
+		exact, _ := Base58(0, Spec{Prefix: v})
+		sum += exact.Probability()
+	}
+	if math.Abs(folded.Probability()-sum) > 1e-15 {
+		t.Fatalf("case-insensitive probability %g, want %g", folded.Probability(), sum)
+	}
+
+	for name, bad := range map[string]func() (*Pattern, error){
+		"base58 empty":      func() (*Pattern, error) { return Base58(0, Spec{}) },
+		"base58 bad suffix": func() (*Pattern, error) { return Base58(0, Spec{Suffix: "0"}) },
+		"bech32 wrong head": func() (*Pattern, error) { return Bech32("bc", Spec{Prefix: "tb1q"}) },
+		"bech32 bad char":   func() (*Pattern, error) { return Bech32("bc", Spec{Prefix: "bc1qb"}) },
+		"bech32 too long":   func() (*Pattern, error) { return Bech32("bc", Spec{Suffix: strings.Repeat("q", 39)}) },
+	} {
+		if _, err := bad(); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+}
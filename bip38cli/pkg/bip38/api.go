@@ -0,0 +1,298 @@
+package bip38
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// EncryptOptions configures Encrypt.
+type EncryptOptions struct {
+	// WIF is the private key to protect. Its network decides the address hash.
+	WIF *btcutil.WIF
+	// Passphrase is NFC-normalized before key derivation. The caller owns the buffer.
+	Passphrase []byte
+	// Compressed overrides the compression flag carried by WIF when not nil.
+	Compressed *bool
+	// Network selects the address the key commits to when several registered
+	// networks share the WIF version. It must agree with the WIF.
+	Network *chaincfg.Params
+}
+
+// EncryptResult is returned by Encrypt.
+type EncryptResult struct {
+	EncryptedKey string           // BIP38 encrypted key (6P...)
+	Address      string           // P2PKH address committed to by the address hash
+	Compressed   bool             // Whether the public key is serialized compressed
+	Network      *chaincfg.Params // Network of the source WIF
+}
+
+// DecryptOptions configures Decrypt.
+type DecryptOptions struct {
+	// EncryptedKey is the 6P... string to decrypt.
+	EncryptedKey string
+	// Passphrase is NFC-normalized before key derivation. The caller owns the buffer.
+	Passphrase []byte
+	// Network selects the network of the returned WIF. When nil the network is
+	// detected from the address hash, which can match several networks.
+	Network *chaincfg.Params
+	// Cache, when set, shares EC-multiply passfactors between calls so keys
+	// from one intermediate code skip the expensive scrypt step.
+	Cache *PassfactorCache
+}
+
+// DecryptResult is returned by Decrypt.
+type DecryptResult struct {
+	WIF        *btcutil.WIF     // Decrypted private key
+	Address    string           // P2PKH address matching the embedded address hash
+	Compressed bool             // Whether the public key is serialized compressed
+	ECMultiply bool             // Whether the key used the EC-multiply scheme
+	Network    *chaincfg.Params // Selected network, nil when several candidates match
+	// Candidates lists every network whose address matched the address hash.
+	// Testnet3, regtest and signet share address versions, so more than one is common.
+	Candidates []*chaincfg.Params
+}
+
+// Ambiguous reports whether the network could not be told apart from the key alone.
+func (r *DecryptResult) Ambiguous() bool {
+	return r.Network == nil
+}
+
+// IntermediateOptions configures GenerateIntermediate.
+type IntermediateOptions struct {
+	// Passphrase is NFC-normalized before key derivation. The caller owns the buffer.
+	Passphrase []byte
+	// LotNumber and SequenceNumber are embedded only when both are set.
+	LotNumber      *uint32
+	SequenceNumber *uint32
+}
+
+// ECMultiplyOptions configures ECMultiply.
+type ECMultiplyOptions struct {
+	// IntermediateCode is the passphrase code handed over by the owner.
+	IntermediateCode string
+	// Compressed selects the public key serialization of the generated key.
+	Compressed bool
+	// Network selects the address the key commits to. Defaults to mainnet.
+	Network *chaincfg.Params
+	// Seed, when set, is the 24-byte seedb to mint from instead of a random
+	// one, such as a seed found by a vanity search. Reusing a seed with the
+	// same intermediate code yields the same key.
+	Seed []byte
+}
+
+// ConfirmOptions configures Confirm.
+type ConfirmOptions struct {
+	// ConfirmationCode is the cfrm38... string produced alongside an EC-multiply key.
+	ConfirmationCode string
+	// Passphrase is NFC-normalized before key derivation. The caller owns the buffer.
+	Passphrase []byte
+	// Network restricts the check to one network. When nil every supported network is tried.
+	Network *chaincfg.Params
+	// Cache, when set, shares passfactors with other Confirm and Decrypt calls.
+	Cache *PassfactorCache
+}
+
+// Encrypt protects a private key with a passphrase using the non EC-multiply scheme.
+func Encrypt(opts EncryptOptions) (result *EncryptResult, err error) {
+	defer func(started time.Time) {
+		emit("encrypt", started, err, func(e *Event) {
+			if result != nil {
+				e.Labels = keyLabels(result.Network, false, result.Compressed)
+				e.Fingerprint = result.Address
+				return
+			}
+			e.Labels = networkLabels(opts.Network)
+		})
+	}(time.Now())
+
+	if opts.WIF == nil {
+		return nil, errors.New("private key is required")
+	}
+
+	wif := opts.WIF
+	if opts.Compressed != nil && *opts.Compressed != wif.CompressPubKey {
+		copied := *wif
+		copied.CompressPubKey = *opts.Compressed
+		wif = &copied
+	}
+
+	netParams := opts.Network
+	if netParams == nil {
+		detected, err := NetworkFromWIF(wif)
+		if err != nil {
+			return nil, err
+		}
+		netParams = detected
+	} else if !wif.IsForNet(netParams) {
+		return nil, fmt.Errorf("private key is not for network %s", netParams.Name)
+	}
+
+	encrypted, err := encryptKey(wif, opts.Passphrase, netParams)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := p2pkhAddress(wif, netParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptResult{
+		EncryptedKey: encrypted,
+		Address:      address,
+		Compressed:   wif.CompressPubKey,
+		Network:      netParams,
+	}, nil
+}
+
+// Decrypt recovers the private key protected by a BIP38 encrypted key.
+// Both the non EC-multiply and EC-multiply forms are handled.
+// When the network is ambiguous the WIF is encoded for the first candidate.
+func Decrypt(opts DecryptOptions) (result *DecryptResult, err error) {
+	defer func(started time.Time) {
+		emit("decrypt", started, err, func(e *Event) {
+			if result != nil {
+				e.Labels = keyLabels(result.Network, result.ECMultiply, result.Compressed)
+				e.Fingerprint = result.Address
+				return
+			}
+			describeEncryptedKey(e, opts.EncryptedKey, opts.Network)
+		})
+	}(time.Now())
+
+	key, err := decrypt(opts.EncryptedKey, opts.Passphrase, candidateNetworks(opts.Network), opts.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectNetwork(opts.Network, key.networks)
+	if err != nil {
+		return nil, err
+	}
+
+	encodeFor := selected
+	if encodeFor == nil {
+		encodeFor = key.networks[0]
+	}
+
+	wif, err := key.wif(encodeFor)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := p2pkhAddress(wif, encodeFor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DecryptResult{
+		WIF:        wif,
+		Address:    address,
+		Compressed: key.compressed,
+		ECMultiply: key.ecMultiply,
+		Network:    selected,
+		Candidates: key.networks,
+	}, nil
+}
+
+// GenerateIntermediate creates an intermediate passphrase code and returns it parsed.
+func GenerateIntermediate(opts IntermediateOptions) (result *IntermediateCode, err error) {
+	defer func(started time.Time) {
+		emit("intermediate", started, err, func(*Event) {})
+	}(time.Now())
+
+	code, err := GenerateIntermediateCode(opts.Passphrase, opts.LotNumber, opts.SequenceNumber)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIntermediateCode(code)
+}
+
+// ECMultiply creates an EC-multiply encrypted key from an intermediate code
+// without knowledge of the passphrase.
+func ECMultiply(opts ECMultiplyOptions) (result *ECMultiplyResult, err error) {
+	netParams := opts.Network
+	if netParams == nil {
+		netParams = &chaincfg.MainNetParams
+	}
+	defer func(started time.Time) {
+		emit("encrypt", started, err, func(e *Event) {
+			e.Labels = keyLabels(netParams, true, opts.Compressed)
+			if result != nil {
+				e.Fingerprint = result.Address
+			}
+		})
+	}(time.Now())
+
+	return ecMultiplyEncrypt(opts.IntermediateCode, opts.Seed, opts.Compressed, netParams)
+}
+
+// Confirm checks a confirmation code against the passphrase and returns the
+// address the matching encrypted key decrypts to.
+func Confirm(opts ConfirmOptions) (result *ConfirmationResult, err error) {
+	defer func(started time.Time) {
+		emit("confirm", started, err, func(e *Event) {
+			if result != nil {
+				e.Labels = keyLabels(result.Network, true, result.Compressed)
+				e.Fingerprint = result.Address
+				return
+			}
+			describeConfirmationCode(e, opts.ConfirmationCode, opts.Network)
+		})
+	}(time.Now())
+
+	confirmation, err := verifyConfirmationCode(opts.ConfirmationCode, opts.Passphrase, candidateNetworks(opts.Network), opts.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Network != nil {
+		if _, err := selectNetwork(opts.Network, confirmation.Candidates); err != nil {
+			return nil, err
+		}
+		confirmation.Network = opts.Network
+	}
+	return confirmation, nil
+}
+
+// selectNetwork picks the explicit network when it matched, the only match
+// otherwise, and nil when several candidates remain.
+func selectNetwork(explicit *chaincfg.Params, matched []*chaincfg.Params) (*chaincfg.Params, error) {
+	if explicit != nil {
+		for _, params := range matched {
+			if params == explicit {
+				return explicit, nil
+			}
+		}
+		names := make([]string, 0, len(matched))
+		for _, params := range matched {
+			names = append(names, params.Name)
+		}
+		return nil, fmt.Errorf("key does not belong to network %s (matches: %s)", explicit.Name, strings.Join(names, ", "))
+	}
+	if len(matched) == 1 {
+		return matched[0], nil
+	}
+	return nil, nil
+}
+
+func p2pkhAddress(wif *btcutil.WIF, netParams *chaincfg.Params) (string, error) {
+	pubKey := wif.PrivKey.PubKey()
+	var pubKeyBytes []byte
+	if wif.CompressPubKey {
+		pubKeyBytes = pubKey.SerializeCompressed()
+	} else {
+		pubKeyBytes = pubKey.SerializeUncompressed()
+	}
+
+	addressPubKey, err := btcutil.NewAddressPubKey(pubKeyBytes, netParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to create address: %w", err)
+	}
+	return addressPubKey.EncodeAddress(), nil
+}
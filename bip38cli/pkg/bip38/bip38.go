@@ -1,4 +1,9 @@
 // Package bip38 implements the BIP38 standard for encryption and decryption of Bitcoin private keys.
+//
+// The option-based entry points (Encrypt, Decrypt, GenerateIntermediate, ECMultiply
+// and Confirm) form the supported API for embedders and return typed results.
+// The lower level helpers such as EncryptKey and DecryptKey remain available.
+// Embedders can observe the option-based calls and GenerateWIF with AddSink.
 package bip38
 
 import (
@@ -9,7 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
@@ -27,42 +33,32 @@ const (
 	bip38TypeEC = 0x43
 )
 
-var (
-	// Regex used to check BIP38 string look correct
-	bip38Regex = regexp.MustCompile(`^6P[123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{56}$`)
+// Scrypt parameters BIP38 derives keys from passphrases with. Every
+// passphrase guess against an encrypted key costs one such derivation.
+const (
+	ScryptN = 16384
+	ScryptR = 8
+	ScryptP = 8
+)
 
-	supportedNetworks = []*chaincfg.Params{
-		&chaincfg.MainNetParams,
-		&chaincfg.TestNet3Params,
-		&chaincfg.RegressionNetParams,
-		&chaincfg.SimNetParams,
-		&chaincfg.SigNetParams,
-	}
+// ErrIncorrectPassphrase is returned when a passphrase does not decrypt a key
+// or does not match a confirmation code.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
 
-	networkAliases = map[string]*chaincfg.Params{
-		"main":       &chaincfg.MainNetParams,
-		"mainnet":    &chaincfg.MainNetParams,
-		"bitcoin":    &chaincfg.MainNetParams,
-		"livenet":    &chaincfg.MainNetParams,
-		"prod":       &chaincfg.MainNetParams,
-		"production": &chaincfg.MainNetParams,
+// ErrInvalidFormat matches, with errors.Is, the errors for an encrypted key,
+// intermediate code or confirmation code that does not decode.
+var ErrInvalidFormat = errors.New("invalid format")
 
-		"test":     &chaincfg.TestNet3Params,
-		"testnet":  &chaincfg.TestNet3Params,
-		"testnet3": &chaincfg.TestNet3Params,
-		"tn3":      &chaincfg.TestNet3Params,
+// formatError is a decoding failure. It keeps its own message and matches
+// ErrInvalidFormat.
+type formatError string
 
-		"regtest":       &chaincfg.RegressionNetParams,
-		"regression":    &chaincfg.RegressionNetParams,
-		"regressionnet": &chaincfg.RegressionNetParams,
+func (e formatError) Error() string { return string(e) }
 
-		"simnet": &chaincfg.SimNetParams,
-		"sim":    &chaincfg.SimNetParams,
+func (e formatError) Is(target error) bool { return target == ErrInvalidFormat }
 
-		"signet": &chaincfg.SigNetParams,
-		"sig":    &chaincfg.SigNetParams,
-	}
-)
+// Regex used to check BIP38 string look correct
+var bip38Regex = regexp.MustCompile(`^6P[123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]{56}$`)
 
 // EncryptedKey represents a BIP38 encrypted private key record with its properties.
 type EncryptedKey struct {
@@ -71,32 +67,47 @@ type EncryptedKey struct {
 	ECMultiply bool   // Whether EC multiplication mode was used
 }
 
-// NetworkFromName resolves a user-provided network identifier to the matching chain parameters.
-func NetworkFromName(name string) (*chaincfg.Params, error) {
-	normalized := strings.ToLower(strings.TrimSpace(name))
-	if normalized == "" {
-		return nil, errors.New("network name is required")
+// GenerateWIF creates a fresh private key for the provided network and encodes it as WIF.
+func GenerateWIF(params *chaincfg.Params, compressed bool) (wif *btcutil.WIF, err error) {
+	defer func(started time.Time) { emitGenerateWIF(started, params, compressed, wif, err) }(time.Now())
+
+	if params == nil {
+		return nil, errors.New("network parameters are required")
 	}
 
-	if params, ok := networkAliases[normalized]; ok {
-		return params, nil
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
 	}
 
-	return nil, fmt.Errorf("unsupported network: %s", name)
+	wif, err = btcutil.NewWIF(privKey, params, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode WIF: %v", err)
+	}
+
+	return wif, nil
 }
 
-// GenerateWIF creates a fresh private key for the provided network and encodes it as WIF.
-func GenerateWIF(params *chaincfg.Params, compressed bool) (*btcutil.WIF, error) {
+// WIFFromKey encodes a private key generated outside this package, such as
+// one found by a vanity search, as WIF. It reports the key as generated, like
+// GenerateWIF, so callers do not bypass the event sinks.
+func WIFFromKey(key []byte, params *chaincfg.Params, compressed bool) (wif *btcutil.WIF, err error) {
+	defer func(started time.Time) { emitGenerateWIF(started, params, compressed, wif, err) }(time.Now())
+
 	if params == nil {
 		return nil, errors.New("network parameters are required")
 	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("private key must be 32 bytes, got %d", len(key))
+	}
 
-	privKey, err := btcec.NewPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	var scalar btcec.ModNScalar
+	if overflow := scalar.SetByteSlice(key); overflow || scalar.IsZero() {
+		return nil, errors.New("private key is out of range")
 	}
 
-	wif, err := btcutil.NewWIF(privKey, params, compressed)
+	privKey, _ := btcec.PrivKeyFromBytes(key)
+	wif, err = btcutil.NewWIF(privKey, params, compressed)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode WIF: %v", err)
 	}
@@ -104,6 +115,22 @@ func GenerateWIF(params *chaincfg.Params, compressed bool) (*btcutil.WIF, error)
 	return wif, nil
 }
 
+// emitGenerateWIF reports a generate_wif operation, fingerprinted by the
+// key's address.
+func emitGenerateWIF(started time.Time, params *chaincfg.Params, compressed bool, wif *btcutil.WIF, err error) {
+	emit("generate_wif", started, err, func(e *Event) {
+		e.Labels = map[string]string{"compressed": strconv.FormatBool(compressed)}
+		if params != nil {
+			e.Labels["network"] = params.Name
+		}
+		if wif != nil {
+			if address, addrErr := btcutil.NewAddressPubKey(wif.SerializePubKey(), params); addrErr == nil {
+				e.Fingerprint = address.EncodeAddress()
+			}
+		}
+	})
+}
+
 // IsBIP38Format checks if the given string matches the BIP38 format pattern.
 // Returns true if the string appears to be a valid BIP38 encrypted key.
 func IsBIP38Format(key string) bool {
@@ -112,54 +139,64 @@ func IsBIP38Format(key string) bool {
 
 // DecryptKey decrypts a BIP38 encrypted private key using the given passphrase.
 // Returns the decrypted WIF (Wallet Import Format) private key or an error if decryption fails.
+// When several networks share the key's address version the first supported one is used;
+// call Decrypt to see every candidate or to pick a network explicitly.
 func DecryptKey(encryptedKey string, passphrase []byte) (*btcutil.WIF, error) {
-	passphrase = normalizePassphrase(passphrase)
-
-	if !IsBIP38Format(encryptedKey) {
-		return nil, errors.New("invalid BIP38 format")
+	key, err := decrypt(encryptedKey, passphrase, DefaultNetworks.Networks(), nil)
+	if err != nil {
+		return nil, err
 	}
+	return key.wif(key.networks[0])
+}
 
-	decoded := base58.Decode(encryptedKey)
-	if len(decoded) != 43 {
-		return nil, errors.New("invalid encrypted key length")
-	}
+// decryptedKey is the outcome of a decryption before a network has been chosen.
+type decryptedKey struct {
+	privKey    *btcec.PrivateKey
+	compressed bool
+	ecMultiply bool
+	address    string             // P2PKH address for networks[0]
+	networks   []*chaincfg.Params // every candidate whose address matches the address hash
+}
 
-	if decoded[0] != bip38Magic {
-		return nil, errors.New("invalid magic byte")
+func (k *decryptedKey) wif(params *chaincfg.Params) (*btcutil.WIF, error) {
+	wif, err := btcutil.NewWIF(k.privKey, params, k.compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WIF: %w", err)
 	}
+	return wif, nil
+}
 
-	payload := decoded[:39]
-	checksum := decoded[39:]
-	hash := sha256.Sum256(payload)
-	hash2 := sha256.Sum256(hash[:])
+func decrypt(encryptedKey string, passphrase []byte, candidates []*chaincfg.Params, cache *PassfactorCache) (*decryptedKey, error) {
+	passphrase = normalizePassphrase(passphrase)
 
-	if !constantTimeEqual(hash2[:4], checksum) {
-		return nil, errors.New("invalid checksum")
+	decoded, err := decodeEncryptedKey(encryptedKey)
+	if err != nil {
+		return nil, err
 	}
 
 	switch decoded[1] {
 	case bip38Type:
-		return decryptNonEC(decoded, passphrase)
+		return decryptNonEC(decoded, passphrase, candidates)
 	case bip38TypeEC:
-		return decryptECMultiply(decoded, passphrase)
+		return decryptECMultiply(decoded, passphrase, candidates, cache)
 	default:
-		return nil, errors.New("unsupported BIP38 type")
+		return nil, formatError("unsupported BIP38 type")
 	}
 }
 
-func decryptNonEC(decoded []byte, passphrase []byte) (*btcutil.WIF, error) {
+func decryptNonEC(decoded []byte, passphrase []byte, candidates []*chaincfg.Params) (*decryptedKey, error) {
 	compressed := false
 	if decoded[2] == 0xe0 {
 		compressed = true
 	} else if decoded[2] != 0xc0 {
-		return nil, errors.New("invalid flag byte")
+		return nil, formatError("invalid flag byte")
 	}
 
 	addressHash := decoded[3:7]
 	encryptedHalf1 := decoded[7:23]
 	encryptedHalf2 := decoded[23:39]
 
-	derivedKey, err := scrypt.Key(passphrase, addressHash, 16384, 8, 8, 64)
+	derivedKey, err := scrypt.Key(passphrase, addressHash, ScryptN, ScryptR, ScryptP, 64)
 	if err != nil {
 		return nil, fmt.Errorf("scrypt derivation failed: %w", err)
 	}
@@ -200,37 +237,29 @@ func decryptNonEC(decoded []byte, passphrase []byte) (*btcutil.WIF, error) {
 		pubKeyBytes = pubKey.SerializeUncompressed()
 	}
 
-	var matchedNet *chaincfg.Params
-	for _, params := range supportedNetworks {
-		addressPubKey, addrErr := btcutil.NewAddressPubKey(pubKeyBytes, params)
-		if addrErr != nil {
-			continue
-		}
-
-		address := addressPubKey.EncodeAddress()
-		hash := sha256.Sum256([]byte(address))
-		hash2 := sha256.Sum256(hash[:])
-
-		if constantTimeEqual(hash2[:4], addressHash) {
-			matchedNet = params
-			break
-		}
+	networks, address := matchNetworks(pubKeyBytes, addressHash, candidates)
+	if len(networks) == 0 {
+		return nil, ErrIncorrectPassphrase
 	}
 
-	if matchedNet == nil {
-		return nil, errors.New("incorrect passphrase")
-	}
+	return &decryptedKey{
+		privKey:    privKey,
+		compressed: compressed,
+		address:    address,
+		networks:   networks,
+	}, nil
+}
 
-	wif, err := btcutil.NewWIF(privKey, matchedNet, compressed)
+// EncryptKey wrap the private key with BIP38 using passphrase bytes
+func EncryptKey(wif *btcutil.WIF, passphrase []byte) (string, error) {
+	netParams, err := NetworkFromWIF(wif)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create WIF: %w", err)
+		return "", err
 	}
-
-	return wif, nil
+	return encryptKey(wif, passphrase, netParams)
 }
 
-// EncryptKey wrap the private key with BIP38 using passphrase bytes
-func EncryptKey(wif *btcutil.WIF, passphrase []byte) (string, error) {
+func encryptKey(wif *btcutil.WIF, passphrase []byte, netParams *chaincfg.Params) (string, error) {
 	passphrase = normalizePassphrase(passphrase)
 	privKeyBytes := wif.PrivKey.Serialize()
 	compressed := wif.CompressPubKey
@@ -243,11 +272,6 @@ func EncryptKey(wif *btcutil.WIF, passphrase []byte) (string, error) {
 		pubKeyBytes = pubKey.SerializeUncompressed()
 	}
 
-	netParams, err := NetworkFromWIF(wif)
-	if err != nil {
-		return "", err
-	}
-
 	addressPubKey, err := btcutil.NewAddressPubKey(pubKeyBytes, netParams)
 	if err != nil {
 		return "", fmt.Errorf("failed to create address: %w", err)
@@ -259,7 +283,7 @@ func EncryptKey(wif *btcutil.WIF, passphrase []byte) (string, error) {
 	hash2 := sha256.Sum256(hash[:])
 	addressHash := hash2[:4]
 
-	derivedKey, err := scrypt.Key(passphrase, addressHash, 16384, 8, 8, 64)
+	derivedKey, err := scrypt.Key(passphrase, addressHash, ScryptN, ScryptR, ScryptP, 64)
 	if err != nil {
 		return "", fmt.Errorf("scrypt derivation failed: %w", err)
 	}
@@ -308,14 +332,29 @@ func constantTimeEqual(a, b []byte) bool {
 	return subtle.ConstantTimeCompare(a, b) == 1
 }
 
-// NetworkFromWIF returns the Bitcoin network associated with the provided WIF.
-func NetworkFromWIF(wif *btcutil.WIF) (*chaincfg.Params, error) {
-	for _, params := range supportedNetworks {
-		if wif.IsForNet(params) {
-			return params, nil
+// matchNetworks returns every candidate network whose P2PKH address for
+// pubKeyBytes hashes to addressHash, together with the first matching address.
+func matchNetworks(pubKeyBytes, addressHash []byte, candidates []*chaincfg.Params) ([]*chaincfg.Params, string) {
+	var matched []*chaincfg.Params
+	var firstAddress string
+	for _, params := range candidates {
+		addressPubKey, err := btcutil.NewAddressPubKey(pubKeyBytes, params)
+		if err != nil {
+			continue
+		}
+
+		address := addressPubKey.EncodeAddress()
+		hash := sha256.Sum256([]byte(address))
+		hash2 := sha256.Sum256(hash[:])
+
+		if constantTimeEqual(hash2[:4], addressHash) {
+			if len(matched) == 0 {
+				firstAddress = address
+			}
+			matched = append(matched, params)
 		}
 	}
-	return nil, errors.New("unsupported WIF network")
+	return matched, firstAddress
 }
 
 // ECB mode helper because stdlib doesn't expose this cipher mode
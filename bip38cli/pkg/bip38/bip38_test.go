@@ -1,9 +1,11 @@
 package bip38
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 )
@@ -288,6 +290,31 @@ func TestGenerateWIF(t *testing.T) {
 	}
 }
 
+func TestWIFFromKey(t *testing.T) {
+	known, _ := btcutil.DecodeWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ")
+	wif, err := WIFFromKey(known.PrivKey.Serialize(), &chaincfg.MainNetParams, false)
+	if err != nil {
+		t.Fatalf("WIFFromKey returned error: %v", err)
+	}
+	if wif.String() != known.String() {
+		t.Fatalf("WIFFromKey = %s, want %s", wif, known)
+	}
+
+	order := btcec.S256().N.Bytes()
+	for name, key := range map[string][]byte{
+		"short": make([]byte, 31),
+		"zero":  make([]byte, 32),
+		"order": order,
+	} {
+		if _, err := WIFFromKey(key, &chaincfg.MainNetParams, true); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := WIFFromKey(known.PrivKey.Serialize(), nil, true); err == nil {
+		t.Fatal("expected error when network params are nil")
+	}
+}
+
 func BenchmarkEncrypt(b *testing.B) {
 	wif, _ := btcutil.DecodeWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ")
 	passphrase := []byte("TestingOneTwoThree")
@@ -376,3 +403,64 @@ func TestEncryptDecryptProperty(t *testing.T) {
 		}
 	}
 }
+
+func TestDecryptNetworkSelection(t *testing.T) {
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x11}, 32))
+	wif, err := btcutil.NewWIF(privKey, &chaincfg.SigNetParams, true)
+	if err != nil {
+		t.Fatalf("NewWIF: %v", err)
+	}
+
+	passphrase := []byte("TestingOneTwoThree")
+	encrypted, err := EncryptKey(wif, passphrase)
+	if err != nil {
+		t.Fatalf("EncryptKey: %v", err)
+	}
+
+	t.Run("detect", func(t *testing.T) {
+		result, err := Decrypt(DecryptOptions{EncryptedKey: encrypted, Passphrase: passphrase})
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if !result.Ambiguous() {
+			t.Fatalf("expected ambiguous result, got network %s", result.Network.Name)
+		}
+		for _, params := range []*chaincfg.Params{&chaincfg.TestNet3Params, &chaincfg.RegressionNetParams, &chaincfg.SigNetParams} {
+			if !containsNetwork(result.Candidates, params) {
+				t.Fatalf("candidates %v do not include %s", result.Candidates, params.Name)
+			}
+		}
+		if containsNetwork(result.Candidates, &chaincfg.MainNetParams) {
+			t.Fatal("mainnet must not be a candidate")
+		}
+	})
+
+	t.Run("explicit", func(t *testing.T) {
+		result, err := Decrypt(DecryptOptions{EncryptedKey: encrypted, Passphrase: passphrase, Network: &chaincfg.SigNetParams})
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if result.Network != &chaincfg.SigNetParams {
+			t.Fatalf("network = %v, want signet", result.Network)
+		}
+		if result.WIF.String() != wif.String() {
+			t.Fatalf("WIF = %s, want %s", result.WIF.String(), wif.String())
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		_, err := Decrypt(DecryptOptions{EncryptedKey: encrypted, Passphrase: passphrase, Network: &chaincfg.MainNetParams})
+		if err == nil || !strings.Contains(err.Error(), "does not belong to network mainnet") {
+			t.Fatalf("expected network mismatch error, got %v", err)
+		}
+	})
+}
+
+func containsNetwork(networks []*chaincfg.Params, want *chaincfg.Params) bool {
+	for _, params := range networks {
+		if params == want {
+			return true
+		}
+	}
+	return false
+}
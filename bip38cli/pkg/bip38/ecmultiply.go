@@ -23,30 +23,47 @@ import (
 
 // ECMultiplyResult holds the output of ECMultiplyEncrypt.
 type ECMultiplyResult struct {
-	EncryptedKey     string // BIP38 encrypted key (6P...)
-	ConfirmationCode string // confirmation code (cfrm38...)
-	Compressed       bool
+	EncryptedKey     string           // BIP38 encrypted key (6P...)
+	ConfirmationCode string           // confirmation code (cfrm38...)
+	Address          string           // P2PKH address of the generated key
+	Compressed       bool             // Whether the public key is serialized compressed
+	Network          *chaincfg.Params // Network the address was encoded for
 }
 
 // ConfirmationResult is returned by VerifyConfirmationCode.
 type ConfirmationResult struct {
-	Address   string
-	HasLotSeq bool
-	LotNumber *uint32
-	SeqNumber *uint32
+	Address    string
+	Compressed bool
+	HasLotSeq  bool
+	LotNumber  *uint32
+	SeqNumber  *uint32
+	Network    *chaincfg.Params   // Matching network, nil when several candidates match
+	Candidates []*chaincfg.Params // Every network whose address matched the address hash
 }
 
 // ECMultiplyEncrypt generates a BIP38 EC-multiply encrypted key from an
 // intermediate passphrase code. The caller does not need to know the passphrase.
+// The address hash is computed for mainnet; use ECMultiply to pick another network.
 func ECMultiplyEncrypt(intermediateCode string, compressed bool) (*ECMultiplyResult, error) {
+	return ecMultiplyEncrypt(intermediateCode, nil, compressed, &chaincfg.MainNetParams)
+}
+
+// ecMultiplyEncrypt mints a key from seed, or from a random seedb when seed
+// is nil.
+func ecMultiplyEncrypt(intermediateCode string, seed []byte, compressed bool, netParams *chaincfg.Params) (*ECMultiplyResult, error) { //nolint:gocyclo
 	ic, err := ParseIntermediateCode(intermediateCode)
 	if err != nil {
 		return nil, fmt.Errorf("invalid intermediate code: %w", err)
 	}
 
 	seedb := make([]byte, 24)
-	if _, readErr := rand.Read(seedb); readErr != nil {
-		return nil, fmt.Errorf("failed to generate seedb: %w", err)
+	if seed != nil {
+		if len(seed) != len(seedb) {
+			return nil, fmt.Errorf("seedb must be %d bytes, got %d", len(seedb), len(seed))
+		}
+		copy(seedb, seed)
+	} else if _, readErr := rand.Read(seedb); readErr != nil {
+		return nil, fmt.Errorf("failed to generate seedb: %w", readErr)
 	}
 	defer zeroBytes(seedb)
 
@@ -81,7 +98,6 @@ func ECMultiplyEncrypt(intermediateCode string, compressed bool) (*ECMultiplyRes
 		pubKeyBytes = generatedPubKey.SerializeUncompressed()
 	}
 
-	netParams := &chaincfg.MainNetParams
 	addrPubKey, err := btcutil.NewAddressPubKey(pubKeyBytes, netParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create address: %w", err)
@@ -160,18 +176,20 @@ func ECMultiplyEncrypt(intermediateCode string, compressed bool) (*ECMultiplyRes
 	return &ECMultiplyResult{
 		EncryptedKey:     encryptedKey,
 		ConfirmationCode: confirmCode,
+		Address:          address,
 		Compressed:       compressed,
+		Network:          netParams,
 	}, nil
 }
 
 // decryptECMultiply decrypts a BIP38 EC-multiply encrypted private key.
-func decryptECMultiply(decoded []byte, passphrase []byte) (*btcutil.WIF, error) { //nolint:gocyclo
+func decryptECMultiply(decoded []byte, passphrase []byte, candidates []*chaincfg.Params, cache *PassfactorCache) (*decryptedKey, error) { //nolint:gocyclo
 	flagbyte := decoded[2]
 	hasLotSeq := flagbyte&0x04 != 0
 	compressed := flagbyte&0x20 != 0
 
 	if flagbyte&^byte(0x24) != 0 {
-		return nil, errors.New("invalid flag byte")
+		return nil, formatError("invalid flag byte")
 	}
 
 	addressHash := decoded[3:7]
@@ -184,7 +202,7 @@ func decryptECMultiply(decoded []byte, passphrase []byte) (*btcutil.WIF, error)
 		ownersalt = ownerEntropy[:4]
 	}
 
-	passfactor, err := derivePassfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+	passfactor, err := cache.passfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
 	if err != nil {
 		return nil, err
 	}
@@ -265,51 +283,32 @@ func decryptECMultiply(decoded []byte, passphrase []byte) (*btcutil.WIF, error)
 		pubKeyBytes = pubKey.SerializeUncompressed()
 	}
 
-	var matchedNet *chaincfg.Params
-	for _, params := range supportedNetworks {
-		addressPubKey, addrErr := btcutil.NewAddressPubKey(pubKeyBytes, params)
-		if addrErr != nil {
-			continue
-		}
-		address := addressPubKey.EncodeAddress()
-		h1 := sha256.Sum256([]byte(address))
-		h2 := sha256.Sum256(h1[:])
-		if constantTimeEqual(h2[:4], addressHash) {
-			matchedNet = params
-			break
-		}
-	}
-	if matchedNet == nil {
-		return nil, errors.New("incorrect passphrase")
+	networks, address := matchNetworks(pubKeyBytes, addressHash, candidates)
+	if len(networks) == 0 {
+		return nil, ErrIncorrectPassphrase
 	}
 
-	wif, err := btcutil.NewWIF(privKey, matchedNet, compressed)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create WIF: %w", err)
-	}
-	return wif, nil
+	return &decryptedKey{
+		privKey:    privKey,
+		compressed: compressed,
+		ecMultiply: true,
+		address:    address,
+		networks:   networks,
+	}, nil
 }
 
 // VerifyConfirmationCode checks that a confirmation code depends on the passphrase.
-func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*ConfirmationResult, error) { //nolint:gocyclo
-	passphrase = normalizePassphrase(passphrase)
-
-	decoded := base58.Decode(confirmationCode)
-	if len(decoded) != 55 {
-		return nil, errors.New("invalid confirmation code length")
-	}
+// Every supported network is tried and the matching one is reported in the result.
+func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*ConfirmationResult, error) {
+	return verifyConfirmationCode(confirmationCode, passphrase, DefaultNetworks.Networks(), nil)
+}
 
-	expectedMagic := []byte{0x64, 0x3B, 0xF6, 0xA8, 0x9A}
-	if !constantTimeEqual(decoded[:5], expectedMagic) {
-		return nil, errors.New("invalid confirmation code magic")
-	}
+func verifyConfirmationCode(confirmationCode string, passphrase []byte, candidates []*chaincfg.Params, cache *PassfactorCache) (*ConfirmationResult, error) { //nolint:gocyclo
+	passphrase = normalizePassphrase(passphrase)
 
-	payload := decoded[:51]
-	checksum := decoded[51:]
-	cs1 := sha256.Sum256(payload)
-	cs2 := sha256.Sum256(cs1[:])
-	if !constantTimeEqual(cs2[:4], checksum) {
-		return nil, errors.New("invalid checksum")
+	decoded, err := decodeConfirmationCode(confirmationCode)
+	if err != nil {
+		return nil, err
 	}
 
 	flagbyte := decoded[5]
@@ -326,7 +325,7 @@ func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*Confir
 		ownersalt = ownerEntropy[:4]
 	}
 
-	passfactor, err := derivePassfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+	passfactor, err := cache.passfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
 	if err != nil {
 		return nil, err
 	}
@@ -369,7 +368,7 @@ func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*Confir
 
 	pointbPub, err := btcec.ParsePubKey(pointb)
 	if err != nil {
-		return nil, errors.New("incorrect passphrase")
+		return nil, ErrIncorrectPassphrase
 	}
 
 	var passfactorScalar btcec.ModNScalar
@@ -390,21 +389,19 @@ func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*Confir
 		pubKeyBytes = addressPub.SerializeUncompressed()
 	}
 
-	addrPubKey, err := btcutil.NewAddressPubKey(pubKeyBytes, &chaincfg.MainNetParams)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create address: %w", err)
-	}
-	address := addrPubKey.EncodeAddress()
-
-	h1 := sha256.Sum256([]byte(address))
-	h2 := sha256.Sum256(h1[:])
-	if !constantTimeEqual(h2[:4], addressHash) {
-		return nil, errors.New("incorrect passphrase")
+	networks, address := matchNetworks(pubKeyBytes, addressHash, candidates)
+	if len(networks) == 0 {
+		return nil, ErrIncorrectPassphrase
 	}
 
 	result := &ConfirmationResult{
-		Address:   address,
-		HasLotSeq: hasLotSeq,
+		Address:    address,
+		Compressed: compressed,
+		HasLotSeq:  hasLotSeq,
+		Candidates: networks,
+	}
+	if len(networks) == 1 {
+		result.Network = networks[0]
 	}
 	if hasLotSeq {
 		lotSeqValue := uint32(ownerEntropy[4])<<24 | uint32(ownerEntropy[5])<<16 |
@@ -418,7 +415,7 @@ func VerifyConfirmationCode(confirmationCode string, passphrase []byte) (*Confir
 }
 
 func derivePassfactor(passphrase, ownersalt, ownerEntropy []byte, hasLotSeq bool) ([]byte, error) {
-	prefactor, err := scrypt.Key(passphrase, ownersalt, 16384, 8, 8, 32)
+	prefactor, err := scrypt.Key(passphrase, ownersalt, ScryptN, ScryptR, ScryptP, 32)
 	if err != nil {
 		return nil, fmt.Errorf("scrypt derivation failed: %w", err)
 	}
@@ -0,0 +1,155 @@
+package bip38
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Event describes one completed call to Encrypt, Decrypt, ECMultiply,
+// Confirm, GenerateIntermediate or GenerateWIF, for embedders that forward
+// operations to their own telemetry.
+type Event struct {
+	// Operation is "encrypt", "decrypt", "confirm", "intermediate" or
+	// "generate_wif". ECMultiply is reported as "encrypt" with the
+	// ec_multiply label set to "true".
+	Operation string
+	// Labels describe the key where known: "network", "ec_multiply" and
+	// "compressed". A failed call carries the labels known from its inputs.
+	Labels map[string]string
+	// Fingerprint identifies the key without revealing it: the P2PKH address
+	// when known, otherwise the hex address hash of the encrypted key or
+	// confirmation code. Empty for GenerateIntermediate and when the input
+	// could not be parsed.
+	Fingerprint string
+	// Duration is the wall time of the call, including scrypt.
+	Duration time.Duration
+	// Err is the error returned to the caller, nil on success.
+	Err error
+}
+
+// Sink receives events. Record runs synchronously on the goroutine that made
+// the call, possibly from several goroutines at once, so it must be safe for
+// concurrent use and should return quickly.
+type Sink interface {
+	Record(Event)
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(Event)
+
+// Record calls f(e).
+func (f SinkFunc) Record(e Event) {
+	f(e)
+}
+
+// sinkEntry gives each registration its own identity, so the same Sink
+// added twice is removed one registration at a time.
+type sinkEntry struct {
+	sink Sink
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   atomic.Pointer[[]*sinkEntry]
+)
+
+// AddSink registers s for every later event and returns a function that
+// removes it again.
+func AddSink(s Sink) (remove func()) {
+	entry := &sinkEntry{sink: s}
+
+	sinksMu.Lock()
+	updated := append(loadSinks(), entry)
+	sinks.Store(&updated)
+	sinksMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sinksMu.Lock()
+			defer sinksMu.Unlock()
+			current := loadSinks()
+			kept := current[:0]
+			for _, existing := range current {
+				if existing != entry {
+					kept = append(kept, existing)
+				}
+			}
+			sinks.Store(&kept)
+		})
+	}
+}
+
+// loadSinks returns a copy of the registered sinks.
+func loadSinks() []*sinkEntry {
+	if current := sinks.Load(); current != nil {
+		return append([]*sinkEntry(nil), *current...)
+	}
+	return nil
+}
+
+// emit sends one event to every sink. describe fills in the labels and
+// fingerprint and only runs when a sink is registered, so calls without
+// telemetry pay for a single atomic load.
+func emit(operation string, started time.Time, err error, describe func(*Event)) {
+	current := sinks.Load()
+	if current == nil || len(*current) == 0 {
+		return
+	}
+	event := Event{Operation: operation, Duration: time.Since(started), Err: err}
+	describe(&event)
+	for _, entry := range *current {
+		entry.sink.Record(event)
+	}
+}
+
+// keyLabels describes a key; a nil network is left out.
+func keyLabels(network *chaincfg.Params, ecMultiply, compressed bool) map[string]string {
+	labels := map[string]string{
+		"ec_multiply": strconv.FormatBool(ecMultiply),
+		"compressed":  strconv.FormatBool(compressed),
+	}
+	if network != nil {
+		labels["network"] = network.Name
+	}
+	return labels
+}
+
+// networkLabels carries only the network, when known.
+func networkLabels(network *chaincfg.Params) map[string]string {
+	if network == nil {
+		return nil
+	}
+	return map[string]string{"network": network.Name}
+}
+
+// describeEncryptedKey reads the scheme, compression and address hash from
+// an encrypted key's header without checking it, so failed decryptions are
+// still labelled.
+func describeEncryptedKey(e *Event, encryptedKey string, network *chaincfg.Params) {
+	decoded := base58.Decode(encryptedKey)
+	if len(decoded) != 43 || decoded[0] != bip38Magic || (decoded[1] != bip38Type && decoded[1] != bip38TypeEC) {
+		e.Labels = networkLabels(network)
+		return
+	}
+	e.Labels = keyLabels(network, decoded[1] == bip38TypeEC, decoded[2]&0x20 != 0)
+	e.Fingerprint = hex.EncodeToString(decoded[3:7])
+}
+
+// describeConfirmationCode does the same for a confirmation code.
+func describeConfirmationCode(e *Event, code string, network *chaincfg.Params) {
+	decoded := base58.Decode(code)
+	if len(decoded) != 55 || !bytes.Equal(decoded[:5], []byte{0x64, 0x3B, 0xF6, 0xA8, 0x9A}) {
+		e.Labels = networkLabels(network)
+		return
+	}
+	e.Labels = keyLabels(network, true, decoded[5]&0x20 != 0)
+	e.Fingerprint = hex.EncodeToString(decoded[6:10])
+}
@@ -0,0 +1,131 @@
+package bip38
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+type collectingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *collectingSink) Record(e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+func (c *collectingSink) take() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := c.events
+	c.events = nil
+	return events
+}
+
+func TestSinkReceivesLabelledEvents(t *testing.T) {
+	sink := &collectingSink{}
+	remove := AddSink(sink)
+	defer remove()
+
+	wif, err := btcutil.DecodeWIF("5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR")
+	if err != nil {
+		t.Fatalf("DecodeWIF: %v", err)
+	}
+	encrypted, err := Encrypt(EncryptOptions{WIF: wif, Passphrase: []byte("TestingOneTwoThree")})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if _, err := Decrypt(DecryptOptions{EncryptedKey: encrypted.EncryptedKey, Passphrase: []byte("wrong")}); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("Decrypt with wrong passphrase: %v", err)
+	}
+	code, err := GenerateIntermediate(IntermediateOptions{Passphrase: []byte("TestingOneTwoThree")})
+	if err != nil {
+		t.Fatalf("GenerateIntermediate: %v", err)
+	}
+	if _, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code.Code, Compressed: true, Network: &chaincfg.TestNet3Params}); err != nil {
+		t.Fatalf("ECMultiply: %v", err)
+	}
+	if _, err := GenerateWIF(&chaincfg.MainNetParams, false); err != nil {
+		t.Fatalf("GenerateWIF: %v", err)
+	}
+
+	want := []struct {
+		operation string
+		failed    bool
+		labels    map[string]string
+	}{
+		{operation: "encrypt", labels: map[string]string{"network": "mainnet", "ec_multiply": "false", "compressed": "false"}},
+		{operation: "decrypt", failed: true, labels: map[string]string{"ec_multiply": "false", "compressed": "false"}},
+		{operation: "intermediate"},
+		{operation: "encrypt", labels: map[string]string{"network": "testnet3", "ec_multiply": "true", "compressed": "true"}},
+		{operation: "generate_wif", labels: map[string]string{"network": "mainnet", "compressed": "false"}},
+	}
+	events := sink.take()
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		got := events[i]
+		if got.Operation != w.operation || (got.Err != nil) != w.failed || got.Duration <= 0 {
+			t.Fatalf("event %d = %+v, want %s (failed %v)", i, got, w.operation, w.failed)
+		}
+		if len(got.Labels) != len(w.labels) {
+			t.Fatalf("event %d labels = %v, want %v", i, got.Labels, w.labels)
+		}
+		for k, v := range w.labels {
+			if got.Labels[k] != v {
+				t.Fatalf("event %d label %s = %q, want %q", i, k, got.Labels[k], v)
+			}
+		}
+	}
+
+	if got := events[0].Fingerprint; got != "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB" {
+		t.Fatalf("encrypt fingerprint = %q, want the address", got)
+	}
+	if got := events[1].Fingerprint; len(got) != 8 {
+		t.Fatalf("failed decrypt fingerprint = %q, want the hex address hash", got)
+	}
+	if events[2].Fingerprint != "" || events[3].Fingerprint == "" || !strings.HasPrefix(events[4].Fingerprint, "1") {
+		t.Fatalf("unexpected fingerprints: %q %q %q", events[2].Fingerprint, events[3].Fingerprint, events[4].Fingerprint)
+	}
+
+	remove()
+	if _, err := GenerateWIF(&chaincfg.MainNetParams, true); err != nil {
+		t.Fatalf("GenerateWIF: %v", err)
+	}
+	if events := sink.take(); len(events) != 0 {
+		t.Fatalf("removed sink still received %d events", len(events))
+	}
+}
+
+func TestAddSinkTwiceRemovesOneRegistration(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	sink := SinkFunc(func(Event) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+	removeFirst := AddSink(sink)
+	removeSecond := AddSink(sink)
+	defer removeSecond()
+
+	if _, err := GenerateWIF(&chaincfg.MainNetParams, true); err != nil {
+		t.Fatalf("GenerateWIF: %v", err)
+	}
+	removeFirst()
+	removeFirst()
+	if _, err := GenerateWIF(&chaincfg.MainNetParams, true); err != nil {
+		t.Fatalf("GenerateWIF: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("sink called %d times, want 3", calls)
+	}
+}
@@ -0,0 +1,91 @@
+package bip38_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"github.com/carlosrabelo/bip38cli/bip38cli/pkg/bip38"
+)
+
+func ExampleEncrypt() {
+	wif, err := btcutil.DecodeWIF("5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := bip38.Encrypt(bip38.EncryptOptions{
+		WIF:        wif,
+		Passphrase: []byte("TestingOneTwoThree"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.EncryptedKey)
+	fmt.Println(result.Address)
+	// Output:
+	// 6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg
+	// 1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB
+}
+
+func ExampleDecrypt() {
+	result, err := bip38.Decrypt(bip38.DecryptOptions{
+		EncryptedKey: "6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo",
+		Passphrase:   []byte("TestingOneTwoThree"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.WIF.String())
+	fmt.Println(result.Compressed, result.ECMultiply, result.Network.Name)
+	// Output:
+	// L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP
+	// true false mainnet
+}
+
+func ExampleConfirm() {
+	result, err := bip38.Confirm(bip38.ConfirmOptions{
+		ConfirmationCode: "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD",
+		Passphrase:       []byte("MOLON LABE"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.Address)
+	fmt.Println(*result.LotNumber, *result.SeqNumber)
+	// Output:
+	// 1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh
+	// 263183 1
+}
+
+func ExampleECMultiply() {
+	// The passphrase owner generates an intermediate code once...
+	owner, err := bip38.GenerateIntermediate(bip38.IntermediateOptions{
+		Passphrase: []byte("correct horse battery staple"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ...and a third party mints encrypted keys from it without the passphrase.
+	minted, err := bip38.ECMultiply(bip38.ECMultiplyOptions{
+		IntermediateCode: owner.Code,
+		Compressed:       true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(strings.HasPrefix(owner.Code, "passphrase"))
+	fmt.Println(strings.HasPrefix(minted.EncryptedKey, "6P"))
+	fmt.Println(strings.HasPrefix(minted.ConfirmationCode, "cfrm38"))
+	// Output:
+	// true
+	// true
+	// true
+}
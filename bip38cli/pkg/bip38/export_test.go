@@ -0,0 +1,20 @@
+package bip38
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// countCacheDerivations counts the passfactors PassfactorCache derives until
+// the test ends.
+func countCacheDerivations(t *testing.T) *atomic.Int64 {
+	t.Helper()
+	var count atomic.Int64
+	orig := deriveCached
+	deriveCached = func(passphrase, ownersalt, ownerEntropy []byte, hasLotSeq bool) ([]byte, error) {
+		count.Add(1)
+		return orig(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+	}
+	t.Cleanup(func() { deriveCached = orig })
+	return &count
+}
@@ -0,0 +1,144 @@
+package bip38
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+)
+
+// KeyInfo is what an encrypted key or confirmation code reveals without the
+// passphrase.
+type KeyInfo struct {
+	ECMultiply  bool
+	Compressed  bool
+	AddressHash []byte // first four bytes of SHA256(SHA256(address))
+	// OwnerEntropy ties an EC-multiply key to the intermediate code it was
+	// minted from; it equals that code's IntermediateCode.OwnerEntropy.
+	OwnerEntropy []byte
+	HasLotSeq    bool
+	LotNumber    *uint32
+	SeqNumber    *uint32
+}
+
+// InspectKey checks the encoding of an encrypted key and reads its header.
+func InspectKey(encryptedKey string) (*KeyInfo, error) {
+	decoded, err := decodeEncryptedKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	flag := decoded[2]
+	info := &KeyInfo{
+		ECMultiply:  decoded[1] == bip38TypeEC,
+		Compressed:  flag&0x20 != 0,
+		AddressHash: append([]byte(nil), decoded[3:7]...),
+	}
+	if !info.ECMultiply {
+		if flag != 0xc0 && flag != 0xe0 {
+			return nil, formatError("invalid flag byte")
+		}
+		return info, nil
+	}
+
+	if flag&^byte(0x24) != 0 {
+		return nil, formatError("invalid flag byte")
+	}
+	info.OwnerEntropy = append([]byte(nil), decoded[7:15]...)
+	info.setLotSeq(flag, decoded[7:15])
+	return info, nil
+}
+
+// InspectConfirmationCode checks the encoding of a confirmation code and
+// reads the compression, address hash and lot and sequence numbers of the
+// key it belongs to.
+func InspectConfirmationCode(confirmationCode string) (*KeyInfo, error) {
+	decoded, err := decodeConfirmationCode(confirmationCode)
+	if err != nil {
+		return nil, err
+	}
+
+	flag := decoded[5]
+	info := &KeyInfo{
+		ECMultiply:  true,
+		Compressed:  flag&0x20 != 0,
+		AddressHash: append([]byte(nil), decoded[6:10]...),
+	}
+	info.OwnerEntropy = append([]byte(nil), decoded[10:18]...)
+	info.setLotSeq(flag, decoded[10:18])
+	return info, nil
+}
+
+// setLotSeq reads the lot and sequence numbers from the owner entropy when
+// the flag byte says they are present.
+func (k *KeyInfo) setLotSeq(flag byte, ownerEntropy []byte) {
+	if flag&0x04 == 0 {
+		return
+	}
+	lotSeq := binary.BigEndian.Uint32(ownerEntropy[4:])
+	lot, seq := lotSeq/4096, lotSeq%4096
+	k.HasLotSeq = true
+	k.LotNumber = &lot
+	k.SeqNumber = &seq
+}
+
+// MatchesAddress reports whether the key commits to address.
+func (k *KeyInfo) MatchesAddress(address string) bool {
+	hash := sha256.Sum256([]byte(address))
+	hash2 := sha256.Sum256(hash[:])
+	return constantTimeEqual(hash2[:4], k.AddressHash)
+}
+
+// decodeEncryptedKey base58-decodes an encrypted key and checks its length,
+// magic, type and checksum.
+func decodeEncryptedKey(encryptedKey string) ([]byte, error) {
+	if !IsBIP38Format(encryptedKey) {
+		return nil, formatError("invalid BIP38 format")
+	}
+
+	decoded := base58.Decode(encryptedKey)
+	if len(decoded) != 43 {
+		return nil, formatError("invalid encrypted key length")
+	}
+
+	if decoded[0] != bip38Magic {
+		return nil, formatError("invalid magic byte")
+	}
+
+	payload := decoded[:39]
+	checksum := decoded[39:]
+	hash := sha256.Sum256(payload)
+	hash2 := sha256.Sum256(hash[:])
+
+	if !constantTimeEqual(hash2[:4], checksum) {
+		return nil, formatError("invalid checksum")
+	}
+
+	if decoded[1] != bip38Type && decoded[1] != bip38TypeEC {
+		return nil, formatError("unsupported BIP38 type")
+	}
+	return decoded, nil
+}
+
+// decodeConfirmationCode base58-decodes a confirmation code and checks its
+// length, magic and checksum.
+func decodeConfirmationCode(confirmationCode string) ([]byte, error) {
+	decoded := base58.Decode(confirmationCode)
+	if len(decoded) != 55 {
+		return nil, formatError("invalid confirmation code length")
+	}
+
+	expectedMagic := []byte{0x64, 0x3B, 0xF6, 0xA8, 0x9A}
+	if !constantTimeEqual(decoded[:5], expectedMagic) {
+		return nil, formatError("invalid confirmation code magic")
+	}
+
+	payload := decoded[:51]
+	checksum := decoded[51:]
+	cs1 := sha256.Sum256(payload)
+	cs2 := sha256.Sum256(cs1[:])
+	if !constantTimeEqual(cs2[:4], checksum) {
+		return nil, formatError("invalid checksum")
+	}
+	return decoded, nil
+}
@@ -0,0 +1,92 @@
+package bip38
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInspectKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		encrypted  string
+		address    string
+		ecMultiply bool
+		compressed bool
+		lot, seq   uint32
+		hasLotSeq  bool
+	}{
+		{
+			name:      "no EC multiply",
+			encrypted: "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+			address:   "1Jq6MksXQVWzrznvZzxkV6oY57oWXD9TXB",
+		},
+		{
+			name:       "EC multiply without lot",
+			encrypted:  "6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX",
+			address:    "1PE6TQi6HTVNz5DLwB1LcpMBALubfuN2z2",
+			ecMultiply: true,
+		},
+		{
+			name:       "EC multiply with lot",
+			encrypted:  "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j",
+			address:    "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh",
+			ecMultiply: true,
+			hasLotSeq:  true,
+			lot:        263183,
+			seq:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := InspectKey(tt.encrypted)
+			if err != nil {
+				t.Fatalf("InspectKey: %v", err)
+			}
+			if info.ECMultiply != tt.ecMultiply || info.Compressed != tt.compressed || info.HasLotSeq != tt.hasLotSeq {
+				t.Fatalf("info = %+v", info)
+			}
+			if tt.hasLotSeq && (*info.LotNumber != tt.lot || *info.SeqNumber != tt.seq) {
+				t.Fatalf("lot/sequence = %d/%d, want %d/%d", *info.LotNumber, *info.SeqNumber, tt.lot, tt.seq)
+			}
+			if !info.MatchesAddress(tt.address) {
+				t.Fatalf("key does not match %s", tt.address)
+			}
+			if info.MatchesAddress("1CqzrtZC6mXSAhoxtFwVjz8LtwLJjDYU3V") {
+				t.Fatal("key matches an unrelated address")
+			}
+		})
+	}
+
+	if _, err := InspectKey("6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGh"); !errors.Is(err, ErrInvalidFormat) || err.Error() != "invalid checksum" {
+		t.Fatalf("InspectKey with a bad checksum: %v, want an ErrInvalidFormat", err)
+	}
+}
+
+func TestInspectConfirmationCode(t *testing.T) {
+	info, err := InspectConfirmationCode("cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKtaVqLNMgnifETYw7BPwWC9aPD")
+	if err != nil {
+		t.Fatalf("InspectConfirmationCode: %v", err)
+	}
+	if !info.ECMultiply || info.Compressed || !info.HasLotSeq || *info.LotNumber != 263183 || *info.SeqNumber != 1 {
+		t.Fatalf("info = %+v", info)
+	}
+	if !info.MatchesAddress("1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh") {
+		t.Fatal("confirmation code does not match its address")
+	}
+
+	key, err := InspectKey("6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j")
+	if err != nil {
+		t.Fatalf("InspectKey: %v", err)
+	}
+	if string(key.AddressHash) != string(info.AddressHash) {
+		t.Fatal("key and confirmation code disagree on the address hash")
+	}
+	if len(info.OwnerEntropy) != 8 || string(key.OwnerEntropy) != string(info.OwnerEntropy) {
+		t.Fatal("key and confirmation code disagree on the owner entropy")
+	}
+
+	if _, err := InspectConfirmationCode("6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j"); err == nil {
+		t.Fatal("InspectConfirmationCode accepted an encrypted key")
+	}
+}
@@ -67,7 +67,7 @@ func GenerateIntermediateCode(passphrase []byte, lotNumber, sequenceNumber *uint
 		ownerSalt = ownerEntropy
 	}
 
-	prefactor, err := scrypt.Key(passphrase, ownerSalt, 16384, 8, 8, 32)
+	prefactor, err := scrypt.Key(passphrase, ownerSalt, ScryptN, ScryptR, ScryptP, 32)
 	if err != nil {
 		return "", fmt.Errorf("scrypt derivation failed: %w", err)
 	}
@@ -114,7 +114,7 @@ func GenerateIntermediateCode(passphrase []byte, lotNumber, sequenceNumber *uint
 func ParseIntermediateCode(code string) (*IntermediateCode, error) {
 	decoded := base58.Decode(code)
 	if len(decoded) != 53 {
-		return nil, errors.New("invalid intermediate code length")
+		return nil, formatError("invalid intermediate code length")
 	}
 
 	magic := decoded[:8]
@@ -123,7 +123,7 @@ func ParseIntermediateCode(code string) (*IntermediateCode, error) {
 	if constantTimeEqual(magic, intermediateMagicLot) {
 		hasLotSeq = true
 	} else if !constantTimeEqual(magic, intermediateMagicNoLot) {
-		return nil, errors.New("invalid intermediate code magic")
+		return nil, formatError("invalid intermediate code magic")
 	}
 
 	payload := decoded[:len(decoded)-4]
@@ -132,7 +132,7 @@ func ParseIntermediateCode(code string) (*IntermediateCode, error) {
 	hash2 := sha256.Sum256(hash[:])
 
 	if !constantTimeEqual(hash2[:4], checksum) {
-		return nil, errors.New("invalid checksum")
+		return nil, formatError("invalid checksum")
 	}
 
 	ownerEntropy := make([]byte, 8)
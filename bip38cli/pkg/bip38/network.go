@@ -0,0 +1,195 @@
+package bip38
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Altcoin networks that share secp256k1 and P2PKH addressing with Bitcoin.
+// Only the fields BIP38 and address derivation rely on are populated.
+var (
+	// LitecoinMainNetParams describes the Litecoin main network.
+	LitecoinMainNetParams = chaincfg.Params{
+		Name:             "litecoin",
+		Net:              wire.BitcoinNet(0xdbb6c0fb),
+		Bech32HRPSegwit:  "ltc",
+		PubKeyHashAddrID: 0x30,
+		ScriptHashAddrID: 0x32,
+		PrivateKeyID:     0xb0,
+	}
+
+	// DogecoinMainNetParams describes the Dogecoin main network. Dogecoin has no segwit.
+	DogecoinMainNetParams = chaincfg.Params{
+		Name:             "dogecoin",
+		Net:              wire.BitcoinNet(0xc0c0c0c0),
+		PubKeyHashAddrID: 0x1e,
+		ScriptHashAddrID: 0x16,
+		PrivateKeyID:     0x9e,
+	}
+
+	// DashMainNetParams describes the Dash main network. Dash has no segwit.
+	DashMainNetParams = chaincfg.Params{
+		Name:             "dash",
+		Net:              wire.BitcoinNet(0xbd6b0cbf),
+		PubKeyHashAddrID: 0x4c,
+		ScriptHashAddrID: 0x10,
+		PrivateKeyID:     0xcc,
+	}
+)
+
+// NetworkRegistry holds the networks used to resolve names, detect WIF
+// networks and match BIP38 address hashes. Registration order is the order
+// in which networks are tried. It is safe for concurrent use.
+type NetworkRegistry struct {
+	mu       sync.RWMutex
+	networks []*chaincfg.Params
+	aliases  map[string]*chaincfg.Params
+}
+
+// DefaultNetworks is the registry used by the package level functions. It
+// starts with the btcd Bitcoin networks followed by the built-in altcoins.
+var DefaultNetworks = newDefaultNetworkRegistry()
+
+// NewNetworkRegistry returns an empty registry.
+func NewNetworkRegistry() *NetworkRegistry {
+	return &NetworkRegistry{aliases: make(map[string]*chaincfg.Params)}
+}
+
+func newDefaultNetworkRegistry() *NetworkRegistry {
+	r := NewNetworkRegistry()
+	builtins := []struct {
+		params  *chaincfg.Params
+		aliases []string
+	}{
+		{&chaincfg.MainNetParams, []string{"main", "bitcoin", "livenet", "prod", "production"}},
+		{&chaincfg.TestNet3Params, []string{"test", "testnet", "tn3"}},
+		{&chaincfg.RegressionNetParams, []string{"regression", "regressionnet"}},
+		{&chaincfg.SimNetParams, []string{"sim"}},
+		{&chaincfg.SigNetParams, []string{"sig"}},
+		{&LitecoinMainNetParams, []string{"ltc"}},
+		{&DogecoinMainNetParams, []string{"doge"}},
+		{&DashMainNetParams, nil},
+	}
+	for _, builtin := range builtins {
+		if err := r.Register(builtin.params, builtin.aliases...); err != nil {
+			panic(fmt.Sprintf("bip38: invalid built-in network %s: %v", builtin.params.Name, err))
+		}
+	}
+	return r
+}
+
+// Register adds a network. Its Name is always usable as an alias; aliases are
+// matched case-insensitively and must not already be taken.
+func (r *NetworkRegistry) Register(params *chaincfg.Params, aliases ...string) error {
+	if params == nil {
+		return errors.New("network parameters are required")
+	}
+
+	names := append([]string{params.Name}, aliases...)
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		alias := normalizeNetworkName(name)
+		if alias == "" {
+			return errors.New("network name is required")
+		}
+		normalized = append(normalized, alias)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.networks {
+		if existing == params {
+			return fmt.Errorf("network already registered: %s", params.Name)
+		}
+	}
+	for _, alias := range normalized {
+		if existing, ok := r.aliases[alias]; ok && existing != params {
+			return fmt.Errorf("network alias %q already used by %s", alias, existing.Name)
+		}
+	}
+
+	r.networks = append(r.networks, params)
+	for _, alias := range normalized {
+		r.aliases[alias] = params
+	}
+	return nil
+}
+
+// Lookup resolves a network name or alias.
+func (r *NetworkRegistry) Lookup(name string) (*chaincfg.Params, error) {
+	normalized := normalizeNetworkName(name)
+	if normalized == "" {
+		return nil, errors.New("network name is required")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if params, ok := r.aliases[normalized]; ok {
+		return params, nil
+	}
+	return nil, fmt.Errorf("unsupported network: %s", name)
+}
+
+// Networks returns the registered networks in registration order.
+func (r *NetworkRegistry) Networks() []*chaincfg.Params {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*chaincfg.Params{}, r.networks...)
+}
+
+// FromWIF returns the first registered network whose private key version matches the WIF.
+func (r *NetworkRegistry) FromWIF(wif *btcutil.WIF) (*chaincfg.Params, error) {
+	for _, params := range r.Networks() {
+		if wif.IsForNet(params) {
+			return params, nil
+		}
+	}
+	return nil, errors.New("unsupported WIF network")
+}
+
+// RegisterNetwork adds a network to DefaultNetworks.
+func RegisterNetwork(params *chaincfg.Params, aliases ...string) error {
+	return DefaultNetworks.Register(params, aliases...)
+}
+
+// Networks returns the networks registered in DefaultNetworks.
+func Networks() []*chaincfg.Params {
+	return DefaultNetworks.Networks()
+}
+
+// NetworkFromName resolves a user-provided network identifier to the matching chain parameters.
+func NetworkFromName(name string) (*chaincfg.Params, error) {
+	return DefaultNetworks.Lookup(name)
+}
+
+// NetworkFromWIF returns the network associated with the provided WIF.
+func NetworkFromWIF(wif *btcutil.WIF) (*chaincfg.Params, error) {
+	return DefaultNetworks.FromWIF(wif)
+}
+
+// candidateNetworks returns the networks to test, making sure an explicit
+// choice is included even when it is not registered.
+func candidateNetworks(explicit *chaincfg.Params) []*chaincfg.Params {
+	networks := DefaultNetworks.Networks()
+	if explicit == nil {
+		return networks
+	}
+	for _, params := range networks {
+		if params == explicit {
+			return networks
+		}
+	}
+	return append(networks, explicit)
+}
+
+func normalizeNetworkName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
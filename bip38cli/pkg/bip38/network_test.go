@@ -0,0 +1,251 @@
+package bip38
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestNetworkRegistryRegister(t *testing.T) {
+	registry := NewNetworkRegistry()
+	custom := &chaincfg.Params{Name: "examplecoin", PubKeyHashAddrID: 0x21, PrivateKeyID: 0xa1}
+
+	if err := registry.Register(custom, "exc", "EXAMPLE"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	for _, name := range []string{"examplecoin", "exc", "example", " Example "} {
+		params, err := registry.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", name, err)
+		}
+		if params != custom {
+			t.Fatalf("Lookup(%q) = %s, want examplecoin", name, params.Name)
+		}
+	}
+
+	if err := registry.Register(custom); err == nil {
+		t.Fatal("expected duplicate registration to fail")
+	}
+
+	other := &chaincfg.Params{Name: "othercoin", PubKeyHashAddrID: 0x22, PrivateKeyID: 0xa2}
+	if err := registry.Register(other, "exc"); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected alias conflict, got %v", err)
+	}
+	if _, err := registry.Lookup("othercoin"); err == nil {
+		t.Fatal("failed registration must not leave partial aliases")
+	}
+
+	if got := registry.Networks(); len(got) != 1 || got[0] != custom {
+		t.Fatalf("Networks() = %v, want [examplecoin]", got)
+	}
+}
+
+func TestBuiltinAltcoinNetworks(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        *chaincfg.Params
+		addressPrefix string
+	}{
+		{name: "ltc", params: &LitecoinMainNetParams, addressPrefix: "L"},
+		{name: "doge", params: &DogecoinMainNetParams, addressPrefix: "D"},
+		{name: "dash", params: &DashMainNetParams, addressPrefix: "X"},
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x33}, 32))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := NetworkFromName(tt.name)
+			if err != nil {
+				t.Fatalf("NetworkFromName: %v", err)
+			}
+			if params != tt.params {
+				t.Fatalf("NetworkFromName(%q) = %s, want %s", tt.name, params.Name, tt.params.Name)
+			}
+
+			wif, err := btcutil.NewWIF(privKey, params, true)
+			if err != nil {
+				t.Fatalf("NewWIF: %v", err)
+			}
+			detected, err := NetworkFromWIF(wif)
+			if err != nil {
+				t.Fatalf("NetworkFromWIF: %v", err)
+			}
+			if detected != params {
+				t.Fatalf("NetworkFromWIF = %s, want %s", detected.Name, params.Name)
+			}
+
+			address, err := p2pkhAddress(wif, params)
+			if err != nil {
+				t.Fatalf("p2pkhAddress: %v", err)
+			}
+			if !strings.HasPrefix(address, tt.addressPrefix) {
+				t.Fatalf("address %s does not start with %s", address, tt.addressPrefix)
+			}
+		})
+	}
+}
+
+func TestEncryptDecryptAltcoinRoundtrip(t *testing.T) {
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x44}, 32))
+	wif, err := btcutil.NewWIF(privKey, &DogecoinMainNetParams, true)
+	if err != nil {
+		t.Fatalf("NewWIF: %v", err)
+	}
+
+	passphrase := []byte("TestingOneTwoThree")
+	encrypted, err := Encrypt(EncryptOptions{WIF: wif, Passphrase: passphrase})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if encrypted.Network != &DogecoinMainNetParams {
+		t.Fatalf("encrypt network = %s, want dogecoin", encrypted.Network.Name)
+	}
+
+	decrypted, err := Decrypt(DecryptOptions{EncryptedKey: encrypted.EncryptedKey, Passphrase: passphrase})
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if decrypted.Network != &DogecoinMainNetParams {
+		t.Fatalf("decrypt network = %v, want dogecoin", decrypted.Network)
+	}
+	if decrypted.WIF.String() != wif.String() || decrypted.Address != encrypted.Address {
+		t.Fatalf("roundtrip mismatch: %s/%s vs %s/%s",
+			decrypted.WIF.String(), decrypted.Address, wif.String(), encrypted.Address)
+	}
+}
+
+func TestParseNetworkDefinitions(t *testing.T) {
+	input := `{"networks": [
+		{"name": "privnet", "aliases": ["pn"], "pubkey_hash_addr_id": "0x3c", "private_key_id": 188, "bech32_hrp": "PN"},
+		{"name": "labnet", "pubkey_hash_addr_id": 100, "private_key_id": "0xe4"}
+	]}`
+
+	defs, err := ParseNetworkDefinitions(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseNetworkDefinitions: %v", err)
+	}
+
+	registry := NewNetworkRegistry()
+	params, err := registry.RegisterDefinitions(defs)
+	if err != nil {
+		t.Fatalf("RegisterDefinitions: %v", err)
+	}
+	if len(params) != 2 {
+		t.Fatalf("registered %d networks, want 2", len(params))
+	}
+
+	privnet, err := registry.Lookup("PN")
+	if err != nil {
+		t.Fatalf("Lookup(PN): %v", err)
+	}
+	if privnet.PubKeyHashAddrID != 0x3c || privnet.PrivateKeyID != 0xbc || privnet.Bech32HRPSegwit != "pn" {
+		t.Fatalf("unexpected privnet params: %+v", privnet)
+	}
+	labnet, err := registry.Lookup("labnet")
+	if err != nil {
+		t.Fatalf("Lookup(labnet): %v", err)
+	}
+	if labnet.PubKeyHashAddrID != 100 || labnet.PrivateKeyID != 0xe4 || labnet.Bech32HRPSegwit != "" {
+		t.Fatalf("unexpected labnet params: %+v", labnet)
+	}
+}
+
+func TestParseNetworkDefinitionsRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: `{"networks": []}`},
+		{name: "unknown field", input: `{"networks": [{"name": "x", "pubkey_hash_addr_id": 1, "private_key_id": 2, "wif": 3}]}`},
+		{name: "out of range", input: `{"networks": [{"name": "x", "pubkey_hash_addr_id": 256, "private_key_id": 2}]}`},
+		{name: "bad hex", input: `{"networks": [{"name": "x", "pubkey_hash_addr_id": "0xzz", "private_key_id": 2}]}`},
+		{name: "not json", input: `networks: []`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseNetworkDefinitions(strings.NewReader(tt.input)); err == nil {
+				t.Fatal("expected parse error")
+			}
+		})
+	}
+}
+
+func TestRegisterDefinitionsIsAllOrNothing(t *testing.T) {
+	tests := []struct {
+		name string
+		defs []NetworkDefinition
+	}{
+		{name: "missing name", defs: []NetworkDefinition{
+			{Name: "good", PubKeyHashAddrID: 1, PrivateKeyID: 2},
+			{Name: " ", PubKeyHashAddrID: 3, PrivateKeyID: 4},
+		}},
+		{name: "same versions", defs: []NetworkDefinition{
+			{Name: "good", PubKeyHashAddrID: 1, PrivateKeyID: 2},
+			{Name: "bad", PubKeyHashAddrID: 5, PrivateKeyID: 5},
+		}},
+		{name: "builtin alias", defs: []NetworkDefinition{
+			{Name: "good", PubKeyHashAddrID: 1, PrivateKeyID: 2},
+			{Name: "other", Aliases: []string{"mainnet"}, PubKeyHashAddrID: 3, PrivateKeyID: 4},
+		}},
+		{name: "duplicate in file", defs: []NetworkDefinition{
+			{Name: "good", PubKeyHashAddrID: 1, PrivateKeyID: 2},
+			{Name: "Good", PubKeyHashAddrID: 3, PrivateKeyID: 4},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newDefaultNetworkRegistry()
+			before := len(registry.Networks())
+
+			if _, err := registry.RegisterDefinitions(tt.defs); err == nil {
+				t.Fatal("expected registration error")
+			}
+			if got := len(registry.Networks()); got != before {
+				t.Fatalf("registry grew from %d to %d networks after a failed load", before, got)
+			}
+			if _, err := registry.Lookup("good"); err == nil {
+				t.Fatal("valid entries must not be registered when another entry fails")
+			}
+		})
+	}
+}
+
+func TestCustomNetworkRoundtrip(t *testing.T) {
+	params, err := NetworkDefinition{Name: "privnet", PubKeyHashAddrID: 0x3c, PrivateKeyID: 0xbc}.Params()
+	if err != nil {
+		t.Fatalf("Params: %v", err)
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x55}, 32))
+	wif, err := btcutil.NewWIF(privKey, params, true)
+	if err != nil {
+		t.Fatalf("NewWIF: %v", err)
+	}
+
+	passphrase := []byte("TestingOneTwoThree")
+	encrypted, err := Encrypt(EncryptOptions{WIF: wif, Passphrase: passphrase, Network: params})
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// The network is not registered, so decryption only succeeds when it is named.
+	if _, err := Decrypt(DecryptOptions{EncryptedKey: encrypted.EncryptedKey, Passphrase: passphrase}); err == nil {
+		t.Fatal("expected decryption without the custom network to fail")
+	}
+	decrypted, err := Decrypt(DecryptOptions{EncryptedKey: encrypted.EncryptedKey, Passphrase: passphrase, Network: params})
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if decrypted.WIF.String() != wif.String() || decrypted.Address != encrypted.Address {
+		t.Fatalf("roundtrip mismatch: %s/%s vs %s/%s",
+			decrypted.WIF.String(), decrypted.Address, wif.String(), encrypted.Address)
+	}
+}
@@ -0,0 +1,122 @@
+package bip38
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// NetworkDefinition describes a custom P2PKH network, typically loaded from a
+// JSON file. Version bytes accept JSON numbers or strings such as "0x6f".
+type NetworkDefinition struct {
+	Name             string      `json:"name"`
+	Aliases          []string    `json:"aliases,omitempty"`
+	PubKeyHashAddrID VersionByte `json:"pubkey_hash_addr_id"`
+	ScriptHashAddrID VersionByte `json:"script_hash_addr_id,omitempty"`
+	PrivateKeyID     VersionByte `json:"private_key_id"`
+	Bech32HRP        string      `json:"bech32_hrp,omitempty"`
+}
+
+// networkFile is the on-disk layout read by ParseNetworkDefinitions.
+type networkFile struct {
+	Networks []NetworkDefinition `json:"networks"`
+}
+
+// VersionByte is a single version byte that unmarshals from a JSON number or
+// a decimal/hex string.
+type VersionByte byte
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *VersionByte) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = strings.TrimSpace(unquoted)
+	}
+
+	value, err := strconv.ParseUint(text, 0, 8)
+	if err != nil {
+		return fmt.Errorf("invalid version byte %s: must be 0-255 or 0x00-0xff", string(data))
+	}
+	*v = VersionByte(value)
+	return nil
+}
+
+// Params builds chain parameters from the definition.
+func (d NetworkDefinition) Params() (*chaincfg.Params, error) {
+	name := strings.TrimSpace(d.Name)
+	if name == "" {
+		return nil, errors.New("network name is required")
+	}
+	if d.PubKeyHashAddrID == d.PrivateKeyID {
+		return nil, fmt.Errorf("network %s: pubkey hash and private key versions must differ", name)
+	}
+
+	return &chaincfg.Params{
+		Name:             name,
+		Bech32HRPSegwit:  strings.ToLower(strings.TrimSpace(d.Bech32HRP)),
+		PubKeyHashAddrID: byte(d.PubKeyHashAddrID),
+		ScriptHashAddrID: byte(d.ScriptHashAddrID),
+		PrivateKeyID:     byte(d.PrivateKeyID),
+	}, nil
+}
+
+// ParseNetworkDefinitions reads a JSON document of the form
+// {"networks": [{"name": ..., "pubkey_hash_addr_id": ..., "private_key_id": ...}]}.
+func ParseNetworkDefinitions(r io.Reader) ([]NetworkDefinition, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network definitions: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var file networkFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse network definitions: %w", err)
+	}
+	if len(file.Networks) == 0 {
+		return nil, errors.New("network definitions file declares no networks")
+	}
+	return file.Networks, nil
+}
+
+// RegisterDefinitions validates every definition and registers them in order.
+// Validation happens up front so a bad entry leaves the registry untouched.
+func (r *NetworkRegistry) RegisterDefinitions(defs []NetworkDefinition) ([]*chaincfg.Params, error) {
+	params := make([]*chaincfg.Params, 0, len(defs))
+	seen := make(map[string]int)
+	for i, def := range defs {
+		p, err := def.Params()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range append([]string{p.Name}, def.Aliases...) {
+			alias := normalizeNetworkName(name)
+			if alias == "" {
+				return nil, fmt.Errorf("network %s: empty alias", p.Name)
+			}
+			if existing, lookupErr := r.Lookup(alias); lookupErr == nil {
+				return nil, fmt.Errorf("network alias %q already used by %s", alias, existing.Name)
+			}
+			if owner, ok := seen[alias]; ok && owner != i {
+				return nil, fmt.Errorf("network alias %q already used by %s", alias, defs[owner].Name)
+			}
+			seen[alias] = i
+		}
+		params = append(params, p)
+	}
+
+	for i, def := range defs {
+		if err := r.Register(params[i], def.Aliases...); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,119 @@
+package bip38
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+)
+
+// PassfactorCache remembers EC-multiply passfactors across decryptions.
+//
+// Keys minted from one intermediate code share their owner entropy, so the
+// expensive scrypt step (N=16384) yields the same passfactor for all of them.
+// With a cache only the first key of a lot pays for it; the rest cost the
+// cheap per-key scrypt (N=1024). Entries are keyed by owner entropy and a
+// keyed hash of the passphrase, so a wrong passphrase never reuses a right
+// one's work.
+//
+// The cache holds secret material: keep it for one run and call Clear once
+// no decryption is using it. A nil *PassfactorCache disables caching. It is
+// safe for concurrent use.
+type PassfactorCache struct {
+	mu      sync.Mutex
+	secret  []byte
+	entries map[passfactorKey]*passfactorEntry
+}
+
+type passfactorKey struct {
+	ownerEntropy [8]byte
+	hasLotSeq    bool
+	passphrase   [sha256.Size]byte
+}
+
+// passfactorEntry is filled once; concurrent lookups wait for the first.
+type passfactorEntry struct {
+	once  sync.Once
+	value []byte
+	err   error
+}
+
+// deriveCached derives the passfactor for a cache miss. Tests replace it to
+// count derivations.
+var deriveCached = derivePassfactor
+
+// NewPassfactorCache returns an empty cache.
+func NewPassfactorCache() *PassfactorCache {
+	return &PassfactorCache{}
+}
+
+// Len returns the number of cached passfactors.
+func (c *PassfactorCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Clear wipes every cached passfactor.
+func (c *PassfactorCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		zeroBytes(entry.value)
+		delete(c.entries, key)
+	}
+	zeroBytes(c.secret)
+	c.secret = nil
+}
+
+// passfactor returns a copy of the passfactor for the given owner entropy,
+// deriving it on first use. The caller owns and should zero the result.
+func (c *PassfactorCache) passfactor(passphrase, ownersalt, ownerEntropy []byte, hasLotSeq bool) ([]byte, error) {
+	if c == nil {
+		return derivePassfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+	}
+
+	c.mu.Lock()
+	if c.secret == nil {
+		c.secret = make([]byte, 32)
+		if _, err := rand.Read(c.secret); err != nil {
+			c.secret = nil
+			c.mu.Unlock()
+			return derivePassfactor(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+		}
+	}
+	key := passfactorKey{hasLotSeq: hasLotSeq}
+	copy(key.ownerEntropy[:], ownerEntropy)
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(passphrase)
+	copy(key.passphrase[:], mac.Sum(nil))
+
+	if c.entries == nil {
+		c.entries = make(map[passfactorKey]*passfactorEntry)
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &passfactorEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = deriveCached(passphrase, ownersalt, ownerEntropy, hasLotSeq)
+	})
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return nil, entry.err
+	}
+	return append([]byte(nil), entry.value...), nil
+}
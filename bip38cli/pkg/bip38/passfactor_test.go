@@ -0,0 +1,131 @@
+package bip38
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func mintLot(t *testing.T, passphrase []byte, lot, seq *uint32, count int) []*ECMultiplyResult {
+	t.Helper()
+	code, err := GenerateIntermediateCode(passphrase, lot, seq)
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCode: %v", err)
+	}
+	minted := make([]*ECMultiplyResult, 0, count)
+	for i := 0; i < count; i++ {
+		result, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code, Compressed: i%2 == 0})
+		if err != nil {
+			t.Fatalf("ECMultiply: %v", err)
+		}
+		minted = append(minted, result)
+	}
+	return minted
+}
+
+func TestPassfactorCacheReusesDerivation(t *testing.T) {
+	passphrase := []byte("TestingOneTwoThree")
+
+	tests := []struct {
+		name     string
+		lot, seq *uint32
+	}{
+		{name: "without lot and sequence"},
+		{name: "with lot and sequence", lot: uint32Ptr(263183), seq: uint32Ptr(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minted := mintLot(t, passphrase, tt.lot, tt.seq, 3)
+			derived := countCacheDerivations(t)
+			cache := NewPassfactorCache()
+			defer cache.Clear()
+
+			for _, key := range minted {
+				cached, err := Decrypt(DecryptOptions{EncryptedKey: key.EncryptedKey, Passphrase: passphrase, Cache: cache})
+				if err != nil {
+					t.Fatalf("Decrypt with cache: %v", err)
+				}
+				if cached.Address != key.Address || !cached.ECMultiply {
+					t.Fatalf("cached decrypt address = %s, want %s", cached.Address, key.Address)
+				}
+			}
+			if derived.Load() != 1 || cache.Len() != 1 {
+				t.Fatalf("expected one derivation for the lot, got %d (entries %d)", derived.Load(), cache.Len())
+			}
+
+			plain, err := Decrypt(DecryptOptions{EncryptedKey: minted[1].EncryptedKey, Passphrase: passphrase})
+			if err != nil {
+				t.Fatalf("Decrypt without cache: %v", err)
+			}
+			cached, err := Decrypt(DecryptOptions{EncryptedKey: minted[1].EncryptedKey, Passphrase: passphrase, Cache: cache})
+			if err != nil {
+				t.Fatalf("Decrypt with cache: %v", err)
+			}
+			if plain.WIF.String() != cached.WIF.String() {
+				t.Fatal("cached and uncached decryption disagree")
+			}
+
+			if _, err := Confirm(ConfirmOptions{ConfirmationCode: minted[2].ConfirmationCode, Passphrase: passphrase, Cache: cache}); err != nil {
+				t.Fatalf("Confirm with cache: %v", err)
+			}
+			if derived.Load() != 1 {
+				t.Fatalf("Confirm should reuse the cached passfactor, got %d derivations", derived.Load())
+			}
+		})
+	}
+}
+
+func TestPassfactorCacheSeparatesPassphrases(t *testing.T) {
+	passphrase := []byte("Satoshi")
+	minted := mintLot(t, passphrase, nil, nil, 1)
+	cache := NewPassfactorCache()
+
+	_, err := Decrypt(DecryptOptions{EncryptedKey: minted[0].EncryptedKey, Passphrase: []byte("satoshi"), Cache: cache})
+	if !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("expected incorrect passphrase, got %v", err)
+	}
+	if _, err := Decrypt(DecryptOptions{EncryptedKey: minted[0].EncryptedKey, Passphrase: passphrase, Cache: cache}); err != nil {
+		t.Fatalf("right passphrase after a wrong one: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("expected separate entries per passphrase, got %d", cache.Len())
+	}
+
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Fatalf("Clear left %d entries", cache.Len())
+	}
+	if _, err := Decrypt(DecryptOptions{EncryptedKey: minted[0].EncryptedKey, Passphrase: passphrase, Cache: cache}); err != nil {
+		t.Fatalf("decrypt after Clear: %v", err)
+	}
+}
+
+func TestPassfactorCacheConcurrentLookups(t *testing.T) {
+	passphrase := []byte("TestingOneTwoThree")
+	minted := mintLot(t, passphrase, nil, nil, 4)
+	derived := countCacheDerivations(t)
+	cache := NewPassfactorCache()
+	defer cache.Clear()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(minted))
+	for _, key := range minted {
+		wg.Add(1)
+		go func(encrypted string) {
+			defer wg.Done()
+			_, err := Decrypt(DecryptOptions{EncryptedKey: encrypted, Passphrase: passphrase, Cache: cache})
+			errs <- err
+		}(key.EncryptedKey)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Decrypt: %v", err)
+		}
+	}
+	if derived.Load() != 1 {
+		t.Fatalf("concurrent lookups derived %d passfactors, want 1", derived.Load())
+	}
+}
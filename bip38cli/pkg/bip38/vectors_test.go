@@ -6,6 +6,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 // Official BIP38 test vectors from https://github.com/bitcoin/bips/blob/master/bip-0038.mediawiki
@@ -310,3 +311,75 @@ func TestECMultiplyRoundtrip(t *testing.T) {
 		t.Fatal("expected confirmation address")
 	}
 }
+
+func TestECMultiplyConfirmNonMainnet(t *testing.T) {
+	passphrase := []byte("TestingOneTwoThree")
+	code, err := GenerateIntermediateCode(passphrase, uint32Ptr(7), uint32Ptr(3))
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCode: %v", err)
+	}
+
+	for _, params := range []*chaincfg.Params{&chaincfg.TestNet3Params, &chaincfg.SimNetParams} {
+		t.Run(params.Name, func(t *testing.T) {
+			minted, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code, Compressed: true, Network: params})
+			if err != nil {
+				t.Fatalf("ECMultiply: %v", err)
+			}
+			if minted.Network != params {
+				t.Fatalf("minted network = %s, want %s", minted.Network.Name, params.Name)
+			}
+
+			confirm, err := VerifyConfirmationCode(minted.ConfirmationCode, passphrase)
+			if err != nil {
+				t.Fatalf("VerifyConfirmationCode: %v", err)
+			}
+			if !containsNetwork(confirm.Candidates, params) {
+				t.Fatalf("confirmed candidates %v do not include %s", confirm.Candidates, params.Name)
+			}
+			if len(confirm.Candidates) == 1 && confirm.Network != params {
+				t.Fatalf("confirmed network = %v, want %s", confirm.Network, params.Name)
+			}
+			if confirm.Address != minted.Address {
+				t.Fatalf("address = %s, want %s", confirm.Address, minted.Address)
+			}
+			if !confirm.Compressed || *confirm.LotNumber != 7 || *confirm.SeqNumber != 3 {
+				t.Fatalf("unexpected confirmation metadata: %+v", confirm)
+			}
+
+			_, err = Confirm(ConfirmOptions{
+				ConfirmationCode: minted.ConfirmationCode,
+				Passphrase:       passphrase,
+				Network:          &chaincfg.MainNetParams,
+			})
+			if err == nil {
+				t.Fatal("expected mainnet-only confirmation to fail")
+			}
+		})
+	}
+}
+
+func TestECMultiplySeed(t *testing.T) {
+	code := "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvuR1hy25aTu5sX"
+	seed := []byte("twenty-four byte seedb!!")
+
+	first, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code, Seed: seed})
+	if err != nil {
+		t.Fatalf("ECMultiply: %v", err)
+	}
+	second, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code, Seed: seed})
+	if err != nil {
+		t.Fatalf("ECMultiply: %v", err)
+	}
+	if *first != *second {
+		t.Fatalf("same seed minted different keys: %+v, %+v", first, second)
+	}
+
+	decrypted, err := Decrypt(DecryptOptions{EncryptedKey: first.EncryptedKey, Passphrase: []byte("MOLON LABE")})
+	if err != nil || decrypted.Address != first.Address {
+		t.Fatalf("seeded key does not decrypt to its address: %v", err)
+	}
+
+	if _, err := ECMultiply(ECMultiplyOptions{IntermediateCode: code, Seed: seed[:23]}); err == nil {
+		t.Fatal("expected error for a short seed")
+	}
+}